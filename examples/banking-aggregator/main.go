@@ -35,9 +35,12 @@ func main() {
 	})
 
 	// Initialize Fiber app
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		ErrorHandler: middleware.FiberErrorHandler(nil),
+	})
 
 	// Global middleware
+	app.Use(middleware.RequestIDMiddleware())
 	app.Use(middleware.RecoveryMiddleware())
 	app.Use(middleware.SecurityHeadersMiddleware())
 
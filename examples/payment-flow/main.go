@@ -8,6 +8,8 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
 	"github.com/PrakarshSingh5/fintechkit/pkg/client"
+	"github.com/PrakarshSingh5/fintechkit/pkg/health"
+	"github.com/PrakarshSingh5/fintechkit/pkg/metrics"
 	"github.com/PrakarshSingh5/fintechkit/pkg/middleware"
 	"github.com/PrakarshSingh5/fintechkit/pkg/providers/stripe"
 	"github.com/PrakarshSingh5/fintechkit/pkg/reliability"
@@ -29,14 +31,11 @@ func main() {
 
 	// Initialize Fiber app
 	app := fiber.New(fiber.Config{
-		ErrorHandler: func(c *fiber.Ctx, err error) error {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": err.Error(),
-			})
-		},
+		ErrorHandler: middleware.FiberErrorHandler(nil),
 	})
 
 	// Global middleware
+	app.Use(middleware.RequestIDMiddleware())
 	app.Use(middleware.RecoveryMiddleware())
 	app.Use(middleware.RequestLoggingMiddleware())
 	app.Use(middleware.SecurityHeadersMiddleware())
@@ -54,6 +53,9 @@ func main() {
 	payments.Get("/:id", getPayment(authManager))
 	payments.Post("/:id/refund", refundPayment(authManager))
 
+	// Prometheus metrics
+	app.Get("/metrics", metrics.Handler())
+
 	// Health check
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
@@ -61,6 +63,28 @@ func main() {
 		})
 	})
 
+	// Liveness and readiness across providers created through the factory
+	factory := client.NewFactory(authManager)
+	factory.Register("stripe", func(cfg *client.ProviderConfig) (client.Provider, error) {
+		return stripe.NewClient(&stripe.Config{APIKey: cfg.Credentials.APIKey})
+	})
+	if _, err := factory.Create(ctx, &client.ProviderConfig{
+		Name:           "stripe",
+		CircuitBreaker: reliability.DefaultCircuitBreakerConfig(),
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	checker := health.NewChecker(&health.CheckerConfig{
+		Factory:  factory,
+		Critical: []string{"stripe"},
+	})
+	checker.Start(ctx)
+	defer checker.Stop()
+
+	app.Get("/healthz", checker.Liveness())
+	app.Get("/readyz", checker.Readiness())
+
 	// Start server
 	log.Println("Starting payment flow server on :3000")
 	log.Fatal(app.Listen(":3000"))
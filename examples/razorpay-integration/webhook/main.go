@@ -1,11 +1,11 @@
 package main
 
 import (
-	"context"
 	"log"
 
-	"github.com/gofiber/fiber/v2"
+	"github.com/PrakarshSingh5/fintechkit/pkg/middleware"
 	"github.com/PrakarshSingh5/fintechkit/pkg/webhook"
+	"github.com/gofiber/fiber/v2"
 )
 
 func main() {
@@ -66,28 +66,17 @@ func main() {
 
 	// Step 5: Create Fiber web server
 	app := fiber.New(fiber.Config{
-		AppName: "Razorpay Integration with FinTechKit",
+		AppName:      "Razorpay Integration with FinTechKit",
+		ErrorHandler: middleware.FiberErrorHandler(nil),
 	})
 
-	// Step 6: Webhook endpoint
-	app.Post("/webhooks/razorpay", func(c *fiber.Ctx) error {
-		// Get webhook payload and signature
-		payload := c.Body()
-		signature := c.Get("X-Razorpay-Signature")
-
-		// Process the webhook event
-		err := receiver.ProcessEvent(context.Background(), "razorpay", payload, signature)
-		if err != nil {
-			log.Printf("Webhook processing error: %v", err)
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Invalid webhook signature or payload",
-			})
-		}
-
-		return c.JSON(fiber.Map{
-			"status": "received",
-		})
+	// Step 6: Webhook endpoint (verifies, deduplicates and routes to the handlers above)
+	ingress := webhook.NewIngress(&webhook.IngressConfig{
+		Receiver: receiver,
+		Router:   router,
+		Tracker:  webhook.NewIdempotencyTracker(),
 	})
+	app.Post("/webhooks/razorpay", middleware.WebhookHandler(ingress, "razorpay"))
 
 	// Health check endpoint
 	app.Get("/health", func(c *fiber.Ctx) error {
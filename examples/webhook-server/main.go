@@ -1,12 +1,12 @@
 package main
 
 import (
-	"context"
 	"log"
 
-	"github.com/gofiber/fiber/v2"
+	"github.com/PrakarshSingh5/fintechkit/pkg/metrics"
 	"github.com/PrakarshSingh5/fintechkit/pkg/middleware"
 	"github.com/PrakarshSingh5/fintechkit/pkg/webhook"
+	"github.com/gofiber/fiber/v2"
 )
 
 func main() {
@@ -46,14 +46,25 @@ func main() {
 	))
 
 	// Initialize Fiber app
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		ErrorHandler: middleware.FiberErrorHandler(nil),
+	})
 
 	// Global middleware
+	app.Use(middleware.RequestIDMiddleware())
 	app.Use(middleware.RecoveryMiddleware())
 	app.Use(middleware.RequestLoggingMiddleware())
 
-	// Webhook endpoint
-	app.Post("/webhooks/stripe", handleStripeWebhook(receiver, router))
+	// Webhook endpoint: verify, decode, deduplicate and route in one handler
+	ingress := webhook.NewIngress(&webhook.IngressConfig{
+		Receiver: receiver,
+		Router:   router,
+		Tracker:  webhook.NewIdempotencyTracker(),
+	})
+	app.Post("/webhooks/stripe", middleware.WebhookHandler(ingress, "stripe"))
+
+	// Prometheus metrics
+	app.Get("/metrics", metrics.Handler())
 
 	// Health check
 	app.Get("/health", func(c *fiber.Ctx) error {
@@ -66,26 +77,3 @@ func main() {
 	log.Println("Starting webhook server on :3001")
 	log.Fatal(app.Listen(":3001"))
 }
-
-func handleStripeWebhook(receiver *webhook.Receiver, router *webhook.Router) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		payload := c.Body()
-		signature := c.Get("Stripe-Signature")
-
-		// Process webhook event
-		err := receiver.ProcessEvent(context.Background(), "stripe", payload, signature)
-		if err != nil {
-			log.Printf("Webhook processing error: %v", err)
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Webhook processing failed",
-			})
-		}
-
-		// Route event to handlers (receiver already validated)
-		// In production, you might want to handle this asynchronously
-
-		return c.JSON(fiber.Map{
-			"status": "received",
-		})
-	}
-}
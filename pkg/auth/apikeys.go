@@ -0,0 +1,290 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidAPIKey is returned for keys that are malformed, unknown or do
+	// not match. Callers should not tell clients which of these it was.
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrAPIKeyRevoked is returned for keys that have been revoked
+	ErrAPIKeyRevoked = errors.New("API key revoked")
+	// ErrAPIKeyExpired is returned for keys past their expiry
+	ErrAPIKeyExpired = errors.New("API key expired")
+	// ErrAPIKeyNotFound is returned by an APIKeyStore for unknown key IDs
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// apiKeyIDLength is the length of the hex key ID embedded in every key
+const apiKeyIDLength = 16
+
+// APIKey is the stored form of an issued key. Only a salted hash of the
+// secret is kept; the full key is shown once, when it is issued.
+type APIKey struct {
+	ID         string    `json:"id"`
+	Prefix     string    `json:"prefix"` // Non-secret start of the key, safe to display
+	Name       string    `json:"name"`
+	TenantID   string    `json:"tenant_id,omitempty"`
+	UserID     string    `json:"user_id,omitempty"`
+	Scopes     []string  `json:"scopes,omitempty"`
+	Roles      []string  `json:"roles,omitempty"`
+	Salt       []byte    `json:"salt"`
+	Hash       []byte    `json:"hash"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at,omitzero"`
+	RevokedAt  time.Time `json:"revoked_at,omitzero"`
+	LastUsedAt time.Time `json:"last_used_at,omitzero"`
+}
+
+// APIKeyStore persists issued API keys by ID
+type APIKeyStore interface {
+	// Save creates or replaces a key
+	Save(ctx context.Context, key *APIKey) error
+	// Get returns a key by ID or ErrAPIKeyNotFound
+	Get(ctx context.Context, id string) (*APIKey, error)
+	// List returns the keys owned by a tenant
+	List(ctx context.Context, tenantID string) ([]*APIKey, error)
+	// MarkUsed records when a key was last used
+	MarkUsed(ctx context.Context, id string, at time.Time) error
+}
+
+// InMemoryAPIKeyStore keeps API keys in memory (not for production)
+type InMemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*APIKey
+}
+
+// NewInMemoryAPIKeyStore creates a new in-memory API key store
+func NewInMemoryAPIKeyStore() *InMemoryAPIKeyStore {
+	return &InMemoryAPIKeyStore{keys: make(map[string]*APIKey)}
+}
+
+// Save stores a copy of the key
+func (s *InMemoryAPIKeyStore) Save(ctx context.Context, key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *key
+	s.keys[key.ID] = &copied
+	return nil
+}
+
+// Get returns a copy of the key with the given ID
+func (s *InMemoryAPIKeyStore) Get(ctx context.Context, id string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	copied := *key
+	return &copied, nil
+}
+
+// List returns the keys owned by a tenant, oldest first
+func (s *InMemoryAPIKeyStore) List(ctx context.Context, tenantID string) ([]*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []*APIKey
+	for _, key := range s.keys {
+		if key.TenantID == tenantID {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// MarkUsed updates the key's last-used time
+func (s *InMemoryAPIKeyStore) MarkUsed(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	key.LastUsedAt = at
+	return nil
+}
+
+// APIKeyConfig configures API key issuance
+type APIKeyConfig struct {
+	Prefix string // Identifies the issuer in every key, e.g. "fk_live"
+
+	// LastUsedInterval limits how often last-used times are written, so
+	// busy keys do not cause a store write per request
+	LastUsedInterval time.Duration
+}
+
+// DefaultAPIKeyConfig returns sensible defaults
+func DefaultAPIKeyConfig() *APIKeyConfig {
+	return &APIKeyConfig{
+		Prefix:           "fk",
+		LastUsedInterval: time.Minute,
+	}
+}
+
+// IssueAPIKeyRequest describes a key to issue
+type IssueAPIKeyRequest struct {
+	Name   string
+	Scopes []string
+	Roles  []string
+	TTL    time.Duration // Zero for keys that do not expire
+}
+
+// APIKeyService issues and verifies API keys for this service's own API.
+// Keys look like "fk_<id>_<secret>": the ID locates the stored record and
+// the secret is checked against its salted hash in constant time.
+type APIKeyService struct {
+	store  APIKeyStore
+	config *APIKeyConfig
+}
+
+// NewAPIKeyService creates an API key service
+func NewAPIKeyService(store APIKeyStore, config *APIKeyConfig) *APIKeyService {
+	if config == nil {
+		config = DefaultAPIKeyConfig()
+	}
+	return &APIKeyService{store: store, config: config}
+}
+
+// Issue creates a key owned by the tenant and user carried by ctx. The
+// returned plaintext key cannot be recovered later.
+func (s *APIKeyService) Issue(ctx context.Context, req *IssueAPIKeyRequest) (string, *APIKey, error) {
+	idBytes := make([]byte, apiKeyIDLength/2)
+	salt := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(salt); err != nil {
+		return "", nil, err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	id := hex.EncodeToString(idBytes)
+	key := &APIKey{
+		ID:        id,
+		Prefix:    s.config.Prefix + "_" + id,
+		Name:      req.Name,
+		TenantID:  TenantFromContext(ctx),
+		UserID:    UserFromContext(ctx),
+		Scopes:    slices.Clone(req.Scopes),
+		Roles:     slices.Clone(req.Roles),
+		Salt:      salt,
+		Hash:      hashAPIKeySecret(salt, secret),
+		CreatedAt: now,
+	}
+	if req.TTL > 0 {
+		key.ExpiresAt = now.Add(req.TTL)
+	}
+
+	if err := s.store.Save(ctx, key); err != nil {
+		return "", nil, fmt.Errorf("failed to store API key: %w", err)
+	}
+	return key.Prefix + "_" + secret, key, nil
+}
+
+// Verify checks a presented key and returns the principal it authenticates
+func (s *APIKeyService) Verify(ctx context.Context, presented string) (*Principal, error) {
+	id, secret, ok := s.parse(presented)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.store.Get(ctx, id)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API key: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare(hashAPIKeySecret(key.Salt, secret), key.Hash) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if !key.RevokedAt.IsZero() {
+		return nil, ErrAPIKeyRevoked
+	}
+	if !key.ExpiresAt.IsZero() && now.After(key.ExpiresAt) {
+		return nil, ErrAPIKeyExpired
+	}
+
+	if now.Sub(key.LastUsedAt) >= s.config.LastUsedInterval {
+		// Usage tracking must not fail the request
+		_ = s.store.MarkUsed(ctx, key.ID, now)
+	}
+
+	return &Principal{
+		ID:       key.ID,
+		Method:   AuthMethodAPIKey,
+		TenantID: key.TenantID,
+		UserID:   key.UserID,
+		Scopes:   slices.Clone(key.Scopes),
+		Roles:    slices.Clone(key.Roles),
+	}, nil
+}
+
+// Revoke permanently disables a key owned by ctx's tenant
+func (s *APIKeyService) Revoke(ctx context.Context, id string) error {
+	key, err := s.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if key.TenantID != TenantFromContext(ctx) {
+		return ErrAPIKeyNotFound
+	}
+	if !key.RevokedAt.IsZero() {
+		return nil
+	}
+
+	key.RevokedAt = time.Now()
+	return s.store.Save(ctx, key)
+}
+
+// List returns the keys owned by ctx's tenant
+func (s *APIKeyService) List(ctx context.Context) ([]*APIKey, error) {
+	return s.store.List(ctx, TenantFromContext(ctx))
+}
+
+// parse splits a presented key into its ID and secret
+func (s *APIKeyService) parse(presented string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(presented, s.config.Prefix+"_")
+	if !ok || len(rest) < apiKeyIDLength+2 || rest[apiKeyIDLength] != '_' {
+		return "", "", false
+	}
+	return rest[:apiKeyIDLength], rest[apiKeyIDLength+1:], true
+}
+
+// hashAPIKeySecret hashes a key secret with its salt. The secrets are 256-bit
+// random values, so a single SHA-256 is enough; a slow password hash would
+// only add latency to every request.
+func hashAPIKeySecret(salt []byte, secret string) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(secret))
+	return h.Sum(nil)
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingAPIKeyStore counts MarkUsed writes
+type countingAPIKeyStore struct {
+	*InMemoryAPIKeyStore
+	marks atomic.Int32
+}
+
+func (s *countingAPIKeyStore) MarkUsed(ctx context.Context, id string, at time.Time) error {
+	s.marks.Add(1)
+	return s.InMemoryAPIKeyStore.MarkUsed(ctx, id, at)
+}
+
+func TestAPIKeyIssueStoresOnlyHash(t *testing.T) {
+	ctx := WithUser(WithTenant(context.Background(), "acme"), "user_1")
+	store := NewInMemoryAPIKeyStore()
+	service := NewAPIKeyService(store, nil)
+
+	plaintext, key, err := service.Issue(ctx, &IssueAPIKeyRequest{Name: "ci", Scopes: []string{"payments:read"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(plaintext, key.Prefix+"_") || !strings.HasPrefix(key.Prefix, "fk_") {
+		t.Fatalf("got key %q with prefix %q, want fk_<id>_<secret>", plaintext, key.Prefix)
+	}
+	secret := strings.TrimPrefix(plaintext, key.Prefix+"_")
+
+	stored, err := store.Get(ctx, key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(secret)) {
+		t.Fatal("stored key contains the secret")
+	}
+	if !bytes.Equal(stored.Hash, hashAPIKeySecret(stored.Salt, secret)) {
+		t.Fatal("stored hash is not the salted hash of the secret")
+	}
+
+	principal, err := service.Verify(context.Background(), plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.ID != key.ID || principal.TenantID != "acme" || principal.UserID != "user_1" || !principal.HasScope("payments:read") {
+		t.Fatalf("got principal %+v, want the key's owner and scopes", principal)
+	}
+	if principal.Method != AuthMethodAPIKey {
+		t.Fatalf("got method %s, want %s", principal.Method, AuthMethodAPIKey)
+	}
+}
+
+func TestAPIKeyHashIsSalted(t *testing.T) {
+	secret := "same-secret"
+	a := hashAPIKeySecret([]byte("salt-a"), secret)
+	b := hashAPIKeySecret([]byte("salt-b"), secret)
+	if bytes.Equal(a, b) {
+		t.Fatal("the same secret hashed identically under different salts")
+	}
+	if !bytes.Equal(a, hashAPIKeySecret([]byte("salt-a"), secret)) {
+		t.Fatal("hashing is not deterministic")
+	}
+}
+
+func TestAPIKeyVerifyRejects(t *testing.T) {
+	ctx := WithTenant(context.Background(), "acme")
+	service := NewAPIKeyService(NewInMemoryAPIKeyStore(), nil)
+	issue := func(req *IssueAPIKeyRequest) (string, *APIKey) {
+		t.Helper()
+		plaintext, key, err := service.Issue(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return plaintext, key
+	}
+
+	valid, _ := issue(&IssueAPIKeyRequest{Name: "valid"})
+	revoked, revokedKey := issue(&IssueAPIKeyRequest{Name: "revoked"})
+	if err := service.Revoke(ctx, revokedKey.ID); err != nil {
+		t.Fatal(err)
+	}
+	expired, _ := issue(&IssueAPIKeyRequest{Name: "expired", TTL: time.Nanosecond})
+	time.Sleep(time.Millisecond)
+
+	// flip changes the last character of the secret
+	flip := func(key string) string {
+		last := key[len(key)-1]
+		if last == 'A' {
+			return key[:len(key)-1] + "B"
+		}
+		return key[:len(key)-1] + "A"
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr error
+	}{
+		{"wrong secret", flip(valid), ErrInvalidAPIKey},
+		{"truncated secret", valid[:len(valid)-1], ErrInvalidAPIKey},
+		{"unknown ID", "fk_0123456789abcdef_" + strings.Repeat("A", 43), ErrInvalidAPIKey},
+		{"other prefix", "sk" + strings.TrimPrefix(valid, "fk"), ErrInvalidAPIKey},
+		{"missing separator", strings.Replace(valid, "_", "", 2), ErrInvalidAPIKey},
+		{"empty", "", ErrInvalidAPIKey},
+		{"revoked", revoked, ErrAPIKeyRevoked},
+		{"expired", expired, ErrAPIKeyExpired},
+		// The secret is checked first so key status is not revealed without it
+		{"revoked with wrong secret", flip(revoked), ErrInvalidAPIKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.Verify(context.Background(), tt.key); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAPIKeyRevokeIsTenantScoped(t *testing.T) {
+	acme := WithTenant(context.Background(), "acme")
+	service := NewAPIKeyService(NewInMemoryAPIKeyStore(), nil)
+	plaintext, key, err := service.Issue(acme, &IssueAPIKeyRequest{Name: "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.Revoke(WithTenant(context.Background(), "globex"), key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Fatalf("got %v revoking another tenant's key, want ErrAPIKeyNotFound", err)
+	}
+	if _, err := service.Verify(context.Background(), plaintext); err != nil {
+		t.Fatalf("key stopped working after another tenant's revoke: %v", err)
+	}
+
+	keys, err := service.List(WithTenant(context.Background(), "globex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("got %d keys listed for another tenant, want 0", len(keys))
+	}
+}
+
+func TestAPIKeyVerifyThrottlesLastUsed(t *testing.T) {
+	store := &countingAPIKeyStore{InMemoryAPIKeyStore: NewInMemoryAPIKeyStore()}
+	service := NewAPIKeyService(store, &APIKeyConfig{Prefix: "fk_test", LastUsedInterval: time.Hour})
+	plaintext, key, err := service.Issue(WithTenant(context.Background(), "acme"), &IssueAPIKeyRequest{Name: "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(plaintext, "fk_test_") {
+		t.Fatalf("got key %q, want the configured prefix", plaintext)
+	}
+
+	for range 3 {
+		if _, err := service.Verify(context.Background(), plaintext); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := store.marks.Load(); got != 1 {
+		t.Fatalf("got %d last-used writes, want 1", got)
+	}
+	stored, err := store.Get(context.Background(), key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LastUsedAt.IsZero() {
+		t.Fatal("last-used time was not recorded")
+	}
+}
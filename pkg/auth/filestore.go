@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// credentialFileVersion is the on-disk format version of EncryptedFileStore
+const credentialFileVersion = 1
+
+type credentialFile struct {
+	Version     int                      `json:"version"`
+	Credentials map[string]*SealedSecret `json:"credentials"`
+}
+
+// EncryptedFileStore is a CredentialStore that persists credentials to a
+// file. Each record is encrypted with its own AES-GCM data key, wrapped by a
+// master key from the KeyProvider; only ciphertext is ever written to disk.
+type EncryptedFileStore struct {
+	path     string
+	envelope *Envelope
+	mu       sync.RWMutex
+	records  map[string]*SealedSecret
+}
+
+// NewEncryptedFileStore opens (or creates) an encrypted credential file
+func NewEncryptedFileStore(path string, keys KeyProvider) (*EncryptedFileStore, error) {
+	s := &EncryptedFileStore{
+		path:     path,
+		envelope: NewEnvelope(keys),
+		records:  make(map[string]*SealedSecret),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credential file: %w", err)
+	}
+	if len(data) == 0 {
+		return s, nil
+	}
+
+	var file credentialFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse credential file: %w", err)
+	}
+	if file.Version != credentialFileVersion {
+		return nil, fmt.Errorf("unsupported credential file version %d", file.Version)
+	}
+	if file.Credentials != nil {
+		s.records = file.Credentials
+	}
+
+	return s, nil
+}
+
+// Get decrypts and returns credentials for a provider
+func (s *EncryptedFileStore) Get(ctx context.Context, key string) (*Credentials, error) {
+	s.mu.RLock()
+	sealed, ok := s.records[key]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrCredentialsNotFound
+	}
+	return openCredentials(ctx, s.envelope, key, sealed)
+}
+
+// Set encrypts credentials for a provider and flushes to disk
+func (s *EncryptedFileStore) Set(ctx context.Context, key string, creds *Credentials) error {
+	sealed, err := sealCredentials(ctx, s.envelope, key, creds)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.records[key]
+	s.records[key] = sealed
+	if err := s.flush(); err != nil {
+		if existed {
+			s.records[key] = previous
+		} else {
+			delete(s.records, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes credentials for a provider and flushes to disk
+func (s *EncryptedFileStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.records[key]
+	if !existed {
+		return nil
+	}
+
+	delete(s.records, key)
+	if err := s.flush(); err != nil {
+		s.records[key] = previous
+		return err
+	}
+	return nil
+}
+
+// RotateMasterKey re-wraps every data key with the KeyProvider's current
+// master key and returns how many records changed. Call it after rotating
+// the master key; the old key can be retired once it returns.
+func (s *EncryptedFileStore) RotateMasterKey(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rewrapped := make(map[string]*SealedSecret, len(s.records))
+	for key, sealed := range s.records {
+		copied := *sealed
+		changed, err := s.envelope.Rewrap(ctx, &copied)
+		if err != nil {
+			return 0, fmt.Errorf("failed to re-wrap credentials for %s: %w", key, err)
+		}
+		if changed {
+			rewrapped[key] = &copied
+		}
+	}
+	if len(rewrapped) == 0 {
+		return 0, nil
+	}
+
+	previous := s.records
+	s.records = make(map[string]*SealedSecret, len(previous))
+	for key, sealed := range previous {
+		s.records[key] = sealed
+	}
+	for key, sealed := range rewrapped {
+		s.records[key] = sealed
+	}
+
+	if err := s.flush(); err != nil {
+		s.records = previous
+		return 0, err
+	}
+	return len(rewrapped), nil
+}
+
+// flush writes the sealed records to a temp file and renames it into place.
+// The temp file is created with 0600 permissions.
+func (s *EncryptedFileStore) flush() error {
+	data, err := json.Marshal(credentialFile{
+		Version:     credentialFileVersion,
+		Credentials: s.records,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode credential file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write credential file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write credential file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync credential file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write credential file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// credentialAAD binds a sealed record to its storage key
+func credentialAAD(key string) []byte {
+	return []byte("fintechkit/credentials:" + key)
+}
+
+// sealCredentials encrypts credentials for storage under key
+func sealCredentials(ctx context.Context, envelope *Envelope, key string, creds *Credentials) (*SealedSecret, error) {
+	plaintext, err := json.Marshal(creds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode credentials: %w", err)
+	}
+	defer clear(plaintext)
+
+	sealed, err := envelope.Seal(ctx, plaintext, credentialAAD(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+	return sealed, nil
+}
+
+// openCredentials decrypts credentials stored under key
+func openCredentials(ctx context.Context, envelope *Envelope, key string, sealed *SealedSecret) (*Credentials, error) {
+	plaintext, err := envelope.Open(ctx, sealed, credentialAAD(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
+	}
+	defer clear(plaintext)
+
+	var creds Credentials
+	if err := json.Unmarshal(plaintext, &creds); err != nil {
+		return nil, fmt.Errorf("failed to decode credentials: %w", err)
+	}
+	return &creds, nil
+}
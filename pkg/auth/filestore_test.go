@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEncryptedFileStoreReload(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	keys := newTestKeyring(t)
+
+	store, err := NewEncryptedFileStore(path, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := &Credentials{
+		Type:         CredentialTypeOAuth,
+		AccessToken:  "at_plaintext_marker",
+		RefreshToken: "rt_plaintext_marker",
+		ExpiresAt:    time.Now().Add(time.Hour).Truncate(time.Second),
+	}
+	for _, key := range []string{"acme/bank", "globex/bank"} {
+		if err := store.Set(ctx, key, creds); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Delete(ctx, "globex/bank"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("plaintext_marker")) {
+		t.Fatal("credential file contains plaintext tokens")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("got file mode %o, want 600", perm)
+	}
+
+	reopened, err := NewEncryptedFileStore(path, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.Get(ctx, "acme/bank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccessToken != creds.AccessToken || got.RefreshToken != creds.RefreshToken || !got.ExpiresAt.Equal(creds.ExpiresAt) {
+		t.Fatalf("got %+v after reload, want %+v", got, creds)
+	}
+	if _, err := reopened.Get(ctx, "globex/bank"); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Fatalf("got %v for deleted credentials, want ErrCredentialsNotFound", err)
+	}
+
+	// Without the master key the file is unreadable
+	locked, err := NewEncryptedFileStore(path, newTestKeyring(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := locked.Get(ctx, "acme/bank"); err == nil {
+		t.Fatal("decrypted credentials with another master key")
+	}
+}
+
+func TestEncryptedFileStoreBindsRecordsToKeys(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewEncryptedFileStore(filepath.Join(t.TempDir(), "credentials.json"), newTestKeyring(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set(ctx, "acme/bank", &Credentials{AccessToken: "at_acme"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A record copied to another tenant's key must not decrypt there
+	store.records["globex/bank"] = store.records["acme/bank"]
+	if _, err := store.Get(ctx, "globex/bank"); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("got %v, want ErrDecryptionFailed", err)
+	}
+}
+
+func TestEncryptedFileStoreRotateMasterKey(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	keys := newTestKeyring(t)
+	oldKeyID, err := keys.CurrentKeyID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewEncryptedFileStore(path, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"acme/bank", "globex/bank", "initech/bank"} {
+		if err := store.Set(ctx, key, &Credentials{AccessToken: "at_" + key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := store.RotateMasterKey(ctx); err != nil || n != 0 {
+		t.Fatalf("rotation without a new key: got %d, %v, want 0", n, err)
+	}
+
+	if _, err := keys.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	n, err := store.RotateMasterKey(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("rewrapped %d records, want 3", n)
+	}
+
+	// The old key can be retired and the rewrapped file still reads back
+	if err := keys.Remove(oldKeyID); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewEncryptedFileStore(path, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.Get(ctx, "globex/bank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccessToken != "at_globex/bank" {
+		t.Fatalf("got %s, want at_globex/bank", got.AccessToken)
+	}
+}
+
+func TestEncryptedFileStoreRejectsUnknownVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(path, []byte(`{"version": 99, "credentials": {}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEncryptedFileStore(path, newTestKeyring(t)); err == nil {
+		t.Fatal("opened a credential file with an unknown version")
+	}
+}
@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+var (
+	// ErrInvalidState is returned when a callback's state is unknown, expired or already used
+	ErrInvalidState = errors.New("invalid or expired OAuth state")
+	// ErrNonceMismatch is returned when the ID token nonce does not match the one sent
+	ErrNonceMismatch = errors.New("ID token nonce mismatch")
+	// ErrIDTokenUnverified is returned when an ID token arrives but no validator is set
+	ErrIDTokenUnverified = errors.New("ID token received but no ID token validator is set")
+)
+
+// AuthorizationState is what we remember between redirecting the user to the
+// authorization server and receiving the callback
+type AuthorizationState struct {
+	State      string
+	Nonce      string
+	PKCE       *PKCEParams
+	ProviderID string
+	TenantID   string // Scope the credentials are stored under
+	UserID     string
+	Metadata   map[string]string // Copied into the resulting credentials
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
+
+// StateStore holds pending authorization states
+type StateStore interface {
+	Save(ctx context.Context, state *AuthorizationState) error
+	// Consume returns and deletes a state so each callback can only be used once
+	Consume(ctx context.Context, state string) (*AuthorizationState, error)
+}
+
+// InMemoryStateStore is an in-memory StateStore (single instance only)
+type InMemoryStateStore struct {
+	mu     sync.Mutex
+	states map[string]*AuthorizationState
+}
+
+// NewInMemoryStateStore creates a new in-memory state store
+func NewInMemoryStateStore() *InMemoryStateStore {
+	return &InMemoryStateStore{
+		states: make(map[string]*AuthorizationState),
+	}
+}
+
+// Save stores a pending state and drops any expired ones
+func (s *InMemoryStateStore) Save(ctx context.Context, state *AuthorizationState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, pending := range s.states {
+		if now.After(pending.ExpiresAt) {
+			delete(s.states, key)
+		}
+	}
+
+	s.states[state.State] = state
+	return nil
+}
+
+// Consume returns and removes a pending state
+func (s *InMemoryStateStore) Consume(ctx context.Context, state string) (*AuthorizationState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending, ok := s.states[state]
+	if !ok {
+		return nil, ErrInvalidState
+	}
+	delete(s.states, state)
+
+	if time.Now().After(pending.ExpiresAt) {
+		return nil, ErrInvalidState
+	}
+	return pending, nil
+}
+
+// AuthorizationFlow runs the authorization-code flow end to end: it issues
+// state, nonce and PKCE values, validates the callback, exchanges the code
+// and stores the resulting credentials in the Manager
+type AuthorizationFlow struct {
+	oauth       *OAuthManager
+	states      StateStore
+	credManager *Manager
+	providerID  string
+	stateTTL    time.Duration
+	idTokens    TokenValidator
+}
+
+// NewAuthorizationFlow creates an authorization flow for a provider
+func NewAuthorizationFlow(oauth *OAuthManager, states StateStore, credManager *Manager, providerID string) *AuthorizationFlow {
+	if states == nil {
+		states = NewInMemoryStateStore()
+	}
+
+	return &AuthorizationFlow{
+		oauth:       oauth,
+		states:      states,
+		credManager: credManager,
+		providerID:  providerID,
+		stateTTL:    10 * time.Minute,
+	}
+}
+
+// SetStateTTL sets how long a user has to complete authorization
+func (f *AuthorizationFlow) SetStateTTL(ttl time.Duration) {
+	f.stateTTL = ttl
+}
+
+// SetIDTokenValidator sets how ID tokens from the token endpoint are verified,
+// usually NewIDTokenValidator for the provider. Without one, a callback that
+// returns an ID token fails with ErrIDTokenUnverified.
+func (f *AuthorizationFlow) SetIDTokenValidator(validator TokenValidator) {
+	f.idTokens = validator
+}
+
+// Begin creates and stores a new authorization state and returns the URL to
+// redirect the user to. Metadata is attached to the resulting credentials,
+// which are stored under the tenant and user carried by ctx.
+func (f *AuthorizationFlow) Begin(ctx context.Context, metadata map[string]string) (string, error) {
+	state, err := GenerateState()
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := GenerateNonce()
+	if err != nil {
+		return "", err
+	}
+
+	var pkce *PKCEParams
+	if f.oauth.config.UsePKCE {
+		pkce, err = GeneratePKCE()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	now := time.Now()
+	pending := &AuthorizationState{
+		State:      state,
+		Nonce:      nonce,
+		PKCE:       pkce,
+		ProviderID: f.providerID,
+		TenantID:   TenantFromContext(ctx),
+		UserID:     UserFromContext(ctx),
+		Metadata:   metadata,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(f.stateTTL),
+	}
+	if err := f.states.Save(ctx, pending); err != nil {
+		return "", fmt.Errorf("failed to save authorization state: %w", err)
+	}
+
+	return f.oauth.GetAuthorizationURL(state, pkce, oauth2.SetAuthURLParam("nonce", nonce)), nil
+}
+
+// Complete validates the callback state, exchanges the code and stores the credentials
+func (f *AuthorizationFlow) Complete(ctx context.Context, state, code string) (*Credentials, error) {
+	if state == "" || code == "" {
+		return nil, errors.New("state and code are required")
+	}
+
+	pending, err := f.states.Consume(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	if pending.ProviderID != f.providerID {
+		return nil, ErrInvalidState
+	}
+
+	creds, err := f.oauth.ExchangeCode(ctx, code, pending.PKCE)
+	if err != nil {
+		return nil, err
+	}
+
+	if idToken := creds.Metadata["id_token"]; idToken != "" {
+		if err := f.checkIDToken(ctx, idToken, pending.Nonce); err != nil {
+			return nil, err
+		}
+	}
+
+	for k, v := range pending.Metadata {
+		creds.Metadata[k] = v
+	}
+
+	// The callback is a browser redirect, so take the scope from when the flow began
+	key := CredentialKey{TenantID: pending.TenantID, UserID: pending.UserID, ProviderID: f.providerID}
+	if err := f.credManager.SetCredentials(key.Context(ctx), f.providerID, creds); err != nil {
+		return nil, fmt.Errorf("failed to store credentials: %w", err)
+	}
+
+	return creds, nil
+}
+
+// checkIDToken verifies the ID token's signature and registered claims, then
+// compares its nonce claim with the expected value
+func (f *AuthorizationFlow) checkIDToken(ctx context.Context, idToken, expected string) error {
+	if f.idTokens == nil {
+		return ErrIDTokenUnverified
+	}
+
+	principal, err := f.idTokens.ValidateToken(ctx, idToken)
+	if err != nil {
+		return fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	nonce, _ := principal.Claims["nonce"].(string)
+	if nonce != expected {
+		return ErrNonceMismatch
+	}
+	return nil
+}
+
+// CallbackHandler returns a net/http handler for the redirect URI. onSuccess
+// and onError let the caller render a page or redirect; when nil a JSON
+// response is written.
+func (f *AuthorizationFlow) CallbackHandler(
+	onSuccess func(w http.ResponseWriter, r *http.Request, creds *Credentials),
+	onError func(w http.ResponseWriter, r *http.Request, err error),
+) http.Handler {
+	if onSuccess == nil {
+		onSuccess = func(w http.ResponseWriter, r *http.Request, creds *Credentials) {
+			writeJSON(w, http.StatusOK, map[string]string{"status": "authorized"})
+		}
+	}
+	if onError == nil {
+		onError = func(w http.ResponseWriter, r *http.Request, err error) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "authorization failed"})
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		// The authorization server reports denials and errors via the error parameter
+		if errCode := query.Get("error"); errCode != "" {
+			// Still consume the state so it cannot be replayed
+			_, _ = f.states.Consume(r.Context(), query.Get("state"))
+			onError(w, r, fmt.Errorf("authorization denied: %s %s", errCode, query.Get("error_description")))
+			return
+		}
+
+		creds, err := f.Complete(r.Context(), query.Get("state"), query.Get("code"))
+		if err != nil {
+			onError(w, r, err)
+			return
+		}
+
+		onSuccess(w, r, creds)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
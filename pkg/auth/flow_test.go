@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testProvider is an authorization server whose token endpoint checks the
+// PKCE verifier against the challenge from the authorization URL and
+// returns an ID token signed by key
+type testProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *ecdsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string
+	nonce     string         // Nonce to put in the ID token
+	claims    map[string]any // Overrides for the ID token claims
+	signer    crypto.Signer  // Signs the ID token; defaults to key
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &testProvider{t: t, key: key}
+	p.server = httptest.NewServer(http.HandlerFunc(p.token))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *testProvider) token(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if p.challenge == "" || base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "invalid_grant"}`))
+		return
+	}
+
+	claims := map[string]any{
+		"iss":   p.server.URL,
+		"aud":   "client_1",
+		"sub":   "user_1",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": p.nonce,
+	}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+	signer := p.signer
+	if signer == nil {
+		signer = p.key
+	}
+	idToken, err := signJWT(signer, AlgES256, "key_1", claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body := map[string]any{
+		"access_token": "at_test",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// begin starts a flow and records the challenge and nonce the provider sees
+func (p *testProvider) begin(ctx context.Context, flow *AuthorizationFlow) string {
+	p.t.Helper()
+	redirect, err := flow.Begin(ctx, map[string]string{"source": "test"})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	parsed, err := url.Parse(redirect)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	query := parsed.Query()
+	if method := query.Get("code_challenge_method"); method != PKCEMethodS256 {
+		p.t.Fatalf("got code_challenge_method %q, want S256", method)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.challenge = query.Get("code_challenge")
+	p.nonce = query.Get("nonce")
+	return query.Get("state")
+}
+
+// newTestFlow returns a PKCE flow against p whose ID tokens are verified
+// with p's key
+func newTestFlow(t *testing.T, p *testProvider) (*AuthorizationFlow, *Manager) {
+	t.Helper()
+	oauth := NewOAuthManager(&OAuthConfig{
+		ClientID:     "client_1",
+		ClientSecret: "secret_1",
+		RedirectURL:  "https://app.example/callback",
+		AuthURL:      p.server.URL + "/authorize",
+		TokenURL:     p.server.URL + "/token",
+		UsePKCE:      true,
+	})
+	manager := NewManager(NewInMemoryStore())
+	flow := NewAuthorizationFlow(oauth, nil, manager, "bank")
+
+	validator, err := NewIDTokenValidator(p.server.URL, "client_1", StaticKeySet{"key_1": &p.key.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	flow.SetIDTokenValidator(validator)
+	return flow, manager
+}
+
+func TestAuthorizationFlowRoundTrip(t *testing.T) {
+	p := newTestProvider(t)
+	flow, manager := newTestFlow(t, p)
+	ctx := WithTenant(context.Background(), "acme")
+
+	state := p.begin(ctx, flow)
+	creds, err := flow.Complete(context.Background(), state, "code_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessToken != "at_test" || creds.Metadata["source"] != "test" {
+		t.Fatalf("got access token %q and metadata %v, want at_test with source=test", creds.AccessToken, creds.Metadata)
+	}
+
+	// Stored under the tenant the flow began in, not the callback's
+	stored, err := manager.GetCredentials(ctx, "bank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.AccessToken != "at_test" {
+		t.Fatalf("got stored access token %q, want at_test", stored.AccessToken)
+	}
+
+	if _, err := flow.Complete(context.Background(), state, "code_1"); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("reused state: got %v, want ErrInvalidState", err)
+	}
+}
+
+func TestAuthorizationFlowRejectsWrongVerifier(t *testing.T) {
+	p := newTestProvider(t)
+	flow, _ := newTestFlow(t, p)
+
+	state := p.begin(context.Background(), flow)
+	p.mu.Lock()
+	p.challenge = "not-the-challenge"
+	p.mu.Unlock()
+
+	if _, err := flow.Complete(context.Background(), state, "code_1"); err == nil {
+		t.Fatal("exchange succeeded with a verifier that does not match the challenge")
+	}
+}
+
+func TestAuthorizationFlowIDToken(t *testing.T) {
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		setup   func(p *testProvider)
+		wantErr error
+	}{
+		{"nonce mismatch", func(p *testProvider) { p.claims = map[string]any{"nonce": "other"} }, ErrNonceMismatch},
+		{"missing nonce", func(p *testProvider) { p.claims = map[string]any{"nonce": nil} }, ErrNonceMismatch},
+		{"wrong signing key", func(p *testProvider) { p.signer = otherKey }, ErrInvalidToken},
+		{"wrong audience", func(p *testProvider) { p.claims = map[string]any{"aud": "client_2"} }, ErrInvalidToken},
+		{"expired", func(p *testProvider) { p.claims = map[string]any{"exp": time.Now().Add(-time.Hour).Unix()} }, ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProvider(t)
+			flow, manager := newTestFlow(t, p)
+			ctx := context.Background()
+
+			state := p.begin(ctx, flow)
+			p.mu.Lock()
+			tt.setup(p)
+			p.mu.Unlock()
+
+			if _, err := flow.Complete(ctx, state, "code_1"); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if _, err := manager.GetCredentials(ctx, "bank"); !errors.Is(err, ErrCredentialsNotFound) {
+				t.Fatalf("got %v for stored credentials, want ErrCredentialsNotFound", err)
+			}
+		})
+	}
+}
+
+func TestAuthorizationFlowRequiresIDTokenValidator(t *testing.T) {
+	p := newTestProvider(t)
+	flow, _ := newTestFlow(t, p)
+	flow.SetIDTokenValidator(nil)
+
+	state := p.begin(context.Background(), flow)
+	if _, err := flow.Complete(context.Background(), state, "code_1"); !errors.Is(err, ErrIDTokenUnverified) {
+		t.Fatalf("got %v, want ErrIDTokenUnverified", err)
+	}
+}
+
+func TestAuthorizationFlowExpiredState(t *testing.T) {
+	p := newTestProvider(t)
+	flow, _ := newTestFlow(t, p)
+	flow.SetStateTTL(-time.Second)
+
+	state := p.begin(context.Background(), flow)
+	if _, err := flow.Complete(context.Background(), state, "code_1"); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("got %v, want ErrInvalidState", err)
+	}
+}
+
+func TestGeneratePKCE(t *testing.T) {
+	pkce, err := GeneratePKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkce.Method != PKCEMethodS256 {
+		t.Fatalf("got method %q, want S256", pkce.Method)
+	}
+	if n := len(pkce.CodeVerifier); n < 43 || n > 128 {
+		t.Fatalf("got a %d character verifier, want 43 to 128", n)
+	}
+	sum := sha256.Sum256([]byte(pkce.CodeVerifier))
+	if want := base64.RawURLEncoding.EncodeToString(sum[:]); pkce.CodeChallenge != want {
+		t.Fatalf("got challenge %q, want %q", pkce.CodeChallenge, want)
+	}
+
+	other, err := GeneratePKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.CodeVerifier == pkce.CodeVerifier {
+		t.Fatal("GeneratePKCE returned the same verifier twice")
+	}
+}
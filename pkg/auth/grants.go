@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/tracing"
+	"golang.org/x/oauth2"
+)
+
+// Metadata keys set on credentials obtained through the client-credentials grant
+const (
+	MetadataGrantType = "grant_type"
+	MetadataScope     = "scope"
+
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+// newTokenHTTPClient builds the HTTP client used for token requests,
+// attaching the client certificate for mTLS when configured. Requests are
+// traced and carry the caller's trace context.
+func newTokenHTTPClient(config *OAuthConfig) *http.Client {
+	base := config.HTTPClient
+	if base == nil {
+		base = &http.Client{Timeout: 30 * time.Second}
+	}
+	if config.TLSCertificate == nil {
+		return tracing.WrapClient(base, nil)
+	}
+
+	transport, ok := base.Transport.(*http.Transport)
+	if !ok || transport == nil {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	transport.TLSClientConfig.Certificates = []tls.Certificate{*config.TLSCertificate}
+
+	client := *base
+	client.Transport = transport
+	return tracing.WrapClient(&client, nil)
+}
+
+// clientContext makes the oauth2 package use our token HTTP client
+func (m *OAuthManager) clientContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, m.httpClient)
+}
+
+// usesCustomClientAuth reports whether token requests need parameters the
+// oauth2 package cannot add on refresh (assertions, mTLS client IDs)
+func (m *OAuthManager) usesCustomClientAuth() bool {
+	return m.config.AuthMethod == ClientAuthPrivateKeyJWT || m.config.AuthMethod == ClientAuthTLS
+}
+
+// ClientCredentialsToken requests an application token with the
+// client-credentials grant. When no scopes are given, the configured scopes are used.
+func (m *OAuthManager) ClientCredentialsToken(ctx context.Context, scopes ...string) (*Credentials, error) {
+	if len(scopes) == 0 {
+		scopes = m.config.Scopes
+	}
+
+	form := url.Values{"grant_type": {GrantTypeClientCredentials}}
+	if len(scopes) > 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+
+	creds, err := m.tokenRequest(ctx, form)
+	if err != nil {
+		return nil, fmt.Errorf("client credentials grant failed: %w", err)
+	}
+
+	creds.Metadata[MetadataGrantType] = GrantTypeClientCredentials
+	if _, ok := creds.Metadata[MetadataScope]; !ok && len(scopes) > 0 {
+		creds.Metadata[MetadataScope] = strings.Join(scopes, " ")
+	}
+	return creds, nil
+}
+
+// ApplicationToken returns a cached client-credentials token for the scopes,
+// requesting a new one when the cached token is near expiry. Concurrent
+// callers for the same scopes share one token request.
+func (m *OAuthManager) ApplicationToken(ctx context.Context, scopes ...string) (*Credentials, error) {
+	if len(scopes) == 0 {
+		scopes = m.config.Scopes
+	}
+	sorted := append([]string(nil), scopes...)
+	sort.Strings(sorted)
+	key := strings.Join(sorted, " ")
+
+	if cached := m.cachedAppToken(key); cached != nil {
+		return cached, nil
+	}
+
+	return m.appFlights.do(ctx, key, func() (*Credentials, error) {
+		// A request that finished while this caller waited may have filled the cache
+		if cached := m.cachedAppToken(key); cached != nil {
+			return cached, nil
+		}
+
+		// Detach from the first caller's cancellation; others share this result
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+		defer cancel()
+
+		creds, err := m.ClientCredentialsToken(ctx, scopes...)
+		if err != nil {
+			return nil, err
+		}
+
+		m.appMu.Lock()
+		m.appTokens[key] = creds
+		m.appMu.Unlock()
+		return creds, nil
+	})
+}
+
+// cachedAppToken returns the cached application token for a scope key if
+// it is still usable
+func (m *OAuthManager) cachedAppToken(key string) *Credentials {
+	m.appMu.Lock()
+	defer m.appMu.Unlock()
+
+	if cached, ok := m.appTokens[key]; ok && !cached.NeedsRefresh() {
+		return cached
+	}
+	return nil
+}
+
+// tokenRequest posts a grant to the token endpoint with client authentication applied
+func (m *OAuthManager) tokenRequest(ctx context.Context, form url.Values) (*Credentials, error) {
+	req, err := m.newTokenRequest(ctx, form)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		RefreshToken     string `json:"refresh_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Scope            string `json:"scope"`
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("token endpoint returned status %d with unparseable body", resp.StatusCode)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || token.Error != "" {
+		if token.Error != "" {
+			return nil, fmt.Errorf("token endpoint error %s: %s", token.Error, token.ErrorDescription)
+		}
+		return nil, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("token endpoint returned no access token")
+	}
+
+	creds := &Credentials{
+		Type:         CredentialTypeOAuth,
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		Metadata:     map[string]string{"token_type": token.TokenType},
+	}
+	if token.ExpiresIn > 0 {
+		creds.ExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	if token.Scope != "" {
+		creds.Metadata[MetadataScope] = token.Scope
+	}
+	if token.IDToken != "" {
+		creds.Metadata["id_token"] = token.IDToken
+	}
+
+	return creds, nil
+}
+
+// newTokenRequest builds the token endpoint request for the configured client auth method
+func (m *OAuthManager) newTokenRequest(ctx context.Context, form url.Values) (*http.Request, error) {
+	switch m.config.AuthMethod {
+	case ClientAuthSecretPost:
+		form.Set("client_id", m.config.ClientID)
+		form.Set("client_secret", m.config.ClientSecret)
+
+	case ClientAuthPrivateKeyJWT:
+		assertion, err := m.clientAssertion()
+		if err != nil {
+			return nil, err
+		}
+		form.Set("client_id", m.config.ClientID)
+		form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		form.Set("client_assertion", assertion)
+
+	case ClientAuthTLS:
+		if m.config.TLSCertificate == nil {
+			return nil, errors.New("tls_client_auth requires a TLS client certificate")
+		}
+		form.Set("client_id", m.config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if m.config.AuthMethod == ClientAuthSecretBasic {
+		req.SetBasicAuth(url.QueryEscape(m.config.ClientID), url.QueryEscape(m.config.ClientSecret))
+	}
+
+	return req, nil
+}
+
+// clientAssertion builds a short-lived signed JWT identifying the client
+func (m *OAuthManager) clientAssertion() (string, error) {
+	if m.config.PrivateKey == nil {
+		return "", errors.New("private_key_jwt requires a private key")
+	}
+
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	audience := m.config.AssertionAudience
+	if audience == "" {
+		audience = m.config.TokenURL
+	}
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss": m.config.ClientID,
+		"sub": m.config.ClientID,
+		"aud": audience,
+		"jti": jti,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+	}
+
+	assertion, err := signJWT(m.config.PrivateKey, m.config.SigningAlg, m.config.KeyID, claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign client assertion: %w", err)
+	}
+	return assertion, nil
+}
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// opaqueSigner hides the concrete key type, as HSM and KMS signers do
+type opaqueSigner struct {
+	crypto.Signer
+}
+
+// tokenServer answers client-credentials grants, handing each form to check
+// and counting requests
+func tokenServer(t *testing.T, requests *atomic.Int32, check func(r *http.Request) bool) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != GrantTypeClientCredentials || !check(r) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "invalid_client"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": fmt.Sprintf("at_%d", n),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientCredentialsToken(t *testing.T) {
+	var requests atomic.Int32
+	server := tokenServer(t, &requests, func(r *http.Request) bool {
+		id, secret, ok := r.BasicAuth()
+		return ok && id == "client_1" && secret == "secret_1" && r.PostForm.Get("scope") == "payments accounts"
+	})
+	oauth := NewOAuthManager(&OAuthConfig{
+		ClientID:     "client_1",
+		ClientSecret: "secret_1",
+		TokenURL:     server.URL,
+		Scopes:       []string{"payments", "accounts"},
+	})
+
+	creds, err := oauth.ClientCredentialsToken(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessToken == "" || creds.ExpiresAt.IsZero() {
+		t.Fatalf("got access token %q expiring %v, want a token with an expiry", creds.AccessToken, creds.ExpiresAt)
+	}
+	if creds.Metadata[MetadataGrantType] != GrantTypeClientCredentials || creds.Metadata[MetadataScope] != "payments accounts" {
+		t.Fatalf("got metadata %v, want the grant type and requested scopes", creds.Metadata)
+	}
+}
+
+func TestApplicationTokenSharesOneRequest(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := tokenServer(t, &requests, func(r *http.Request) bool {
+		if r.PostForm.Get("scope") == "payments" {
+			<-release
+		}
+		return true
+	})
+	oauth := NewOAuthManager(&OAuthConfig{ClientID: "client_1", ClientSecret: "secret_1", TokenURL: server.URL})
+
+	const callers = 8
+	var wg sync.WaitGroup
+	tokens := make([]string, callers)
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			creds, err := oauth.ApplicationToken(context.Background(), "payments")
+			errs[i] = err
+			if err == nil {
+				tokens[i] = creds.AccessToken
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond) // Let the callers pile up behind the request
+
+	// Other scopes are not held up by the pending request
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := oauth.ApplicationToken(ctx, "accounts"); err != nil {
+		t.Fatalf("token for other scopes: %v", err)
+	}
+
+	close(release)
+	wg.Wait()
+
+	for i := range callers {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if tokens[i] != tokens[0] {
+			t.Fatalf("caller %d got %s, want the shared %s", i, tokens[i], tokens[0])
+		}
+	}
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("got %d token requests, want one per scope set", got)
+	}
+
+	// Cached until it nears expiry
+	if _, err := oauth.ApplicationToken(context.Background(), "payments"); err != nil {
+		t.Fatal(err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("got %d token requests after a cached call, want 2", got)
+	}
+}
+
+func TestPrivateKeyJWTAssertion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     crypto.Signer
+		wantAlg string
+	}{
+		{"RSA", rsaKey, AlgRS256},
+		{"ECDSA", ecKey, AlgES256},
+		{"ECDSA behind crypto.Signer", opaqueSigner{ecKey}, AlgES256},
+		{"Ed25519", edKey, AlgEdDSA},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			var claims map[string]any
+			server := tokenServer(t, &requests, func(r *http.Request) bool {
+				if r.PostForm.Get("client_id") != "client_1" ||
+					r.PostForm.Get("client_assertion_type") != "urn:ietf:params:oauth:client-assertion-type:jwt-bearer" {
+					return false
+				}
+				var err error
+				claims, err = VerifyJWT(r.Context(), r.PostForm.Get("client_assertion"), StaticKeySet{"key_1": tt.key.Public()}, tt.wantAlg)
+				return err == nil
+			})
+
+			oauth := NewOAuthManager(&OAuthConfig{
+				ClientID:   "client_1",
+				TokenURL:   server.URL,
+				AuthMethod: ClientAuthPrivateKeyJWT,
+				PrivateKey: tt.key,
+				KeyID:      "key_1",
+			})
+			if _, err := oauth.ClientCredentialsToken(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if claims["iss"] != "client_1" || claims["sub"] != "client_1" {
+				t.Fatalf("got iss %v and sub %v, want client_1", claims["iss"], claims["sub"])
+			}
+			if claims["aud"] != server.URL {
+				t.Fatalf("got aud %v, want the token endpoint %s", claims["aud"], server.URL)
+			}
+			if jti, _ := claims["jti"].(string); jti == "" {
+				t.Fatal("assertion has no jti")
+			}
+			iat, _ := claims["iat"].(float64)
+			exp, _ := claims["exp"].(float64)
+			if exp-iat != (5 * time.Minute).Seconds() {
+				t.Fatalf("assertion lives %vs, want 300s", exp-iat)
+			}
+		})
+	}
+}
+
+func TestPrivateKeyJWTAssertionAudience(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests atomic.Int32
+	var audience any
+	server := tokenServer(t, &requests, func(r *http.Request) bool {
+		claims, err := VerifyJWT(r.Context(), r.PostForm.Get("client_assertion"), StaticKeySet{"": &key.PublicKey}, AlgES256)
+		audience = claims["aud"]
+		return err == nil
+	})
+
+	oauth := NewOAuthManager(&OAuthConfig{
+		ClientID:          "client_1",
+		TokenURL:          server.URL,
+		AuthMethod:        ClientAuthPrivateKeyJWT,
+		PrivateKey:        key,
+		AssertionAudience: "https://bank.example",
+	})
+	if _, err := oauth.ClientCredentialsToken(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if audience != "https://bank.example" {
+		t.Fatalf("got aud %v, want the configured assertion audience", audience)
+	}
+
+	// Without a key the request is not sent at all
+	noKey := NewOAuthManager(&OAuthConfig{ClientID: "client_1", TokenURL: server.URL, AuthMethod: ClientAuthPrivateKeyJWT})
+	if _, err := noKey.ClientCredentialsToken(context.Background()); err == nil {
+		t.Fatal("got a token without a private key")
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("got %d token requests, want 1", got)
+	}
+}
@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/tracing"
+)
+
+// ErrUnknownSigningKey is returned when no key matches a token's key ID
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// KeySet resolves the public key a token was signed with
+type KeySet interface {
+	// Key returns the key with the given ID. An empty ID matches the only
+	// key of a single-key set.
+	Key(ctx context.Context, keyID string) (crypto.PublicKey, error)
+}
+
+// StaticKeySet is a fixed KeySet keyed by key ID
+type StaticKeySet map[string]crypto.PublicKey
+
+// Key returns the key with the given ID
+func (s StaticKeySet) Key(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	return lookupKey(s, keyID)
+}
+
+// JWKSConfig configures a remote JSON Web Key Set
+type JWKSConfig struct {
+	URL        string
+	HTTPClient *http.Client
+
+	// RefreshInterval is how long fetched keys are used before refetching
+	RefreshInterval time.Duration
+	// MinRefreshInterval limits refetches triggered by unknown key IDs, so
+	// tokens with made-up key IDs cannot make us fetch on every request
+	MinRefreshInterval time.Duration
+}
+
+// DefaultJWKSConfig returns sensible defaults for a JWKS URL
+func DefaultJWKSConfig(url string) *JWKSConfig {
+	return &JWKSConfig{
+		URL:                url,
+		RefreshInterval:    time.Hour,
+		MinRefreshInterval: time.Minute,
+	}
+}
+
+// JWKS is a KeySet fetched from a JWKS endpoint. Keys are cached and
+// refetched periodically, and immediately (rate limited) when a token names a
+// key we have not seen, which picks up key rotation at the issuer. If a
+// refresh fails the previously fetched keys stay in use.
+type JWKS struct {
+	config     *JWKSConfig
+	httpClient *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+
+	fetchMu     sync.Mutex // Serializes fetches
+	lastAttempt time.Time
+}
+
+// NewJWKS creates a JWKS key set. Keys are fetched on first use.
+func NewJWKS(config *JWKSConfig) *JWKS {
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &JWKS{config: config, httpClient: tracing.WrapClient(httpClient, nil)}
+}
+
+// Key returns the key with the given ID, fetching the set if needed
+func (j *JWKS) Key(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	j.mu.RLock()
+	keys, fetchedAt := j.keys, j.fetchedAt
+	j.mu.RUnlock()
+
+	if keys != nil && time.Since(fetchedAt) < j.config.RefreshInterval {
+		if key, err := lookupKey(keys, keyID); err == nil {
+			return key, nil
+		}
+	}
+
+	refreshed, err := j.refresh(ctx, fetchedAt)
+	if err != nil && keys == nil {
+		return nil, err
+	}
+	if refreshed != nil {
+		keys = refreshed
+	}
+	return lookupKey(keys, keyID)
+}
+
+// refresh fetches the key set unless another caller already did so since
+// seen, or the last attempt was too recent
+func (j *JWKS) refresh(ctx context.Context, seen time.Time) (map[string]crypto.PublicKey, error) {
+	j.fetchMu.Lock()
+	defer j.fetchMu.Unlock()
+
+	j.mu.RLock()
+	keys, fetchedAt := j.keys, j.fetchedAt
+	j.mu.RUnlock()
+
+	if fetchedAt.After(seen) {
+		return keys, nil
+	}
+	if time.Since(j.lastAttempt) < j.config.MinRefreshInterval {
+		return nil, nil
+	}
+	j.lastAttempt = time.Now()
+
+	fetched, err := j.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	j.mu.Lock()
+	j.keys, j.fetchedAt = fetched, time.Now()
+	j.mu.Unlock()
+	return fetched, nil
+}
+
+// fetch downloads and parses the key set
+func (j *JWKS) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.config.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := j.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, raw := range set.Keys {
+		// Skip keys we cannot use rather than rejecting the whole set
+		keyID, key, err := ParseJWK(raw)
+		if err != nil {
+			continue
+		}
+		keys[keyID] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS contains no usable signing keys")
+	}
+	return keys, nil
+}
+
+// jsonWebKey holds the JWK members we use (RFC 7517, RFC 7518, RFC 8037)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWK decodes a public signing key from its JWK form, returning its key ID
+func ParseJWK(raw []byte) (string, crypto.PublicKey, error) {
+	var jwk jsonWebKey
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return "", nil, err
+	}
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return "", nil, fmt.Errorf("key %s is not a signing key", jwk.Kid)
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(jwk.N)
+		if err != nil {
+			return "", nil, err
+		}
+		e, err := decodeJWKInt(jwk.E)
+		if err != nil {
+			return "", nil, err
+		}
+		if n.BitLen() < 2048 || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return "", nil, fmt.Errorf("unsupported RSA key %s", jwk.Kid)
+		}
+		return jwk.Kid, &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return "", nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != 32 {
+			return "", nil, errors.New("malformed EC key")
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil || len(y) != 32 {
+			return "", nil, errors.New("malformed EC key")
+		}
+		key, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return "", nil, err
+		}
+		return jwk.Kid, key, nil
+
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return "", nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return "", nil, errors.New("malformed Ed25519 key")
+		}
+		return jwk.Kid, ed25519.PublicKey(x), nil
+
+	default:
+		return "", nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+	}
+}
+
+func decodeJWKInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("malformed RSA key")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// lookupKey finds a key by ID, allowing an empty ID for single-key sets
+func lookupKey(keys map[string]crypto.PublicKey, keyID string) (crypto.PublicKey, error) {
+	if key, ok := keys[keyID]; ok {
+		return key, nil
+	}
+	if keyID == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownSigningKey
+}
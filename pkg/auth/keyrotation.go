@@ -0,0 +1,491 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/logging"
+)
+
+// ErrRotationInProgress is returned when a key is rotated again before the
+// previous rotation's overlap window has closed
+var ErrRotationInProgress = errors.New("previous key rotation still in its overlap window")
+
+// ErrNoKeyIssuer is returned when rotating a key for a provider without a
+// registered KeyIssuer. Keys are never generated locally by default, since a
+// random string would replace a real provider key that the provider rejects.
+var ErrNoKeyIssuer = errors.New("no key issuer registered")
+
+// Bounds for retrying a failed revocation when an overlap window closes
+const (
+	revokeRetryInitial = time.Minute
+	revokeRetryMax     = time.Hour
+)
+
+// KeyIssuer obtains and revokes API keys at the provider that accepts them
+type KeyIssuer interface {
+	// IssueKey creates a new key alongside the current one, which must keep
+	// working until RevokeKey is called for it
+	IssueKey(ctx context.Context, providerID string, current *Credentials) (*Credentials, error)
+	// RevokeKey invalidates a key that has been rotated out
+	RevokeKey(ctx context.Context, providerID string, old *Credentials) error
+}
+
+// LocalKeyIssuer issues random keys locally, for keys this service hands out
+// itself. Revocation is a no-op since dropping the key from the store is
+// enough. It must be registered explicitly with RegisterKeyIssuer.
+type LocalKeyIssuer struct{}
+
+// IssueKey generates a random API key
+func (LocalKeyIssuer) IssueKey(ctx context.Context, providerID string, current *Credentials) (*Credentials, error) {
+	key, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	return &Credentials{Type: CredentialTypeAPIKey, APIKey: key}, nil
+}
+
+// RevokeKey does nothing
+func (LocalKeyIssuer) RevokeKey(ctx context.Context, providerID string, old *Credentials) error {
+	return nil
+}
+
+// KeyIssuerFuncs adapts a pair of functions to a KeyIssuer
+type KeyIssuerFuncs struct {
+	Issue  func(ctx context.Context, providerID string, current *Credentials) (*Credentials, error)
+	Revoke func(ctx context.Context, providerID string, old *Credentials) error
+}
+
+// IssueKey calls Issue
+func (f KeyIssuerFuncs) IssueKey(ctx context.Context, providerID string, current *Credentials) (*Credentials, error) {
+	return f.Issue(ctx, providerID, current)
+}
+
+// RevokeKey calls Revoke, if set
+func (f KeyIssuerFuncs) RevokeKey(ctx context.Context, providerID string, old *Credentials) error {
+	if f.Revoke == nil {
+		return nil
+	}
+	return f.Revoke(ctx, providerID, old)
+}
+
+// RotationRecord is one entry in the rotation history. Keys are identified by
+// fingerprint only; secrets are never recorded.
+type RotationRecord struct {
+	ID             string    `json:"id"`
+	Key            string    `json:"key"` // CredentialKey string
+	ProviderID     string    `json:"provider_id"`
+	OldFingerprint string    `json:"old_fingerprint"`
+	NewFingerprint string    `json:"new_fingerprint"`
+	RotatedAt      time.Time `json:"rotated_at"`
+	OverlapUntil   time.Time `json:"overlap_until"`
+	RevokedAt      time.Time `json:"revoked_at,omitzero"`
+	RevokeError    string    `json:"revoke_error,omitempty"`
+}
+
+// RotationHistory stores rotation records
+type RotationHistory interface {
+	// Record saves or updates a record by ID
+	Record(ctx context.Context, record *RotationRecord) error
+	// List returns the records for a credential key, oldest first
+	List(ctx context.Context, key string) ([]*RotationRecord, error)
+}
+
+// InMemoryRotationHistory keeps rotation records in memory
+type InMemoryRotationHistory struct {
+	mu      sync.RWMutex
+	records map[string]*RotationRecord
+}
+
+// NewInMemoryRotationHistory creates an in-memory rotation history
+func NewInMemoryRotationHistory() *InMemoryRotationHistory {
+	return &InMemoryRotationHistory{records: make(map[string]*RotationRecord)}
+}
+
+// Record saves or updates a record
+func (h *InMemoryRotationHistory) Record(ctx context.Context, record *RotationRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	copied := *record
+	h.records[record.ID] = &copied
+	return nil
+}
+
+// List returns the records for a credential key, oldest first
+func (h *InMemoryRotationHistory) List(ctx context.Context, key string) ([]*RotationRecord, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var records []*RotationRecord
+	for _, record := range h.records {
+		if record.Key == key {
+			copied := *record
+			records = append(records, &copied)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].RotatedAt.Before(records[j].RotatedAt)
+	})
+	return records, nil
+}
+
+// RegisterKeyIssuer sets the issuer used to rotate a provider's API keys
+func (m *Manager) RegisterKeyIssuer(providerID string, issuer KeyIssuer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keyIssuers[providerID] = issuer
+}
+
+// SetRotationOverlap sets how long a provider's old key stays valid after RotateAPIKey
+func (m *Manager) SetRotationOverlap(providerID string, overlap time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rotationOverlaps[providerID] = overlap
+}
+
+// SetRotationHistory replaces the store for rotation records
+func (m *Manager) SetRotationHistory(history RotationHistory) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.history = history
+}
+
+// RotationHistory returns the rotation records for a provider in ctx's scope
+func (m *Manager) RotationHistory(ctx context.Context, providerID string) ([]*RotationRecord, error) {
+	key, _, err := m.lookup(ctx, providerID)
+	if err != nil && !errors.Is(err, ErrCredentialsNotFound) {
+		return nil, err
+	}
+	return m.rotationHistory().List(ctx, key)
+}
+
+// RotateAPIKeyWithOverlap rotates an API key in four steps: the issuer creates
+// a new key, rotation handlers are notified, the new key replaces the old one
+// for every reader in a single store write, and the old key is revoked once
+// the overlap window ends. Until then the old key is kept as
+// Credentials.Previous and accepted by AcceptedAPIKeys. With no overlap the
+// old key is revoked straight away; if that fails the rotation still stands,
+// the error is set on the returned record and the revocation is retried.
+func (m *Manager) RotateAPIKeyWithOverlap(ctx context.Context, providerID string, overlap time.Duration) (*RotationRecord, error) {
+	key, oldCreds, version, err := m.loadForUpdate(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if oldCreds.Type != CredentialTypeAPIKey {
+		return nil, errors.New("can only rotate API key credentials")
+	}
+	if oldCreds.Previous != nil {
+		return nil, ErrRotationInProgress
+	}
+
+	scoped := scopeForStoreKey(ctx, key)
+	issuer, err := m.keyIssuer(providerID)
+	if err != nil {
+		return nil, err
+	}
+
+	issued, err := issuer.IssueKey(scoped, providerID, oldCreds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue new key for %s: %w", providerID, err)
+	}
+
+	newCreds := *issued
+	newCreds.Type = CredentialTypeAPIKey
+	if newCreds.Metadata == nil {
+		newCreds.Metadata = oldCreds.Metadata
+	}
+
+	m.mu.RLock()
+	handler, exists := m.rotationHandlers[providerID]
+	m.mu.RUnlock()
+
+	if exists {
+		if err := handler(scoped, providerID, oldCreds, &newCreds); err != nil {
+			m.revokeQuietly(scoped, issuer, providerID, &newCreds)
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	newCreds.IssuedAt = now
+	retired := *oldCreds
+	retired.Previous = nil
+	// Without an overlap the old key is stored already expired, so a failed
+	// revocation below stays pending for CompleteRotation to retry
+	newCreds.Previous = &RetiringCredentials{Credentials: retired, ValidUntil: now.Add(max(overlap, 0))}
+
+	// Readers switch to the new key with this single write
+	if err := m.storeVersioned(ctx, key, &newCreds, version); err != nil {
+		m.revokeQuietly(scoped, issuer, providerID, &newCreds)
+		return nil, err
+	}
+	m.publish(scoped, CredentialsRotated, key, &newCreds)
+
+	record := &RotationRecord{
+		ID:             randomRecordID(),
+		Key:            key,
+		ProviderID:     providerID,
+		OldFingerprint: credentialFingerprint(oldCreds.APIKey),
+		NewFingerprint: credentialFingerprint(newCreds.APIKey),
+		RotatedAt:      now,
+		OverlapUntil:   now.Add(overlap),
+	}
+
+	_ = m.rotationHistory().Record(scoped, record)
+
+	if overlap <= 0 {
+		// The new key is already in use, so a failed revocation is a
+		// retirement failure to retry rather than a failed rotation
+		if err := m.CompleteRotation(scoped, providerID); err != nil {
+			record.RevokeError = err.Error()
+			logging.Logger().ErrorContext(scoped, "failed to retire old key",
+				"provider", providerID,
+				"retry_in", revokeRetryInitial,
+				"error", err,
+			)
+			m.scheduleCompletion(context.WithoutCancel(scoped), providerID, revokeRetryInitial, revokeRetryInitial*2)
+		} else {
+			record.RevokedAt = time.Now()
+		}
+		return record, nil
+	}
+
+	// Revoke in the background when the window closes. If the process stops
+	// first, CompleteRotation (run by RotationScheduler) picks it up.
+	m.scheduleCompletion(context.WithoutCancel(scoped), providerID, overlap, revokeRetryInitial)
+
+	return record, nil
+}
+
+// scheduleCompletion runs CompleteRotation after delay. A failure is logged
+// and retried with backoff; the old key stays pending until it succeeds, or
+// until another replica completes the rotation. Retries stop on errors that
+// another attempt cannot fix and when the Manager is closed.
+func (m *Manager) scheduleCompletion(ctx context.Context, providerID string, delay, retry time.Duration) {
+	m.completionMu.Lock()
+	defer m.completionMu.Unlock()
+
+	if m.closed {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		m.completionMu.Lock()
+		delete(m.completions, timer)
+		closed := m.closed
+		m.completionMu.Unlock()
+		if closed {
+			return
+		}
+
+		err := m.CompleteRotation(ctx, providerID)
+		if err == nil {
+			return
+		}
+		if errors.Is(err, ErrCredentialsNotFound) || errors.Is(err, ErrNoKeyIssuer) {
+			logging.Logger().ErrorContext(ctx, "abandoned key rotation",
+				"provider", providerID,
+				"error", err,
+			)
+			return
+		}
+
+		logging.Logger().ErrorContext(ctx, "failed to complete key rotation",
+			"provider", providerID,
+			"retry_in", retry,
+			"error", err,
+		)
+		m.scheduleCompletion(ctx, providerID, retry, min(retry*2, revokeRetryMax))
+	})
+	m.completions[timer] = struct{}{}
+}
+
+// Close stops the background revocations scheduled when overlap windows
+// end. Rotations still pending are completed by the next CompleteRotation,
+// which RotationScheduler runs when it starts.
+func (m *Manager) Close() {
+	m.completionMu.Lock()
+	defer m.completionMu.Unlock()
+
+	m.closed = true
+	for timer := range m.completions {
+		timer.Stop()
+		delete(m.completions, timer)
+	}
+}
+
+// CompleteRotation revokes the previous key once its overlap window has
+// ended and removes it from the stored credentials. It does nothing when no
+// rotation is pending or the window is still open.
+func (m *Manager) CompleteRotation(ctx context.Context, providerID string) error {
+	key, creds, version, err := m.loadForUpdate(ctx, providerID)
+	if err != nil {
+		return err
+	}
+	if creds.Previous == nil || time.Now().Before(creds.Previous.ValidUntil) {
+		return nil
+	}
+
+	scoped := scopeForStoreKey(ctx, key)
+	retired := creds.Previous.Credentials
+
+	issuer, err := m.keyIssuer(providerID)
+	if err != nil {
+		return err
+	}
+
+	// Revoke before forgetting the key so a failed revocation is retried
+	record := m.pendingRecord(scoped, key, credentialFingerprint(retired.APIKey))
+	if err := m.finishRevocation(scoped, issuer, providerID, &retired, record); err != nil {
+		return err
+	}
+
+	updated := *creds
+	updated.Previous = nil
+	if err := m.storeVersioned(ctx, key, &updated, version); err != nil {
+		return err
+	}
+
+	m.publish(scoped, CredentialsRetired, key, &updated)
+	return nil
+}
+
+// AcceptedAPIKeys returns every API key currently valid for a provider: the
+// current key and, during an overlap window, the previous one. Use it when
+// verifying keys this service issued to others.
+func (m *Manager) AcceptedAPIKeys(ctx context.Context, providerID string) ([]string, error) {
+	_, creds, err := m.lookup(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{creds.APIKey}
+	if creds.Previous != nil && time.Now().Before(creds.Previous.ValidUntil) {
+		keys = append(keys, creds.Previous.APIKey)
+	}
+	return keys, nil
+}
+
+// finishRevocation revokes the retired key and records the outcome
+func (m *Manager) finishRevocation(ctx context.Context, issuer KeyIssuer, providerID string, retired *Credentials, record *RotationRecord) error {
+	err := issuer.RevokeKey(ctx, providerID, retired)
+	if record != nil {
+		if err != nil {
+			record.RevokeError = err.Error()
+		} else {
+			record.RevokedAt = time.Now()
+			record.RevokeError = ""
+		}
+		_ = m.rotationHistory().Record(ctx, record)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke old key for %s: %w", providerID, err)
+	}
+	return nil
+}
+
+// revokeQuietly revokes a key that was issued but never put into use
+func (m *Manager) revokeQuietly(ctx context.Context, issuer KeyIssuer, providerID string, creds *Credentials) {
+	_ = issuer.RevokeKey(context.WithoutCancel(ctx), providerID, creds)
+}
+
+// pendingRecord finds the history record for the rotation that retired the
+// key with the given fingerprint
+func (m *Manager) pendingRecord(ctx context.Context, key, oldFingerprint string) *RotationRecord {
+	records, err := m.rotationHistory().List(ctx, key)
+	if err != nil {
+		return nil
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].OldFingerprint == oldFingerprint {
+			return records[i]
+		}
+	}
+	return nil
+}
+
+// loadForUpdate reads credentials and, for versioned stores, their version
+func (m *Manager) loadForUpdate(ctx context.Context, providerID string) (string, *Credentials, int64, error) {
+	key, creds, err := m.lookup(ctx, providerID)
+	if err != nil {
+		return "", nil, 0, err
+	}
+
+	if versioned, ok := m.store.(VersionedCredentialStore); ok {
+		creds, version, err := versioned.GetVersioned(ctx, key)
+		if err != nil {
+			return "", nil, 0, err
+		}
+		return key, creds, version, nil
+	}
+	return key, creds, 0, nil
+}
+
+// storeVersioned writes credentials, with compare-and-swap when supported so
+// a concurrent refresh or rotation on another replica is not overwritten
+func (m *Manager) storeVersioned(ctx context.Context, key string, creds *Credentials, version int64) error {
+	if versioned, ok := m.store.(VersionedCredentialStore); ok {
+		if _, err := versioned.CompareAndSet(ctx, key, creds, version); err != nil {
+			return fmt.Errorf("failed to store rotated credentials: %w", err)
+		}
+		return nil
+	}
+
+	if err := m.store.Set(ctx, key, creds); err != nil {
+		return fmt.Errorf("failed to store rotated credentials: %w", err)
+	}
+	return nil
+}
+
+// keyIssuer returns the issuer registered for a provider
+func (m *Manager) keyIssuer(providerID string) (KeyIssuer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if issuer, ok := m.keyIssuers[providerID]; ok {
+		return issuer, nil
+	}
+	return nil, fmt.Errorf("%w for %s", ErrNoKeyIssuer, providerID)
+}
+
+func (m *Manager) rotationHistory() RotationHistory {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.history
+}
+
+// scopeForStoreKey scopes ctx to the credentials actually stored under key,
+// which may be the tenant's when a user-scoped lookup fell back
+func scopeForStoreKey(ctx context.Context, key string) context.Context {
+	parsed, err := ParseCredentialKey(key)
+	if err != nil {
+		return ctx
+	}
+	return parsed.Context(ctx)
+}
+
+// credentialFingerprint identifies a secret without revealing it
+func credentialFingerprint(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return "fp_" + hex.EncodeToString(sum[:6])
+}
+
+func randomRecordID() string {
+	id, err := randomToken(12)
+	if err != nil {
+		return fmt.Sprintf("rot_%d", time.Now().UnixNano())
+	}
+	return "rot_" + id
+}
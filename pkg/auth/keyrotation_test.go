@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRotateAPIKeyRequiresIssuer(t *testing.T) {
+	ctx := context.Background()
+	manager := NewManager(NewInMemoryStore())
+	original := &Credentials{Type: CredentialTypeAPIKey, APIKey: "sk_live_original"}
+	if err := manager.SetCredentials(ctx, "stripe", original); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := manager.RotateAPIKey(ctx, "stripe"); !errors.Is(err, ErrNoKeyIssuer) {
+		t.Fatalf("RotateAPIKey without issuer: got %v, want ErrNoKeyIssuer", err)
+	}
+
+	creds, err := manager.GetCredentials(ctx, "stripe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.APIKey != original.APIKey {
+		t.Fatalf("key was replaced with %q", creds.APIKey)
+	}
+}
+
+func TestCompleteRotationKeepsPendingWhenRevokeFails(t *testing.T) {
+	ctx := context.Background()
+	manager := NewManager(NewInMemoryStore())
+	if err := manager.SetCredentials(ctx, "stripe", &Credentials{Type: CredentialTypeAPIKey, APIKey: "sk_old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	revokeErr := errors.New("provider unavailable")
+	failing := true
+	manager.RegisterKeyIssuer("stripe", KeyIssuerFuncs{
+		Issue: func(ctx context.Context, providerID string, current *Credentials) (*Credentials, error) {
+			return &Credentials{APIKey: "sk_new"}, nil
+		},
+		Revoke: func(ctx context.Context, providerID string, old *Credentials) error {
+			if failing {
+				return revokeErr
+			}
+			return nil
+		},
+	})
+
+	// The window is long enough that the background completion never runs
+	if _, err := manager.RotateAPIKeyWithOverlap(ctx, "stripe", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// Close the window by hand
+	creds, err := manager.GetCredentials(ctx, "stripe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds.Previous.ValidUntil = time.Now().Add(-time.Second)
+	if err := manager.SetCredentials(ctx, "stripe", creds); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := manager.CompleteRotation(ctx, "stripe"); !errors.Is(err, revokeErr) {
+		t.Fatalf("CompleteRotation: got %v, want the revocation error", err)
+	}
+	creds, err = manager.GetCredentials(ctx, "stripe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.Previous == nil || creds.Previous.APIKey != "sk_old" {
+		t.Fatal("old key was forgotten although its revocation failed")
+	}
+
+	failing = false
+	if err := manager.CompleteRotation(ctx, "stripe"); err != nil {
+		t.Fatalf("CompleteRotation retry: %v", err)
+	}
+	creds, err = manager.GetCredentials(ctx, "stripe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.Previous != nil {
+		t.Fatal("old key still pending after a successful revocation")
+	}
+
+	history, err := manager.RotationHistory(ctx, "stripe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].RevokedAt.IsZero() || history[0].RevokeError != "" {
+		t.Fatalf("history does not record the revocation: %+v", history)
+	}
+}
+
+// revokingIssuer issues sk_new and counts revocations, failing them while
+// failing is set
+func revokingIssuer(revokes *atomic.Int32, failing *atomic.Bool) KeyIssuerFuncs {
+	return KeyIssuerFuncs{
+		Issue: func(ctx context.Context, providerID string, current *Credentials) (*Credentials, error) {
+			return &Credentials{APIKey: "sk_new"}, nil
+		},
+		Revoke: func(ctx context.Context, providerID string, old *Credentials) error {
+			revokes.Add(1)
+			if failing.Load() {
+				return errors.New("provider unavailable")
+			}
+			return nil
+		},
+	}
+}
+
+func TestRotateWithoutOverlapReportsRetirementFailure(t *testing.T) {
+	ctx := context.Background()
+	manager := NewManager(NewInMemoryStore())
+	t.Cleanup(manager.Close)
+	if err := manager.SetCredentials(ctx, "stripe", &Credentials{Type: CredentialTypeAPIKey, APIKey: "sk_old"}); err != nil {
+		t.Fatal(err)
+	}
+	var revokes atomic.Int32
+	var failing atomic.Bool
+	failing.Store(true)
+	manager.RegisterKeyIssuer("stripe", revokingIssuer(&revokes, &failing))
+
+	record, err := manager.RotateAPIKeyWithOverlap(ctx, "stripe", 0)
+	if err != nil {
+		t.Fatalf("got %v, want the rotation to stand despite the failed revocation", err)
+	}
+	if record.RevokeError == "" || !record.RevokedAt.IsZero() {
+		t.Fatalf("got record %+v, want the revocation error on it", record)
+	}
+
+	accepted, err := manager.AcceptedAPIKeys(ctx, "stripe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accepted) != 1 || accepted[0] != "sk_new" {
+		t.Fatalf("got accepted keys %v, want only sk_new", accepted)
+	}
+
+	failing.Store(false)
+	if err := manager.CompleteRotation(ctx, "stripe"); err != nil {
+		t.Fatal(err)
+	}
+	creds, err := manager.GetCredentials(ctx, "stripe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.Previous != nil {
+		t.Fatal("old key still pending after a successful revocation")
+	}
+}
+
+func TestRotateWithoutOverlapRevokesImmediately(t *testing.T) {
+	ctx := context.Background()
+	manager := NewManager(NewInMemoryStore())
+	if err := manager.SetCredentials(ctx, "stripe", &Credentials{Type: CredentialTypeAPIKey, APIKey: "sk_old"}); err != nil {
+		t.Fatal(err)
+	}
+	var revokes atomic.Int32
+	var failing atomic.Bool
+	manager.RegisterKeyIssuer("stripe", revokingIssuer(&revokes, &failing))
+
+	record, err := manager.RotateAPIKeyWithOverlap(ctx, "stripe", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revokes.Load() != 1 || record.RevokedAt.IsZero() {
+		t.Fatalf("got %d revocations and record %+v, want the old key revoked", revokes.Load(), record)
+	}
+	creds, err := manager.GetCredentials(ctx, "stripe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.APIKey != "sk_new" || creds.Previous != nil {
+		t.Fatalf("got key %s with previous %v, want sk_new alone", creds.APIKey, creds.Previous)
+	}
+}
+
+func TestScheduledCompletion(t *testing.T) {
+	pending := func(m *Manager) int {
+		m.completionMu.Lock()
+		defer m.completionMu.Unlock()
+		return len(m.completions)
+	}
+
+	t.Run("stops when the credentials are deleted", func(t *testing.T) {
+		ctx := context.Background()
+		manager := NewManager(NewInMemoryStore())
+		t.Cleanup(manager.Close)
+		if err := manager.SetCredentials(ctx, "stripe", &Credentials{Type: CredentialTypeAPIKey, APIKey: "sk_old"}); err != nil {
+			t.Fatal(err)
+		}
+		var revokes atomic.Int32
+		var failing atomic.Bool
+		manager.RegisterKeyIssuer("stripe", revokingIssuer(&revokes, &failing))
+
+		if _, err := manager.RotateAPIKeyWithOverlap(ctx, "stripe", 20*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		if err := manager.DeleteCredentials(ctx, "stripe"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(60 * time.Millisecond)
+
+		if n := pending(manager); n != 0 {
+			t.Fatalf("got %d completions still scheduled, want 0", n)
+		}
+		if revokes.Load() != 0 {
+			t.Fatalf("got %d revocations for deleted credentials, want 0", revokes.Load())
+		}
+	})
+
+	t.Run("Close cancels pending completions", func(t *testing.T) {
+		ctx := context.Background()
+		manager := NewManager(NewInMemoryStore())
+		if err := manager.SetCredentials(ctx, "stripe", &Credentials{Type: CredentialTypeAPIKey, APIKey: "sk_old"}); err != nil {
+			t.Fatal(err)
+		}
+		var revokes atomic.Int32
+		var failing atomic.Bool
+		manager.RegisterKeyIssuer("stripe", revokingIssuer(&revokes, &failing))
+
+		if _, err := manager.RotateAPIKeyWithOverlap(ctx, "stripe", 20*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		manager.Close()
+		time.Sleep(60 * time.Millisecond)
+
+		if revokes.Load() != 0 {
+			t.Fatalf("got %d revocations after Close, want 0", revokes.Load())
+		}
+		creds, err := manager.GetCredentials(ctx, "stripe")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds.Previous == nil {
+			t.Fatal("pending rotation was dropped instead of left for CompleteRotation")
+		}
+	})
+}
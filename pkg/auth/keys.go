@@ -0,0 +1,431 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrUnknownMasterKey is returned when data was wrapped with a master key
+	// the KeyProvider no longer has
+	ErrUnknownMasterKey = errors.New("unknown master key")
+	// ErrDecryptionFailed is returned when ciphertext fails authentication
+	ErrDecryptionFailed = errors.New("decryption failed")
+)
+
+// KeyProvider wraps and unwraps data encryption keys with a master key,
+// in the style of a KMS. Implementations may hold several master keys so
+// data wrapped before a rotation can still be read.
+type KeyProvider interface {
+	// CurrentKeyID returns the ID of the master key used for new wraps
+	CurrentKeyID(ctx context.Context) (string, error)
+	// WrapKey encrypts a data key with the current master key
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey decrypts a data key wrapped with the given master key
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Keyring is a KeyProvider holding AES-256 master keys in memory. The first
+// key added is current until Rotate or SetCurrent changes it; older keys are
+// kept for unwrapping.
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[string][]byte
+	current string
+}
+
+// NewKeyring creates an empty keyring
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string][]byte)}
+}
+
+// Add registers a 32-byte master key. An empty keyID derives one from the
+// key's fingerprint.
+func (k *Keyring) Add(keyID string, key []byte) (string, error) {
+	if len(key) != 32 {
+		return "", fmt.Errorf("master key must be 32 bytes, got %d", len(key))
+	}
+	if keyID == "" {
+		keyID = keyFingerprint(key)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys[keyID] = append([]byte(nil), key...)
+	if k.current == "" {
+		k.current = keyID
+	}
+	return keyID, nil
+}
+
+// SetCurrent makes an existing key the one used for new wraps
+func (k *Keyring) SetCurrent(keyID string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[keyID]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownMasterKey, keyID)
+	}
+	k.current = keyID
+	return nil
+}
+
+// Rotate generates a new master key and makes it current
+func (k *Keyring) Rotate() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	keyID, err := k.Add("", key)
+	if err != nil {
+		return "", err
+	}
+	return keyID, k.SetCurrent(keyID)
+}
+
+// Remove drops a retired master key. The current key cannot be removed.
+func (k *Keyring) Remove(keyID string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if keyID == k.current {
+		return errors.New("cannot remove the current master key")
+	}
+	delete(k.keys, keyID)
+	return nil
+}
+
+// CurrentKeyID returns the ID of the current master key
+func (k *Keyring) CurrentKeyID(ctx context.Context) (string, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.current == "" {
+		return "", errors.New("keyring has no master key")
+	}
+	return k.current, nil
+}
+
+// WrapKey encrypts a data key with the current master key
+func (k *Keyring) WrapKey(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	k.mu.RLock()
+	keyID, master := k.current, k.keys[k.current]
+	k.mu.RUnlock()
+
+	if keyID == "" {
+		return "", nil, errors.New("keyring has no master key")
+	}
+
+	wrapped, err := sealAESGCM(master, dataKey, []byte(keyID))
+	if err != nil {
+		return "", nil, err
+	}
+	return keyID, wrapped, nil
+}
+
+// UnwrapKey decrypts a data key wrapped with the given master key
+func (k *Keyring) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	k.mu.RLock()
+	master, ok := k.keys[keyID]
+	k.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMasterKey, keyID)
+	}
+	return openAESGCM(master, wrapped, []byte(keyID))
+}
+
+// NewEnvKeyProvider loads master keys from an environment variable. The value
+// is a comma-separated list of base64 keys, optionally prefixed with "id:";
+// the first entry is current and the rest are kept for decryption, so a
+// rotation is deployed by prepending the new key.
+func NewEnvKeyProvider(name string) (*Keyring, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", name)
+	}
+
+	keyring, err := parseKeyList(strings.Split(value, ","))
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key in %s: %w", name, err)
+	}
+	return keyring, nil
+}
+
+// NewFileKeyProvider loads master keys from a file with one key per line in
+// the same format as NewEnvKeyProvider. Blank lines and lines starting with
+// # are ignored.
+func NewFileKeyProvider(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key file: %w", err)
+	}
+
+	var entries []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			entries = append(entries, line)
+		}
+	}
+
+	keyring, err := parseKeyList(entries)
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key in %s: %w", path, err)
+	}
+	return keyring, nil
+}
+
+// parseKeyList builds a keyring from "id:base64" or "base64" entries
+func parseKeyList(entries []string) (*Keyring, error) {
+	keyring := NewKeyring()
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		keyID, encoded := "", entry
+		if i := strings.IndexByte(entry, ':'); i >= 0 {
+			keyID, encoded = entry[:i], entry[i+1:]
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.New("key is not valid base64")
+		}
+		if _, err := keyring.Add(keyID, key); err != nil {
+			return nil, err
+		}
+	}
+
+	if keyring.current == "" {
+		return nil, errors.New("no keys found")
+	}
+	return keyring, nil
+}
+
+// KMSClient is the subset of a cloud KMS API needed to wrap data keys
+type KMSClient interface {
+	Encrypt(ctx context.Context, keyID string, plaintext []byte) ([]byte, error)
+	Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error)
+}
+
+// KMSKeyProvider wraps data keys with a key held in a KMS
+type KMSKeyProvider struct {
+	client KMSClient
+	mu     sync.RWMutex
+	keyID  string
+}
+
+// NewKMSKeyProvider creates a KeyProvider backed by a KMS key
+func NewKMSKeyProvider(client KMSClient, keyID string) *KMSKeyProvider {
+	return &KMSKeyProvider{client: client, keyID: keyID}
+}
+
+// SetKeyID switches new wraps to another KMS key; data wrapped with the old
+// key stays readable as long as the KMS can still decrypt with it
+func (p *KMSKeyProvider) SetKeyID(keyID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keyID = keyID
+}
+
+// CurrentKeyID returns the KMS key used for new wraps
+func (p *KMSKeyProvider) CurrentKeyID(ctx context.Context) (string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.keyID, nil
+}
+
+// WrapKey encrypts a data key with the current KMS key
+func (p *KMSKeyProvider) WrapKey(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	keyID, _ := p.CurrentKeyID(ctx)
+	wrapped, err := p.client.Encrypt(ctx, keyID, dataKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("kms encrypt failed: %w", err)
+	}
+	return keyID, wrapped, nil
+}
+
+// UnwrapKey decrypts a data key with the KMS
+func (p *KMSKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	dataKey, err := p.client.Decrypt(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("kms decrypt failed: %w", err)
+	}
+	return dataKey, nil
+}
+
+// LocalKMS is an in-process stand-in for a KMS, for development and tests.
+// Keys are created on first use and never leave the process.
+type LocalKMS struct {
+	keyring *Keyring
+}
+
+// NewLocalKMS creates a local KMS stand-in
+func NewLocalKMS() *LocalKMS {
+	return &LocalKMS{keyring: NewKeyring()}
+}
+
+// Encrypt encrypts plaintext with the named key, creating the key if needed
+func (k *LocalKMS) Encrypt(ctx context.Context, keyID string, plaintext []byte) ([]byte, error) {
+	k.keyring.mu.Lock()
+	master, ok := k.keyring.keys[keyID]
+	if !ok {
+		master = make([]byte, 32)
+		if _, err := rand.Read(master); err != nil {
+			k.keyring.mu.Unlock()
+			return nil, err
+		}
+		k.keyring.keys[keyID] = master
+	}
+	k.keyring.mu.Unlock()
+
+	return sealAESGCM(master, plaintext, []byte(keyID))
+}
+
+// Decrypt decrypts ciphertext produced by Encrypt with the same key
+func (k *LocalKMS) Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	return k.keyring.UnwrapKey(ctx, keyID, ciphertext)
+}
+
+// SealedSecret is data encrypted under its own data key, with the data key
+// wrapped by a master key (envelope encryption)
+type SealedSecret struct {
+	KeyID      string `json:"kid"`
+	WrappedKey []byte `json:"wrapped_key"`
+	Ciphertext []byte `json:"ciphertext"` // nonce || AES-GCM ciphertext
+}
+
+// Envelope seals and opens secrets with per-secret data keys
+type Envelope struct {
+	keys KeyProvider
+}
+
+// NewEnvelope creates an envelope cipher using the key provider
+func NewEnvelope(keys KeyProvider) *Envelope {
+	return &Envelope{keys: keys}
+}
+
+// Seal encrypts plaintext under a fresh data key. aad binds the ciphertext to
+// its context (e.g. the storage key) so it cannot be moved to another record.
+func (e *Envelope) Seal(ctx context.Context, plaintext, aad []byte) (*SealedSecret, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	defer clear(dataKey)
+
+	ciphertext, err := sealAESGCM(dataKey, plaintext, aad)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, wrapped, err := e.keys.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SealedSecret{KeyID: keyID, WrappedKey: wrapped, Ciphertext: ciphertext}, nil
+}
+
+// Open decrypts a sealed secret
+func (e *Envelope) Open(ctx context.Context, sealed *SealedSecret, aad []byte) ([]byte, error) {
+	dataKey, err := e.keys.UnwrapKey(ctx, sealed.KeyID, sealed.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(dataKey)
+
+	return openAESGCM(dataKey, sealed.Ciphertext, aad)
+}
+
+// Rewrap re-wraps the data key with the current master key, leaving the
+// ciphertext untouched. It reports whether anything changed.
+func (e *Envelope) Rewrap(ctx context.Context, sealed *SealedSecret) (bool, error) {
+	current, err := e.keys.CurrentKeyID(ctx)
+	if err != nil {
+		return false, err
+	}
+	if sealed.KeyID == current {
+		return false, nil
+	}
+
+	dataKey, err := e.keys.UnwrapKey(ctx, sealed.KeyID, sealed.WrappedKey)
+	if err != nil {
+		return false, err
+	}
+	defer clear(dataKey)
+
+	keyID, wrapped, err := e.keys.WrapKey(ctx, dataKey)
+	if err != nil {
+		return false, err
+	}
+
+	sealed.KeyID = keyID
+	sealed.WrappedKey = wrapped
+	return true, nil
+}
+
+// sealAESGCM encrypts with AES-GCM, prefixing the random nonce
+func sealAESGCM(key, plaintext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// openAESGCM reverses sealAESGCM
+func openAESGCM(key, ciphertext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, ErrDecryptionFailed
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, sealed, aad)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
+
+// keyFingerprint derives a stable, non-secret ID for a master key
+func keyFingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return "mk_" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvelopeSealOpen(t *testing.T) {
+	ctx := context.Background()
+	envelope := NewEnvelope(newTestKeyring(t))
+	plaintext := []byte(`{"access_token": "at_test"}`)
+
+	sealed, err := envelope.Seal(ctx, plaintext, []byte("acme/bank"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed.Ciphertext, plaintext) {
+		t.Fatal("ciphertext contains the plaintext")
+	}
+
+	opened, err := envelope.Open(ctx, sealed, []byte("acme/bank"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Fatalf("got %q, want %q", opened, plaintext)
+	}
+
+	again, err := envelope.Seal(ctx, plaintext, []byte("acme/bank"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again.WrappedKey, sealed.WrappedKey) || bytes.Equal(again.Ciphertext, sealed.Ciphertext) {
+		t.Fatal("two seals shared a data key or ciphertext")
+	}
+}
+
+func TestEnvelopeOpenRejects(t *testing.T) {
+	ctx := context.Background()
+	keys := newTestKeyring(t)
+	envelope := NewEnvelope(keys)
+	sealed, err := envelope.Seal(ctx, []byte("secret"), []byte("acme/bank"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tamper := func(b []byte) []byte {
+		copied := append([]byte(nil), b...)
+		copied[len(copied)-1] ^= 1
+		return copied
+	}
+
+	tests := []struct {
+		name    string
+		sealed  SealedSecret
+		aad     string
+		keys    KeyProvider
+		wantErr error
+	}{
+		{"different AAD", *sealed, "globex/bank", keys, ErrDecryptionFailed},
+		{"tampered ciphertext", SealedSecret{KeyID: sealed.KeyID, WrappedKey: sealed.WrappedKey, Ciphertext: tamper(sealed.Ciphertext)}, "acme/bank", keys, ErrDecryptionFailed},
+		{"tampered wrapped key", SealedSecret{KeyID: sealed.KeyID, WrappedKey: tamper(sealed.WrappedKey), Ciphertext: sealed.Ciphertext}, "acme/bank", keys, ErrDecryptionFailed},
+		{"truncated ciphertext", SealedSecret{KeyID: sealed.KeyID, WrappedKey: sealed.WrappedKey, Ciphertext: sealed.Ciphertext[:4]}, "acme/bank", keys, ErrDecryptionFailed},
+		{"unknown master key", SealedSecret{KeyID: "mk_other", WrappedKey: sealed.WrappedKey, Ciphertext: sealed.Ciphertext}, "acme/bank", keys, ErrUnknownMasterKey},
+		{"different keyring", *sealed, "acme/bank", newTestKeyring(t), ErrDecryptionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewEnvelope(tt.keys).Open(ctx, &tt.sealed, []byte(tt.aad)); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnvelopeRewrap(t *testing.T) {
+	ctx := context.Background()
+	keys := newTestKeyring(t)
+	envelope := NewEnvelope(keys)
+	sealed, err := envelope.Seal(ctx, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKeyID := sealed.KeyID
+	ciphertext := append([]byte(nil), sealed.Ciphertext...)
+
+	if changed, err := envelope.Rewrap(ctx, sealed); err != nil || changed {
+		t.Fatalf("rewrap under the current key: got changed=%v, err=%v, want no change", changed, err)
+	}
+
+	newKeyID, err := keys.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := envelope.Rewrap(ctx, sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || sealed.KeyID != newKeyID {
+		t.Fatalf("got changed=%v under %s, want a rewrap under %s", changed, sealed.KeyID, newKeyID)
+	}
+	if !bytes.Equal(sealed.Ciphertext, ciphertext) {
+		t.Fatal("rewrap re-encrypted the data instead of only the data key")
+	}
+
+	// The old master key is no longer needed
+	if err := keys.Remove(oldKeyID); err != nil {
+		t.Fatal(err)
+	}
+	opened, err := envelope.Open(ctx, sealed, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(opened) != "secret" {
+		t.Fatalf("got %q, want secret", opened)
+	}
+}
+
+func TestKeyringRejectsBadKeys(t *testing.T) {
+	keys := NewKeyring()
+	if _, err := keys.Add("short", make([]byte, 16)); err == nil {
+		t.Fatal("accepted a 16-byte master key")
+	}
+	if _, err := keys.CurrentKeyID(context.Background()); err == nil {
+		t.Fatal("empty keyring reported a current key")
+	}
+	if err := keys.SetCurrent("missing"); !errors.Is(err, ErrUnknownMasterKey) {
+		t.Fatalf("got %v, want ErrUnknownMasterKey", err)
+	}
+
+	keyID, err := keys.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Remove(keyID); err == nil {
+		t.Fatal("removed the current master key")
+	}
+}
+
+func TestKeyProvidersFromConfig(t *testing.T) {
+	encode := func() string {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(key)
+	}
+	newKey, oldKey := encode(), encode()
+
+	t.Setenv("FINTECHKIT_TEST_KEYS", "new:"+newKey+",old:"+oldKey)
+	fromEnv, err := NewEnvKeyProvider("FINTECHKIT_TEST_KEYS")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte("# rotated\nnew:"+newKey+"\n\nold:"+oldKey+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fromFile, err := NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, keys := range map[string]*Keyring{"env": fromEnv, "file": fromFile} {
+		current, err := keys.CurrentKeyID(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current != "new" {
+			t.Fatalf("%s: got current key %s, want the first entry", name, current)
+		}
+		if err := keys.SetCurrent("old"); err != nil {
+			t.Fatalf("%s: older key not kept: %v", name, err)
+		}
+	}
+
+	t.Setenv("FINTECHKIT_TEST_KEYS", "new:not base64")
+	if _, err := NewEnvKeyProvider("FINTECHKIT_TEST_KEYS"); err == nil {
+		t.Fatal("accepted a key that is not base64")
+	}
+}
+
+func TestKMSKeyProvider(t *testing.T) {
+	ctx := context.Background()
+	keys := NewKMSKeyProvider(NewLocalKMS(), "kms_1")
+	envelope := NewEnvelope(keys)
+
+	sealed, err := envelope.Seal(ctx, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.SetKeyID("kms_2")
+	if changed, err := envelope.Rewrap(ctx, sealed); err != nil || !changed {
+		t.Fatalf("got changed=%v, err=%v, want a rewrap under kms_2", changed, err)
+	}
+	if sealed.KeyID != "kms_2" {
+		t.Fatalf("got key %s, want kms_2", sealed.KeyID)
+	}
+	opened, err := envelope.Open(ctx, sealed, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(opened) != "secret" {
+		t.Fatalf("got %q, want secret", opened)
+	}
+}
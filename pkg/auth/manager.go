@@ -5,10 +5,20 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 )
 
+var (
+	// ErrCredentialsNotFound is returned when no credentials are stored for a provider
+	ErrCredentialsNotFound = errors.New("credentials not found")
+	// ErrTokenExpired is returned for OAuth credentials whose access token has expired
+	ErrTokenExpired = errors.New("access token expired, refresh required")
+	// ErrVersionConflict is returned by CompareAndSet when the stored version changed
+	ErrVersionConflict = errors.New("credentials were modified concurrently")
+)
+
 // CredentialType represents the type of credentials being managed
 type CredentialType string
 
@@ -20,19 +30,46 @@ const (
 
 // Credentials represents authentication credentials
 type Credentials struct {
-	Type         CredentialType
-	APIKey       string
-	AccessToken  string
-	RefreshToken string
-	ExpiresAt    time.Time
-	Metadata     map[string]string
+	Type         CredentialType    `json:"type"`
+	APIKey       string            `json:"api_key,omitempty"`
+	AccessToken  string            `json:"access_token,omitempty"`
+	RefreshToken string            `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time         `json:"expires_at,omitzero"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+
+	// IssuedAt is when the key was rotated in or first stored; credential
+	// age for scheduled rotation is measured from it
+	IssuedAt time.Time `json:"issued_at,omitzero"`
+
+	// Previous holds the key replaced by the last rotation while its overlap
+	// window is open
+	Previous *RetiringCredentials `json:"previous,omitempty"`
+}
+
+// RetiringCredentials are credentials replaced by a rotation that remain
+// valid at the provider until ValidUntil, when they are revoked
+type RetiringCredentials struct {
+	Credentials
+	ValidUntil time.Time `json:"valid_until"`
 }
 
-// CredentialStore interface for storing and retrieving credentials
+// CredentialStore interface for storing and retrieving credentials. Keys are
+// CredentialKey strings, so one store holds every tenant's credentials.
 type CredentialStore interface {
-	Get(ctx context.Context, providerID string) (*Credentials, error)
-	Set(ctx context.Context, providerID string, creds *Credentials) error
-	Delete(ctx context.Context, providerID string) error
+	Get(ctx context.Context, key string) (*Credentials, error)
+	Set(ctx context.Context, key string, creds *Credentials) error
+	Delete(ctx context.Context, key string) error
+}
+
+// VersionedCredentialStore is a CredentialStore shared between processes that
+// supports optimistic concurrency. Versions start at 1; version 0 means the
+// credentials do not exist yet.
+type VersionedCredentialStore interface {
+	CredentialStore
+	GetVersioned(ctx context.Context, key string) (*Credentials, int64, error)
+	// CompareAndSet stores creds only if the stored version still equals
+	// expected, returning the new version or ErrVersionConflict
+	CompareAndSet(ctx context.Context, key string, creds *Credentials, expected int64) (int64, error)
 }
 
 // InMemoryStore is a simple in-memory credential store (not for production)
@@ -49,41 +86,54 @@ func NewInMemoryStore() *InMemoryStore {
 }
 
 // Get retrieves credentials for a provider
-func (s *InMemoryStore) Get(ctx context.Context, providerID string) (*Credentials, error) {
+func (s *InMemoryStore) Get(ctx context.Context, key string) (*Credentials, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	creds, ok := s.store[providerID]
+	creds, ok := s.store[key]
 	if !ok {
-		return nil, errors.New("credentials not found")
+		return nil, ErrCredentialsNotFound
 	}
 	return creds, nil
 }
 
 // Set stores credentials for a provider
-func (s *InMemoryStore) Set(ctx context.Context, providerID string, creds *Credentials) error {
+func (s *InMemoryStore) Set(ctx context.Context, key string, creds *Credentials) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.store[providerID] = creds
+	s.store[key] = creds
 	return nil
 }
 
 // Delete removes credentials for a provider
-func (s *InMemoryStore) Delete(ctx context.Context, providerID string) error {
+func (s *InMemoryStore) Delete(ctx context.Context, key string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	delete(s.store, providerID)
+	delete(s.store, key)
 	return nil
 }
 
 // Manager handles credential management for multiple providers
 type Manager struct {
-	store           CredentialStore
-	rotationEnabled bool
+	store            CredentialStore
+	rotationEnabled  bool
 	rotationHandlers map[string]RotationHandler
-	mu              sync.RWMutex
+	keyIssuers       map[string]KeyIssuer
+	refreshers       map[string]RefreshFunc
+	rotationOverlaps map[string]time.Duration
+	history          RotationHistory
+	mu               sync.RWMutex
+
+	refreshes flightGroup
+
+	completions  map[*time.Timer]struct{} // Pending rotation completions
+	closed       bool
+	completionMu sync.Mutex
+
+	subscriptions []*subscription
+	subMu         sync.RWMutex
 }
 
 // RotationHandler is called when credentials are rotated
@@ -95,72 +145,101 @@ func NewManager(store CredentialStore) *Manager {
 		store:            store,
 		rotationEnabled:  false,
 		rotationHandlers: make(map[string]RotationHandler),
+		keyIssuers:       make(map[string]KeyIssuer),
+		refreshers:       make(map[string]RefreshFunc),
+		rotationOverlaps: make(map[string]time.Duration),
+		history:          NewInMemoryRotationHistory(),
+		completions:      make(map[*time.Timer]struct{}),
 	}
 }
 
-// GetCredentials retrieves credentials for a provider
+// GetCredentials retrieves credentials for a provider in the tenant and user
+// scope carried by ctx (see WithTenant and WithUser)
 func (m *Manager) GetCredentials(ctx context.Context, providerID string) (*Credentials, error) {
-	creds, err := m.store.Get(ctx, providerID)
+	_, creds, err := m.lookup(ctx, providerID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Check if OAuth token needs refresh
 	if creds.Type == CredentialTypeOAuth && !creds.ExpiresAt.IsZero() && time.Now().After(creds.ExpiresAt) {
-		return nil, errors.New("access token expired, refresh required")
+		return nil, fmt.Errorf("%s: %w", providerID, ErrTokenExpired)
 	}
 
 	return creds, nil
 }
 
-// SetCredentials stores credentials for a provider
-func (m *Manager) SetCredentials(ctx context.Context, providerID string, creds *Credentials) error {
-	return m.store.Set(ctx, providerID, creds)
+// GetStoredCredentials retrieves credentials for a provider without checking
+// expiry, so that callers able to refresh can still read the refresh token
+func (m *Manager) GetStoredCredentials(ctx context.Context, providerID string) (*Credentials, error) {
+	_, creds, err := m.lookup(ctx, providerID)
+	return creds, err
 }
 
-// RegisterRotationHandler registers a handler for credential rotation
-func (m *Manager) RegisterRotationHandler(providerID string, handler RotationHandler) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.rotationHandlers[providerID] = handler
-}
+// SetCredentials stores credentials for a provider in the scope carried by ctx
+func (m *Manager) SetCredentials(ctx context.Context, providerID string, creds *Credentials) error {
+	if creds.IssuedAt.IsZero() {
+		stamped := *creds
+		stamped.IssuedAt = time.Now()
+		creds = &stamped
+	}
 
-// RotateAPIKey generates a new API key and calls the rotation handler
-func (m *Manager) RotateAPIKey(ctx context.Context, providerID string) error {
-	oldCreds, err := m.store.Get(ctx, providerID)
-	if err != nil {
+	key := KeyFromContext(ctx, providerID).String()
+	if err := m.store.Set(ctx, key, creds); err != nil {
 		return err
 	}
 
-	if oldCreds.Type != CredentialTypeAPIKey {
-		return errors.New("can only rotate API key credentials")
-	}
+	m.publish(ctx, CredentialsUpdated, key, creds)
+	return nil
+}
 
-	// Generate new API key
-	newKey, err := generateAPIKey()
-	if err != nil {
+// DeleteCredentials removes credentials for a provider in the scope carried by ctx
+func (m *Manager) DeleteCredentials(ctx context.Context, providerID string) error {
+	key := KeyFromContext(ctx, providerID).String()
+	if err := m.store.Delete(ctx, key); err != nil {
 		return err
 	}
 
-	newCreds := &Credentials{
-		Type:     CredentialTypeAPIKey,
-		APIKey:   newKey,
-		Metadata: oldCreds.Metadata,
-	}
+	m.publish(ctx, CredentialsDeleted, key, nil)
+	return nil
+}
 
-	// Call rotation handler if registered
-	m.mu.RLock()
-	handler, exists := m.rotationHandlers[providerID]
-	m.mu.RUnlock()
+// lookup finds the credentials for a provider in ctx's scope and the store
+// key they live under. A user without credentials of their own falls back to
+// their tenant's; lookups never cross into another tenant.
+func (m *Manager) lookup(ctx context.Context, providerID string) (string, *Credentials, error) {
+	key := KeyFromContext(ctx, providerID)
+	creds, err := m.store.Get(ctx, key.String())
+	if err == nil {
+		return key.String(), creds, nil
+	}
 
-	if exists {
-		if err := handler(ctx, providerID, oldCreds, newCreds); err != nil {
-			return err
+	if parent, ok := key.parent(); ok && errors.Is(err, ErrCredentialsNotFound) {
+		if creds, perr := m.store.Get(ctx, parent.String()); perr == nil {
+			return parent.String(), creds, nil
 		}
 	}
+	return key.String(), nil, err
+}
+
+// RegisterRotationHandler registers a handler for credential rotation. Handlers
+// are per provider and receive a context scoped to the rotated credentials.
+func (m *Manager) RegisterRotationHandler(providerID string, handler RotationHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rotationHandlers[providerID] = handler
+}
+
+// RotateAPIKey replaces the API key GetCredentials would return for ctx with
+// one from the provider's KeyIssuer, keeping the old key valid for the
+// overlap set with SetRotationOverlap
+func (m *Manager) RotateAPIKey(ctx context.Context, providerID string) error {
+	m.mu.RLock()
+	overlap := m.rotationOverlaps[providerID]
+	m.mu.RUnlock()
 
-	// Store new credentials
-	return m.store.Set(ctx, providerID, newCreds)
+	_, err := m.RotateAPIKeyWithOverlap(ctx, providerID, overlap)
+	return err
 }
 
 // generateAPIKey generates a random API key
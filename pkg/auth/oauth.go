@@ -2,14 +2,29 @@ package auth
 
 import (
 	"context"
+	"crypto"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
 
 	"golang.org/x/oauth2"
 )
 
+// ClientAuthMethod is how the client authenticates to the token endpoint
+type ClientAuthMethod string
+
+const (
+	ClientAuthSecretBasic   ClientAuthMethod = "client_secret_basic" // HTTP Basic (default)
+	ClientAuthSecretPost    ClientAuthMethod = "client_secret_post"  // client_secret in the form body
+	ClientAuthPrivateKeyJWT ClientAuthMethod = "private_key_jwt"     // Signed JWT assertion (RFC 7523)
+	ClientAuthTLS           ClientAuthMethod = "tls_client_auth"     // Mutual TLS (RFC 8705)
+)
+
 // OAuthConfig holds OAuth 2.0 configuration
 type OAuthConfig struct {
 	ClientID     string
@@ -19,63 +34,130 @@ type OAuthConfig struct {
 	AuthURL      string
 	TokenURL     string
 	UsePKCE      bool // Use PKCE for enhanced security
+
+	// Client authentication; defaults to ClientAuthSecretBasic
+	AuthMethod ClientAuthMethod
+
+	// private_key_jwt settings
+	PrivateKey        crypto.Signer
+	KeyID             string // kid header, matching the key registered with the provider
+	SigningAlg        string // Defaults to RS256, ES256 or EdDSA based on the key type
+	AssertionAudience string // Defaults to TokenURL
+
+	// TLSCertificate is presented to the token endpoint; required for tls_client_auth
+	// and usable with any method for mTLS-bound tokens
+	TLSCertificate *tls.Certificate
+
+	HTTPClient *http.Client // Optional base client for token requests
 }
 
 // OAuthManager handles OAuth 2.0 flows
 type OAuthManager struct {
-	config *OAuthConfig
-	oauth  *oauth2.Config
+	config     *OAuthConfig
+	oauth      *oauth2.Config
+	httpClient *http.Client
+
+	appTokens  map[string]*Credentials // Cached client-credentials tokens by scope set
+	appMu      sync.Mutex
+	appFlights flightGroup
 }
 
 // NewOAuthManager creates a new OAuth manager
 func NewOAuthManager(config *OAuthConfig) *OAuthManager {
+	if config.AuthMethod == "" {
+		config.AuthMethod = ClientAuthSecretBasic
+	}
+
+	authStyle := oauth2.AuthStyleInHeader
+	if config.AuthMethod != ClientAuthSecretBasic {
+		authStyle = oauth2.AuthStyleInParams
+	}
+
 	oauth := &oauth2.Config{
 		ClientID:     config.ClientID,
 		ClientSecret: config.ClientSecret,
 		RedirectURL:  config.RedirectURL,
 		Scopes:       config.Scopes,
 		Endpoint: oauth2.Endpoint{
-			AuthURL:  config.AuthURL,
-			TokenURL: config.TokenURL,
+			AuthURL:   config.AuthURL,
+			TokenURL:  config.TokenURL,
+			AuthStyle: authStyle,
 		},
 	}
 
 	return &OAuthManager{
-		config: config,
-		oauth:  oauth,
+		config:     config,
+		oauth:      oauth,
+		httpClient: newTokenHTTPClient(config),
+		appTokens:  make(map[string]*Credentials),
 	}
 }
 
+// PKCE code challenge methods
+const (
+	PKCEMethodS256  = "S256"
+	PKCEMethodPlain = "plain" // Only for servers that do not support S256
+)
+
 // PKCEParams holds PKCE parameters
 type PKCEParams struct {
 	CodeVerifier  string
 	CodeChallenge string
+	Method        string // PKCEMethodS256 or PKCEMethodPlain
 }
 
-// GeneratePKCE generates PKCE parameters
+// GeneratePKCE generates PKCE parameters using the S256 challenge method
 func GeneratePKCE() (*PKCEParams, error) {
 	// Generate random code verifier (43-128 characters)
-	verifierBytes := make([]byte, 32)
-	if _, err := rand.Read(verifierBytes); err != nil {
+	verifier, err := randomToken(32)
+	if err != nil {
 		return nil, fmt.Errorf("failed to generate code verifier: %w", err)
 	}
-	verifier := base64.RawURLEncoding.EncodeToString(verifierBytes)
 
-	// For simplicity, using plain challenge (production should use S256)
 	return &PKCEParams{
 		CodeVerifier:  verifier,
-		CodeChallenge: verifier,
+		CodeChallenge: oauth2.S256ChallengeFromVerifier(verifier),
+		Method:        PKCEMethodS256,
 	}, nil
 }
 
-// GetAuthorizationURL generates the OAuth authorization URL
-func (m *OAuthManager) GetAuthorizationURL(state string, pkce *PKCEParams) string {
-	opts := []oauth2.AuthCodeOption{}
+// GenerateState generates a cryptographically random OAuth state value
+func GenerateState() (string, error) {
+	state, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	return state, nil
+}
 
+// GenerateNonce generates a cryptographically random OpenID Connect nonce
+func GenerateNonce() (string, error) {
+	nonce, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return nonce, nil
+}
+
+// randomToken returns n random bytes encoded as unpadded base64url
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// GetAuthorizationURL generates the OAuth authorization URL
+func (m *OAuthManager) GetAuthorizationURL(state string, pkce *PKCEParams, opts ...oauth2.AuthCodeOption) string {
 	if m.config.UsePKCE && pkce != nil {
+		method := pkce.Method
+		if method == "" {
+			method = PKCEMethodS256
+		}
 		opts = append(opts,
 			oauth2.SetAuthURLParam("code_challenge", pkce.CodeChallenge),
-			oauth2.SetAuthURLParam("code_challenge_method", "plain"),
+			oauth2.SetAuthURLParam("code_challenge_method", method),
 		)
 	}
 
@@ -87,21 +169,43 @@ func (m *OAuthManager) ExchangeCode(ctx context.Context, code string, pkce *PKCE
 	opts := []oauth2.AuthCodeOption{}
 
 	if m.config.UsePKCE && pkce != nil {
-		opts = append(opts, oauth2.SetAuthURLParam("code_verifier", pkce.CodeVerifier))
+		opts = append(opts, oauth2.VerifierOption(pkce.CodeVerifier))
 	}
 
-	token, err := m.oauth.Exchange(ctx, code, opts...)
+	if m.usesCustomClientAuth() {
+		form := url.Values{
+			"grant_type":   {"authorization_code"},
+			"code":         {code},
+			"redirect_uri": {m.config.RedirectURL},
+		}
+		if m.config.UsePKCE && pkce != nil {
+			form.Set("code_verifier", pkce.CodeVerifier)
+		}
+
+		creds, err := m.tokenRequest(ctx, form)
+		if err != nil {
+			return nil, fmt.Errorf("failed to exchange code: %w", err)
+		}
+		return creds, nil
+	}
+
+	token, err := m.oauth.Exchange(m.clientContext(ctx), code, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange code: %w", err)
 	}
 
-	return &Credentials{
+	creds := &Credentials{
 		Type:         CredentialTypeOAuth,
 		AccessToken:  token.AccessToken,
 		RefreshToken: token.RefreshToken,
 		ExpiresAt:    token.Expiry,
 		Metadata:     map[string]string{"token_type": token.TokenType},
-	}, nil
+	}
+	if idToken, ok := token.Extra("id_token").(string); ok && idToken != "" {
+		creds.Metadata["id_token"] = idToken
+	}
+
+	return creds, nil
 }
 
 // RefreshToken refreshes an OAuth access token
@@ -110,11 +214,26 @@ func (m *OAuthManager) RefreshToken(ctx context.Context, refreshToken string) (*
 		return nil, errors.New("refresh token is required")
 	}
 
+	if m.usesCustomClientAuth() {
+		creds, err := m.tokenRequest(ctx, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshToken},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to refresh token: %w", err)
+		}
+		// Providers that don't rotate refresh tokens omit them from the response
+		if creds.RefreshToken == "" {
+			creds.RefreshToken = refreshToken
+		}
+		return creds, nil
+	}
+
 	token := &oauth2.Token{
 		RefreshToken: refreshToken,
 	}
 
-	tokenSource := m.oauth.TokenSource(ctx, token)
+	tokenSource := m.oauth.TokenSource(m.clientContext(ctx), token)
 	newToken, err := tokenSource.Token()
 	if err != nil {
 		return nil, fmt.Errorf("failed to refresh token: %w", err)
@@ -134,6 +253,9 @@ type AutoRefreshMiddleware struct {
 	manager     *OAuthManager
 	credManager *Manager
 	providerID  string
+
+	clientCredentials bool
+	scopes            []string
 }
 
 // NewAutoRefreshMiddleware creates a middleware that auto-refreshes tokens
@@ -145,27 +267,112 @@ func NewAutoRefreshMiddleware(manager *OAuthManager, credManager *Manager, provi
 	}
 }
 
-// GetValidToken ensures a valid access token, refreshing if needed
+// UseClientCredentials makes the middleware obtain application tokens with the
+// client-credentials grant when no usable token is stored, instead of failing
+func (m *AutoRefreshMiddleware) UseClientCredentials(scopes ...string) *AutoRefreshMiddleware {
+	m.clientCredentials = true
+	m.scopes = scopes
+	return m
+}
+
+// GetValidToken ensures a valid access token, refreshing if needed. Expired
+// tokens are refreshed too, and concurrent callers share a single refresh.
 func (m *AutoRefreshMiddleware) GetValidToken(ctx context.Context) (string, error) {
-	creds, err := m.credManager.GetCredentials(ctx, m.providerID)
+	creds, err := m.credManager.GetStoredCredentials(ctx, m.providerID)
 	if err != nil {
-		return "", err
+		if !m.clientCredentials {
+			return "", err
+		}
+		creds = nil
 	}
 
-	// Check if refresh is needed
-	if creds.NeedsRefresh() && creds.RefreshToken != "" {
-		newCreds, err := m.manager.RefreshToken(ctx, creds.RefreshToken)
-		if err != nil {
-			return "", fmt.Errorf("failed to refresh token: %w", err)
+	if creds != nil && !creds.NeedsRefresh() {
+		return creds.AccessToken, nil
+	}
+
+	// Without a way to refresh, a token inside the refresh buffer is still usable
+	if creds != nil && !m.canRefresh(creds) {
+		if creds.IsExpired() {
+			return "", fmt.Errorf("%s: %w", m.providerID, ErrTokenExpired)
 		}
+		return creds.AccessToken, nil
+	}
 
-		// Update stored credentials
-		if err := m.credManager.SetCredentials(ctx, m.providerID, newCreds); err != nil {
-			return "", fmt.Errorf("failed to store refreshed credentials: %w", err)
+	newCreds, err := m.credManager.RefreshCredentials(ctx, m.providerID, creds, m.refresh)
+	if err != nil {
+		return "", err
+	}
+	return newCreds.AccessToken, nil
+}
+
+// ForceRefresh refreshes the credentials after the provider rejected the
+// given token. If another caller already replaced it, the new token is
+// returned without a second refresh.
+func (m *AutoRefreshMiddleware) ForceRefresh(ctx context.Context, rejected string) (string, error) {
+	creds, err := m.credManager.GetStoredCredentials(ctx, m.providerID)
+	if err != nil && !m.clientCredentials {
+		return "", err
+	}
+	if err == nil {
+		if creds.AccessToken != rejected && !creds.NeedsRefresh() {
+			return creds.AccessToken, nil
 		}
+		if !m.canRefresh(creds) {
+			return "", fmt.Errorf("%s: token rejected and no refresh token available", m.providerID)
+		}
+	}
 
-		return newCreds.AccessToken, nil
+	// Mark the rejected token as stale even if its expiry says otherwise
+	stale := &Credentials{AccessToken: rejected}
+	newCreds, err := m.credManager.RefreshCredentials(ctx, m.providerID, stale, m.refresh)
+	if err != nil {
+		return "", err
+	}
+	return newCreds.AccessToken, nil
+}
+
+// RefreshFunc returns the middleware's refresh logic for registering with
+// Manager.RegisterRefresher, so live sources refresh the same way
+func (m *AutoRefreshMiddleware) RefreshFunc() RefreshFunc {
+	return m.refresh
+}
+
+// canRefresh reports whether new credentials can be obtained for creds
+func (m *AutoRefreshMiddleware) canRefresh(creds *Credentials) bool {
+	return creds.RefreshToken != "" || m.isApplicationToken(creds)
+}
+
+func (m *AutoRefreshMiddleware) isApplicationToken(creds *Credentials) bool {
+	return m.clientCredentials || creds.Metadata[MetadataGrantType] == GrantTypeClientCredentials
+}
+
+// refresh is the RefreshFunc run under the Manager's single-flight
+func (m *AutoRefreshMiddleware) refresh(ctx context.Context, current *Credentials) (*Credentials, error) {
+	// Application tokens have no refresh token; request a new one instead
+	if current == nil || (current.RefreshToken == "" && m.isApplicationToken(current)) {
+		return m.manager.ClientCredentialsToken(ctx, m.scopes...)
 	}
 
-	return creds.AccessToken, nil
+	if current.RefreshToken == "" {
+		return nil, fmt.Errorf("%s: %w", m.providerID, ErrTokenExpired)
+	}
+
+	newCreds, err := m.manager.RefreshToken(ctx, current.RefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+
+	// Keep metadata the token endpoint doesn't echo back (user IDs, scopes)
+	for k, v := range current.Metadata {
+		if _, ok := newCreds.Metadata[k]; !ok {
+			newCreds.Metadata[k] = v
+		}
+	}
+	return newCreds, nil
+}
+
+// Transport returns an http.RoundTripper that authorizes requests with this
+// middleware's tokens
+func (m *AutoRefreshMiddleware) Transport(base http.RoundTripper) *Transport {
+	return NewTransport(m, base)
 }
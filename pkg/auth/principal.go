@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+// AuthMethod is how a principal authenticated
+type AuthMethod string
+
+const (
+	AuthMethodAPIKey        AuthMethod = "api_key"
+	AuthMethodJWT           AuthMethod = "jwt"
+	AuthMethodIntrospection AuthMethod = "introspection"
+)
+
+// Principal is the authenticated caller of this service's API
+type Principal struct {
+	ID       string // API key ID or token subject
+	Method   AuthMethod
+	TenantID string
+	UserID   string
+	Scopes   []string
+	Roles    []string
+	Claims   map[string]any // Token claims, for bearer token principals
+}
+
+// HasScope reports whether the principal was granted a scope
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// HasScopes reports whether the principal was granted every listed scope
+func (p *Principal) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !p.HasScope(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+type principalContextKey struct{}
+
+// WithPrincipal returns a context carrying the authenticated principal and
+// scoped to its tenant and user
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	ctx = context.WithValue(ctx, principalContextKey{}, p)
+	if p.TenantID != "" {
+		ctx = WithTenant(ctx, p.TenantID)
+	}
+	if p.UserID != "" {
+		ctx = WithUser(ctx, p.UserID)
+	}
+	return ctx
+}
+
+// PrincipalFromContext returns the principal carried by ctx, if any
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return p, ok && p != nil
+}
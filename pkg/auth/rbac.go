@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrForbidden is returned when a principal is not allowed to do something
+var ErrForbidden = errors.New("forbidden")
+
+// Permission names an action, as "<resource>:<action>"
+type Permission string
+
+// Permissions for the payment and banking API surface
+const (
+	PermPaymentsCreate Permission = "payments:create"
+	PermPaymentsRead   Permission = "payments:read"
+	PermPaymentsRefund Permission = "payments:refund"
+	PermRefundLarge    Permission = "refund:large"
+	PermBankingRead    Permission = "banking:read"
+
+	// PermTenantsAny lets a principal without a tenant act on any tenant's
+	// resources, for platform operators
+	PermTenantsAny Permission = "tenants:*"
+)
+
+// UnknownAmount is passed to AuthorizeAmount when a request does not state
+// the amount it acts on, such as a refund of the full payment. Every amount
+// limit on the permission then applies.
+const UnknownAmount int64 = -1
+
+// AmountLimit requires an extra permission for amounts above a threshold,
+// e.g. refunds over 1000.00 need PermRefundLarge
+type AmountLimit struct {
+	Permission Permission // The action being limited, e.g. PermPaymentsRefund
+	Currency   string     // Empty to apply to every currency
+	Threshold  int64      // In minor units; amounts above it need Requires
+	Requires   Permission
+}
+
+// Policy maps roles and token scopes to permissions and decides what a
+// principal may do. A principal holds the permissions of its roles and of
+// the scopes defined with DefineScope; other scopes grant nothing.
+// Permissions may use a wildcard action ("payments:*") or "*" for everything.
+type Policy struct {
+	mu     sync.RWMutex
+	roles  map[string][]Permission
+	scopes map[string][]Permission
+	limits []AmountLimit
+}
+
+// NewPolicy creates an empty policy
+func NewPolicy() *Policy {
+	return &Policy{
+		roles:  make(map[string][]Permission),
+		scopes: make(map[string][]Permission),
+	}
+}
+
+// DefaultPolicy returns a policy with viewer, operator and admin roles for
+// the payment API, and a scope for each of its permissions except
+// PermTenantsAny
+func DefaultPolicy() *Policy {
+	p := NewPolicy()
+	p.DefineRole("viewer", PermPaymentsRead, PermBankingRead)
+	p.DefineRole("operator", PermPaymentsRead, PermBankingRead, PermPaymentsCreate, PermPaymentsRefund)
+	p.DefineRole("admin", "payments:*", "refund:*", "banking:*")
+	for _, permission := range []Permission{PermPaymentsCreate, PermPaymentsRead, PermPaymentsRefund, PermRefundLarge, PermBankingRead} {
+		p.DefineScope(string(permission), permission)
+	}
+	return p
+}
+
+// DefineRole sets the permissions granted by a role
+func (p *Policy) DefineRole(role string, permissions ...Permission) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.roles[role] = append([]Permission(nil), permissions...)
+}
+
+// DefineScope sets the permissions granted by a token or API key scope.
+// Scopes are issued outside the policy, so they map to permissions only
+// through this allowlist.
+func (p *Policy) DefineScope(scope string, permissions ...Permission) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.scopes[scope] = append([]Permission(nil), permissions...)
+}
+
+// AddAmountLimit adds an amount-based constraint
+func (p *Policy) AddAmountLimit(limit AmountLimit) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.limits = append(p.limits, limit)
+}
+
+// Allowed reports whether the principal holds a permission
+func (p *Policy) Allowed(principal *Principal, permission Permission) bool {
+	if principal == nil {
+		return false
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, scope := range principal.Scopes {
+		if grants(p.scopes[scope], permission) {
+			return true
+		}
+	}
+	for _, role := range principal.Roles {
+		if grants(p.roles[role], permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// grants reports whether any granted permission covers a required one
+func grants(granted []Permission, required Permission) bool {
+	for _, g := range granted {
+		if permissionMatches(g, required) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize returns ErrForbidden unless the principal holds every permission
+func (p *Policy) Authorize(principal *Principal, permissions ...Permission) error {
+	for _, permission := range permissions {
+		if !p.Allowed(principal, permission) {
+			return fmt.Errorf("%w: missing permission %s", ErrForbidden, permission)
+		}
+	}
+	return nil
+}
+
+// AuthorizeAmount authorizes an action on an amount, applying any amount
+// limits configured for the permission. amount is UnknownAmount when the
+// request does not state one, and currency is empty when it does not name
+// one; limits are applied rather than skipped for whatever is unknown.
+func (p *Policy) AuthorizeAmount(principal *Principal, permission Permission, amount int64, currency string) error {
+	if err := p.Authorize(principal, permission); err != nil {
+		return err
+	}
+
+	p.mu.RLock()
+	limits := append([]AmountLimit(nil), p.limits...)
+	p.mu.RUnlock()
+
+	for _, limit := range limits {
+		if limit.Permission != permission || (amount >= 0 && amount <= limit.Threshold) {
+			continue
+		}
+		if limit.Currency != "" && currency != "" && !strings.EqualFold(limit.Currency, currency) {
+			continue
+		}
+		if !p.Allowed(principal, limit.Requires) {
+			return fmt.Errorf("%w: amounts above %d need permission %s", ErrForbidden, limit.Threshold, limit.Requires)
+		}
+	}
+	return nil
+}
+
+// AuthorizeTenant checks that a principal may act on a resource owned by
+// tenantID. Principals belonging to a tenant only reach that tenant's
+// resources; principals without one need PermTenantsAny.
+func (p *Policy) AuthorizeTenant(principal *Principal, tenantID string) error {
+	if principal == nil {
+		return ErrForbidden
+	}
+	if principal.TenantID != "" {
+		if principal.TenantID != tenantID {
+			return fmt.Errorf("%w: resource belongs to another tenant", ErrForbidden)
+		}
+		return nil
+	}
+	if tenantID != "" && !p.Allowed(principal, PermTenantsAny) {
+		return fmt.Errorf("%w: resource belongs to a tenant", ErrForbidden)
+	}
+	return nil
+}
+
+// permissionMatches reports whether a granted permission covers a required one
+func permissionMatches(granted, required Permission) bool {
+	if granted == "*" || granted == required {
+		return true
+	}
+	resource, action, ok := strings.Cut(string(granted), ":")
+	if !ok || action != "*" {
+		return false
+	}
+	return strings.HasPrefix(string(required), resource+":")
+}
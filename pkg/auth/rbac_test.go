@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPolicyGrantsOnlyDefinedScopes(t *testing.T) {
+	policy := DefaultPolicy()
+
+	wildcard := &Principal{Scopes: []string{"*", "tenants:*"}}
+	if policy.Allowed(wildcard, PermTenantsAny) || policy.Allowed(wildcard, PermPaymentsCreate) {
+		t.Fatal("undefined scopes granted permissions")
+	}
+
+	reader := &Principal{Scopes: []string{string(PermPaymentsRead)}}
+	if !policy.Allowed(reader, PermPaymentsRead) {
+		t.Fatal("payments:read scope does not grant payments:read")
+	}
+	if policy.Allowed(reader, PermPaymentsRefund) {
+		t.Fatal("payments:read scope grants payments:refund")
+	}
+}
+
+func TestPolicyAmountLimitsApplyToUnknownAmountAndCurrency(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.AddAmountLimit(AmountLimit{
+		Permission: PermPaymentsRefund,
+		Currency:   "USD",
+		Threshold:  100000,
+		Requires:   PermRefundLarge,
+	})
+	operator := &Principal{Roles: []string{"operator"}}
+
+	tests := []struct {
+		name     string
+		amount   int64
+		currency string
+		allowed  bool
+	}{
+		{"small", 5000, "USD", true},
+		{"large", 500000, "USD", false},
+		{"large in another currency", 500000, "EUR", true},
+		{"large without currency", 500000, "", false},
+		{"full refund", UnknownAmount, "USD", false},
+		{"full refund without currency", UnknownAmount, "", false},
+	}
+	for _, tt := range tests {
+		err := policy.AuthorizeAmount(operator, PermPaymentsRefund, tt.amount, tt.currency)
+		if allowed := err == nil; allowed != tt.allowed {
+			t.Errorf("%s: got error %v, want allowed=%v", tt.name, err, tt.allowed)
+		}
+		if err != nil && !errors.Is(err, ErrForbidden) {
+			t.Errorf("%s: got %v, want ErrForbidden", tt.name, err)
+		}
+	}
+
+	admin := &Principal{Roles: []string{"admin"}}
+	if err := policy.AuthorizeAmount(admin, PermPaymentsRefund, UnknownAmount, ""); err != nil {
+		t.Fatalf("admin full refund: %v", err)
+	}
+}
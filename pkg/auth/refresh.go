@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// refreshTimeout bounds a shared refresh so one slow token endpoint call
+// cannot hold up every waiting caller indefinitely
+const refreshTimeout = 30 * time.Second
+
+// RefreshFunc exchanges the currently stored credentials for fresh ones.
+// current is nil when nothing is stored yet.
+type RefreshFunc func(ctx context.Context, current *Credentials) (*Credentials, error)
+
+// flightGroup collapses concurrent calls with the same key into one
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done  chan struct{}
+	creds *Credentials
+	err   error
+}
+
+// do runs fn once per key at a time; callers arriving while it runs wait for
+// and share its result. Waiters give up when their own context is done.
+func (g *flightGroup) do(ctx context.Context, key string, fn func() (*Credentials, error)) (*Credentials, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.creds, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.creds, call.err = fn()
+	return call.creds, call.err
+}
+
+// RegisterRefresher registers how a provider's OAuth tokens are refreshed.
+// Live sources (see LiveSource) use it to replace tokens that are about to
+// expire instead of failing with ErrTokenExpired.
+func (m *Manager) RegisterRefresher(providerID string, refresh RefreshFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refreshers[providerID] = refresh
+}
+
+// Refreshable reports whether a refresher is registered for a provider
+func (m *Manager) Refreshable(providerID string) bool {
+	return m.refresher(providerID) != nil
+}
+
+func (m *Manager) refresher(providerID string) RefreshFunc {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.refreshers[providerID]
+}
+
+// RefreshCredentials refreshes a provider's credentials, running at most one
+// refresh per credential key (provider, tenant and user) at a time. stale is the copy the caller found unusable;
+// if the stored credentials have already been replaced by a fresh copy the
+// refresh is skipped and the stored copy returned. This matters for providers
+// that rotate refresh tokens, where a second refresh with the same token fails.
+//
+// With a VersionedCredentialStore the result is written with compare-and-swap,
+// so when replicas race the first write wins and the others adopt it.
+func (m *Manager) RefreshCredentials(ctx context.Context, providerID string, stale *Credentials, refresh RefreshFunc) (*Credentials, error) {
+	key, _, _ := m.lookup(ctx, providerID)
+
+	return m.refreshes.do(ctx, key, func() (*Credentials, error) {
+		// Detach from the first caller's cancellation; others share this result
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+		defer cancel()
+
+		versioned, isVersioned := m.store.(VersionedCredentialStore)
+
+		var current *Credentials
+		var version int64
+		var err error
+		if isVersioned {
+			current, version, err = versioned.GetVersioned(ctx, key)
+		} else {
+			current, err = m.store.Get(ctx, key)
+		}
+		if err != nil {
+			current, version = nil, 0
+		}
+		if replaced(current, stale) {
+			return current, nil
+		}
+
+		fresh, err := refresh(ctx, current)
+		if err != nil {
+			// Another replica may have refreshed first and rotated the refresh
+			// token; give its write a moment to land before failing
+			if isVersioned {
+				if latest := m.awaitReplacement(ctx, key, current); latest != nil {
+					m.publish(ctx, CredentialsRefreshed, key, latest)
+					return latest, nil
+				}
+			}
+			return nil, err
+		}
+
+		if !isVersioned {
+			if err := m.store.Set(ctx, key, fresh); err != nil {
+				return nil, fmt.Errorf("failed to store refreshed credentials: %w", err)
+			}
+			m.publish(ctx, CredentialsRefreshed, key, fresh)
+			return fresh, nil
+		}
+
+		if _, err := versioned.CompareAndSet(ctx, key, fresh, version); err != nil {
+			if errors.Is(err, ErrVersionConflict) {
+				if latest, lerr := m.store.Get(ctx, key); lerr == nil && replaced(latest, current) {
+					m.publish(ctx, CredentialsRefreshed, key, latest)
+					return latest, nil
+				}
+			}
+			return nil, fmt.Errorf("failed to store refreshed credentials: %w", err)
+		}
+		m.publish(ctx, CredentialsRefreshed, key, fresh)
+		return fresh, nil
+	})
+}
+
+// awaitReplacement polls briefly for credentials written by another replica
+func (m *Manager) awaitReplacement(ctx context.Context, key string, current *Credentials) *Credentials {
+	for _, wait := range []time.Duration{0, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond} {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil
+		}
+		if latest, err := m.store.Get(ctx, key); err == nil && replaced(latest, current) {
+			return latest
+		}
+	}
+	return nil
+}
+
+// replaced reports whether current is a usable copy different from stale
+func replaced(current, stale *Credentials) bool {
+	if current == nil || current.NeedsRefresh() {
+		return false
+	}
+	return stale == nil || current.AccessToken != stale.AccessToken
+}
+
+// TokenSource supplies bearer tokens to a Transport
+type TokenSource interface {
+	// GetValidToken returns a usable access token, refreshing if needed
+	GetValidToken(ctx context.Context) (string, error)
+	// ForceRefresh replaces a token the server rejected and returns the new one
+	ForceRefresh(ctx context.Context, rejected string) (string, error)
+}
+
+// Transport is an http.RoundTripper that authorizes requests with a bearer
+// token from a TokenSource. When the server answers 401 the token is
+// refreshed and the request retried once.
+type Transport struct {
+	Source TokenSource
+	Base   http.RoundTripper // Defaults to http.DefaultTransport
+}
+
+// NewTransport creates a bearer token transport
+func NewTransport(source TokenSource, base http.RoundTripper) *Transport {
+	return &Transport{Source: source, Base: base}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ctx := req.Context()
+	token, err := t.Source.GetValidToken(ctx)
+	if err != nil {
+		closeRequestBody(req)
+		return nil, fmt.Errorf("failed to obtain access token: %w", err)
+	}
+
+	resp, err := base.RoundTrip(authorize(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// A consumed body can only be resent if the request knows how to rebuild it
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	fresh, err := t.Source.ForceRefresh(ctx, token)
+	if err != nil || fresh == token {
+		return resp, nil
+	}
+
+	retry := authorize(req, fresh)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+
+	return base.RoundTrip(retry)
+}
+
+// authorize clones a request with the bearer token set; RoundTrippers must
+// not modify the caller's request
+func authorize(req *http.Request, token string) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Header.Set("Authorization", "Bearer "+token)
+	return clone
+}
+
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
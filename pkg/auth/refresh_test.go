@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestTransport returns an HTTP client authorizing requests with tokens
+// for "bank" stored as stored, refreshed against a token endpoint that
+// counts refreshes and issues at_1, at_2, ...
+func newTestTransport(t *testing.T, stored *Credentials, refreshes *atomic.Int32) *http.Client {
+	t.Helper()
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "refresh_token" {
+			http.Error(w, "unsupported grant", http.StatusBadRequest)
+			return
+		}
+		n := refreshes.Add(1)
+		time.Sleep(10 * time.Millisecond) // Keep the refresh in flight while others arrive
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  fmt.Sprintf("at_%d", n),
+			"refresh_token": fmt.Sprintf("rt_%d", n),
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	}))
+	t.Cleanup(tokens.Close)
+
+	ctx := context.Background()
+	manager := NewManager(NewInMemoryStore())
+	if err := manager.SetCredentials(ctx, "bank", stored); err != nil {
+		t.Fatal(err)
+	}
+	oauth := NewOAuthManager(&OAuthConfig{ClientID: "client_1", ClientSecret: "secret_1", TokenURL: tokens.URL})
+	source := NewAutoRefreshMiddleware(oauth, manager, "bank")
+	return &http.Client{Transport: NewTransport(source, nil)}
+}
+
+func TestTransportRefreshesExpiredTokenOnce(t *testing.T) {
+	var refreshes atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer at_1" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer api.Close()
+	client := newTestTransport(t, &Credentials{
+		Type:         CredentialTypeOAuth,
+		AccessToken:  "at_old",
+		RefreshToken: "rt_old",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+	}, &refreshes)
+
+	var wg sync.WaitGroup
+	statuses := make([]int, 10)
+	for i := range statuses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(api.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			statuses[i] = resp.StatusCode
+		}()
+	}
+	wg.Wait()
+
+	for i, status := range statuses {
+		if status != http.StatusOK {
+			t.Fatalf("request %d: got status %d, want 200", i, status)
+		}
+	}
+	if got := refreshes.Load(); got != 1 {
+		t.Fatalf("got %d refreshes, want 1", got)
+	}
+}
+
+func TestTransportRetriesOnceOnUnauthorized(t *testing.T) {
+	valid := &Credentials{
+		Type:         CredentialTypeOAuth,
+		AccessToken:  "at_revoked",
+		RefreshToken: "rt_old",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}
+
+	tests := []struct {
+		name          string
+		accept        string // Token the API accepts
+		body          func() io.Reader
+		wantStatus    int
+		wantCalls     int32
+		wantRefreshes int32
+	}{
+		{"rebuildable body", "at_1", func() io.Reader { return strings.NewReader(`{"amount": 500}`) }, http.StatusOK, 2, 1},
+		{"still rejected", "none", func() io.Reader { return strings.NewReader(`{"amount": 500}`) }, http.StatusUnauthorized, 2, 1},
+		{"body cannot be resent", "at_1", func() io.Reader { return io.LimitReader(strings.NewReader(`{"amount": 500}`), 1<<10) }, http.StatusUnauthorized, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls, refreshes atomic.Int32
+			api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				body, _ := io.ReadAll(r.Body)
+				if r.Header.Get("Authorization") != "Bearer "+tt.accept {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				if string(body) != `{"amount": 500}` {
+					w.WriteHeader(http.StatusBadRequest)
+				}
+			}))
+			defer api.Close()
+			stored := *valid
+			client := newTestTransport(t, &stored, &refreshes)
+
+			resp, err := client.Post(api.URL, "application/json", tt.body())
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Fatalf("got %d API calls, want %d", got, tt.wantCalls)
+			}
+			if got := refreshes.Load(); got != tt.wantRefreshes {
+				t.Fatalf("got %d refreshes, want %d", got, tt.wantRefreshes)
+			}
+		})
+	}
+}
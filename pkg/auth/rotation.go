@@ -3,88 +3,323 @@ package auth
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/logging"
 )
 
+// rotationRetryDelay is how long the scheduler waits after a failed rotation
+// before trying again
+const rotationRetryDelay = time.Minute
+
 // RotationPolicy defines when and how credentials should be rotated
 type RotationPolicy struct {
 	Enabled         bool
-	RotationPeriod  time.Duration
+	RotationPeriod  time.Duration // Maximum age of a key before it is rotated
 	OverlapDuration time.Duration // Time both old and new credentials are valid
+	Jitter          time.Duration // Random delay of up to this much added to each rotation
+}
+
+// RotationStatus reports the schedule and last outcome for one set of credentials
+type RotationStatus struct {
+	Key          CredentialKey
+	Enabled      bool
+	LastRotation time.Time // When the current key was issued or stored
+	NextDue      time.Time // Zero until the first check after the policy is added
+	LastError    string
+	LastErrorAt  time.Time
 }
 
-// RotationScheduler handles scheduled credential rotation
+// RotationScheduler rotates credentials once they reach their policy's
+// rotation period. Age is measured from Credentials.IssuedAt, so restarts do
+// not postpone rotation and replicas sharing a store do not rotate twice.
+// Policies may be added and removed while the scheduler is running.
 type RotationScheduler struct {
-	manager  *Manager
-	policies map[string]*RotationPolicy
-	stopChan chan struct{}
-	wg       sync.WaitGroup
-	mu       sync.RWMutex
+	manager *Manager
+	logger  *slog.Logger
+
+	mu      sync.Mutex
+	entries map[CredentialKey]*scheduledRotation
+	ctx     context.Context // Set while running
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+type scheduledRotation struct {
+	policy RotationPolicy
+	cancel context.CancelFunc // Stops this entry's worker
+	status RotationStatus
 }
 
 // NewRotationScheduler creates a new rotation scheduler
 func NewRotationScheduler(manager *Manager) *RotationScheduler {
 	return &RotationScheduler{
-		manager:  manager,
-		policies: make(map[string]*RotationPolicy),
-		stopChan: make(chan struct{}),
+		manager: manager,
+		entries: make(map[CredentialKey]*scheduledRotation),
+	}
+}
+
+// SetLogger sets the logger used to report rotations. By default the
+// scheduler logs to logging.Logger().
+func (s *RotationScheduler) SetLogger(logger *slog.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logger = logger
+}
+
+// AddPolicy adds or replaces the rotation policy for a provider's credentials
+// in the tenant and user scope carried by ctx. If the scheduler is running
+// the new policy takes effect immediately.
+func (s *RotationScheduler) AddPolicy(ctx context.Context, providerID string, policy *RotationPolicy) {
+	key := KeyFromContext(ctx, providerID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &scheduledRotation{
+		policy: *policy,
+		status: RotationStatus{Key: key, Enabled: policy.Enabled},
+	}
+	if previous, ok := s.entries[key]; ok {
+		s.stopEntry(previous)
+		entry.status.LastRotation = previous.status.LastRotation
+		entry.status.LastError = previous.status.LastError
+		entry.status.LastErrorAt = previous.status.LastErrorAt
+	}
+	s.entries[key] = entry
+
+	if s.ctx != nil {
+		s.startEntry(key, entry)
 	}
 }
 
-// AddPolicy adds a rotation policy for a provider
-func (s *RotationScheduler) AddPolicy(providerID string, policy *RotationPolicy) {
+// RemovePolicy stops rotating a provider's credentials in ctx's scope
+func (s *RotationScheduler) RemovePolicy(ctx context.Context, providerID string) {
+	key := KeyFromContext(ctx, providerID)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.policies[providerID] = policy
+
+	if entry, ok := s.entries[key]; ok {
+		s.stopEntry(entry)
+		delete(s.entries, key)
+	}
 }
 
-// Start starts the rotation scheduler
+// Start starts a worker for every enabled policy. Calling Start on a running
+// scheduler does nothing.
 func (s *RotationScheduler) Start(ctx context.Context) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	for providerID, policy := range s.policies {
-		if !policy.Enabled {
-			continue
-		}
+	if s.ctx != nil {
+		return
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
 
-		s.wg.Add(1)
-		go s.rotationWorker(ctx, providerID, policy)
+	for key, entry := range s.entries {
+		s.startEntry(key, entry)
 	}
 }
 
-// Stop stops the rotation scheduler
+// Stop stops all workers and waits for in-flight rotations to finish. It is
+// safe to call more than once, and the scheduler can be started again.
 func (s *RotationScheduler) Stop() {
-	close(s.stopChan)
+	s.mu.Lock()
+	if s.ctx != nil {
+		s.cancel()
+		s.ctx, s.cancel = nil, nil
+		for _, entry := range s.entries {
+			entry.cancel = nil
+		}
+	}
+	s.mu.Unlock()
+
 	s.wg.Wait()
 }
 
-// rotationWorker runs the rotation task for a specific provider
-func (s *RotationScheduler) rotationWorker(ctx context.Context, providerID string, policy *RotationPolicy) {
+// Status returns the rotation status of every policy, ordered by key
+func (s *RotationScheduler) Status() []RotationStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]RotationStatus, 0, len(s.entries))
+	for _, entry := range s.entries {
+		statuses = append(statuses, entry.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Key.String() < statuses[j].Key.String()
+	})
+	return statuses
+}
+
+// StatusFor returns the rotation status for a provider in ctx's scope
+func (s *RotationScheduler) StatusFor(ctx context.Context, providerID string) (RotationStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[KeyFromContext(ctx, providerID)]
+	if !ok {
+		return RotationStatus{}, false
+	}
+	return entry.status, true
+}
+
+// startEntry launches the worker for an entry. Callers hold s.mu.
+func (s *RotationScheduler) startEntry(key CredentialKey, entry *scheduledRotation) {
+	if !entry.policy.Enabled || entry.policy.RotationPeriod <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	entry.cancel = cancel
+
+	s.wg.Add(1)
+	go s.rotationWorker(key.Context(ctx), key, entry)
+}
+
+// stopEntry cancels an entry's worker, if running. Callers hold s.mu.
+func (s *RotationScheduler) stopEntry(entry *scheduledRotation) {
+	if entry.cancel != nil {
+		entry.cancel()
+		entry.cancel = nil
+	}
+}
+
+// rotationWorker waits until the credentials are due and rotates them
+func (s *RotationScheduler) rotationWorker(ctx context.Context, key CredentialKey, entry *scheduledRotation) {
 	defer s.wg.Done()
 
-	ticker := time.NewTicker(policy.RotationPeriod)
-	defer ticker.Stop()
+	policy := entry.policy
+	firstSeen := time.Now()
+	var retryAt time.Time
 
 	for {
+		// Finish rotations whose overlap ended while we were not running
+		if err := s.manager.CompleteRotation(ctx, key.ProviderID); err != nil && ctx.Err() == nil {
+			s.recordError(key, entry, err)
+		}
+
+		due, issuedAt, err := s.nextDue(ctx, key, policy, firstSeen)
+		if err != nil {
+			s.recordError(key, entry, err)
+			due = time.Now().Add(rotationRetryDelay)
+		}
+		if due.Before(retryAt) {
+			due = retryAt
+		}
+		s.update(entry, func(status *RotationStatus) {
+			status.NextDue = due
+			if !issuedAt.IsZero() {
+				status.LastRotation = issuedAt
+			}
+		})
+
+		timer := time.NewTimer(time.Until(due))
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			return
-		case <-s.stopChan:
-			return
-		case <-ticker.C:
-			if err := s.rotateCredentials(ctx, providerID); err != nil {
-				// In production, this should be logged to an error tracking system
-				fmt.Printf("Failed to rotate credentials for provider %s: %v\n", providerID, err)
+		case <-timer.C:
+		}
+
+		// Another replica may have rotated while we slept
+		if current, _, err := s.nextDue(ctx, key, policy, firstSeen); err == nil && time.Now().Before(current) {
+			continue
+		}
+
+		record, err := s.rotateCredentials(ctx, key.ProviderID, &policy)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
 			}
+			s.recordError(key, entry, err)
+			retryAt = time.Now().Add(min(rotationRetryDelay, policy.RotationPeriod))
+			continue
 		}
+
+		retryAt = time.Time{}
+		s.log().InfoContext(ctx, "credentials rotated",
+			"key", key.String(),
+			"overlap_until", record.OverlapUntil,
+		)
+		s.update(entry, func(status *RotationStatus) {
+			status.LastRotation = record.RotatedAt
+			status.LastError = ""
+			status.LastErrorAt = time.Time{}
+		})
 	}
 }
 
-// rotateCredentials performs the credential rotation
-func (s *RotationScheduler) rotateCredentials(ctx context.Context, providerID string) error {
-	return s.manager.RotateAPIKey(ctx, providerID)
+// nextDue computes when credentials are next due for rotation: their age
+// reaching the rotation period plus jitter, and never inside an open overlap
+// window. Credentials stored without IssuedAt are aged from firstSeen.
+func (s *RotationScheduler) nextDue(ctx context.Context, key CredentialKey, policy RotationPolicy, firstSeen time.Time) (time.Time, time.Time, error) {
+	creds, err := s.manager.GetStoredCredentials(ctx, key.ProviderID)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	issuedAt := creds.IssuedAt
+	if issuedAt.IsZero() {
+		issuedAt = firstSeen
+	}
+
+	due := issuedAt.Add(policy.RotationPeriod).Add(rotationJitter(key, issuedAt, policy.Jitter))
+	if creds.Previous != nil && creds.Previous.ValidUntil.After(due) {
+		due = creds.Previous.ValidUntil
+	}
+	return due, creds.IssuedAt, nil
+}
+
+// rotateCredentials performs the credential rotation, first revoking the key
+// from the previous rotation if its overlap window has ended
+func (s *RotationScheduler) rotateCredentials(ctx context.Context, providerID string, policy *RotationPolicy) (*RotationRecord, error) {
+	if err := s.manager.CompleteRotation(ctx, providerID); err != nil {
+		return nil, err
+	}
+	return s.manager.RotateAPIKeyWithOverlap(ctx, providerID, policy.OverlapDuration)
+}
+
+// recordError logs a failed check or rotation and saves it in the status
+func (s *RotationScheduler) recordError(key CredentialKey, entry *scheduledRotation, err error) {
+	s.mu.Lock()
+	entry.status.LastError = err.Error()
+	entry.status.LastErrorAt = time.Now()
+	s.mu.Unlock()
+
+	s.log().Error("credential rotation failed", "key", key.String(), "error", err)
+}
+
+func (s *RotationScheduler) log() *slog.Logger {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return logging.OrDefault(s.logger)
+}
+
+// update modifies an entry's status under the scheduler lock
+func (s *RotationScheduler) update(entry *scheduledRotation, fn func(status *RotationStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&entry.status)
+}
+
+// rotationJitter returns a delay in [0, spread) derived from the key and the
+// credentials' issue time. It stays the same across checks and replicas for
+// the same key, so every replica agrees on when a key is due, while
+// different tenants' keys are spread out.
+func rotationJitter(key CredentialKey, issuedAt time.Time, spread time.Duration) time.Duration {
+	if spread <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key.String()))
+	h.Write([]byte(issuedAt.UTC().Format(time.RFC3339Nano)))
+	return time.Duration(h.Sum64() % uint64(spread))
 }
 
 // GracefulRotationHandler provides graceful credential rotation with overlap
@@ -101,7 +336,15 @@ func NewGracefulRotationHandler(overlapDuration time.Duration, onRotate func(pro
 	}
 }
 
-// Handle implements the RotationHandler interface
+// Register installs the handler for a provider and sets the provider's
+// rotation overlap, so RotateAPIKey keeps the old key valid for that long
+func (h *GracefulRotationHandler) Register(manager *Manager, providerID string) {
+	manager.RegisterRotationHandler(providerID, h.Handle)
+	manager.SetRotationOverlap(providerID, h.overlapDuration)
+}
+
+// Handle implements the RotationHandler interface. It runs before the new
+// key is stored; returning an error aborts the rotation and revokes the new key.
 func (h *GracefulRotationHandler) Handle(ctx context.Context, providerID string, oldCreds, newCreds *Credentials) error {
 	// Notify external system of new credentials
 	if h.onRotate != nil {
@@ -109,13 +352,6 @@ func (h *GracefulRotationHandler) Handle(ctx context.Context, providerID string,
 			return fmt.Errorf("rotation callback failed: %w", err)
 		}
 	}
-
-	// In a production system, you might:
-	// 1. Store both old and new credentials temporarily
-	// 2. Schedule deletion of old credentials after overlap period
-	// 3. Update all services to use new credentials
-	// 4. Monitor for any services still using old credentials
-
 	return nil
 }
 
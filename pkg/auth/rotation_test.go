@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// storedKey returns the API key currently stored for a provider
+func storedKey(t *testing.T, manager *Manager, ctx context.Context, providerID string) string {
+	t.Helper()
+	creds, err := manager.GetStoredCredentials(ctx, providerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return creds.APIKey
+}
+
+func TestRotationJitter(t *testing.T) {
+	issuedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	spread := time.Hour
+
+	seen := make(map[time.Duration]bool)
+	for _, tenant := range []string{"acme", "globex", "initech", "umbrella", "hooli", "stark"} {
+		key := CredentialKey{TenantID: tenant, ProviderID: "stripe"}
+		jitter := rotationJitter(key, issuedAt, spread)
+		if jitter < 0 || jitter >= spread {
+			t.Fatalf("%s: got jitter %v, want within [0, %v)", tenant, jitter, spread)
+		}
+		if again := rotationJitter(key, issuedAt, spread); again != jitter {
+			t.Fatalf("%s: got %v then %v, want the same jitter on every check", tenant, jitter, again)
+		}
+		seen[jitter] = true
+	}
+	if len(seen) < 2 {
+		t.Fatal("every tenant got the same jitter")
+	}
+
+	if jitter := rotationJitter(CredentialKey{ProviderID: "stripe"}, issuedAt, 0); jitter != 0 {
+		t.Fatalf("got jitter %v without a spread, want 0", jitter)
+	}
+}
+
+func TestRotationSchedulerNextDue(t *testing.T) {
+	ctx := WithTenant(context.Background(), "acme")
+	key := KeyFromContext(ctx, "stripe")
+	issuedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	firstSeen := time.Now()
+	policy := RotationPolicy{Enabled: true, RotationPeriod: 24 * time.Hour, Jitter: time.Hour}
+
+	tests := []struct {
+		name  string
+		creds *Credentials
+		want  time.Time
+	}{
+		{
+			"aged from IssuedAt",
+			&Credentials{Type: CredentialTypeAPIKey, APIKey: "sk_1", IssuedAt: issuedAt},
+			issuedAt.Add(24 * time.Hour).Add(rotationJitter(key, issuedAt, time.Hour)),
+		},
+		{
+			"aged from first sight without IssuedAt",
+			&Credentials{Type: CredentialTypeAPIKey, APIKey: "sk_1"},
+			firstSeen.Add(24 * time.Hour).Add(rotationJitter(key, firstSeen, time.Hour)),
+		},
+		{
+			"never inside an open overlap window",
+			&Credentials{Type: CredentialTypeAPIKey, APIKey: "sk_1", IssuedAt: issuedAt, Previous: &RetiringCredentials{
+				Credentials: Credentials{APIKey: "sk_0"},
+				ValidUntil:  issuedAt.Add(48 * time.Hour),
+			}},
+			issuedAt.Add(48 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewManager(NewInMemoryStore())
+			if err := manager.SetCredentials(ctx, "stripe", tt.creds); err != nil {
+				t.Fatal(err)
+			}
+			// SetCredentials stamps IssuedAt; restore the case's value
+			stored := *tt.creds
+			if err := manager.store.Set(ctx, key.String(), &stored); err != nil {
+				t.Fatal(err)
+			}
+
+			due, _, err := NewRotationScheduler(manager).nextDue(ctx, key, policy, firstSeen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !due.Equal(tt.want) {
+				t.Fatalf("got due %v, want %v", due, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotationSchedulerRotatesDueKeys(t *testing.T) {
+	ctx := WithTenant(context.Background(), "acme")
+	manager := NewManager(NewInMemoryStore())
+	t.Cleanup(manager.Close)
+	manager.RegisterKeyIssuer("stripe", LocalKeyIssuer{})
+	if err := manager.SetCredentials(ctx, "stripe", &Credentials{Type: CredentialTypeAPIKey, APIKey: "sk_original"}); err != nil {
+		t.Fatal(err)
+	}
+	// Make the key old enough to be due
+	age := func() {
+		t.Helper()
+		key := KeyFromContext(ctx, "stripe").String()
+		creds, err := manager.store.Get(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		creds.IssuedAt = time.Now().Add(-48 * time.Hour)
+		if err := manager.store.Set(ctx, key, creds); err != nil {
+			t.Fatal(err)
+		}
+	}
+	age()
+
+	scheduler := NewRotationScheduler(manager)
+	scheduler.AddPolicy(ctx, "stripe", &RotationPolicy{Enabled: true, RotationPeriod: 24 * time.Hour})
+	scheduler.Start(context.Background())
+	t.Cleanup(scheduler.Stop)
+
+	waitFor(t, "the first rotation", func() bool { return storedKey(t, manager, ctx, "stripe") != "sk_original" })
+	rotated := storedKey(t, manager, ctx, "stripe")
+
+	var status RotationStatus
+	waitFor(t, "the status to update", func() bool {
+		status, _ = scheduler.StatusFor(ctx, "stripe")
+		return time.Until(status.NextDue) > 23*time.Hour
+	})
+	if status.LastError != "" || time.Since(status.LastRotation) > time.Minute {
+		t.Fatalf("got status %+v, want a recent rotation without errors", status)
+	}
+
+	// Stopped, nothing rotates; started again, due keys rotate
+	scheduler.Stop()
+	scheduler.Stop()
+	age()
+	time.Sleep(20 * time.Millisecond)
+	if got := storedKey(t, manager, ctx, "stripe"); got != rotated {
+		t.Fatal("a stopped scheduler rotated the key")
+	}
+	scheduler.Start(context.Background())
+	waitFor(t, "the rotation after restart", func() bool { return storedKey(t, manager, ctx, "stripe") != rotated })
+}
+
+func TestRotationSchedulerStatus(t *testing.T) {
+	ctx := context.Background()
+	manager := NewManager(NewInMemoryStore())
+	for _, tenant := range []string{"globex", "acme"} {
+		scoped := WithTenant(ctx, tenant)
+		creds := &Credentials{Type: CredentialTypeAPIKey, APIKey: "sk_" + tenant}
+		if err := manager.SetCredentials(scoped, "stripe", creds); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Age acme's key so it is due; no issuer is registered, so rotating fails
+	acme := WithTenant(ctx, "acme")
+	key := KeyFromContext(acme, "stripe").String()
+	creds, err := manager.store.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds.IssuedAt = time.Now().Add(-48 * time.Hour)
+	if err := manager.store.Set(ctx, key, creds); err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler := NewRotationScheduler(manager)
+	policy := &RotationPolicy{Enabled: true, RotationPeriod: 24 * time.Hour}
+	scheduler.AddPolicy(WithTenant(ctx, "globex"), "stripe", policy)
+	scheduler.AddPolicy(acme, "stripe", policy)
+	scheduler.Start(ctx)
+	t.Cleanup(scheduler.Stop)
+
+	waitFor(t, "the failed rotation", func() bool {
+		status, _ := scheduler.StatusFor(acme, "stripe")
+		return status.LastError != ""
+	})
+
+	statuses := scheduler.Status()
+	if len(statuses) != 2 || statuses[0].Key.TenantID != "acme" || statuses[1].Key.TenantID != "globex" {
+		t.Fatalf("got statuses %+v, want acme then globex", statuses)
+	}
+	if !strings.Contains(statuses[0].LastError, ErrNoKeyIssuer.Error()) || statuses[0].LastErrorAt.IsZero() {
+		t.Fatalf("got acme status %+v, want the missing issuer error", statuses[0])
+	}
+	if statuses[1].LastError != "" {
+		t.Fatalf("got globex error %q, want none", statuses[1].LastError)
+	}
+
+	scheduler.RemovePolicy(acme, "stripe")
+	if _, ok := scheduler.StatusFor(acme, "stripe"); ok {
+		t.Fatal("removed policy still has a status")
+	}
+}
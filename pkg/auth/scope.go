@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+type tenantContextKey struct{}
+type userContextKey struct{}
+
+// WithTenant returns a context scoped to a tenant (e.g. a merchant account).
+// Credentials read or written with this context belong to that tenant.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantID)
+}
+
+// WithUser returns a context scoped to an end user within the current tenant
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userContextKey{}, userID)
+}
+
+// TenantFromContext returns the tenant ID carried by ctx, if any
+func TenantFromContext(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenantID
+}
+
+// UserFromContext returns the user ID carried by ctx, if any
+func UserFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userContextKey{}).(string)
+	return userID
+}
+
+// CredentialKey identifies one set of credentials: a provider account,
+// optionally owned by a tenant and optionally by a user within it
+type CredentialKey struct {
+	TenantID   string
+	UserID     string
+	ProviderID string
+}
+
+// KeyFromContext builds the credential key for a provider from the tenant
+// and user carried by ctx
+func KeyFromContext(ctx context.Context, providerID string) CredentialKey {
+	return CredentialKey{
+		TenantID:   TenantFromContext(ctx),
+		UserID:     UserFromContext(ctx),
+		ProviderID: providerID,
+	}
+}
+
+// Context returns ctx scoped to exactly the key's tenant and user, replacing
+// any scope ctx already carried
+func (k CredentialKey) Context(ctx context.Context) context.Context {
+	return WithUser(WithTenant(ctx, k.TenantID), k.UserID)
+}
+
+// String encodes the key for use with a CredentialStore. Unscoped keys are
+// just the provider ID, so data stored before scoping keeps working.
+//
+//	stripe                       unscoped
+//	tenants/acme/stripe          tenant-owned
+//	tenants/acme/users/42/plaid  user-owned
+func (k CredentialKey) String() string {
+	var b strings.Builder
+	if k.TenantID != "" {
+		b.WriteString("tenants/")
+		b.WriteString(url.PathEscape(k.TenantID))
+		b.WriteByte('/')
+	}
+	if k.UserID != "" {
+		b.WriteString("users/")
+		b.WriteString(url.PathEscape(k.UserID))
+		b.WriteByte('/')
+	}
+	b.WriteString(url.PathEscape(k.ProviderID))
+	return b.String()
+}
+
+// parent returns the tenant-level key a user-scoped key falls back to
+func (k CredentialKey) parent() (CredentialKey, bool) {
+	if k.UserID == "" {
+		return k, false
+	}
+	return CredentialKey{TenantID: k.TenantID, ProviderID: k.ProviderID}, true
+}
+
+// ParseCredentialKey decodes a store key produced by CredentialKey.String
+func ParseCredentialKey(s string) (CredentialKey, error) {
+	var key CredentialKey
+	parts := strings.Split(s, "/")
+
+	var err error
+	if len(parts) >= 2 && parts[0] == "tenants" {
+		if key.TenantID, err = url.PathUnescape(parts[1]); err != nil {
+			return CredentialKey{}, err
+		}
+		parts = parts[2:]
+	}
+	if len(parts) >= 2 && parts[0] == "users" {
+		if key.UserID, err = url.PathUnescape(parts[1]); err != nil {
+			return CredentialKey{}, err
+		}
+		parts = parts[2:]
+	}
+	if len(parts) != 1 || parts[0] == "" {
+		return CredentialKey{}, errors.New("malformed credential key")
+	}
+	if key.ProviderID, err = url.PathUnescape(parts[0]); err != nil {
+		return CredentialKey{}, err
+	}
+
+	return key, nil
+}
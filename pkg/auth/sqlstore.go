@@ -0,0 +1,328 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/sqldialect"
+)
+
+// SQLStoreConfig configures a SQLStore
+type SQLStoreConfig struct {
+	Dialect sqldialect.Dialect
+	Table   string // Credentials table; migrations are tracked in <Table>_migrations
+}
+
+// DefaultSQLStoreConfig returns default SQL store configuration
+func DefaultSQLStoreConfig() *SQLStoreConfig {
+	return &SQLStoreConfig{
+		Dialect: sqldialect.SQLite,
+		Table:   "fintechkit_credentials",
+	}
+}
+
+// SQLStore is a VersionedCredentialStore backed by database/sql, for
+// deployments where several replicas share credentials. Secrets are sealed
+// with envelope encryption before they reach the database; only the
+// credential type and expiry are stored in the clear.
+type SQLStore struct {
+	db       *sql.DB
+	envelope *Envelope
+	config   *SQLStoreConfig
+}
+
+// NewSQLStore creates a SQL credential store. Call Migrate before first use.
+func NewSQLStore(db *sql.DB, keys KeyProvider, config *SQLStoreConfig) (*SQLStore, error) {
+	if config == nil {
+		config = DefaultSQLStoreConfig()
+	}
+	if config.Dialect == "" {
+		config.Dialect = sqldialect.SQLite
+	}
+	if config.Table == "" {
+		config.Table = "fintechkit_credentials"
+	}
+	if !sqldialect.ValidIdentifier(config.Table) {
+		return nil, fmt.Errorf("invalid table name %q", config.Table)
+	}
+
+	if err := config.Dialect.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &SQLStore{
+		db:       db,
+		envelope: NewEnvelope(keys),
+		config:   config,
+	}, nil
+}
+
+// migrations are applied in order; never edit one that has shipped. Each
+// must be idempotent, since on MySQL DDL commits implicitly and a replica
+// can run a statement another replica has already applied.
+func (s *SQLStore) migrations() []string {
+	blob := s.config.Dialect.BlobType()
+	// MySQL has no CREATE INDEX IF NOT EXISTS; the migration claim below
+	// keeps two replicas from both creating the index
+	ifNotExists := "IF NOT EXISTS "
+	if s.config.Dialect == sqldialect.MySQL {
+		ifNotExists = ""
+	}
+
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	credential_key  VARCHAR(255) NOT NULL PRIMARY KEY,
+	credential_type VARCHAR(32)  NOT NULL,
+	expires_at      BIGINT       NOT NULL DEFAULT 0,
+	key_id          VARCHAR(255) NOT NULL,
+	wrapped_key     %s           NOT NULL,
+	ciphertext      %s           NOT NULL,
+	version         BIGINT       NOT NULL,
+	updated_at      BIGINT       NOT NULL
+)`, s.config.Table, blob, blob),
+		fmt.Sprintf(`CREATE INDEX %s%s_expires_at ON %s (expires_at)`, ifNotExists, s.config.Table, s.config.Table),
+	}
+}
+
+// Migrate creates or upgrades the schema. It is safe to run on every start,
+// including from several replicas at once: each migration is claimed by
+// inserting its version first, and a replica that loses the claim skips it.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	migrationsTable := s.config.Table + "_migrations"
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s (version INTEGER NOT NULL PRIMARY KEY, applied_at BIGINT NOT NULL)`,
+		migrationsTable)); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var applied int
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT COALESCE(MAX(version), 0) FROM %s`, migrationsTable))
+	if err := row.Scan(&applied); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i, statement := range s.migrations() {
+		version := i + 1
+		if version <= applied {
+			continue
+		}
+
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, s.config.Dialect.Rebind(fmt.Sprintf(
+			`INSERT INTO %s (version, applied_at) VALUES (?, ?)`, migrationsTable)),
+			version, time.Now().Unix()); err != nil {
+			tx.Rollback()
+			// Losing the claim to another replica is success
+			if done, verr := s.migrationApplied(ctx, migrationsTable, version); verr == nil && done {
+				continue
+			}
+			return fmt.Errorf("failed to record migration %d: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			if done, verr := s.migrationApplied(ctx, migrationsTable, version); verr == nil && done {
+				continue
+			}
+			return fmt.Errorf("migration %d failed: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+// migrationApplied reports whether a migration version has been recorded
+func (s *SQLStore) migrationApplied(ctx context.Context, migrationsTable string, version int) (bool, error) {
+	var count int
+	row := s.db.QueryRowContext(ctx, s.config.Dialect.Rebind(fmt.Sprintf(
+		`SELECT COUNT(*) FROM %s WHERE version = ?`, migrationsTable)), version)
+	if err := row.Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Get decrypts and returns credentials for a provider
+func (s *SQLStore) Get(ctx context.Context, key string) (*Credentials, error) {
+	creds, _, err := s.GetVersioned(ctx, key)
+	return creds, err
+}
+
+// GetVersioned returns credentials together with their version
+func (s *SQLStore) GetVersioned(ctx context.Context, key string) (*Credentials, int64, error) {
+	var sealed SealedSecret
+	var version int64
+
+	row := s.db.QueryRowContext(ctx, s.config.Dialect.Rebind(fmt.Sprintf(
+		`SELECT key_id, wrapped_key, ciphertext, version FROM %s WHERE credential_key = ?`, s.config.Table)),
+		key)
+	if err := row.Scan(&sealed.KeyID, &sealed.WrappedKey, &sealed.Ciphertext, &version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, 0, ErrCredentialsNotFound
+		}
+		return nil, 0, fmt.Errorf("failed to load credentials: %w", err)
+	}
+
+	creds, err := openCredentials(ctx, s.envelope, key, &sealed)
+	if err != nil {
+		return nil, 0, err
+	}
+	return creds, version, nil
+}
+
+// Set stores credentials unconditionally, overwriting whatever is stored
+func (s *SQLStore) Set(ctx context.Context, key string, creds *Credentials) error {
+	for attempt := 0; attempt < 3; attempt++ {
+		_, version, err := s.GetVersioned(ctx, key)
+		if err != nil && !errors.Is(err, ErrCredentialsNotFound) {
+			// Undecryptable rows are still overwritten; only the version matters
+			if version, err = s.currentVersion(ctx, key); err != nil {
+				return err
+			}
+		}
+
+		_, err = s.CompareAndSet(ctx, key, creds, version)
+		if !errors.Is(err, ErrVersionConflict) {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to store credentials for %s: %w", key, ErrVersionConflict)
+}
+
+// CompareAndSet stores credentials if the stored version equals expected
+// (0 meaning not yet stored) and returns the new version
+func (s *SQLStore) CompareAndSet(ctx context.Context, key string, creds *Credentials, expected int64) (int64, error) {
+	sealed, err := sealCredentials(ctx, s.envelope, key, creds)
+	if err != nil {
+		return 0, err
+	}
+
+	var expiresAt int64
+	if !creds.ExpiresAt.IsZero() {
+		expiresAt = creds.ExpiresAt.Unix()
+	}
+	now := time.Now().Unix()
+
+	if expected == 0 {
+		_, err := s.db.ExecContext(ctx, s.config.Dialect.Rebind(fmt.Sprintf(
+			`INSERT INTO %s (credential_key, credential_type, expires_at, key_id, wrapped_key, ciphertext, version, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, 1, ?)`, s.config.Table)),
+			key, string(creds.Type), expiresAt, sealed.KeyID, sealed.WrappedKey, sealed.Ciphertext, now)
+		if err != nil {
+			// A failed insert most likely means another writer got there first
+			if version, verr := s.currentVersion(ctx, key); verr == nil && version != 0 {
+				return 0, ErrVersionConflict
+			}
+			return 0, fmt.Errorf("failed to store credentials: %w", err)
+		}
+		return 1, nil
+	}
+
+	result, err := s.db.ExecContext(ctx, s.config.Dialect.Rebind(fmt.Sprintf(
+		`UPDATE %s SET credential_type = ?, expires_at = ?, key_id = ?, wrapped_key = ?, ciphertext = ?,
+		 version = version + 1, updated_at = ?
+		 WHERE credential_key = ? AND version = ?`, s.config.Table)),
+		string(creds.Type), expiresAt, sealed.KeyID, sealed.WrappedKey, sealed.Ciphertext, now,
+		key, expected)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store credentials: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to store credentials: %w", err)
+	}
+	if affected == 0 {
+		return 0, ErrVersionConflict
+	}
+	return expected + 1, nil
+}
+
+// Delete removes credentials for a provider
+func (s *SQLStore) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, s.config.Dialect.Rebind(fmt.Sprintf(
+		`DELETE FROM %s WHERE credential_key = ?`, s.config.Table)), key)
+	if err != nil {
+		return fmt.Errorf("failed to delete credentials: %w", err)
+	}
+	return nil
+}
+
+// RotateMasterKey re-wraps every data key with the KeyProvider's current
+// master key and returns how many rows changed. Ciphertext and versions are
+// untouched; rows modified concurrently are skipped since their writer
+// already used the current key.
+func (s *SQLStore) RotateMasterKey(ctx context.Context) (int, error) {
+	type row struct {
+		key     string
+		sealed  SealedSecret
+		version int64
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT credential_key, key_id, wrapped_key, version FROM %s`, s.config.Table))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list credentials: %w", err)
+	}
+
+	var pending []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.key, &r.sealed.KeyID, &r.sealed.WrappedKey, &r.version); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to list credentials: %w", err)
+		}
+		pending = append(pending, r)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to list credentials: %w", err)
+	}
+
+	rotated := 0
+	for _, r := range pending {
+		changed, err := s.envelope.Rewrap(ctx, &r.sealed)
+		if err != nil {
+			return rotated, fmt.Errorf("failed to re-wrap credentials for %s: %w", r.key, err)
+		}
+		if !changed {
+			continue
+		}
+
+		result, err := s.db.ExecContext(ctx, s.config.Dialect.Rebind(fmt.Sprintf(
+			`UPDATE %s SET key_id = ?, wrapped_key = ? WHERE credential_key = ? AND version = ?`, s.config.Table)),
+			r.sealed.KeyID, r.sealed.WrappedKey, r.key, r.version)
+		if err != nil {
+			return rotated, fmt.Errorf("failed to update credentials for %s: %w", r.key, err)
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			rotated++
+		}
+	}
+
+	return rotated, nil
+}
+
+// currentVersion reads only the version column (0 when absent)
+func (s *SQLStore) currentVersion(ctx context.Context, key string) (int64, error) {
+	var version int64
+	row := s.db.QueryRowContext(ctx, s.config.Dialect.Rebind(fmt.Sprintf(
+		`SELECT version FROM %s WHERE credential_key = ?`, s.config.Table)), key)
+	if err := row.Scan(&version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to load credentials: %w", err)
+	}
+	return version, nil
+}
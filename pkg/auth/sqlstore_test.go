@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// openTestSQLite opens a SQLite database file that several connections, and
+// so several simulated replicas, can share
+func openTestSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newTestKeyring(t *testing.T) *Keyring {
+	t.Helper()
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	keys := NewKeyring()
+	if _, err := keys.Add("test", key); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func newTestSQLStore(t *testing.T, db *sql.DB, keys KeyProvider) *SQLStore {
+	t.Helper()
+
+	store, err := NewSQLStore(db, keys, nil)
+	if err != nil {
+		t.Fatalf("NewSQLStore: %v", err)
+	}
+	return store
+}
+
+func TestSQLStoreMigrateConcurrentReplicas(t *testing.T) {
+	db := openTestSQLite(t)
+	keys := newTestKeyring(t)
+
+	const replicas = 8
+	stores := make([]*SQLStore, replicas)
+	for i := range stores {
+		stores[i] = newTestSQLStore(t, db, keys)
+	}
+
+	errs := make(chan error, replicas)
+	var wg sync.WaitGroup
+	for _, store := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- store.Migrate(context.Background())
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent Migrate: %v", err)
+		}
+	}
+
+	var applied int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM fintechkit_credentials_migrations`).Scan(&applied); err != nil {
+		t.Fatal(err)
+	}
+	if want := len(stores[0].migrations()); applied != want {
+		t.Fatalf("recorded %d migrations, want %d", applied, want)
+	}
+}
+
+func TestSQLStoreMigrateIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLStore(t, openTestSQLite(t), newTestKeyring(t))
+
+	for i := 0; i < 3; i++ {
+		if err := store.Migrate(ctx); err != nil {
+			t.Fatalf("Migrate run %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestSQLStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	db := openTestSQLite(t)
+	store := newTestSQLStore(t, db, newTestKeyring(t))
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	creds := &Credentials{Type: CredentialTypeAPIKey, APIKey: "sk_test_secret"}
+	if err := store.Set(ctx, "stripe", creds); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	got, version, err := store.GetVersioned(ctx, "stripe")
+	if err != nil {
+		t.Fatalf("GetVersioned: %v", err)
+	}
+	if got.APIKey != creds.APIKey || version != 1 {
+		t.Fatalf("got key %q version %d, want %q version 1", got.APIKey, version, creds.APIKey)
+	}
+
+	// Secrets never reach the database in the clear
+	var ciphertext []byte
+	if err := db.QueryRow(`SELECT ciphertext FROM fintechkit_credentials WHERE credential_key = 'stripe'`).Scan(&ciphertext); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, []byte(creds.APIKey)) {
+		t.Fatal("ciphertext contains the plaintext API key")
+	}
+
+	if err := store.Delete(ctx, "stripe"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, "stripe"); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Fatalf("Get after Delete: got %v, want ErrCredentialsNotFound", err)
+	}
+}
+
+func TestSQLStoreCompareAndSetConflict(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLStore(t, openTestSQLite(t), newTestKeyring(t))
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	v1, err := store.CompareAndSet(ctx, "plaid", &Credentials{AccessToken: "a"}, 0)
+	if err != nil {
+		t.Fatalf("first CompareAndSet: %v", err)
+	}
+	if _, err := store.CompareAndSet(ctx, "plaid", &Credentials{AccessToken: "b"}, 0); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("second insert: got %v, want ErrVersionConflict", err)
+	}
+	if _, err := store.CompareAndSet(ctx, "plaid", &Credentials{AccessToken: "c"}, v1); err != nil {
+		t.Fatalf("update at current version: %v", err)
+	}
+	if _, err := store.CompareAndSet(ctx, "plaid", &Credentials{AccessToken: "d"}, v1); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("update at stale version: got %v, want ErrVersionConflict", err)
+	}
+
+	got, err := store.Get(ctx, "plaid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccessToken != "c" {
+		t.Fatalf("got token %q, want %q", got.AccessToken, "c")
+	}
+}
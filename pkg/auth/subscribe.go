@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CredentialEventType describes what happened to a set of credentials
+type CredentialEventType string
+
+const (
+	CredentialsUpdated   CredentialEventType = "updated"
+	CredentialsRefreshed CredentialEventType = "refreshed"
+	CredentialsRotated   CredentialEventType = "rotated"
+	CredentialsRetired   CredentialEventType = "retired" // Overlap ended, previous key revoked
+	CredentialsDeleted   CredentialEventType = "deleted"
+)
+
+// CredentialEvent is delivered to subscribers after a change is stored
+type CredentialEvent struct {
+	Type        CredentialEventType
+	Key         CredentialKey
+	Credentials *Credentials // nil for CredentialsDeleted
+}
+
+// CredentialListener receives credential events. Listeners run synchronously
+// on the goroutine that made the change and should return quickly.
+type CredentialListener func(ctx context.Context, event CredentialEvent)
+
+type subscription struct {
+	providerID string
+	listener   CredentialListener
+}
+
+// Subscribe registers a listener for changes to a provider's credentials in
+// any scope, or to every provider when providerID is empty. Changes made by
+// other processes sharing the store are not observed. Call the returned
+// function to unsubscribe.
+func (m *Manager) Subscribe(providerID string, listener CredentialListener) func() {
+	sub := &subscription{providerID: providerID, listener: listener}
+
+	m.subMu.Lock()
+	m.subscriptions = append(m.subscriptions, sub)
+	m.subMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.subMu.Lock()
+			defer m.subMu.Unlock()
+			for i, s := range m.subscriptions {
+				if s == sub {
+					m.subscriptions = append(m.subscriptions[:i:i], m.subscriptions[i+1:]...)
+					break
+				}
+			}
+		})
+	}
+}
+
+// publish notifies subscribers of a change stored under key
+func (m *Manager) publish(ctx context.Context, eventType CredentialEventType, key string, creds *Credentials) {
+	parsed, err := ParseCredentialKey(key)
+	if err != nil {
+		return
+	}
+
+	m.subMu.RLock()
+	subs := make([]*subscription, 0, len(m.subscriptions))
+	for _, sub := range m.subscriptions {
+		if sub.providerID == "" || sub.providerID == parsed.ProviderID {
+			subs = append(subs, sub)
+		}
+	}
+	m.subMu.RUnlock()
+
+	event := CredentialEvent{Type: eventType, Key: parsed, Credentials: creds}
+	for _, sub := range subs {
+		sub.listener(ctx, event)
+	}
+}
+
+// CredentialSource supplies the current credentials for a provider. Provider
+// clients read through a source on every call, so rotated or refreshed
+// credentials take effect without rebuilding the client.
+type CredentialSource interface {
+	Credentials(ctx context.Context) (*Credentials, error)
+}
+
+// StaticCredentials is a CredentialSource that always returns the same credentials
+type StaticCredentials struct {
+	creds *Credentials
+}
+
+// NewStaticCredentials wraps fixed credentials as a CredentialSource
+func NewStaticCredentials(creds *Credentials) *StaticCredentials {
+	return &StaticCredentials{creds: creds}
+}
+
+// Credentials returns the wrapped credentials
+func (s *StaticCredentials) Credentials(ctx context.Context) (*Credentials, error) {
+	return s.creds, nil
+}
+
+// LiveCredentials is a CredentialSource backed by a Manager. It caches the
+// credentials and drops the cache whenever the Manager reports a change, so
+// readers switch to new credentials on their next call. The cache also
+// expires after MaxAge to pick up changes made by other replicas.
+type LiveCredentials struct {
+	manager *Manager
+	key     CredentialKey
+	maxAge  atomic.Int64 // time.Duration
+
+	cached      atomic.Pointer[liveEntry]
+	generation  atomic.Uint64 // Bumped on every change; older entries are ignored
+	unsubscribe func()
+}
+
+type liveEntry struct {
+	creds      *Credentials
+	loadedAt   time.Time
+	generation uint64
+}
+
+// LiveSource returns a CredentialSource for a provider, bound to the tenant
+// and user scope carried by ctx
+func (m *Manager) LiveSource(ctx context.Context, providerID string) *LiveCredentials {
+	live := &LiveCredentials{
+		manager: m,
+		key:     KeyFromContext(ctx, providerID),
+	}
+	live.maxAge.Store(int64(30 * time.Second))
+
+	live.unsubscribe = m.Subscribe(providerID, func(ctx context.Context, event CredentialEvent) {
+		if live.affectedBy(event.Key) {
+			live.generation.Add(1)
+		}
+	})
+
+	return live
+}
+
+// SetMaxAge sets how long credentials are cached without a change event
+func (l *LiveCredentials) SetMaxAge(maxAge time.Duration) {
+	l.maxAge.Store(int64(maxAge))
+}
+
+// Credentials returns the current credentials. OAuth tokens that are about to
+// expire are refreshed through the provider's registered refresher, with
+// concurrent callers sharing one refresh.
+func (l *LiveCredentials) Credentials(ctx context.Context) (*Credentials, error) {
+	generation := l.generation.Load()
+	if entry := l.cached.Load(); entry != nil && entry.generation == generation &&
+		time.Since(entry.loadedAt) < time.Duration(l.maxAge.Load()) && !entry.creds.NeedsRefresh() {
+		return entry.creds, nil
+	}
+
+	// An entry loaded while a change lands carries the old generation and is
+	// never served
+	scoped := l.key.Context(ctx)
+	creds, err := l.manager.GetStoredCredentials(scoped, l.key.ProviderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if creds.Type == CredentialTypeOAuth && creds.NeedsRefresh() {
+		creds, err = l.refresh(scoped, creds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	l.cached.Store(&liveEntry{creds: creds, loadedAt: time.Now(), generation: generation})
+	return creds, nil
+}
+
+// StoredCredentials returns the stored credentials without checking expiry
+// or refreshing, e.g. to tell whether an expired token can be refreshed
+func (l *LiveCredentials) StoredCredentials(ctx context.Context) (*Credentials, error) {
+	return l.manager.GetStoredCredentials(l.key.Context(ctx), l.key.ProviderID)
+}
+
+// refresh replaces an OAuth token inside its refresh window. A token that has
+// not expired yet is still served when the refresh fails.
+func (l *LiveCredentials) refresh(ctx context.Context, stale *Credentials) (*Credentials, error) {
+	refresh := l.manager.refresher(l.key.ProviderID)
+	if refresh == nil {
+		if stale.IsExpired() {
+			return nil, fmt.Errorf("%s: %w", l.key.ProviderID, ErrTokenExpired)
+		}
+		return stale, nil
+	}
+
+	fresh, err := l.manager.RefreshCredentials(ctx, l.key.ProviderID, stale, refresh)
+	if err != nil {
+		if stale.IsExpired() {
+			return nil, fmt.Errorf("%s: %w: %w", l.key.ProviderID, ErrTokenExpired, err)
+		}
+		return stale, nil
+	}
+	return fresh, nil
+}
+
+// Close stops listening for changes
+func (l *LiveCredentials) Close() {
+	l.unsubscribe()
+}
+
+// affectedBy reports whether a change to key can change what this source
+// resolves to: its own key or, for user-scoped sources, the tenant fallback
+func (l *LiveCredentials) affectedBy(key CredentialKey) bool {
+	if key == l.key {
+		return true
+	}
+	parent, ok := l.key.parent()
+	return ok && key == parent
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLiveCredentialsRefreshesExpiredToken(t *testing.T) {
+	ctx := context.Background()
+	manager := NewManager(NewInMemoryStore())
+	expired := &Credentials{
+		Type:         CredentialTypeOAuth,
+		AccessToken:  "expired",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+	}
+	if err := manager.SetCredentials(ctx, "truelayer", expired); err != nil {
+		t.Fatal(err)
+	}
+
+	live := manager.LiveSource(ctx, "truelayer")
+	defer live.Close()
+
+	if _, err := live.Credentials(ctx); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("without a refresher: got %v, want ErrTokenExpired", err)
+	}
+
+	var refreshes atomic.Int32
+	manager.RegisterRefresher("truelayer", func(ctx context.Context, current *Credentials) (*Credentials, error) {
+		refreshes.Add(1)
+		time.Sleep(10 * time.Millisecond) // Keep the refresh in flight while others arrive
+		return &Credentials{
+			Type:         CredentialTypeOAuth,
+			AccessToken:  "fresh",
+			RefreshToken: current.RefreshToken,
+			ExpiresAt:    time.Now().Add(time.Hour),
+		}, nil
+	})
+
+	const callers = 16
+	errs := make(chan error, callers)
+	tokens := make(chan string, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			creds, err := live.Credentials(ctx)
+			if err != nil {
+				errs <- err
+				return
+			}
+			tokens <- creds.AccessToken
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	close(tokens)
+
+	for err := range errs {
+		t.Fatalf("Credentials: %v", err)
+	}
+	for token := range tokens {
+		if token != "fresh" {
+			t.Fatalf("got token %q, want %q", token, "fresh")
+		}
+	}
+	if n := refreshes.Load(); n != 1 {
+		t.Fatalf("refreshed %d times, want 1", n)
+	}
+}
+
+func TestLiveCredentialsServesTokenInsideBufferWhenRefreshFails(t *testing.T) {
+	ctx := context.Background()
+	manager := NewManager(NewInMemoryStore())
+	expiring := &Credentials{
+		Type:         CredentialTypeOAuth,
+		AccessToken:  "expiring",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(time.Minute),
+	}
+	if err := manager.SetCredentials(ctx, "truelayer", expiring); err != nil {
+		t.Fatal(err)
+	}
+	manager.RegisterRefresher("truelayer", func(ctx context.Context, current *Credentials) (*Credentials, error) {
+		return nil, errors.New("token endpoint unavailable")
+	})
+
+	live := manager.LiveSource(ctx, "truelayer")
+	defer live.Close()
+
+	creds, err := live.Credentials(ctx)
+	if err != nil {
+		t.Fatalf("Credentials: %v", err)
+	}
+	if creds.AccessToken != "expiring" {
+		t.Fatalf("got token %q, want %q", creds.AccessToken, "expiring")
+	}
+}
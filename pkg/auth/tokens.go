@@ -0,0 +1,380 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/tracing"
+)
+
+// ErrInvalidToken is returned for bearer tokens that fail validation
+var ErrInvalidToken = errors.New("invalid token")
+
+// maxIntrospectionCacheEntries bounds the introspection result cache
+const maxIntrospectionCacheEntries = 10000
+
+// JWT typ header values
+const (
+	TokenTypeAccess = "at+jwt" // JWT access tokens (RFC 9068)
+	TokenTypeJWT    = "JWT"    // Generic JWTs, including most ID tokens
+)
+
+// TokenValidator validates bearer tokens presented to this service's API
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string) (*Principal, error)
+}
+
+// JWTValidatorConfig configures JWT access token validation
+type JWTValidatorConfig struct {
+	Keys     KeySet // Usually a JWKS
+	Issuer   string // Required iss claim
+	Audience string // Required entry in the aud claim
+
+	Algorithms []string      // Accepted algorithms; defaults to RS256, ES256 and EdDSA
+	Leeway     time.Duration // Allowed clock skew for exp and nbf
+
+	// Types are the accepted typ headers; defaults to TokenTypeAccess, so
+	// ID tokens cannot be replayed as access tokens. An empty entry accepts
+	// tokens without a typ header.
+	Types []string
+
+	TenantClaim string // Claim holding the tenant ID; defaults to "tenant_id"
+	UserClaim   string // Claim holding the user ID, if tokens are user-scoped
+}
+
+// DefaultJWTValidatorConfig returns defaults for tokens from issuer, verified
+// with keys from the issuer's JWKS URL
+func DefaultJWTValidatorConfig(issuer, audience, jwksURL string) *JWTValidatorConfig {
+	return &JWTValidatorConfig{
+		Keys:        NewJWKS(DefaultJWKSConfig(jwksURL)),
+		Issuer:      issuer,
+		Audience:    audience,
+		Algorithms:  []string{AlgRS256, AlgES256, AlgEdDSA},
+		Leeway:      time.Minute,
+		Types:       []string{TokenTypeAccess},
+		TenantClaim: "tenant_id",
+	}
+}
+
+// JWTValidator validates signed JWT access tokens locally
+type JWTValidator struct {
+	config *JWTValidatorConfig
+}
+
+// NewJWTValidator creates a JWT validator
+func NewJWTValidator(config *JWTValidatorConfig) (*JWTValidator, error) {
+	if config.Keys == nil {
+		return nil, errors.New("a key set is required")
+	}
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, errors.New("issuer and audience are required")
+	}
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = []string{AlgRS256, AlgES256, AlgEdDSA}
+	}
+	if len(config.Types) == 0 {
+		config.Types = []string{TokenTypeAccess}
+	}
+	if config.TenantClaim == "" {
+		config.TenantClaim = "tenant_id"
+	}
+	return &JWTValidator{config: config}, nil
+}
+
+// NewIDTokenValidator creates a validator for OpenID Connect ID tokens from
+// issuer, which are issued to clientID and signed with keys from the
+// issuer's JWKS. Use it with AuthorizationFlow.SetIDTokenValidator.
+func NewIDTokenValidator(issuer, clientID string, keys KeySet) (*JWTValidator, error) {
+	return NewJWTValidator(&JWTValidatorConfig{
+		Keys:     keys,
+		Issuer:   issuer,
+		Audience: clientID,
+		Leeway:   time.Minute,
+		Types:    []string{TokenTypeJWT, ""},
+	})
+}
+
+// ValidateToken verifies the token signature and its iss, aud, exp and nbf
+// claims, and returns the principal it was issued to
+func (v *JWTValidator) ValidateToken(ctx context.Context, token string) (*Principal, error) {
+	header, payload, err := verifyJWT(ctx, token, v.config.Keys, v.config.Algorithms)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.ContainsFunc(v.config.Types, func(typ string) bool { return sameTokenType(typ, header.Typ) }) {
+		return nil, fmt.Errorf("%w: unexpected token type %q", ErrInvalidToken, header.Typ)
+	}
+
+	claims, err := decodeClaims(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if err := claims.validate(v.config.Issuer, v.config.Audience, v.config.Leeway, true); err != nil {
+		return nil, err
+	}
+
+	return claims.principal(AuthMethodJWT, v.config.TenantClaim, v.config.UserClaim), nil
+}
+
+// sameTokenType compares typ headers, which are case-insensitive media
+// types whose "application/" prefix may be omitted (RFC 7515)
+func sameTokenType(a, b string) bool {
+	normalize := func(typ string) string {
+		return strings.TrimPrefix(strings.ToLower(typ), "application/")
+	}
+	return normalize(a) == normalize(b)
+}
+
+// IntrospectionConfig configures OAuth 2.0 token introspection (RFC 7662)
+type IntrospectionConfig struct {
+	URL          string
+	ClientID     string // Credentials this service uses at the endpoint
+	ClientSecret string
+	HTTPClient   *http.Client
+
+	Issuer   string // Optional required iss claim
+	Audience string // Optional required entry in the aud claim
+
+	// CacheTTL is how long an active result is reused, capped at the
+	// token's expiry. Revocations take up to this long to apply.
+	CacheTTL time.Duration
+
+	TenantClaim string // Defaults to "tenant_id"
+	UserClaim   string
+}
+
+// IntrospectionValidator validates opaque tokens by asking the
+// authorization server
+type IntrospectionValidator struct {
+	config     *IntrospectionConfig
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]*introspectionResult
+}
+
+type introspectionResult struct {
+	principal *Principal
+	expiresAt time.Time
+}
+
+// NewIntrospectionValidator creates an introspection-based validator
+func NewIntrospectionValidator(config *IntrospectionConfig) *IntrospectionValidator {
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.TenantClaim == "" {
+		config.TenantClaim = "tenant_id"
+	}
+	return &IntrospectionValidator{
+		config:     config,
+		httpClient: tracing.WrapClient(httpClient, nil),
+		cache:      make(map[[sha256.Size]byte]*introspectionResult),
+	}
+}
+
+// ValidateToken introspects the token, reusing recent active results
+func (v *IntrospectionValidator) ValidateToken(ctx context.Context, token string) (*Principal, error) {
+	// Cache by hash so tokens are not kept in memory
+	cacheKey := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	v.mu.Lock()
+	if cached, ok := v.cache[cacheKey]; ok && now.Before(cached.expiresAt) {
+		v.mu.Unlock()
+		return cached.principal, nil
+	}
+	v.mu.Unlock()
+
+	claims, err := v.introspect(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if active, _ := claims.raw["active"].(bool); !active {
+		return nil, fmt.Errorf("%w: token is not active", ErrInvalidToken)
+	}
+	if err := claims.validate(v.config.Issuer, v.config.Audience, 0, false); err != nil {
+		return nil, err
+	}
+
+	principal := claims.principal(AuthMethodIntrospection, v.config.TenantClaim, v.config.UserClaim)
+
+	if v.config.CacheTTL > 0 {
+		expiresAt := now.Add(v.config.CacheTTL)
+		if !claims.expiresAt.IsZero() && claims.expiresAt.Before(expiresAt) {
+			expiresAt = claims.expiresAt
+		}
+		v.store(cacheKey, &introspectionResult{principal: principal, expiresAt: expiresAt})
+	}
+
+	return principal, nil
+}
+
+// introspect calls the introspection endpoint
+func (v *IntrospectionValidator) introspect(ctx context.Context, token string) (*tokenClaims, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.config.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if v.config.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(v.config.ClientID), url.QueryEscape(v.config.ClientSecret))
+	}
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token introspection failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("token introspection failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token introspection failed: status %d", resp.StatusCode)
+	}
+
+	return decodeClaims(body)
+}
+
+// store caches a result, evicting expired entries when the cache is full
+func (v *IntrospectionValidator) store(key [sha256.Size]byte, result *introspectionResult) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if len(v.cache) >= maxIntrospectionCacheEntries {
+		now := time.Now()
+		for k, cached := range v.cache {
+			if !now.Before(cached.expiresAt) {
+				delete(v.cache, k)
+			}
+		}
+		if len(v.cache) >= maxIntrospectionCacheEntries {
+			clear(v.cache)
+		}
+	}
+	v.cache[key] = result
+}
+
+// tokenClaims are the claims of a JWT or an introspection response
+type tokenClaims struct {
+	raw       map[string]any
+	issuer    string
+	subject   string
+	audience  []string
+	expiresAt time.Time
+	notBefore time.Time
+}
+
+// decodeClaims parses a claims object
+func decodeClaims(data []byte) (*tokenClaims, error) {
+	claims := &tokenClaims{}
+	if err := json.Unmarshal(data, &claims.raw); err != nil {
+		return nil, errors.New("malformed claims")
+	}
+
+	claims.issuer, _ = claims.raw["iss"].(string)
+	claims.subject, _ = claims.raw["sub"].(string)
+
+	switch aud := claims.raw["aud"].(type) {
+	case string:
+		claims.audience = []string{aud}
+	case []any:
+		for _, entry := range aud {
+			if s, ok := entry.(string); ok {
+				claims.audience = append(claims.audience, s)
+			}
+		}
+	}
+
+	if exp, ok := claims.raw["exp"].(float64); ok {
+		claims.expiresAt = time.Unix(int64(exp), 0)
+	}
+	if nbf, ok := claims.raw["nbf"].(float64); ok {
+		claims.notBefore = time.Unix(int64(nbf), 0)
+	}
+	return claims, nil
+}
+
+// validate checks the registered claims. Empty issuer or audience are not
+// checked; requireExpiry rejects tokens that never expire.
+func (c *tokenClaims) validate(issuer, audience string, leeway time.Duration, requireExpiry bool) error {
+	now := time.Now()
+
+	if issuer != "" && c.issuer != issuer {
+		return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+	if audience != "" && !slices.Contains(c.audience, audience) {
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	if c.expiresAt.IsZero() {
+		if requireExpiry {
+			return fmt.Errorf("%w: missing exp claim", ErrInvalidToken)
+		}
+	} else if now.After(c.expiresAt.Add(leeway)) {
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if !c.notBefore.IsZero() && now.Add(leeway).Before(c.notBefore) {
+		return fmt.Errorf("%w: token not yet valid", ErrInvalidToken)
+	}
+	return nil
+}
+
+// principal builds the principal the claims describe. Scopes come from the
+// space-separated "scope" claim (RFC 9068) or a "scp" array, and roles from a
+// "roles" claim.
+func (c *tokenClaims) principal(method AuthMethod, tenantClaim, userClaim string) *Principal {
+	p := &Principal{
+		ID:     c.subject,
+		Method: method,
+		Roles:  claimList(c.raw["roles"]),
+		Claims: c.raw,
+	}
+	if p.ID == "" {
+		p.ID, _ = c.raw["client_id"].(string)
+	}
+	if tenantClaim != "" {
+		p.TenantID, _ = c.raw[tenantClaim].(string)
+	}
+	if userClaim != "" {
+		p.UserID, _ = c.raw[userClaim].(string)
+	}
+
+	p.Scopes = claimList(c.raw["scope"])
+	if len(p.Scopes) == 0 {
+		p.Scopes = claimList(c.raw["scp"])
+	}
+	return p
+}
+
+// claimList reads a claim holding either a space-separated string or an
+// array of strings
+func claimList(claim any) []string {
+	switch v := claim.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var list []string
+		for _, entry := range v {
+			if s, ok := entry.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
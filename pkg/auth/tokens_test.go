@@ -0,0 +1,354 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testJWT builds a compact JWS with the given header, signed by key with the
+// header's alg. A nil key leaves the signature empty.
+func testJWT(t *testing.T, key crypto.Signer, header map[string]string, claims map[string]any) string {
+	t.Helper()
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	if key == nil {
+		return input + "."
+	}
+	sig, err := signJWS(key, header["alg"], []byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// ecJWK returns the public JWK form of a P-256 key
+func ecJWK(t *testing.T, keyID string, key *ecdsa.PrivateKey) map[string]string {
+	t.Helper()
+	point, err := key.PublicKey.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]string{
+		"kty": "EC",
+		"crv": "P-256",
+		"use": "sig",
+		"kid": keyID,
+		"x":   base64.RawURLEncoding.EncodeToString(point[1:33]),
+		"y":   base64.RawURLEncoding.EncodeToString(point[33:]),
+	}
+}
+
+func TestJWTValidator(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validator, err := NewJWTValidator(&JWTValidatorConfig{
+		Keys:       StaticKeySet{"ec": &ecKey.PublicKey, "rsa": &rsaKey.PublicKey},
+		Issuer:     "https://issuer.example",
+		Audience:   "payments-api",
+		Algorithms: []string{AlgES256, AlgRS256},
+		Leeway:     time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	// claims returns valid claims with the given overrides; nil deletes a claim
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{
+			"iss":       "https://issuer.example",
+			"aud":       "payments-api",
+			"sub":       "client_1",
+			"exp":       now.Add(time.Hour).Unix(),
+			"tenant_id": "acme",
+			"scope":     "payments:read payments:write",
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	header := func(alg, kid, typ string) map[string]string {
+		h := map[string]string{"alg": alg, "kid": kid}
+		if typ != "" {
+			h["typ"] = typ
+		}
+		return h
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", testJWT(t, ecKey, header(AlgES256, "ec", "at+jwt"), claims(nil)), false},
+		{"valid RSA", testJWT(t, rsaKey, header(AlgRS256, "rsa", "at+jwt"), claims(nil)), false},
+		{"full media type", testJWT(t, ecKey, header(AlgES256, "ec", "application/AT+JWT"), claims(nil)), false},
+		{"audience list", testJWT(t, ecKey, header(AlgES256, "ec", "at+jwt"), claims(map[string]any{"aud": []string{"other", "payments-api"}})), false},
+		{"ID token typ", testJWT(t, ecKey, header(AlgES256, "ec", "JWT"), claims(nil)), true},
+		{"missing typ", testJWT(t, ecKey, header(AlgES256, "ec", ""), claims(nil)), true},
+		{"bad signature", testJWT(t, otherKey, header(AlgES256, "ec", "at+jwt"), claims(nil)), true},
+		{"alg none", testJWT(t, nil, header("none", "ec", "at+jwt"), claims(nil)), true},
+		{"alg outside allowlist", testJWT(t, ecKey, header(AlgPS256, "rsa", "at+jwt"), claims(nil)), true},
+		{"ES256 with an RSA key", testJWT(t, ecKey, header(AlgES256, "rsa", "at+jwt"), claims(nil)), true},
+		{"RS256 with an EC key", testJWT(t, rsaKey, header(AlgRS256, "ec", "at+jwt"), claims(nil)), true},
+		{"unknown kid", testJWT(t, ecKey, header(AlgES256, "missing", "at+jwt"), claims(nil)), true},
+		{"expired", testJWT(t, ecKey, header(AlgES256, "ec", "at+jwt"), claims(map[string]any{"exp": now.Add(-2 * time.Minute).Unix()})), true},
+		{"expired within leeway", testJWT(t, ecKey, header(AlgES256, "ec", "at+jwt"), claims(map[string]any{"exp": now.Add(-30 * time.Second).Unix()})), false},
+		{"missing exp", testJWT(t, ecKey, header(AlgES256, "ec", "at+jwt"), claims(map[string]any{"exp": nil})), true},
+		{"not yet valid", testJWT(t, ecKey, header(AlgES256, "ec", "at+jwt"), claims(map[string]any{"nbf": now.Add(2 * time.Minute).Unix()})), true},
+		{"nbf within leeway", testJWT(t, ecKey, header(AlgES256, "ec", "at+jwt"), claims(map[string]any{"nbf": now.Add(30 * time.Second).Unix()})), false},
+		{"wrong issuer", testJWT(t, ecKey, header(AlgES256, "ec", "at+jwt"), claims(map[string]any{"iss": "https://evil.example"})), true},
+		{"wrong audience", testJWT(t, ecKey, header(AlgES256, "ec", "at+jwt"), claims(map[string]any{"aud": "other-api"})), true},
+		{"malformed", "not.a.jwt", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := validator.ValidateToken(context.Background(), tt.token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("got %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if principal.ID != "client_1" || principal.TenantID != "acme" || !principal.HasScopes("payments:read", "payments:write") {
+				t.Fatalf("got principal %+v, want client_1 in acme with both scopes", principal)
+			}
+		})
+	}
+}
+
+func TestIDTokenValidatorAcceptsIDTokenTypes(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator, err := NewIDTokenValidator("https://issuer.example", "client_1", StaticKeySet{"": &key.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := map[string]any{"iss": "https://issuer.example", "aud": "client_1", "sub": "user_1", "exp": time.Now().Add(time.Hour).Unix()}
+
+	for typ, wantErr := range map[string]bool{"JWT": false, "": false, "at+jwt": true} {
+		header := map[string]string{"alg": AlgES256}
+		if typ != "" {
+			header["typ"] = typ
+		}
+		_, err := validator.ValidateToken(context.Background(), testJWT(t, key, header, claims))
+		if (err != nil) != wantErr {
+			t.Fatalf("typ %q: got error %v, want error %v", typ, err, wantErr)
+		}
+	}
+}
+
+func TestJWKSRefresh(t *testing.T) {
+	first, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// newJWKS serves a key set holding first, and second once rotated is set
+	newJWKS := func(t *testing.T, minRefresh time.Duration) (*JWKS, *atomic.Int32, *atomic.Bool) {
+		t.Helper()
+		var fetches atomic.Int32
+		var rotated atomic.Bool
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetches.Add(1)
+			keys := []map[string]string{ecJWK(t, "k1", first), {"kty": "oct", "kid": "secret"}}
+			if rotated.Load() {
+				keys = append(keys, ecJWK(t, "k2", second))
+			}
+			json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+		}))
+		t.Cleanup(server.Close)
+		return NewJWKS(&JWKSConfig{URL: server.URL, RefreshInterval: time.Hour, MinRefreshInterval: minRefresh}), &fetches, &rotated
+	}
+
+	t.Run("unknown kid refetches the set", func(t *testing.T) {
+		keys, fetches, rotated := newJWKS(t, 0)
+		ctx := context.Background()
+
+		if _, err := keys.Key(ctx, "k1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := keys.Key(ctx, "k1"); err != nil {
+			t.Fatal(err)
+		}
+		if got := fetches.Load(); got != 1 {
+			t.Fatalf("got %d fetches for a cached key, want 1", got)
+		}
+
+		rotated.Store(true)
+		key, err := keys.Key(ctx, "k2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !second.PublicKey.Equal(key) {
+			t.Fatal("got a different key for k2")
+		}
+		if got := fetches.Load(); got != 2 {
+			t.Fatalf("got %d fetches, want a refetch for the new kid", got)
+		}
+	})
+
+	t.Run("refetches are rate limited", func(t *testing.T) {
+		keys, fetches, _ := newJWKS(t, time.Hour)
+		ctx := context.Background()
+
+		for range 3 {
+			if _, err := keys.Key(ctx, "made-up"); !errors.Is(err, ErrUnknownSigningKey) {
+				t.Fatalf("got %v, want ErrUnknownSigningKey", err)
+			}
+		}
+		if got := fetches.Load(); got != 1 {
+			t.Fatalf("got %d fetches for made-up kids, want 1", got)
+		}
+		if _, err := keys.Key(ctx, "secret"); !errors.Is(err, ErrUnknownSigningKey) {
+			t.Fatalf("got %v for a symmetric key, want it skipped", err)
+		}
+	})
+}
+
+func TestIntrospectionValidator(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if id, secret, ok := r.BasicAuth(); !ok || id != "api" || secret != "api_secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.ParseForm()
+		response := map[string]any{"active": false}
+		switch r.PostForm.Get("token") {
+		case "active", "other_active":
+			response = map[string]any{
+				"active":    true,
+				"iss":       "https://issuer.example",
+				"aud":       "payments-api",
+				"client_id": "client_1",
+				"scope":     "payments:read",
+				"tenant_id": "acme",
+				"exp":       time.Now().Add(time.Hour).Unix(),
+			}
+		case "wrong_audience":
+			response = map[string]any{"active": true, "iss": "https://issuer.example", "aud": "other-api"}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	newValidator := func(ttl time.Duration) *IntrospectionValidator {
+		return NewIntrospectionValidator(&IntrospectionConfig{
+			URL:          server.URL,
+			ClientID:     "api",
+			ClientSecret: "api_secret",
+			Issuer:       "https://issuer.example",
+			Audience:     "payments-api",
+			CacheTTL:     ttl,
+		})
+	}
+	ctx := context.Background()
+
+	t.Run("results", func(t *testing.T) {
+		validator := newValidator(0)
+		principal, err := validator.ValidateToken(ctx, "active")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if principal.ID != "client_1" || principal.TenantID != "acme" || !principal.HasScope("payments:read") {
+			t.Fatalf("got principal %+v, want client_1 in acme with payments:read", principal)
+		}
+		if principal.Method != AuthMethodIntrospection {
+			t.Fatalf("got method %s, want %s", principal.Method, AuthMethodIntrospection)
+		}
+
+		for _, token := range []string{"inactive", "wrong_audience"} {
+			if _, err := validator.ValidateToken(ctx, token); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("%s: got %v, want ErrInvalidToken", token, err)
+			}
+		}
+	})
+
+	t.Run("cache expiry", func(t *testing.T) {
+		calls.Store(0)
+		validator := newValidator(50 * time.Millisecond)
+
+		for range 3 {
+			if _, err := validator.ValidateToken(ctx, "active"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := calls.Load(); got != 1 {
+			t.Fatalf("got %d introspection calls, want 1 while cached", got)
+		}
+		if _, err := validator.ValidateToken(ctx, "other_active"); err != nil {
+			t.Fatal(err)
+		}
+		if got := calls.Load(); got != 2 {
+			t.Fatalf("got %d introspection calls, want a separate call per token", got)
+		}
+
+		time.Sleep(60 * time.Millisecond)
+		if _, err := validator.ValidateToken(ctx, "active"); err != nil {
+			t.Fatal(err)
+		}
+		if got := calls.Load(); got != 3 {
+			t.Fatalf("got %d introspection calls, want a new call after the TTL", got)
+		}
+	})
+
+	t.Run("inactive results are not cached", func(t *testing.T) {
+		calls.Store(0)
+		validator := newValidator(time.Hour)
+		for range 2 {
+			if _, err := validator.ValidateToken(ctx, "revoked"); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("got %v, want ErrInvalidToken", err)
+			}
+		}
+		if got := calls.Load(); got != 2 {
+			t.Fatalf("got %d introspection calls, want 2", got)
+		}
+	})
+}
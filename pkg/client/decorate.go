@@ -0,0 +1,291 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// interceptor runs one provider operation with a wrapper's behaviour around it
+type interceptor interface {
+	intercept(ctx context.Context, operation string, call func(context.Context) error) error
+}
+
+// layer is a wrapper applied by Factory.Create
+type layer interface {
+	Provider
+	interceptor
+}
+
+// chain runs operations through wrappers, outermost first
+type chain []layer
+
+func (c chain) invoke(ctx context.Context, operation string, call func(context.Context) error) error {
+	if len(c) == 0 {
+		return call(ctx)
+	}
+	return c[0].intercept(ctx, operation, func(ctx context.Context) error {
+		return c[1:].invoke(ctx, operation, call)
+	})
+}
+
+// invoke runs an operation returning a value through the chain
+func invoke[T any](ctx context.Context, c chain, operation string, call func(context.Context) (T, error)) (T, error) {
+	var result T
+	err := c.invoke(ctx, operation, func(ctx context.Context) (err error) {
+		result, err = call(ctx)
+		return err
+	})
+	return result, err
+}
+
+// retrySafe reports whether an operation may be repeated after a failure
+// without repeating its effect
+func retrySafe(operation string) bool {
+	switch operation {
+	case "create_payment", "refund_payment":
+		return false
+	default:
+		return true
+	}
+}
+
+// decorate returns wrapped extended with the capability interfaces base
+// implements, so type assertions on the result behave as on base
+func decorate(wrapped, base Provider, layers chain) Provider {
+	const (
+		payments = 1 << iota
+		banking
+		crypto
+		identity
+	)
+
+	var capabilities int
+	p, ok := base.(PaymentProvider)
+	if ok {
+		capabilities |= payments
+	}
+	b, ok := base.(BankingProvider)
+	if ok {
+		capabilities |= banking
+	}
+	c, ok := base.(CryptoProvider)
+	if ok {
+		capabilities |= crypto
+	}
+	i, ok := base.(IdentityProvider)
+	if ok {
+		capabilities |= identity
+	}
+
+	po := paymentOps{base: p, layers: layers}
+	bo := bankingOps{base: b, layers: layers}
+	co := cryptoOps{base: c, layers: layers}
+	io := identityOps{base: i, layers: layers}
+
+	switch capabilities {
+	case payments:
+		return &struct {
+			Provider
+			paymentOps
+		}{wrapped, po}
+	case banking:
+		return &struct {
+			Provider
+			bankingOps
+		}{wrapped, bo}
+	case crypto:
+		return &struct {
+			Provider
+			cryptoOps
+		}{wrapped, co}
+	case identity:
+		return &struct {
+			Provider
+			identityOps
+		}{wrapped, io}
+	case payments | banking:
+		return &struct {
+			Provider
+			paymentOps
+			bankingOps
+		}{wrapped, po, bo}
+	case payments | crypto:
+		return &struct {
+			Provider
+			paymentOps
+			cryptoOps
+		}{wrapped, po, co}
+	case payments | identity:
+		return &struct {
+			Provider
+			paymentOps
+			identityOps
+		}{wrapped, po, io}
+	case banking | crypto:
+		return &struct {
+			Provider
+			bankingOps
+			cryptoOps
+		}{wrapped, bo, co}
+	case banking | identity:
+		return &struct {
+			Provider
+			bankingOps
+			identityOps
+		}{wrapped, bo, io}
+	case crypto | identity:
+		return &struct {
+			Provider
+			cryptoOps
+			identityOps
+		}{wrapped, co, io}
+	case payments | banking | crypto:
+		return &struct {
+			Provider
+			paymentOps
+			bankingOps
+			cryptoOps
+		}{wrapped, po, bo, co}
+	case payments | banking | identity:
+		return &struct {
+			Provider
+			paymentOps
+			bankingOps
+			identityOps
+		}{wrapped, po, bo, io}
+	case payments | crypto | identity:
+		return &struct {
+			Provider
+			paymentOps
+			cryptoOps
+			identityOps
+		}{wrapped, po, co, io}
+	case banking | crypto | identity:
+		return &struct {
+			Provider
+			bankingOps
+			cryptoOps
+			identityOps
+		}{wrapped, bo, co, io}
+	case payments | banking | crypto | identity:
+		return &struct {
+			Provider
+			paymentOps
+			bankingOps
+			cryptoOps
+			identityOps
+		}{wrapped, po, bo, co, io}
+	default:
+		return wrapped
+	}
+}
+
+// paymentOps forwards PaymentProvider operations through the chain
+type paymentOps struct {
+	base   PaymentProvider
+	layers chain
+}
+
+func (o paymentOps) CreatePayment(ctx context.Context, req *PaymentRequest) (*Payment, error) {
+	return invoke(ctx, o.layers, "create_payment", func(ctx context.Context) (*Payment, error) {
+		return o.base.CreatePayment(ctx, req)
+	})
+}
+
+func (o paymentOps) GetPayment(ctx context.Context, id string) (*Payment, error) {
+	return invoke(ctx, o.layers, "get_payment", func(ctx context.Context) (*Payment, error) {
+		return o.base.GetPayment(ctx, id)
+	})
+}
+
+func (o paymentOps) RefundPayment(ctx context.Context, id string, amount int64, reason string) (*Refund, error) {
+	return invoke(ctx, o.layers, "refund_payment", func(ctx context.Context) (*Refund, error) {
+		return o.base.RefundPayment(ctx, id, amount, reason)
+	})
+}
+
+func (o paymentOps) ListPayments(ctx context.Context, filters map[string]string) ([]*Payment, error) {
+	return invoke(ctx, o.layers, "list_payments", func(ctx context.Context) ([]*Payment, error) {
+		return o.base.ListPayments(ctx, filters)
+	})
+}
+
+// bankingOps forwards BankingProvider operations through the chain
+type bankingOps struct {
+	base   BankingProvider
+	layers chain
+}
+
+func (o bankingOps) GetAccounts(ctx context.Context) ([]*Account, error) {
+	return invoke(ctx, o.layers, "get_accounts", o.base.GetAccounts)
+}
+
+func (o bankingOps) GetAccount(ctx context.Context, accountID string) (*Account, error) {
+	return invoke(ctx, o.layers, "get_account", func(ctx context.Context) (*Account, error) {
+		return o.base.GetAccount(ctx, accountID)
+	})
+}
+
+func (o bankingOps) GetTransactions(ctx context.Context, accountID string, startDate, endDate time.Time) ([]*Transaction, error) {
+	return invoke(ctx, o.layers, "get_transactions", func(ctx context.Context) ([]*Transaction, error) {
+		return o.base.GetTransactions(ctx, accountID, startDate, endDate)
+	})
+}
+
+func (o bankingOps) GetBalance(ctx context.Context, accountID string) (int64, string, error) {
+	var balance int64
+	var currency string
+	err := o.layers.invoke(ctx, "get_balance", func(ctx context.Context) (err error) {
+		balance, currency, err = o.base.GetBalance(ctx, accountID)
+		return err
+	})
+	return balance, currency, err
+}
+
+// cryptoOps forwards CryptoProvider operations through the chain
+type cryptoOps struct {
+	base   CryptoProvider
+	layers chain
+}
+
+func (o cryptoOps) GetPrice(ctx context.Context, coinID string, currency string) (*Price, error) {
+	return invoke(ctx, o.layers, "get_price", func(ctx context.Context) (*Price, error) {
+		return o.base.GetPrice(ctx, coinID, currency)
+	})
+}
+
+func (o cryptoOps) GetPrices(ctx context.Context, coinIDs []string, currency string) ([]*Price, error) {
+	return invoke(ctx, o.layers, "get_prices", func(ctx context.Context) ([]*Price, error) {
+		return o.base.GetPrices(ctx, coinIDs, currency)
+	})
+}
+
+func (o cryptoOps) GetMarketData(ctx context.Context, coinID string) (*MarketData, error) {
+	return invoke(ctx, o.layers, "get_market_data", func(ctx context.Context) (*MarketData, error) {
+		return o.base.GetMarketData(ctx, coinID)
+	})
+}
+
+func (o cryptoOps) GetHistoricalPrices(ctx context.Context, coinID string, currency string, days int) ([]*Price, error) {
+	return invoke(ctx, o.layers, "get_historical_prices", func(ctx context.Context) ([]*Price, error) {
+		return o.base.GetHistoricalPrices(ctx, coinID, currency, days)
+	})
+}
+
+// identityOps forwards IdentityProvider operations through the chain
+type identityOps struct {
+	base   IdentityProvider
+	layers chain
+}
+
+func (o identityOps) VerifyIdentity(ctx context.Context, userID string) (*Identity, error) {
+	return invoke(ctx, o.layers, "verify_identity", func(ctx context.Context) (*Identity, error) {
+		return o.base.VerifyIdentity(ctx, userID)
+	})
+}
+
+func (o identityOps) GetIdentity(ctx context.Context, userID string) (*Identity, error) {
+	return invoke(ctx, o.layers, "get_identity", func(ctx context.Context) (*Identity, error) {
+		return o.base.GetIdentity(ctx, userID)
+	})
+}
@@ -0,0 +1,271 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
+	"github.com/PrakarshSingh5/fintechkit/pkg/metrics"
+	"github.com/PrakarshSingh5/fintechkit/pkg/reliability"
+	"github.com/PrakarshSingh5/fintechkit/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// bankProvider is a PaymentProvider and BankingProvider whose calls fail
+// with the queued errors before succeeding
+type bankProvider struct {
+	stubProvider
+	errs  []error
+	calls map[string]int
+}
+
+func newBankProvider(errs ...error) *bankProvider {
+	return &bankProvider{stubProvider: stubProvider{name: "bank"}, errs: errs, calls: make(map[string]int)}
+}
+
+func (p *bankProvider) call(operation string) error {
+	p.calls[operation]++
+	if len(p.errs) == 0 {
+		return nil
+	}
+	err := p.errs[0]
+	p.errs = p.errs[1:]
+	return err
+}
+
+func (p *bankProvider) CreatePayment(ctx context.Context, req *PaymentRequest) (*Payment, error) {
+	if err := p.call("create_payment"); err != nil {
+		return nil, err
+	}
+	return &Payment{ID: "pay_1", Amount: req.Amount, Currency: req.Currency}, nil
+}
+
+func (p *bankProvider) GetPayment(ctx context.Context, id string) (*Payment, error) {
+	if err := p.call("get_payment"); err != nil {
+		return nil, err
+	}
+	return &Payment{ID: id}, nil
+}
+
+func (p *bankProvider) RefundPayment(ctx context.Context, id string, amount int64, reason string) (*Refund, error) {
+	if err := p.call("refund_payment"); err != nil {
+		return nil, err
+	}
+	return &Refund{ID: "re_1", PaymentID: id, Amount: amount}, nil
+}
+
+func (p *bankProvider) ListPayments(ctx context.Context, filters map[string]string) ([]*Payment, error) {
+	return nil, p.call("list_payments")
+}
+
+func (p *bankProvider) GetAccounts(ctx context.Context) ([]*Account, error) {
+	return nil, p.call("get_accounts")
+}
+
+func (p *bankProvider) GetAccount(ctx context.Context, accountID string) (*Account, error) {
+	return &Account{ID: accountID}, p.call("get_account")
+}
+
+func (p *bankProvider) GetTransactions(ctx context.Context, accountID string, startDate, endDate time.Time) ([]*Transaction, error) {
+	return nil, p.call("get_transactions")
+}
+
+func (p *bankProvider) GetBalance(ctx context.Context, accountID string) (int64, string, error) {
+	return 1250, "GBP", p.call("get_balance")
+}
+
+// createTraced creates base through a factory whose spans are recorded
+func createTraced(t *testing.T, base Provider, config *ProviderConfig) (Provider, *tracetest.InMemoryExporter) {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+
+	factory := NewFactory(auth.NewManager(auth.NewInMemoryStore()))
+	factory.Register(base.Name(), func(*ProviderConfig) (Provider, error) {
+		return base, nil
+	})
+
+	config.Name = base.Name()
+	config.Credentials = &auth.Credentials{APIKey: "sk_test"}
+	config.TracerProvider = tp
+	provider, err := factory.Create(auth.WithTenant(context.Background(), "acme"), config)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return provider, exporter
+}
+
+func fastRetryPolicy() *reliability.RetryPolicy {
+	return &reliability.RetryPolicy{
+		MaxRetries:      2,
+		InitialInterval: time.Millisecond,
+		MaxInterval:     time.Millisecond,
+		Multiplier:      1,
+		RetryableErrors: []error{reliability.ErrServiceUnavailable},
+	}
+}
+
+func spansNamed(spans tracetest.SpanStubs, name string) []tracetest.SpanStub {
+	var matched []tracetest.SpanStub
+	for _, span := range spans {
+		if span.Name == name {
+			matched = append(matched, span)
+		}
+	}
+	return matched
+}
+
+func hasAttribute(span tracetest.SpanStub, want attribute.KeyValue) bool {
+	for _, attr := range span.Attributes {
+		if attr == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCreateKeepsCapabilityInterfaces(t *testing.T) {
+	provider, _ := createTraced(t, newBankProvider(), &ProviderConfig{RetryPolicy: fastRetryPolicy()})
+
+	if _, ok := provider.(PaymentProvider); !ok {
+		t.Fatal("wrapped provider is not a PaymentProvider")
+	}
+	if _, ok := provider.(BankingProvider); !ok {
+		t.Fatal("wrapped provider is not a BankingProvider")
+	}
+	if _, ok := provider.(CryptoProvider); ok {
+		t.Fatal("wrapped provider claims to be a CryptoProvider")
+	}
+
+	plain, _ := createTraced(t, &stubProvider{name: "stub"}, &ProviderConfig{})
+	if _, ok := plain.(PaymentProvider); ok {
+		t.Fatal("plain provider claims to be a PaymentProvider")
+	}
+}
+
+func TestCreateTracesProviderOperations(t *testing.T) {
+	ctx := context.Background()
+	base := newBankProvider(reliability.ErrServiceUnavailable)
+	provider, exporter := createTraced(t, base, &ProviderConfig{RetryPolicy: fastRetryPolicy()})
+	payments := provider.(PaymentProvider)
+
+	// The first attempt fails and is retried
+	payment, err := payments.GetPayment(ctx, "pay_1")
+	if err != nil {
+		t.Fatalf("GetPayment: %v", err)
+	}
+	if payment.ID != "pay_1" {
+		t.Fatalf("got payment %q, want pay_1", payment.ID)
+	}
+
+	if _, _, err := provider.(BankingProvider).GetBalance(ctx, "acc_1"); err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	operation := spansNamed(spans, "bank.get_payment")
+	if len(operation) != 1 {
+		t.Fatalf("got %d bank.get_payment spans, want 1", len(operation))
+	}
+	span := operation[0]
+	if span.SpanKind != trace.SpanKindClient {
+		t.Fatalf("got span kind %v, want client", span.SpanKind)
+	}
+	for _, want := range []attribute.KeyValue{
+		tracing.ProviderKey.String("bank"),
+		tracing.OperationKey.String("get_payment"),
+		tracing.AccountKey.String(auth.KeyFromContext(auth.WithTenant(ctx, "acme"), "bank").String()),
+	} {
+		if !hasAttribute(span, want) {
+			t.Fatalf("span lacks %s=%s: %v", want.Key, want.Value.Emit(), span.Attributes)
+		}
+	}
+
+	attempts := spansNamed(spans, "bank.get_payment.attempt")
+	if len(attempts) != 2 {
+		t.Fatalf("got %d attempt spans, want 2", len(attempts))
+	}
+	for _, attempt := range attempts {
+		if attempt.Parent.SpanID() != span.SpanContext.SpanID() {
+			t.Fatal("attempt span is not a child of the operation span")
+		}
+	}
+	if attempts[0].Status.Code != codes.Error {
+		t.Fatalf("failed attempt has status %v, want error", attempts[0].Status.Code)
+	}
+
+	if len(spansNamed(spans, "bank.get_balance")) != 1 {
+		t.Fatal("GetBalance was not traced")
+	}
+}
+
+func TestCreateDoesNotRetryPaymentCreation(t *testing.T) {
+	ctx := context.Background()
+	base := newBankProvider(reliability.ErrServiceUnavailable, reliability.ErrServiceUnavailable)
+	provider, exporter := createTraced(t, base, &ProviderConfig{RetryPolicy: fastRetryPolicy()})
+	payments := provider.(PaymentProvider)
+
+	_, err := payments.CreatePayment(ctx, &PaymentRequest{Amount: 1000, Currency: "USD"})
+	if !errors.Is(err, reliability.ErrServiceUnavailable) {
+		t.Fatalf("CreatePayment: got %v, want ErrServiceUnavailable", err)
+	}
+	if _, err := payments.RefundPayment(ctx, "pay_1", 0, ""); !errors.Is(err, reliability.ErrServiceUnavailable) {
+		t.Fatalf("RefundPayment: got %v, want ErrServiceUnavailable", err)
+	}
+	if base.calls["create_payment"] != 1 || base.calls["refund_payment"] != 1 {
+		t.Fatalf("calls: %v, want one create_payment and one refund_payment", base.calls)
+	}
+
+	operation := spansNamed(exporter.GetSpans(), "bank.create_payment")
+	if len(operation) != 1 || operation[0].Status.Code != codes.Error {
+		t.Fatalf("got create_payment spans %+v, want one with error status", operation)
+	}
+}
+
+func TestCreateRecordsMetricsForProviderOperations(t *testing.T) {
+	ctx := context.Background()
+	registry := prometheus.NewRegistry()
+	base := newBankProvider(reliability.ErrServiceUnavailable)
+	provider, _ := createTraced(t, base, &ProviderConfig{
+		RetryPolicy: fastRetryPolicy(),
+		Metrics:     metrics.New(registry),
+	})
+
+	if _, err := provider.(PaymentProvider).CreatePayment(ctx, &PaymentRequest{Amount: 1000, Currency: "USD"}); err == nil {
+		t.Fatal("CreatePayment: want the queued error")
+	}
+	if _, err := provider.(BankingProvider).GetAccounts(ctx); err != nil {
+		t.Fatalf("GetAccounts: %v", err)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := make(map[string]string) // operation -> outcome
+	for _, family := range families {
+		if family.GetName() != "fintechkit_provider_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, pair := range metric.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			recorded[labels["operation"]] = labels["outcome"]
+		}
+	}
+
+	if recorded["create_payment"] != metrics.OutcomeError || recorded["get_accounts"] != metrics.OutcomeSuccess {
+		t.Fatalf("recorded outcomes %v, want create_payment=error and get_accounts=success", recorded)
+	}
+}
@@ -0,0 +1,23 @@
+package client
+
+import "fmt"
+
+// ProviderError is an error response from a provider's API
+type ProviderError struct {
+	Provider   string
+	StatusCode int    // HTTP status returned by the provider
+	Code       string // Provider's own error code, e.g. "card_declined"
+	Message    string // Provider's message, safe to show end users
+	Err        error  // Underlying cause, if any
+}
+
+func (e *ProviderError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%s: %s (%d): %s", e.Provider, e.Code, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s: status %d: %s", e.Provider, e.StatusCode, e.Message)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
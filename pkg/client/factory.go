@@ -2,10 +2,20 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
+	"github.com/PrakarshSingh5/fintechkit/pkg/logging"
+	"github.com/PrakarshSingh5/fintechkit/pkg/metrics"
 	"github.com/PrakarshSingh5/fintechkit/pkg/reliability"
+	"github.com/PrakarshSingh5/fintechkit/pkg/tracing"
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ProviderConfig holds configuration for creating a provider
@@ -13,16 +23,54 @@ type ProviderConfig struct {
 	Name        string
 	Credentials *auth.Credentials
 
+	// Source supplies credentials on every call. Constructors should prefer
+	// it over Credentials so rotations apply to existing clients.
+	Source auth.CredentialSource
+
 	// Reliability settings
 	RetryPolicy     *reliability.RetryPolicy
 	RateLimitConfig *reliability.RateLimitConfig
 	CircuitBreaker  *reliability.CircuitBreakerConfig
+
+	// SharedRateLimiter, when set, replaces RateLimitConfig with a quota
+	// shared by every replica, keyed by the provider account (tenant, user
+	// and provider) so accounts do not consume each other's quota
+	SharedRateLimiter reliability.DistributedRateLimiter
+
+	// Logger, when set, logs every provider call with its outcome and
+	// duration. Retries and breaker transitions are logged regardless.
+	Logger *slog.Logger
+
+	// TracerProvider records a span for every provider operation, with
+	// child spans for retry attempts and rate-limit waits. Defaults to the
+	// global OpenTelemetry provider.
+	TracerProvider trace.TracerProvider
+
+	// Metrics records call counts and latency per operation, retries,
+	// rate-limit waits and breaker state. Defaults to metrics.Default().
+	Metrics *metrics.Metrics
 }
 
 // Factory creates provider instances with built-in reliability features
 type Factory struct {
 	authManager *auth.Manager
 	providers   map[string]ProviderConstructor
+
+	mu        sync.RWMutex
+	instances map[string]*Instance
+	sources   map[string]*auth.LiveCredentials // Shared by every provider of an account
+}
+
+// Instance is a provider created by a Factory, with the parts health checks
+// inspect
+type Instance struct {
+	Name      string
+	Account   string                      // Credential key of the account: tenant, user and provider
+	Provider  Provider                    // As returned by Create
+	Base      Provider                    // Without the reliability wrappers
+	Breaker   *reliability.CircuitBreaker // Nil when no circuit breaker is configured
+	Source    auth.CredentialSource
+	CreatedAt time.Time
 }
 
 // ProviderConstructor is a function that creates a new provider instance
@@ -33,6 +81,8 @@ func NewFactory(authManager *auth.Manager) *Factory {
 	return &Factory{
 		authManager: authManager,
 		providers:   make(map[string]ProviderConstructor),
+		instances:   make(map[string]*Instance),
+		sources:     make(map[string]*auth.LiveCredentials),
 	}
 }
 
@@ -41,18 +91,43 @@ func (f *Factory) Register(name string, constructor ProviderConstructor) {
 	f.providers[name] = constructor
 }
 
-// Create creates a provider instance with reliability features
+// Create creates a provider instance with reliability features. When no
+// credentials are given they are loaded for the tenant and user carried by
+// ctx (see auth.WithTenant and auth.WithUser), so each merchant or end user
+// gets a provider bound to their own account. config is not modified, so one
+// config can serve as a template for every account.
+//
+// The returned provider implements the same capability interfaces as the
+// constructed one (PaymentProvider, BankingProvider, CryptoProvider and
+// IdentityProvider), with every operation going through the configured
+// wrappers. Other methods of the concrete client are reachable through
+// Instance.Base.
 func (f *Factory) Create(ctx context.Context, config *ProviderConfig) (Provider, error) {
 	constructor, ok := f.providers[config.Name]
 	if !ok {
 		return nil, fmt.Errorf("provider %s not registered", config.Name)
 	}
 
-	// Retrieve credentials if not provided
+	// Resolved credentials belong to this account only; filling them into a
+	// shared template would bind the next account's provider to this one
+	copied := *config
+	config = &copied
+
+	// Read credentials through a live source unless fixed ones were given,
+	// so the provider follows later rotations and refreshes
+	account := auth.KeyFromContext(ctx, config.Name).String()
+	if config.Source == nil {
+		if config.Credentials != nil {
+			config.Source = auth.NewStaticCredentials(config.Credentials)
+		} else {
+			config.Source = f.liveSource(ctx, config.Name, account)
+		}
+	}
+
 	if config.Credentials == nil {
-		creds, err := f.authManager.GetCredentials(ctx, config.Name)
+		creds, err := config.Source.Credentials(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get credentials for %s: %w", config.Name, err)
+			return nil, fmt.Errorf("failed to get credentials for %s: %w", account, err)
 		}
 		config.Credentials = creds
 	}
@@ -63,39 +138,161 @@ func (f *Factory) Create(ctx context.Context, config *ProviderConfig) (Provider,
 		return nil, fmt.Errorf("failed to create provider %s: %w", config.Name, err)
 	}
 
-	// Wrap with reliability features if configured
+	// Wrap with reliability features if configured. The wrappers also form
+	// the chain that the payment, banking, crypto and identity operations
+	// run through, outermost first.
 	wrapped := provider
+	var layers chain
+	use := func(w layer) {
+		wrapped = w
+		layers = append(chain{w}, layers...)
+	}
+
+	tracer := tracing.Tracer(config.TracerProvider)
+	m := metrics.OrDefault(config.Metrics)
+	var breaker *reliability.CircuitBreaker
 
 	if config.RetryPolicy != nil {
-		wrapped = &RetryWrapper{
+		use(&RetryWrapper{
 			provider: wrapped,
 			policy:   config.RetryPolicy,
-		}
+			tracer:   tracer,
+			metrics:  m,
+		})
 	}
 
-	if config.RateLimitConfig != nil {
+	if config.SharedRateLimiter != nil {
+		use(&RateLimitWrapper{
+			provider: wrapped,
+			limiter: &sharedQuota{
+				limiter: config.SharedRateLimiter,
+				key:     account,
+			},
+			tracer:  tracer,
+			metrics: m,
+		})
+	} else if config.RateLimitConfig != nil {
 		limiter := reliability.NewRateLimiter(config.RateLimitConfig)
-		wrapped = &RateLimitWrapper{
+		use(&RateLimitWrapper{
 			provider: wrapped,
 			limiter:  limiter,
-		}
+			tracer:   tracer,
+			metrics:  m,
+		})
 	}
 
 	if config.CircuitBreaker != nil {
-		breaker := reliability.NewCircuitBreaker(config.Name, config.CircuitBreaker)
-		wrapped = &CircuitBreakerWrapper{
+		breakerConfig := *config.CircuitBreaker
+		if breakerConfig.Metrics == nil {
+			breakerConfig.Metrics = config.Metrics
+		}
+		breaker = reliability.NewCircuitBreaker(config.Name, &breakerConfig)
+		use(&CircuitBreakerWrapper{
 			provider: wrapped,
 			breaker:  breaker,
-		}
+		})
+	}
+
+	if config.Logger != nil {
+		use(&LoggingWrapper{
+			provider: wrapped,
+			logger:   logging.Redacted(config.Logger).With("provider", config.Name, "account", account),
+		})
 	}
 
+	use(&MetricsWrapper{
+		provider: wrapped,
+		metrics:  m,
+	})
+
+	// Outermost, so the span covers every layer above
+	use(&TracingWrapper{
+		provider: wrapped,
+		tracer:   tracer,
+		account:  account,
+	})
+	wrapped = decorate(wrapped, provider, layers)
+
+	// Track the latest provider per account for health checks
+	f.mu.Lock()
+	f.instances[account] = &Instance{
+		Name:      config.Name,
+		Account:   account,
+		Provider:  wrapped,
+		Base:      provider,
+		Breaker:   breaker,
+		Source:    config.Source,
+		CreatedAt: time.Now(),
+	}
+	f.mu.Unlock()
+
 	return wrapped, nil
 }
 
+// Instances returns the providers created so far, the latest per account,
+// ordered by account
+func (f *Factory) Instances() []*Instance {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	instances := make([]*Instance, 0, len(f.instances))
+	for _, instance := range f.instances {
+		instances = append(instances, instance)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Account < instances[j].Account
+	})
+	return instances
+}
+
+// liveSource returns the live credential source for an account, creating it
+// on first use. Every provider created for the account shares it, so
+// recreating providers does not add subscriptions.
+func (f *Factory) liveSource(ctx context.Context, providerID, account string) *auth.LiveCredentials {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if live, ok := f.sources[account]; ok {
+		return live
+	}
+	live := f.authManager.LiveSource(ctx, providerID)
+	f.sources[account] = live
+	return live
+}
+
+// Forget stops tracking the provider created for an account, e.g. when a
+// tenant is offboarded, and closes the account's live credential source.
+// Providers still holding the source keep working but only see changes once
+// their cached credentials age out.
+func (f *Factory) Forget(account string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.instances, account)
+	if live, ok := f.sources[account]; ok {
+		live.Close()
+		delete(f.sources, account)
+	}
+}
+
+// Close forgets every account, closing their live credential sources
+func (f *Factory) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for account, live := range f.sources {
+		live.Close()
+		delete(f.sources, account)
+	}
+	clear(f.instances)
+}
+
 // RetryWrapper wraps a provider with retry logic
 type RetryWrapper struct {
 	provider Provider
 	policy   *reliability.RetryPolicy
+	tracer   trace.Tracer
+	metrics  *metrics.Metrics
 }
 
 func (w *RetryWrapper) Name() string {
@@ -103,21 +300,59 @@ func (w *RetryWrapper) Name() string {
 }
 
 func (w *RetryWrapper) Authenticate(ctx context.Context) error {
-	return reliability.WithRetry(ctx, w.policy, func() error {
-		return w.provider.Authenticate(ctx)
-	})
+	return w.intercept(ctx, "authenticate", w.provider.Authenticate)
 }
 
 func (w *RetryWrapper) HealthCheck(ctx context.Context) error {
-	return reliability.WithRetry(ctx, w.policy, func() error {
-		return w.provider.HealthCheck(ctx)
-	})
+	return w.intercept(ctx, "health_check", w.provider.HealthCheck)
+}
+
+// intercept runs call under the retry policy, each attempt in its own span.
+// Operations that move money run once: without an idempotency key, a retry
+// after a timeout could charge or refund twice.
+func (w *RetryWrapper) intercept(ctx context.Context, operation string, call func(context.Context) error) error {
+	attempt := 0
+	run := func() error {
+		attempt++
+		if attempt > 1 {
+			w.metrics.ProviderRetry(w.provider.Name(), operation)
+		}
+		ctx, span := w.tracer.Start(ctx, w.provider.Name()+"."+operation+".attempt",
+			trace.WithAttributes(tracing.AttemptKey.Int(attempt)))
+		defer span.End()
+
+		err := call(ctx)
+		tracing.RecordError(span, err)
+		return err
+	}
+
+	if !retrySafe(operation) {
+		return run()
+	}
+	return reliability.WithRetry(ctx, w.policy, run)
 }
 
 // RateLimitWrapper wraps a provider with rate limiting
 type RateLimitWrapper struct {
 	provider Provider
-	limiter  *reliability.RateLimiter
+	limiter  rateWaiter
+	tracer   trace.Tracer
+	metrics  *metrics.Metrics
+}
+
+// rateWaiter blocks until a call is allowed
+type rateWaiter interface {
+	Wait(ctx context.Context) error
+}
+
+// sharedQuota waits on one key of a distributed rate limiter
+type sharedQuota struct {
+	limiter reliability.DistributedRateLimiter
+	key     string
+}
+
+func (q *sharedQuota) Wait(ctx context.Context) error {
+	return q.limiter.Wait(ctx, q.key)
 }
 
 func (w *RateLimitWrapper) Name() string {
@@ -125,17 +360,37 @@ func (w *RateLimitWrapper) Name() string {
 }
 
 func (w *RateLimitWrapper) Authenticate(ctx context.Context) error {
-	if err := w.limiter.Wait(ctx); err != nil {
-		return err
-	}
-	return w.provider.Authenticate(ctx)
+	return w.intercept(ctx, "authenticate", w.provider.Authenticate)
 }
 
 func (w *RateLimitWrapper) HealthCheck(ctx context.Context) error {
-	if err := w.limiter.Wait(ctx); err != nil {
+	return w.intercept(ctx, "health_check", w.provider.HealthCheck)
+}
+
+// intercept runs call once the rate limiter allows it
+func (w *RateLimitWrapper) intercept(ctx context.Context, operation string, call func(context.Context) error) error {
+	if err := w.wait(ctx); err != nil {
 		return err
 	}
-	return w.provider.HealthCheck(ctx)
+	return call(ctx)
+}
+
+// wait blocks for the rate limiter, recording the time spent on both a
+// span of its own and the operation's span
+func (w *RateLimitWrapper) wait(ctx context.Context) error {
+	waitCtx, span := w.tracer.Start(ctx, w.provider.Name()+".rate_limit.wait")
+	defer span.End()
+
+	start := time.Now()
+	err := w.limiter.Wait(waitCtx)
+	elapsed := time.Since(start)
+	w.metrics.RateLimitWait(w.provider.Name(), elapsed, err != nil)
+	waited := tracing.RateLimitWaitKey.Float64(tracing.Milliseconds(elapsed))
+
+	span.SetAttributes(waited)
+	trace.SpanFromContext(ctx).SetAttributes(waited)
+	tracing.RecordError(span, err)
+	return err
 }
 
 // CircuitBreakerWrapper wraps a provider with circuit breaker
@@ -149,17 +404,138 @@ func (w *CircuitBreakerWrapper) Name() string {
 }
 
 func (w *CircuitBreakerWrapper) Authenticate(ctx context.Context) error {
-	result, err := w.breaker.Execute(func() (interface{}, error) {
-		return nil, w.provider.Authenticate(ctx)
-	})
-	_ = result
-	return err
+	return w.intercept(ctx, "authenticate", w.provider.Authenticate)
 }
 
 func (w *CircuitBreakerWrapper) HealthCheck(ctx context.Context) error {
-	result, err := w.breaker.Execute(func() (interface{}, error) {
-		return nil, w.provider.HealthCheck(ctx)
+	return w.intercept(ctx, "health_check", w.provider.HealthCheck)
+}
+
+// intercept runs call through the circuit breaker
+func (w *CircuitBreakerWrapper) intercept(ctx context.Context, operation string, call func(context.Context) error) error {
+	w.annotate(ctx)
+	_, err := w.breaker.Execute(func() (interface{}, error) {
+		return nil, call(ctx)
 	})
-	_ = result
 	return err
 }
+
+// annotate records the breaker state on the operation's span
+func (w *CircuitBreakerWrapper) annotate(ctx context.Context) {
+	trace.SpanFromContext(ctx).SetAttributes(tracing.BreakerStateKey.String(w.breaker.State().String()))
+}
+
+// LoggingWrapper logs provider calls
+type LoggingWrapper struct {
+	provider Provider
+	logger   *slog.Logger
+}
+
+func (w *LoggingWrapper) Name() string {
+	return w.provider.Name()
+}
+
+func (w *LoggingWrapper) Authenticate(ctx context.Context) error {
+	return w.intercept(ctx, "authenticate", w.provider.Authenticate)
+}
+
+func (w *LoggingWrapper) HealthCheck(ctx context.Context) error {
+	return w.intercept(ctx, "health_check", w.provider.HealthCheck)
+}
+
+// intercept logs call with its outcome and duration
+func (w *LoggingWrapper) intercept(ctx context.Context, operation string, call func(context.Context) error) error {
+	start := time.Now()
+	err := call(ctx)
+
+	if err != nil {
+		w.logger.WarnContext(ctx, "provider call failed",
+			"operation", operation,
+			"duration", time.Since(start),
+			"error", err,
+		)
+	} else {
+		w.logger.DebugContext(ctx, "provider call",
+			"operation", operation,
+			"duration", time.Since(start),
+		)
+	}
+	return err
+}
+
+// TracingWrapper records a span for each provider operation
+type TracingWrapper struct {
+	provider Provider
+	tracer   trace.Tracer
+	account  string
+}
+
+func (w *TracingWrapper) Name() string {
+	return w.provider.Name()
+}
+
+func (w *TracingWrapper) Authenticate(ctx context.Context) error {
+	return w.intercept(ctx, "authenticate", w.provider.Authenticate)
+}
+
+func (w *TracingWrapper) HealthCheck(ctx context.Context) error {
+	return w.intercept(ctx, "health_check", w.provider.HealthCheck)
+}
+
+// intercept runs call in a client span named after the operation
+func (w *TracingWrapper) intercept(ctx context.Context, operation string, call func(context.Context) error) error {
+	ctx, span := w.tracer.Start(ctx, w.provider.Name()+"."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			tracing.ProviderKey.String(w.provider.Name()),
+			tracing.OperationKey.String(operation),
+			tracing.AccountKey.String(w.account),
+		),
+	)
+	defer span.End()
+
+	err := call(ctx)
+	tracing.RecordError(span, err)
+	return err
+}
+
+// MetricsWrapper counts provider operations by outcome and records their
+// latency
+type MetricsWrapper struct {
+	provider Provider
+	metrics  *metrics.Metrics
+}
+
+func (w *MetricsWrapper) Name() string {
+	return w.provider.Name()
+}
+
+func (w *MetricsWrapper) Authenticate(ctx context.Context) error {
+	return w.intercept(ctx, "authenticate", w.provider.Authenticate)
+}
+
+func (w *MetricsWrapper) HealthCheck(ctx context.Context) error {
+	return w.intercept(ctx, "health_check", w.provider.HealthCheck)
+}
+
+// intercept records call's outcome and latency
+func (w *MetricsWrapper) intercept(ctx context.Context, operation string, call func(context.Context) error) error {
+	start := time.Now()
+	err := call(ctx)
+	w.metrics.ProviderRequest(w.provider.Name(), operation, callOutcome(err), time.Since(start))
+	return err
+}
+
+// callOutcome classifies a provider call's error for metrics
+func callOutcome(err error) string {
+	switch {
+	case err == nil:
+		return metrics.OutcomeSuccess
+	case errors.Is(err, gobreaker.ErrOpenState), errors.Is(err, gobreaker.ErrTooManyRequests):
+		return metrics.OutcomeCircuitOpen
+	case errors.Is(err, reliability.ErrRateLimitExceeded), errors.Is(err, reliability.ErrRateLimited):
+		return metrics.OutcomeRateLimited
+	default:
+		return metrics.OutcomeError
+	}
+}
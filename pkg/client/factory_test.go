@@ -0,0 +1,216 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
+)
+
+// stubProvider is a Provider that records the credentials it was built with
+type stubProvider struct {
+	name   string
+	apiKey string
+}
+
+func (p *stubProvider) Name() string                           { return p.name }
+func (p *stubProvider) Authenticate(ctx context.Context) error { return nil }
+func (p *stubProvider) HealthCheck(ctx context.Context) error  { return nil }
+
+func TestFactoryCreateDoesNotModifySharedConfig(t *testing.T) {
+	ctx := context.Background()
+	manager := auth.NewManager(auth.NewInMemoryStore())
+	for tenant, key := range map[string]string{"acme": "sk_acme", "globex": "sk_globex"} {
+		if err := manager.SetCredentials(auth.WithTenant(ctx, tenant), "stub", &auth.Credentials{APIKey: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	factory := NewFactory(manager)
+	var built []*stubProvider
+	factory.Register("stub", func(config *ProviderConfig) (Provider, error) {
+		p := &stubProvider{name: "stub", apiKey: config.Credentials.APIKey}
+		built = append(built, p)
+		return p, nil
+	})
+
+	template := &ProviderConfig{Name: "stub"}
+	for _, tenant := range []string{"acme", "globex"} {
+		if _, err := factory.Create(auth.WithTenant(ctx, tenant), template); err != nil {
+			t.Fatalf("Create for %s: %v", tenant, err)
+		}
+	}
+
+	if template.Credentials != nil || template.Source != nil {
+		t.Fatal("Create filled credentials into the caller's config")
+	}
+	if built[0].apiKey != "sk_acme" || built[1].apiKey != "sk_globex" {
+		t.Fatalf("providers built with keys %q and %q, want sk_acme and sk_globex", built[0].apiKey, built[1].apiKey)
+	}
+}
+
+func TestFactorySharesLiveSourcePerAccount(t *testing.T) {
+	ctx := auth.WithTenant(context.Background(), "acme")
+	manager := auth.NewManager(auth.NewInMemoryStore())
+	if err := manager.SetCredentials(ctx, "stub", &auth.Credentials{APIKey: "sk_acme"}); err != nil {
+		t.Fatal(err)
+	}
+
+	factory := NewFactory(manager)
+	defer factory.Close()
+	factory.Register("stub", func(config *ProviderConfig) (Provider, error) {
+		return &stubProvider{name: "stub", apiKey: config.Credentials.APIKey}, nil
+	})
+
+	source := func() auth.CredentialSource {
+		t.Helper()
+		if _, err := factory.Create(ctx, &ProviderConfig{Name: "stub"}); err != nil {
+			t.Fatal(err)
+		}
+		return factory.Instances()[0].Source
+	}
+
+	first := source()
+	if second := source(); second != first {
+		t.Fatal("recreating the provider opened a second live source")
+	}
+
+	factory.Forget(auth.KeyFromContext(ctx, "stub").String())
+	if third := source(); third == first {
+		t.Fatal("Forget kept the closed live source")
+	}
+}
+
+// keyCheckingProvider reads its key through the source on every call and
+// fails unless the simulated provider API still accepts it
+type keyCheckingProvider struct {
+	source auth.CredentialSource
+	keys   *issuedKeys
+}
+
+func (p *keyCheckingProvider) Name() string                           { return "stub" }
+func (p *keyCheckingProvider) Authenticate(ctx context.Context) error { return nil }
+
+func (p *keyCheckingProvider) HealthCheck(ctx context.Context) error {
+	creds, err := p.source.Credentials(ctx)
+	if err != nil {
+		return err
+	}
+	if !p.keys.valid(creds.APIKey) {
+		return fmt.Errorf("key %s rejected", creds.APIKey)
+	}
+	return nil
+}
+
+// issuedKeys is a KeyIssuer simulating a provider's API key management
+type issuedKeys struct {
+	mu     sync.Mutex
+	next   int
+	active map[string]bool
+}
+
+func (k *issuedKeys) IssueKey(ctx context.Context, providerID string, current *auth.Credentials) (*auth.Credentials, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.next++
+	key := fmt.Sprintf("sk_%d", k.next)
+	k.active[key] = true
+	return &auth.Credentials{APIKey: key}, nil
+}
+
+func (k *issuedKeys) RevokeKey(ctx context.Context, providerID string, old *auth.Credentials) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.active, old.APIKey)
+	return nil
+}
+
+func (k *issuedKeys) valid(key string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.active[key]
+}
+
+func TestFactoryProvidersSurviveRotationWithoutFailedCalls(t *testing.T) {
+	ctx := auth.WithTenant(context.Background(), "acme")
+	manager := auth.NewManager(auth.NewInMemoryStore())
+	keys := &issuedKeys{active: map[string]bool{"sk_0": true}}
+	manager.RegisterKeyIssuer("stub", keys)
+	if err := manager.SetCredentials(ctx, "stub", &auth.Credentials{Type: auth.CredentialTypeAPIKey, APIKey: "sk_0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	factory := NewFactory(manager)
+	defer factory.Close()
+	factory.Register("stub", func(config *ProviderConfig) (Provider, error) {
+		return &keyCheckingProvider{source: config.Source, keys: keys}, nil
+	})
+	provider, err := factory.Create(ctx, &ProviderConfig{Name: "stub"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls, failures atomic.Int64
+	var firstFailure atomic.Value
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				calls.Add(1)
+				if err := provider.HealthCheck(ctx); err != nil {
+					failures.Add(1)
+					firstFailure.CompareAndSwap(nil, err)
+				}
+			}
+		}()
+	}
+
+	// The overlap only has to outlast calls already in flight with the old key
+	const rotations = 3
+	for i := 0; i < rotations; i++ {
+		if _, err := manager.RotateAPIKeyWithOverlap(ctx, "stub", 200*time.Millisecond); err != nil {
+			t.Fatalf("rotation %d: %v", i+1, err)
+		}
+		awaitRotationComplete(t, ctx, manager)
+	}
+	close(stop)
+	wg.Wait()
+
+	if n := failures.Load(); n != 0 {
+		t.Fatalf("%d of %d calls failed during rotation, first: %v", n, calls.Load(), firstFailure.Load())
+	}
+	if keys.valid("sk_0") || !keys.valid(fmt.Sprintf("sk_%d", rotations)) {
+		t.Fatal("rotations did not revoke the old keys")
+	}
+}
+
+// awaitRotationComplete waits for the overlap window to close and the old key
+// to be revoked
+func awaitRotationComplete(t *testing.T, ctx context.Context, manager *auth.Manager) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		creds, err := manager.GetCredentials(ctx, "stub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds.Previous == nil {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("rotation did not complete")
+}
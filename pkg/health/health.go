@@ -0,0 +1,506 @@
+// Package health aggregates the health of the providers created through a
+// client.Factory, and of any other registered dependency, into liveness and
+// readiness endpoints.
+package health
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
+	"github.com/PrakarshSingh5/fintechkit/pkg/client"
+	"github.com/PrakarshSingh5/fintechkit/pkg/logging"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sony/gobreaker"
+)
+
+// Status is the health of a dependency or of the service as a whole
+type Status string
+
+const (
+	StatusUp       Status = "up"
+	StatusDegraded Status = "degraded" // Working, but needs attention soon
+	StatusDown     Status = "down"
+)
+
+// worse returns the more severe of two statuses
+func worse(a, b Status) Status {
+	if a == StatusDown || b == StatusDown {
+		return StatusDown
+	}
+	if a == StatusDegraded || b == StatusDegraded {
+		return StatusDegraded
+	}
+	return StatusUp
+}
+
+// CheckFunc checks one dependency, returning nil when it is healthy
+type CheckFunc func(ctx context.Context) error
+
+// CheckResult is the outcome of checking one dependency
+type CheckResult struct {
+	Name       string    `json:"name"`
+	Status     Status    `json:"status"`
+	Critical   bool      `json:"critical"`
+	Provider   string    `json:"provider,omitempty"`
+	Breaker    string    `json:"breaker,omitempty"`
+	ExpiresAt  time.Time `json:"credentials_expire_at,omitzero"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// Report is the aggregated result of a round of checks. Ready is false
+// while any critical dependency is down.
+type Report struct {
+	Status    Status         `json:"status"`
+	Ready     bool           `json:"ready"`
+	CheckedAt time.Time      `json:"checked_at"`
+	Checks    []*CheckResult `json:"checks"`
+}
+
+// CheckerConfig configures a Checker
+type CheckerConfig struct {
+	Factory  *client.Factory // Providers created through it are checked
+	Interval time.Duration   // How often checks run; results are cached in between
+	Timeout  time.Duration   // Per check
+
+	// Concurrency bounds how many checks run at once
+	Concurrency int
+
+	// Critical names the providers whose failure makes the service not
+	// ready. Other providers only degrade it. Empty means every provider is
+	// critical.
+	Critical []string
+
+	// ExpiryWarning degrades a provider whose credentials expire within it
+	ExpiryWarning time.Duration
+
+	Logger *slog.Logger // Reports status changes; defaults to logging.Logger()
+}
+
+// DefaultCheckerConfig returns sensible defaults
+func DefaultCheckerConfig() *CheckerConfig {
+	return &CheckerConfig{
+		Interval:      30 * time.Second,
+		Timeout:       5 * time.Second,
+		Concurrency:   8,
+		ExpiryWarning: 24 * time.Hour,
+	}
+}
+
+// check is a registered dependency check
+type check struct {
+	name     string
+	critical bool
+	fn       CheckFunc
+}
+
+// Checker periodically checks providers and registered dependencies and
+// serves the cached results
+type Checker struct {
+	config   *CheckerConfig
+	critical map[string]bool
+
+	mu     sync.RWMutex
+	checks []check
+	report *Report
+
+	refresh  sync.Mutex // Serializes check rounds
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewChecker creates a new health checker. A nil config uses
+// DefaultCheckerConfig.
+func NewChecker(config *CheckerConfig) *Checker {
+	if config == nil {
+		config = DefaultCheckerConfig()
+	}
+	defaults := DefaultCheckerConfig()
+	if config.Interval <= 0 {
+		config.Interval = defaults.Interval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaults.Concurrency
+	}
+	if config.ExpiryWarning <= 0 {
+		config.ExpiryWarning = defaults.ExpiryWarning
+	}
+
+	critical := make(map[string]bool, len(config.Critical))
+	for _, name := range config.Critical {
+		critical[name] = true
+	}
+
+	return &Checker{
+		config:   config,
+		critical: critical,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// AddCheck registers a dependency other than a provider, such as a database
+func (c *Checker) AddCheck(name string, critical bool, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, critical: critical, fn: fn})
+}
+
+// Check runs every check now, caches the report and returns it
+func (c *Checker) Check(ctx context.Context) *Report {
+	c.refresh.Lock()
+	defer c.refresh.Unlock()
+	return c.run(ctx)
+}
+
+// Report returns the cached report, or nil before the first check
+func (c *Checker) Report() *Report {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.report
+}
+
+// current returns the cached report, checking first when it is missing or
+// older than the interval, e.g. because Start was not called
+func (c *Checker) current(ctx context.Context) *Report {
+	if report := c.Report(); report != nil && time.Since(report.CheckedAt) < c.config.Interval {
+		return report
+	}
+
+	c.refresh.Lock()
+	defer c.refresh.Unlock()
+
+	// Another request may have refreshed while we waited
+	if report := c.Report(); report != nil && time.Since(report.CheckedAt) < c.config.Interval {
+		return report
+	}
+	return c.run(ctx)
+}
+
+// run checks every dependency, at most Concurrency at a time. Callers must
+// hold c.refresh.
+//
+// Breakers and credentials are checked per account, but each provider's API
+// is probed once per round, through its first account with usable
+// credentials, however many tenants have created a client for it.
+func (c *Checker) run(ctx context.Context) *Report {
+	var instances []*client.Instance
+	if c.config.Factory != nil {
+		instances = c.config.Factory.Instances()
+	}
+	c.mu.RLock()
+	checks := append([]check(nil), c.checks...)
+	previous := c.report
+	c.mu.RUnlock()
+
+	accounts := make([]*accountCheck, len(instances))
+	c.parallel(len(instances), func(i int) {
+		accounts[i] = c.checkAccount(ctx, instances[i])
+	})
+
+	var providers []string
+	byProvider := make(map[string][]*accountCheck)
+	for _, account := range accounts {
+		name := account.instance.Name
+		if _, ok := byProvider[name]; !ok {
+			providers = append(providers, name)
+		}
+		byProvider[name] = append(byProvider[name], account)
+	}
+
+	dependencies := make([]*CheckResult, len(checks))
+	c.parallel(len(providers)+len(checks), func(i int) {
+		if i < len(providers) {
+			c.probeProvider(ctx, byProvider[providers[i]])
+			return
+		}
+		dependencies[i-len(providers)] = c.checkDependency(ctx, checks[i-len(providers)])
+	})
+
+	results := make([]*CheckResult, 0, len(accounts)+len(dependencies))
+	for _, account := range accounts {
+		results = append(results, account.finish())
+	}
+	results = append(results, dependencies...)
+
+	report := &Report{Status: StatusUp, Ready: true, CheckedAt: time.Now(), Checks: results}
+	for _, result := range results {
+		if result.Status == StatusDown && result.Critical {
+			report.Ready = false
+			report.Status = StatusDown
+		} else if result.Status != StatusUp {
+			report.Status = worse(report.Status, StatusDegraded)
+		}
+	}
+
+	c.logChanges(ctx, previous, report)
+
+	c.mu.Lock()
+	c.report = report
+	c.mu.Unlock()
+	return report
+}
+
+// parallel calls fn for 0..n-1 on at most Concurrency goroutines
+func (c *Checker) parallel(n int, fn func(i int)) {
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(n, c.config.Concurrency); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// accountCheck is a provider account's result while a round is running
+type accountCheck struct {
+	instance *client.Instance
+	result   *CheckResult
+	problems []error
+	usable   bool // Credentials can be used to probe the provider
+}
+
+// fail records a problem that leaves the account at status at best
+func (a *accountCheck) fail(status Status, err error) {
+	a.result.Status = worse(a.result.Status, status)
+	a.problems = append(a.problems, err)
+}
+
+// finish completes the result once every check has reported
+func (a *accountCheck) finish() *CheckResult {
+	if err := errors.Join(a.problems...); err != nil {
+		a.result.Error = redactor.String(err.Error())
+	}
+	a.result.CheckedAt = time.Now()
+	return a.result
+}
+
+// checkAccount folds an account's circuit breaker state and credential
+// expiry into its result
+func (c *Checker) checkAccount(ctx context.Context, instance *client.Instance) *accountCheck {
+	account := &accountCheck{
+		instance: instance,
+		result: &CheckResult{
+			Name:     instance.Account,
+			Status:   StatusUp,
+			Critical: len(c.critical) == 0 || c.critical[instance.Name],
+			Provider: instance.Name,
+		},
+		usable: true,
+	}
+
+	if instance.Breaker != nil {
+		state := instance.Breaker.State()
+		account.result.Breaker = state.String()
+		switch state {
+		case gobreaker.StateOpen:
+			account.fail(StatusDown, gobreaker.ErrOpenState)
+		case gobreaker.StateHalfOpen:
+			account.result.Status = worse(account.result.Status, StatusDegraded)
+		}
+	}
+
+	if instance.Source == nil {
+		return account
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	creds, err := instance.Source.Credentials(ctx)
+	if errors.Is(err, auth.ErrTokenExpired) {
+		// Look past the expiry to tell whether the token can be refreshed
+		if stored, ok := instance.Source.(storedSource); ok {
+			if creds, err = stored.StoredCredentials(ctx); err == nil {
+				account.usable = false
+			}
+		}
+	}
+
+	switch {
+	case err != nil:
+		account.usable = false
+		account.fail(StatusDown, err)
+	case !creds.ExpiresAt.IsZero():
+		account.result.ExpiresAt = creds.ExpiresAt
+		remaining := time.Until(creds.ExpiresAt)
+		if remaining <= 0 && !refreshable(creds) {
+			account.usable = false
+			account.fail(StatusDown, ErrCredentialsExpired)
+		} else if remaining <= 0 {
+			// Refreshed on next use, unless the refresh keeps failing
+			account.fail(StatusDegraded, auth.ErrTokenExpired)
+		} else if remaining < c.config.ExpiryWarning {
+			// Still usable but needs rotating soon
+			account.result.Status = worse(account.result.Status, StatusDegraded)
+		}
+	}
+	return account
+}
+
+// storedSource is implemented by credential sources that can return
+// credentials without checking their expiry, like auth.LiveCredentials
+type storedSource interface {
+	StoredCredentials(ctx context.Context) (*auth.Credentials, error)
+}
+
+// refreshable reports whether expired credentials can be replaced without
+// the account holder's involvement
+func refreshable(creds *auth.Credentials) bool {
+	return creds.RefreshToken != "" || creds.Metadata[auth.MetadataGrantType] == auth.GrantTypeClientCredentials
+}
+
+// probeProvider runs one provider health check for all of a provider's
+// accounts. It calls the unwrapped provider, so a probe neither retries nor
+// is refused by an open breaker.
+func (c *Checker) probeProvider(ctx context.Context, accounts []*accountCheck) {
+	var probe *accountCheck
+	for _, account := range accounts {
+		if account.usable {
+			probe = account
+			break
+		}
+	}
+	if probe == nil {
+		return // Every account is already down for its credentials
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := probe.instance.Base.HealthCheck(ctx)
+	duration := time.Since(start).Milliseconds()
+
+	for _, account := range accounts {
+		account.result.DurationMS = duration
+		if err != nil {
+			account.fail(StatusDown, err)
+		}
+	}
+}
+
+// checkDependency runs a registered check
+func (c *Checker) checkDependency(ctx context.Context, dep check) *CheckResult {
+	result := &CheckResult{Name: dep.name, Status: StatusUp, Critical: dep.critical}
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+	start := time.Now()
+
+	if err := dep.fn(ctx); err != nil {
+		result.Status = StatusDown
+		result.Error = redactor.String(err.Error())
+	}
+	result.DurationMS = time.Since(start).Milliseconds()
+	result.CheckedAt = time.Now()
+	return result
+}
+
+// ErrCredentialsExpired is reported for providers whose credentials have
+// expired and cannot be refreshed
+var ErrCredentialsExpired = errors.New("credentials expired")
+
+// redactor scrubs credentials and personal data from reported errors
+var redactor = logging.NewRedactor(nil)
+
+// logChanges logs dependencies whose status changed since the last round
+func (c *Checker) logChanges(ctx context.Context, previous, report *Report) {
+	before := make(map[string]Status)
+	if previous != nil {
+		for _, result := range previous.Checks {
+			before[result.Name] = result.Status
+		}
+	}
+
+	logger := logging.OrDefault(c.config.Logger)
+	for _, result := range report.Checks {
+		was, seen := before[result.Name]
+		if was == result.Status || (!seen && result.Status == StatusUp) {
+			continue
+		}
+
+		level := slog.LevelInfo
+		if result.Status != StatusUp {
+			level = slog.LevelWarn
+		}
+		logger.Log(ctx, level, "dependency health changed",
+			"dependency", result.Name,
+			"critical", result.Critical,
+			"from", string(was),
+			"to", string(result.Status),
+			"error", result.Error,
+		)
+	}
+}
+
+// Start runs the checks every interval in the background
+func (c *Checker) Start(ctx context.Context) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.Check(ctx)
+
+		ticker := time.NewTicker(c.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.stopChan:
+				return
+			case <-ticker.C:
+				c.Check(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops the background checks. It is safe to call more than once.
+func (c *Checker) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopChan)
+	})
+	c.wg.Wait()
+}
+
+// Liveness serves /healthz: 200 while the process can handle requests.
+// Dependencies are deliberately ignored, so an outage at a provider does not
+// get the service restarted.
+func (c *Checker) Liveness() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		return ctx.JSON(fiber.Map{"status": StatusUp})
+	}
+}
+
+// Readiness serves /readyz: the cached report with per-dependency detail,
+// with 503 while any critical dependency is down
+func (c *Checker) Readiness() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		report := c.current(ctx.UserContext())
+
+		status := fiber.StatusOK
+		if !report.Ready {
+			status = fiber.StatusServiceUnavailable
+		}
+		ctx.Set(fiber.HeaderCacheControl, "no-store")
+		return ctx.Status(status).JSON(report)
+	}
+}
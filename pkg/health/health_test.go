@@ -0,0 +1,155 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
+	"github.com/PrakarshSingh5/fintechkit/pkg/client"
+)
+
+// probedProvider is a Provider whose health checks are counted
+type probedProvider struct {
+	name  string
+	probe func(ctx context.Context) error
+}
+
+func (p *probedProvider) Name() string                           { return p.name }
+func (p *probedProvider) Authenticate(ctx context.Context) error { return nil }
+func (p *probedProvider) HealthCheck(ctx context.Context) error  { return p.probe(ctx) }
+
+// newTestFactory registers each provider name with probe and creates a
+// client for it in every tenant
+func newTestFactory(t *testing.T, names, tenants []string, creds *auth.Credentials, probe func(ctx context.Context) error) (*client.Factory, *auth.Manager) {
+	t.Helper()
+	ctx := context.Background()
+	manager := auth.NewManager(auth.NewInMemoryStore())
+	factory := client.NewFactory(manager)
+	t.Cleanup(factory.Close)
+
+	for _, name := range names {
+		factory.Register(name, func(config *client.ProviderConfig) (client.Provider, error) {
+			return &probedProvider{name: name, probe: probe}, nil
+		})
+		for _, tenant := range tenants {
+			scoped := auth.WithTenant(ctx, tenant)
+			if err := manager.SetCredentials(scoped, name, creds); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := factory.Create(scoped, &client.ProviderConfig{Name: name}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return factory, manager
+}
+
+func TestCheckerProbesEachProviderOnce(t *testing.T) {
+	var probes atomic.Int32
+	tenants := []string{"acme", "globex", "initech", "umbrella"}
+	factory, _ := newTestFactory(t, []string{"bank"}, tenants, &auth.Credentials{APIKey: "sk_test"}, func(ctx context.Context) error {
+		probes.Add(1)
+		return fmt.Errorf("bank unavailable")
+	})
+
+	report := NewChecker(&CheckerConfig{Factory: factory}).Check(context.Background())
+
+	if got := probes.Load(); got != 1 {
+		t.Fatalf("got %d probes, want 1", got)
+	}
+	if len(report.Checks) != len(tenants) {
+		t.Fatalf("got %d results, want %d", len(report.Checks), len(tenants))
+	}
+	for _, result := range report.Checks {
+		if result.Status != StatusDown {
+			t.Fatalf("%s: got status %s, want %s", result.Name, result.Status, StatusDown)
+		}
+	}
+}
+
+func TestCheckerBoundsConcurrency(t *testing.T) {
+	var active, peak atomic.Int32
+	names := make([]string, 12)
+	for i := range names {
+		names[i] = fmt.Sprintf("bank%d", i)
+	}
+	factory, _ := newTestFactory(t, names, []string{"acme"}, &auth.Credentials{APIKey: "sk_test"}, func(ctx context.Context) error {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			seen := peak.Load()
+			if n <= seen || peak.CompareAndSwap(seen, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+
+	report := NewChecker(&CheckerConfig{Factory: factory, Concurrency: 3}).Check(context.Background())
+
+	if report.Status != StatusUp {
+		t.Fatalf("got status %s, want %s", report.Status, StatusUp)
+	}
+	if got := peak.Load(); got > 3 {
+		t.Fatalf("got %d concurrent probes, want at most 3", got)
+	}
+}
+
+func TestCheckerExpiredTokens(t *testing.T) {
+	tests := []struct {
+		name         string
+		refreshToken string
+		want         Status
+	}{
+		{"refreshable", "rt_test", StatusDegraded},
+		{"not refreshable", "", StatusDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := auth.WithTenant(context.Background(), "acme")
+			var mu sync.Mutex
+			probed := false
+			factory, manager := newTestFactory(t, []string{"bank"}, []string{"acme"}, &auth.Credentials{
+				Type:        auth.CredentialTypeOAuth,
+				AccessToken: "at_test",
+				ExpiresAt:   time.Now().Add(time.Hour),
+			}, func(ctx context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				probed = true
+				return nil
+			})
+
+			// Expire the token after the client was created
+			if err := manager.SetCredentials(ctx, "bank", &auth.Credentials{
+				Type:         auth.CredentialTypeOAuth,
+				AccessToken:  "at_test",
+				RefreshToken: tt.refreshToken,
+				ExpiresAt:    time.Now().Add(-time.Minute),
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			report := NewChecker(&CheckerConfig{Factory: factory}).Check(context.Background())
+
+			result := report.Checks[0]
+			if result.Status != tt.want {
+				t.Fatalf("got status %s (%s), want %s", result.Status, result.Error, tt.want)
+			}
+			if result.ExpiresAt.IsZero() {
+				t.Fatal("result does not report when the credentials expired")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if probed {
+				t.Fatal("probed the provider with an expired token")
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Package logging provides the structured logger used across fintechkit,
+// with redaction of card numbers, account numbers, credentials and personal
+// data applied before anything reaches the output.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+)
+
+var logger atomic.Pointer[slog.Logger]
+
+// Logger returns the logger the library writes to: the one set with
+// SetLogger, or else slog.Default() behind the default redactor
+func Logger() *slog.Logger {
+	if l := logger.Load(); l != nil {
+		return l
+	}
+	return slog.New(NewHandler(slog.Default().Handler(), nil))
+}
+
+// SetLogger makes the library log to l, with redaction (see Redacted). A
+// nil logger restores the default.
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		logger.Store(nil)
+		return
+	}
+	logger.Store(Redacted(l))
+}
+
+// OrDefault returns l with redaction, or Logger() when l is nil
+func OrDefault(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return Logger()
+	}
+	return Redacted(l)
+}
+
+// Redacted returns l with its handler wrapped by the default redactor,
+// unless it already redacts
+func Redacted(l *slog.Logger) *slog.Logger {
+	if _, ok := l.Handler().(*Handler); ok {
+		return l
+	}
+	return slog.New(NewHandler(l.Handler(), nil))
+}
+
+// Handler is a slog.Handler that redacts attributes and messages before
+// passing records to the wrapped handler
+type Handler struct {
+	inner    slog.Handler
+	redactor *Redactor
+}
+
+// NewHandler wraps inner with redaction. A nil redactor uses
+// DefaultRedactorConfig.
+func NewHandler(inner slog.Handler, redactor *Redactor) *Handler {
+	if redactor == nil {
+		redactor = defaultRedactor
+	}
+	return &Handler{inner: inner, redactor: redactor}
+}
+
+var defaultRedactor = NewRedactor(nil)
+
+// Enabled reports whether the wrapped handler handles level
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+// Handle redacts the record and passes it on
+func (h *Handler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, h.redactor.String(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(h.attr(attr))
+		return true
+	})
+	return h.inner.Handle(ctx, redacted)
+}
+
+// WithAttrs redacts attrs once and passes them on
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = h.attr(attr)
+	}
+	return &Handler{inner: h.inner.WithAttrs(redacted), redactor: h.redactor}
+}
+
+// WithGroup passes the group on
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{inner: h.inner.WithGroup(name), redactor: h.redactor}
+}
+
+// attr redacts one attribute
+func (h *Handler) attr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+
+	if h.redactor.SensitiveField(attr.Key) && value.Kind() != slog.KindGroup {
+		if value.Kind() == slog.KindString && value.String() == "" {
+			return attr
+		}
+		return slog.String(attr.Key, h.redactor.mask)
+	}
+
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, h.redactor.String(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, child := range group {
+			redacted[i] = h.attr(child)
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redacted...)}
+	case slog.KindAny:
+		return slog.Attr{Key: attr.Key, Value: h.any(value.Any())}
+	default:
+		return slog.Attr{Key: attr.Key, Value: value}
+	}
+}
+
+// any redacts values slog would otherwise print as they are
+func (h *Handler) any(v any) slog.Value {
+	switch v := v.(type) {
+	case nil:
+		return slog.AnyValue(nil)
+	case error:
+		return slog.StringValue(h.redactor.String(v.Error()))
+	case json.RawMessage:
+		return slog.AnyValue(json.RawMessage(h.redactor.JSON(v)))
+	case []byte:
+		return slog.StringValue(string(h.redactor.JSON(v)))
+	case fmt.Stringer:
+		return slog.StringValue(h.redactor.String(v.String()))
+	}
+
+	// Structs, maps and slices: redact their JSON form
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return slog.StringValue(h.redactor.String(fmt.Sprintf("%+v", v)))
+	}
+	return slog.AnyValue(json.RawMessage(h.redactor.JSON(encoded)))
+}
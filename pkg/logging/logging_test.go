@@ -0,0 +1,193 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// newTestLogger returns a redacting logger writing JSON lines to a buffer
+func newTestLogger() (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return Redacted(slog.New(slog.NewJSONHandler(&buf, nil))), &buf
+}
+
+// customer logs itself as a group
+type customer struct {
+	ID    string
+	Email string
+}
+
+func (c customer) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("id", c.ID), slog.String("email", c.Email))
+}
+
+// cardHolder logs itself as a string
+type cardHolder struct {
+	Number string
+}
+
+func (c cardHolder) LogValue() slog.Value {
+	return slog.StringValue("card " + c.Number)
+}
+
+func TestHandlerRedacts(t *testing.T) {
+	tests := []struct {
+		name   string
+		log    func(l *slog.Logger)
+		secret string
+		keep   string // Must survive, to catch over-redaction
+	}{
+		{
+			"sensitive attr",
+			func(l *slog.Logger) { l.Info("created", "client_secret", "cs_abc123", "client_id", "ci_abc123") },
+			"cs_abc123", "ci_abc123",
+		},
+		{
+			"pattern in attr",
+			func(l *slog.Logger) { l.Info("declined", "note", "paid with 4242 4242 4242 4242", "amount", 5000) },
+			"4242 4242 4242 4242", `"amount":5000`,
+		},
+		{
+			"pattern in message",
+			func(l *slog.Logger) { l.Info("retrying with sk_live_51HxYzAbCdEfGh") },
+			"sk_live_51HxYzAbCdEfGh", "retrying with",
+		},
+		{
+			"error",
+			func(l *slog.Logger) { l.Error("failed", "error", errors.New("rejected Bearer abc123.def456")) },
+			"abc123.def456", "rejected",
+		},
+		{
+			"group",
+			func(l *slog.Logger) {
+				l.Info("charged", slog.Group("card", "card_number", "4000056655665556", "last4", "5556"))
+			},
+			"4000056655665556", `"last4":"5556"`,
+		},
+		{
+			"nested group",
+			func(l *slog.Logger) {
+				l.Info("charged", slog.Group("payment", slog.Group("source", "cvc", "123", "brand", "visa")))
+			},
+			`"123"`, `"brand":"visa"`,
+		},
+		{
+			"WithGroup",
+			func(l *slog.Logger) {
+				l.WithGroup("request").Info("received", "authorization", "opaque-value", "method", "POST")
+			},
+			"opaque-value", `"request":{`,
+		},
+		{
+			"WithAttrs",
+			func(l *slog.Logger) { l.With("api_key", "opaque-value").Info("called", "provider", "stripe") },
+			"opaque-value", `"provider":"stripe"`,
+		},
+		{
+			"LogValuer group",
+			func(l *slog.Logger) {
+				l.Info("signed up", "customer", customer{ID: "cus_1", Email: "jane@example.com"})
+			},
+			"jane@example.com", `"id":"cus_1"`,
+		},
+		{
+			"LogValuer in group",
+			func(l *slog.Logger) {
+				l.Info("signed up", slog.Group("order", slog.Any("customer", customer{ID: "cus_1", Email: "jane@example.com"})))
+			},
+			"jane@example.com", `"id":"cus_1"`,
+		},
+		{
+			"LogValuer string",
+			func(l *slog.Logger) { l.Info("charged", "holder", cardHolder{Number: "4242424242424242"}) },
+			"4242424242424242", "card ",
+		},
+		{
+			"struct",
+			func(l *slog.Logger) {
+				l.Info("linked", "account", struct {
+					AccountNumber string `json:"account_number"`
+					Bank          string `json:"bank"`
+				}{"000123456789", "Chase"})
+			},
+			"000123456789", "Chase",
+		},
+		{
+			"map",
+			func(l *slog.Logger) {
+				l.Info("token", "response", map[string]any{"access_token": "at_1", "expires_in": 3600})
+			},
+			"at_1", `"expires_in":3600`,
+		},
+		{
+			"JSON body",
+			func(l *slog.Logger) { l.Info("request", "body", []byte(`{"password": "hunter2", "user": "jane"}`)) },
+			"hunter2", "jane",
+		},
+		{
+			"raw JSON",
+			func(l *slog.Logger) {
+				l.Info("request", "body", json.RawMessage(`{"ssn": "078-05-1120", "state": "NY"}`))
+			},
+			"078-05-1120", `"state":"NY"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, buf := newTestLogger()
+			tt.log(logger)
+
+			got := buf.String()
+			if !json.Valid([]byte(got)) {
+				t.Fatalf("got invalid JSON line %s", got)
+			}
+			if strings.Contains(got, tt.secret) || !strings.Contains(got, "[REDACTED]") {
+				t.Fatalf("got %s, want %s masked", got, tt.secret)
+			}
+			if !strings.Contains(got, tt.keep) {
+				t.Fatalf("got %s, want %s kept", got, tt.keep)
+			}
+		})
+	}
+}
+
+func TestHandlerKeepsEmptySensitiveValues(t *testing.T) {
+	logger, buf := newTestLogger()
+	logger.Info("no key", "api_key", "")
+
+	if got := buf.String(); strings.Contains(got, "[REDACTED]") || !strings.Contains(got, `"api_key":""`) {
+		t.Fatalf("got %s, want the empty value shown", got)
+	}
+}
+
+func TestRedactedWrapsOnce(t *testing.T) {
+	logger, _ := newTestLogger()
+	if again := Redacted(logger); again != logger {
+		t.Fatal("Redacted wrapped a logger that already redacts")
+	}
+	if OrDefault(logger) != logger {
+		t.Fatal("OrDefault wrapped a logger that already redacts")
+	}
+}
+
+func TestSetLoggerRedacts(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { SetLogger(nil) })
+
+	Logger().Info("configured", "webhook_signing_key", "whsec_abc123")
+	OrDefault(nil).Info("configured", "password", "hunter2")
+
+	got := buf.String()
+	if strings.Contains(got, "whsec_abc123") || strings.Contains(got, "hunter2") {
+		t.Fatalf("got %s, want the secrets masked", got)
+	}
+	if strings.Count(got, "[REDACTED]") != 2 {
+		t.Fatalf("got %s, want two masked values", got)
+	}
+}
@@ -0,0 +1,210 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Pattern finds sensitive values inside free text
+type Pattern struct {
+	Name   string
+	Regexp *regexp.Regexp
+	Match  func(s string) bool // Optional check on each match, e.g. a Luhn check
+}
+
+// Built-in patterns
+var (
+	CardNumberPattern = Pattern{
+		Name:   "card_number",
+		Regexp: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		Match:  luhnValid,
+	}
+	EmailPattern = Pattern{
+		Name:   "email",
+		Regexp: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	}
+	BearerTokenPattern = Pattern{
+		Name:   "bearer_token",
+		Regexp: regexp.MustCompile(`(?i)\b(?:bearer|basic)\s+[A-Za-z0-9._~+/-]+=*`),
+	}
+	JWTPattern = Pattern{
+		Name:   "jwt",
+		Regexp: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	}
+	APIKeyPattern = Pattern{
+		Name:   "api_key",
+		Regexp: regexp.MustCompile(`\b(?:(?:sk|pk|rk)_(?:live|test)|rzp_(?:live|test)|fk_[0-9a-f]{16})_[A-Za-z0-9_-]{8,}`),
+	}
+	IBANPattern = Pattern{
+		Name:   "iban",
+		Regexp: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,4})?\b`),
+	}
+)
+
+// RedactorConfig configures a Redactor
+type RedactorConfig struct {
+	// Fields are attribute and JSON field names whose values are always
+	// masked. Matching ignores case, '_' and '-', and also applies to names
+	// ending in a field, so "secret" covers "client_secret".
+	Fields []string
+
+	// Patterns are masked wherever they appear in string values
+	Patterns []Pattern
+
+	Mask string
+}
+
+// DefaultRedactorConfig masks card and account numbers, credentials, tokens
+// and contact details
+func DefaultRedactorConfig() *RedactorConfig {
+	return &RedactorConfig{
+		Fields: []string{
+			"password", "secret", "api_key", "authorization", "cookie",
+			"token", "private_key", "signing_key", "signature",
+			"card_number", "cvc", "cvv", "account_number", "routing_number", "sort_code", "iban",
+			"ssn", "tax_id", "email", "phone", "dob", "date_of_birth",
+		},
+		Patterns: []Pattern{
+			JWTPattern, BearerTokenPattern, APIKeyPattern,
+			CardNumberPattern, IBANPattern, EmailPattern,
+		},
+		Mask: "[REDACTED]",
+	}
+}
+
+// Redactor masks sensitive data in strings and JSON. It is safe for
+// concurrent use.
+type Redactor struct {
+	fields   []string
+	patterns []Pattern
+	mask     string
+}
+
+// NewRedactor creates a redactor
+func NewRedactor(config *RedactorConfig) *Redactor {
+	if config == nil {
+		config = DefaultRedactorConfig()
+	}
+
+	r := &Redactor{
+		patterns: append([]Pattern(nil), config.Patterns...),
+		mask:     config.Mask,
+	}
+	if r.mask == "" {
+		r.mask = "[REDACTED]"
+	}
+	for _, field := range config.Fields {
+		r.fields = append(r.fields, normalizeField(field))
+	}
+	return r
+}
+
+// SensitiveField reports whether values under name are always masked
+func (r *Redactor) SensitiveField(name string) bool {
+	name = normalizeField(name)
+	if name == "" {
+		return false
+	}
+	for _, field := range r.fields {
+		if strings.HasSuffix(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// String masks every pattern match in s
+func (r *Redactor) String(s string) string {
+	for _, p := range r.patterns {
+		s = p.Regexp.ReplaceAllStringFunc(s, func(match string) string {
+			if p.Match != nil && !p.Match(match) {
+				return match
+			}
+			return r.mask
+		})
+	}
+	return s
+}
+
+// JSON masks sensitive fields and patterns in a JSON document. Input that
+// is not JSON is treated as text.
+func (r *Redactor) JSON(body []byte) []byte {
+	var doc any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil || decoder.More() {
+		return []byte(r.String(string(body)))
+	}
+
+	redacted, err := json.Marshal(r.value(doc))
+	if err != nil {
+		return []byte(r.mask)
+	}
+	return redacted
+}
+
+// value masks a decoded JSON value
+func (r *Redactor) value(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if r.SensitiveField(key) {
+				v[key] = r.mask
+			} else {
+				v[key] = r.value(child)
+			}
+		}
+		return v
+	case []any:
+		for i, child := range v {
+			v[i] = r.value(child)
+		}
+		return v
+	case string:
+		return r.String(v)
+	case json.Number:
+		// Card numbers sent as JSON numbers
+		if r.String(string(v)) != string(v) {
+			return r.mask
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func normalizeField(name string) string {
+	return strings.Map(func(c rune) rune {
+		if c == '_' || c == '-' {
+			return -1
+		}
+		if 'A' <= c && c <= 'Z' {
+			return c + ('a' - 'A')
+		}
+		return c
+	}, name)
+}
+
+// luhnValid reports whether the digits in s pass the Luhn check, which every
+// card number does and most other long numbers do not
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
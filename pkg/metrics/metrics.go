@@ -0,0 +1,326 @@
+// Package metrics exposes fintechkit's Prometheus metrics: provider calls,
+// retries, circuit breakers, rate limiting, webhooks and the dead letter
+// queue, with a Fiber handler serving them in the Prometheus text format.
+package metrics
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes every metric name
+const Namespace = "fintechkit"
+
+// Circuit breaker states as reported by the state gauge
+const (
+	BreakerClosed   = 0
+	BreakerHalfOpen = 1
+	BreakerOpen     = 2
+)
+
+// Provider call outcomes
+const (
+	OutcomeSuccess     = "success"
+	OutcomeError       = "error"
+	OutcomeCircuitOpen = "circuit_open"
+	OutcomeRateLimited = "rate_limited"
+)
+
+// Webhook outcomes
+const (
+	WebhookAccepted        = "accepted"
+	WebhookDuplicate       = "duplicate"
+	WebhookInvalid         = "invalid_signature"
+	WebhookValid           = "valid"
+	WebhookMalformed       = "malformed"
+	WebhookUnknownProvider = "unknown_provider"
+	WebhookUnavailable     = "unavailable"
+	WebhookFailed          = "failed"
+	WebhookTooLarge        = "too_large"
+)
+
+// UnknownProvider is the label used for webhooks addressed to a provider that
+// is not configured, so arbitrary path segments cannot create new series
+const UnknownProvider = "unknown"
+
+// OtherEventType is the label used for webhook event types outside the
+// configured set, since payloads name their own types
+const OtherEventType = "other"
+
+// Metrics holds the collectors fintechkit reports to. All methods are safe
+// to call on a nil *Metrics, which records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	providerRequests    *prometheus.CounterVec
+	providerDuration    *prometheus.HistogramVec
+	providerRetries     *prometheus.CounterVec
+	breakerState        *prometheus.GaugeVec
+	breakerTransitions  *prometheus.CounterVec
+	rateLimitWait       *prometheus.HistogramVec
+	rateLimitRejections *prometheus.CounterVec
+	webhookReceived     *prometheus.CounterVec
+	webhookVerified     *prometheus.CounterVec
+	webhookProcessed    *prometheus.CounterVec
+	webhookDuration     *prometheus.HistogramVec
+	dlqDepth            *prometheus.GaugeVec
+}
+
+// New creates the metrics and registers them with registry. A nil registry
+// creates a new one that also reports Go runtime and process metrics.
+func New(registry *prometheus.Registry) *Metrics {
+	if registry == nil {
+		registry = prometheus.NewRegistry()
+		registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	}
+
+	m := &Metrics{
+		registry: registry,
+		providerRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "provider",
+			Name:      "requests_total",
+			Help:      "Provider operations by outcome.",
+		}, []string{"provider", "operation", "outcome"}),
+		providerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "provider",
+			Name:      "request_duration_seconds",
+			Help:      "Provider operation latency, including retries and rate-limit waits.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"provider", "operation"}),
+		providerRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "provider",
+			Name:      "retries_total",
+			Help:      "Retried provider attempts.",
+		}, []string{"provider", "operation"}),
+		breakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "circuit_breaker",
+			Name:      "state",
+			Help:      "Circuit breaker state: 0 closed, 1 half-open, 2 open.",
+		}, []string{"breaker"}),
+		breakerTransitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "circuit_breaker",
+			Name:      "transitions_total",
+			Help:      "Circuit breaker state changes.",
+		}, []string{"breaker", "from", "to"}),
+		rateLimitWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "rate_limit",
+			Name:      "wait_seconds",
+			Help:      "Time spent waiting for the rate limiter.",
+			Buckets:   []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		}, []string{"provider"}),
+		rateLimitRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "rate_limit",
+			Name:      "rejections_total",
+			Help:      "Calls the rate limiter refused or timed out.",
+		}, []string{"provider"}),
+		webhookReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "webhook",
+			Name:      "received_total",
+			Help:      "Inbound webhooks by final outcome.",
+		}, []string{"provider", "outcome"}),
+		webhookVerified: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "webhook",
+			Name:      "verifications_total",
+			Help:      "Webhook signature checks by result.",
+		}, []string{"provider", "outcome"}),
+		webhookProcessed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "webhook",
+			Name:      "processed_total",
+			Help:      "Verified webhook events routed to handlers, by outcome.",
+		}, []string{"provider", "event_type", "outcome"}),
+		webhookDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "webhook",
+			Name:      "processing_duration_seconds",
+			Help:      "Time to handle an inbound webhook.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"provider"}),
+		dlqDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "webhook",
+			Name:      "dlq_depth",
+			Help:      "Failed events in the dead letter queue by status.",
+		}, []string{"status"}),
+	}
+
+	registry.MustRegister(
+		m.providerRequests,
+		m.providerDuration,
+		m.providerRetries,
+		m.breakerState,
+		m.breakerTransitions,
+		m.rateLimitWait,
+		m.rateLimitRejections,
+		m.webhookReceived,
+		m.webhookVerified,
+		m.webhookProcessed,
+		m.webhookDuration,
+		m.dlqDepth,
+	)
+	return m
+}
+
+var defaultMetrics atomic.Pointer[Metrics]
+
+func init() {
+	defaultMetrics.Store(New(nil))
+}
+
+// Default returns the metrics the library reports to unless configured
+// otherwise
+func Default() *Metrics {
+	return defaultMetrics.Load()
+}
+
+// SetDefault replaces the default metrics. A nil m disables them.
+func SetDefault(m *Metrics) {
+	defaultMetrics.Store(m)
+}
+
+// OrDefault returns m, or Default() when m is nil
+func OrDefault(m *Metrics) *Metrics {
+	if m == nil {
+		return Default()
+	}
+	return m
+}
+
+// Registry returns the registry the metrics are registered with
+func (m *Metrics) Registry() *prometheus.Registry {
+	if m == nil {
+		return nil
+	}
+	return m.registry
+}
+
+// Handler serves the metrics in the Prometheus text format, e.g.
+// app.Get("/metrics", metrics.Default().Handler())
+func (m *Metrics) Handler() fiber.Handler {
+	if m == nil {
+		return func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+	}
+	return adaptor.HTTPHandler(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// Handler serves the default metrics
+func Handler() fiber.Handler {
+	return Default().Handler()
+}
+
+// ProviderRequest records one provider operation
+func (m *Metrics) ProviderRequest(provider, operation, outcome string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.providerRequests.WithLabelValues(provider, operation, outcome).Inc()
+	m.providerDuration.WithLabelValues(provider, operation).Observe(duration.Seconds())
+}
+
+// ProviderRetry records a retried provider attempt
+func (m *Metrics) ProviderRetry(provider, operation string) {
+	if m == nil {
+		return
+	}
+	m.providerRetries.WithLabelValues(provider, operation).Inc()
+}
+
+// BreakerState sets the state gauge of a circuit breaker. state is the
+// breaker's state name: "closed", "half-open" or "open".
+func (m *Metrics) BreakerState(breaker, state string) {
+	if m == nil {
+		return
+	}
+	m.breakerState.WithLabelValues(breaker).Set(breakerStateValue(state))
+}
+
+// BreakerTransition records a circuit breaker state change and updates the
+// state gauge
+func (m *Metrics) BreakerTransition(breaker, from, to string) {
+	if m == nil {
+		return
+	}
+	m.breakerTransitions.WithLabelValues(breaker, from, to).Inc()
+	m.BreakerState(breaker, to)
+}
+
+func breakerStateValue(state string) float64 {
+	switch strings.ToLower(state) {
+	case "open":
+		return BreakerOpen
+	case "half-open", "half_open":
+		return BreakerHalfOpen
+	default:
+		return BreakerClosed
+	}
+}
+
+// RateLimitWait records time spent waiting for a rate limiter, and a
+// rejection when the wait failed
+func (m *Metrics) RateLimitWait(provider string, waited time.Duration, rejected bool) {
+	if m == nil {
+		return
+	}
+	m.rateLimitWait.WithLabelValues(provider).Observe(waited.Seconds())
+	if rejected {
+		m.rateLimitRejections.WithLabelValues(provider).Inc()
+	}
+}
+
+// WebhookReceived records the final outcome of an inbound webhook
+func (m *Metrics) WebhookReceived(provider, outcome string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.webhookReceived.WithLabelValues(provider, outcome).Inc()
+	m.webhookDuration.WithLabelValues(provider).Observe(duration.Seconds())
+}
+
+// WebhookVerified records a signature check
+func (m *Metrics) WebhookVerified(provider string, valid bool) {
+	if m == nil {
+		return
+	}
+	outcome := WebhookValid
+	if !valid {
+		outcome = WebhookInvalid
+	}
+	m.webhookVerified.WithLabelValues(provider, outcome).Inc()
+}
+
+// WebhookProcessed records the routing outcome of a verified event
+func (m *Metrics) WebhookProcessed(provider, eventType, outcome string) {
+	if m == nil {
+		return
+	}
+	m.webhookProcessed.WithLabelValues(provider, eventType, outcome).Inc()
+}
+
+// DLQDepth sets the number of dead letter queue entries with a status
+func (m *Metrics) DLQDepth(status string, depth int) {
+	if m == nil {
+		return
+	}
+	m.dlqDepth.WithLabelValues(status).Set(float64(depth))
+}
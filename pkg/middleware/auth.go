@@ -1,19 +1,22 @@
 package middleware
 
 import (
-	"github.com/gofiber/fiber/v2"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
+	"github.com/gofiber/fiber/v2"
 )
 
 // AuthMiddleware creates Fiber middleware for API key authentication
 func AuthMiddleware(manager *auth.Manager, providerID string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Get credentials
-		creds, err := manager.GetCredentials(c.Context(), providerID)
+		// Get credentials for the tenant/user scope set by TenantMiddleware
+		creds, err := manager.GetCredentials(c.UserContext(), providerID)
 		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Unauthorized",
-			})
+			return ErrUnauthenticated.Wrap(err)
 		}
 
 		// Store credentials in context for downstream handlers
@@ -24,57 +27,157 @@ func AuthMiddleware(manager *auth.Manager, providerID string) fiber.Handler {
 	}
 }
 
-// BearerTokenMiddleware extracts and validates bearer tokens
-func BearerTokenMiddleware(manager *auth.Manager) fiber.Handler {
+// TenantMiddleware scopes the request to a tenant and optionally a user, so
+// credential lookups further down the chain resolve that tenant's accounts.
+// resolve should derive the IDs from the authenticated principal rather than
+// from anything the client can choose freely.
+func TenantMiddleware(resolve func(c *fiber.Ctx) (tenantID, userID string, err error)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tenantID, userID, err := resolve(c)
+		if err != nil {
+			return ErrPermissionDenied.WithDetail("unknown tenant").Wrap(err)
+		}
+
+		ctx := c.UserContext()
+		if tenantID != "" {
+			ctx = auth.WithTenant(ctx, tenantID)
+			c.Locals("tenant_id", tenantID)
+		}
+		if userID != "" {
+			ctx = auth.WithUser(ctx, userID)
+			c.Locals("user_id", userID)
+		}
+		c.SetUserContext(ctx)
+
+		return c.Next()
+	}
+}
+
+// BearerTokenMiddleware validates bearer tokens with a TokenValidator (a
+// JWTValidator or IntrospectionValidator). The principal is stored in
+// c.Locals("principal"), the raw token in c.Locals("access_token"), and the
+// request context is scoped to the principal's tenant and user. Tokens
+// lacking any of requiredScopes are rejected with 403.
+func BearerTokenMiddleware(validator auth.TokenValidator, requiredScopes ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Extract Bearer token from Authorization header
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Missing authorization header",
-			})
+			c.Set("WWW-Authenticate", "Bearer")
+			return ErrUnauthenticated.WithDetail("missing authorization header")
 		}
 
 		// Parse Bearer token
 		var token string
-		if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
+		if len(authHeader) > 7 && strings.EqualFold(authHeader[:7], "Bearer ") {
 			token = authHeader[7:]
 		} else {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid authorization format",
-			})
+			c.Set("WWW-Authenticate", "Bearer")
+			return ErrUnauthenticated.WithDetail("invalid authorization format")
+		}
+
+		principal, err := validator.ValidateToken(c.UserContext(), token)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidToken) {
+				c.Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				return ErrUnauthenticated.WithDetail("invalid token").Wrap(err)
+			}
+			return ErrProviderUnavailable.WithDetail("authentication unavailable").Wrap(err)
+		}
+
+		if !principal.HasScopes(requiredScopes...) {
+			return insufficientScope(c, principal, requiredScopes)
 		}
 
-		// Store token in context
 		c.Locals("access_token", token)
+		setPrincipal(c, principal)
+		return c.Next()
+	}
+}
 
+// RequireScopes rejects requests whose principal lacks any of the scopes.
+// Use it on routes behind APIKeyAuth or BearerTokenMiddleware.
+func RequireScopes(scopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := PrincipalFromLocals(c)
+		if !ok {
+			return ErrUnauthenticated
+		}
+		if !principal.HasScopes(scopes...) {
+			return insufficientScope(c, principal, scopes)
+		}
 		return c.Next()
 	}
 }
 
-// APIKeyMiddleware validates API key from header or query param
+// insufficientScope rejects with 403 and, for bearer tokens, the RFC 6750 challenge
+func insufficientScope(c *fiber.Ctx, principal *auth.Principal, scopes []string) error {
+	if principal.Method != auth.AuthMethodAPIKey {
+		c.Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, strings.Join(scopes, " ")))
+	}
+	return ErrPermissionDenied.WithDetail("insufficient scope")
+}
+
+// APIKeyMiddleware validates a single static API key from the X-API-Key
+// header. Prefer APIKeyAuth, which supports many keys, scopes and revocation.
 func APIKeyMiddleware(expectedKey string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Check header first
 		apiKey := c.Get("X-API-Key")
-
-		// Fall back to query parameter
 		if apiKey == "" {
-			apiKey = c.Query("api_key")
+			return ErrUnauthenticated.WithDetail("API key required")
 		}
 
+		if subtle.ConstantTimeCompare([]byte(apiKey), []byte(expectedKey)) != 1 {
+			return ErrUnauthenticated.WithDetail("invalid API key")
+		}
+
+		return c.Next()
+	}
+}
+
+// APIKeyAuth authenticates requests with keys issued by an APIKeyService,
+// read from the X-API-Key header. Keys in the query string are not accepted
+// since URLs end up in logs. The principal is stored in c.Locals("principal")
+// and the request context is scoped to its tenant and user. Requests whose
+// key lacks any of requiredScopes are rejected with 403.
+func APIKeyAuth(service *auth.APIKeyService, requiredScopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		apiKey := c.Get("X-API-Key")
 		if apiKey == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "API key required",
-			})
+			return ErrUnauthenticated.WithDetail("API key required")
+		}
+
+		principal, err := service.Verify(c.UserContext(), apiKey)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidAPIKey) || errors.Is(err, auth.ErrAPIKeyRevoked) || errors.Is(err, auth.ErrAPIKeyExpired) {
+				return ErrUnauthenticated.WithDetail("invalid API key").Wrap(err)
+			}
+			return ErrInternal.Wrap(err)
 		}
 
-		if apiKey != expectedKey {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid API key",
-			})
+		if !principal.HasScopes(requiredScopes...) {
+			return insufficientScope(c, principal, requiredScopes)
 		}
 
+		setPrincipal(c, principal)
 		return c.Next()
 	}
 }
+
+// PrincipalFromLocals returns the principal set by an authentication middleware
+func PrincipalFromLocals(c *fiber.Ctx) (*auth.Principal, bool) {
+	principal, ok := c.Locals("principal").(*auth.Principal)
+	return principal, ok && principal != nil
+}
+
+// setPrincipal exposes an authenticated principal to downstream handlers
+func setPrincipal(c *fiber.Ctx, principal *auth.Principal) {
+	c.Locals("principal", principal)
+	if principal.TenantID != "" {
+		c.Locals("tenant_id", principal.TenantID)
+	}
+	if principal.UserID != "" {
+		c.Locals("user_id", principal.UserID)
+	}
+	c.SetUserContext(auth.WithPrincipal(c.UserContext(), principal))
+}
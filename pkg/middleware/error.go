@@ -1,51 +1,191 @@
 package middleware
 
 import (
-	"time"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
 
+	"github.com/PrakarshSingh5/fintechkit/pkg/logging"
 	"github.com/gofiber/fiber/v2"
 )
 
-// ErrorHandler creates a centralized error handling middleware
+const (
+	// HeaderRequestID carries the correlation ID of a request
+	HeaderRequestID = "X-Request-ID"
+
+	// MIMEProblemJSON is the media type of RFC 9457 problem details
+	MIMEProblemJSON = "application/problem+json"
+)
+
+// ErrorHandlerConfig configures error responses
+type ErrorHandlerConfig struct {
+	Logger *slog.Logger // Defaults to logging.Logger()
+
+	// DocsBaseURL, when set, makes each problem's type a link to
+	// DocsBaseURL/<code> instead of the catalog's own documentation
+	DocsBaseURL string
+
+	// Mappers translate application errors before the built-in mapping
+	Mappers []ErrorMapper
+}
+
+// DefaultErrorHandlerConfig returns default error handling configuration
+func DefaultErrorHandlerConfig() *ErrorHandlerConfig {
+	return &ErrorHandlerConfig{}
+}
+
+// problem is an RFC 9457 problem details body
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// ErrorHandler creates a centralized error handling middleware. Errors
+// returned by later handlers are mapped onto the error catalog and written
+// as application/problem+json; internal details are logged, never sent.
+// The other middleware in this package reject requests by returning catalog
+// errors, so install it (or FiberErrorHandler) in front of them.
 func ErrorHandler() fiber.Handler {
+	return ErrorHandlerWithConfig(nil)
+}
+
+// ErrorHandlerWithConfig is ErrorHandler with custom logging, documentation
+// links and error mappers
+func ErrorHandlerWithConfig(config *ErrorHandlerConfig) fiber.Handler {
+	handle := FiberErrorHandler(config)
 	return func(c *fiber.Ctx) error {
-		err := c.Next()
+		if err := c.Next(); err != nil {
+			return handle(c, err)
+		}
+		return nil
+	}
+}
 
-		if err != nil {
-			// Log error (in production, use structured logging)
-			// logger.Error(err)
+// FiberErrorHandler is ErrorHandler in the form of fiber.Config.ErrorHandler,
+// which also sees errors from routing and middleware registered earlier
+func FiberErrorHandler(config *ErrorHandlerConfig) fiber.ErrorHandler {
+	if config == nil {
+		config = DefaultErrorHandlerConfig()
+	}
+	logger := config.Logger
+	if logger != nil {
+		logger = logging.Redacted(logger)
+	}
 
-			// Determine status code
-			code := fiber.StatusInternalServerError
-			if e, ok := err.(*fiber.Error); ok {
-				code = e.Code
-			}
+	return func(c *fiber.Ctx, err error) error {
+		apiErr := ToAPIError(err, config.Mappers...)
+		requestID := RequestID(c)
 
-			// Return error response
-			return c.Status(code).JSON(fiber.Map{
-				"error":     err.Error(),
-				"timestamp": time.Now().Unix(),
-			})
+		if apiErr.Status >= fiber.StatusInternalServerError {
+			logging.OrDefault(logger).ErrorContext(c.UserContext(), "request failed",
+				"error", err,
+				"code", apiErr.Code,
+				"method", c.Method(),
+				"path", c.Path(),
+				"request_id", requestID,
+			)
 		}
 
-		return nil
+		body := problem{
+			Type:      apiErr.Type,
+			Title:     apiErr.Title,
+			Status:    apiErr.Status,
+			Detail:    apiErr.Detail,
+			Instance:  c.Path(),
+			Code:      apiErr.Code,
+			RequestID: requestID,
+			Errors:    apiErr.Errors,
+		}
+		if config.DocsBaseURL != "" {
+			body.Type = strings.TrimSuffix(config.DocsBaseURL, "/") + "/" + apiErr.Code
+		}
+		if body.Type == "" {
+			// RFC 9457: an about:blank problem is titled by its status
+			body.Type = "about:blank"
+			body.Title = http.StatusText(apiErr.Status)
+		}
+
+		return c.Status(apiErr.Status).JSON(body, MIMEProblemJSON)
 	}
 }
 
-// RecoveryMiddleware recovers from panics
+// PanicError is returned by RecoveryMiddleware when a handler panics
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("handler panicked: %v", e.Value)
+}
+
+// RecoveryMiddleware recovers from panics, logs them with their stack and
+// returns a *PanicError for the error handler to report
 func RecoveryMiddleware() fiber.Handler {
-	return func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) (err error) {
 		defer func() {
 			if r := recover(); r != nil {
-				// Log panic (in production, use structured logging)
-				// logger.Error("panic recovered", "panic", r)
-
-				c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Internal server error",
-				})
+				stack := debug.Stack()
+				logging.Logger().ErrorContext(c.UserContext(), "panic recovered",
+					"panic", fmt.Sprint(r),
+					"method", c.Method(),
+					"path", c.Path(),
+					"request_id", RequestID(c),
+					"stack", string(stack),
+				)
+				err = &PanicError{Value: r, Stack: stack}
 			}
 		}()
 
 		return c.Next()
 	}
 }
+
+// RequestIDMiddleware gives every request a correlation ID, reusing a
+// well-formed X-Request-ID from the client, and echoes it in the response
+func RequestIDMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		RequestID(c)
+		return c.Next()
+	}
+}
+
+// RequestID returns the request's correlation ID, assigning one if needed
+func RequestID(c *fiber.Ctx) string {
+	if id, ok := c.Locals("request_id").(string); ok {
+		return id
+	}
+
+	id := c.Get(HeaderRequestID)
+	if !validRequestID(id) {
+		b := make([]byte, 16)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+
+	c.Locals("request_id", id)
+	c.Set(HeaderRequestID, id)
+	return id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
+	"github.com/PrakarshSingh5/fintechkit/pkg/reliability"
+	"github.com/PrakarshSingh5/fintechkit/pkg/webhook"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestErrorHandlerWritesProblemDetails(t *testing.T) {
+	tests := map[string]struct {
+		handler  fiber.Handler
+		wantType string
+	}{
+		"default":     {ErrorHandler(), ErrorDocsURL + "#not_found"},
+		"with config": {ErrorHandlerWithConfig(&ErrorHandlerConfig{DocsBaseURL: "https://docs.example.com/errors"}), "https://docs.example.com/errors/not_found"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(tt.handler)
+			app.Get("/missing", func(c *fiber.Ctx) error {
+				return ErrNotFound
+			})
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/missing", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != fiber.StatusNotFound {
+				t.Fatalf("got status %d, want 404", resp.StatusCode)
+			}
+			if got := resp.Header.Get(fiber.HeaderContentType); got != MIMEProblemJSON {
+				t.Fatalf("got content type %q, want %q", got, MIMEProblemJSON)
+			}
+
+			var body problem
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != "not_found" || body.Status != fiber.StatusNotFound {
+				t.Fatalf("got problem %+v", body)
+			}
+			if body.Type != tt.wantType || body.Title != ErrNotFound.Title {
+				t.Fatalf("got type %q titled %q, want %q titled %q", body.Type, body.Title, tt.wantType, ErrNotFound.Title)
+			}
+		})
+	}
+}
+
+func TestErrorHandlerUntypedProblemIsAboutBlank(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: FiberErrorHandler(nil)})
+	app.Get("/teapot", func(c *fiber.Ctx) error {
+		return fiber.ErrTeapot
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/teapot", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body problem
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Type != "about:blank" || body.Title != "I'm a teapot" || body.Status != fiber.StatusTeapot {
+		t.Fatalf("got problem %+v, want about:blank titled by its status", body)
+	}
+}
+
+// rejectingValidator rejects every token
+type rejectingValidator struct{}
+
+func (rejectingValidator) ValidateToken(ctx context.Context, token string) (*auth.Principal, error) {
+	return nil, auth.ErrInvalidToken
+}
+
+func TestMiddlewareRejectionsAreProblems(t *testing.T) {
+	limiter, err := reliability.NewKeyedRateLimiter(reliability.DefaultKeyedRateLimiterConfig(
+		reliability.RateWindow{Limit: 1, Period: time.Hour},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := limiter.Allow(t.Context(), "ip:0.0.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	idempotency := DefaultIdempotencyConfig()
+	idempotency.Required = true
+
+	app := fiber.New(fiber.Config{ErrorHandler: FiberErrorHandler(nil)})
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	app.Get("/bearer", BearerTokenMiddleware(rejectingValidator{}), ok)
+	app.Get("/static-key", APIKeyMiddleware("sk_expected"), ok)
+	app.Get("/scoped", RequireScopes("payments:read"), ok)
+	app.Get("/limited", KeyedRateLimitMiddleware(limiter, KeyByIP), ok)
+	app.Post("/idempotent", IdempotencyMiddleware(idempotency), ok)
+	webhook.RegisterDLQRoutes(app.Group("/dlq"), webhook.NewDeadLetterQueue())
+
+	tests := []struct {
+		method, path string
+		token        string
+		header       string
+		status       int
+		code         string
+	}{
+		{"GET", "/bearer", "", "WWW-Authenticate", fiber.StatusUnauthorized, "unauthenticated"},
+		{"GET", "/bearer", "Bearer forged", "WWW-Authenticate", fiber.StatusUnauthorized, "unauthenticated"},
+		{"GET", "/static-key", "", "", fiber.StatusUnauthorized, "unauthenticated"},
+		{"GET", "/scoped", "", "", fiber.StatusUnauthorized, "unauthenticated"},
+		{"GET", "/limited", "", "Retry-After", fiber.StatusTooManyRequests, "rate_limited"},
+		{"POST", "/idempotent", "", "", fiber.StatusBadRequest, "bad_request"},
+		{"GET", "/dlq/evt_missing", "", "", fiber.StatusNotFound, "not_found"},
+		{"GET", "/dlq?status=bogus", "", "", fiber.StatusBadRequest, "bad_request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tt.status)
+			}
+			if got := resp.Header.Get(fiber.HeaderContentType); got != MIMEProblemJSON {
+				t.Fatalf("got content type %q, want %q", got, MIMEProblemJSON)
+			}
+			if tt.header != "" && resp.Header.Get(tt.header) == "" {
+				t.Fatalf("missing %s header", tt.header)
+			}
+
+			var body problem
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != tt.code || body.Type != ErrorDocsURL+"#"+tt.code {
+				t.Fatalf("got problem %+v, want code %s", body, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// IdempotencyRecord is a request remembered under its Idempotency-Key
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string // Hash of method, path and body
+
+	// Response, set once the request completes; Status is 0 while in flight
+	Status  int
+	Headers [][2]string
+	Body    []byte
+
+	LockedUntil time.Time // In-flight lock expiry, in case the process dies
+	ExpiresAt   time.Time
+}
+
+// InFlight reports whether the original request is still being processed
+func (r *IdempotencyRecord) InFlight() bool {
+	return r.Status == 0
+}
+
+// IdempotencyStore keeps idempotency records. Implementations shared between
+// replicas must make Begin atomic.
+type IdempotencyStore interface {
+	// Begin stores record as in flight and returns nil, unless a live record
+	// exists for its key, which is returned instead. In-flight records whose
+	// lock expired count as absent.
+	Begin(ctx context.Context, record *IdempotencyRecord) (*IdempotencyRecord, error)
+	// Complete saves the response for an in-flight record
+	Complete(ctx context.Context, record *IdempotencyRecord) error
+	// Release drops an in-flight record so the request can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// InMemoryIdempotencyStore keeps records in memory (single instance only)
+type InMemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*IdempotencyRecord
+	writes  int
+}
+
+// NewInMemoryIdempotencyStore creates an in-memory idempotency store
+func NewInMemoryIdempotencyStore() *InMemoryIdempotencyStore {
+	return &InMemoryIdempotencyStore{records: make(map[string]*IdempotencyRecord)}
+}
+
+// Begin stores an in-flight record unless a live one exists
+func (s *InMemoryIdempotencyStore) Begin(ctx context.Context, record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := s.records[record.Key]; ok && !s.expired(existing, now) {
+		copied := *existing
+		return &copied, nil
+	}
+
+	copied := *record
+	s.records[record.Key] = &copied
+
+	// Drop expired records now and then so old keys do not accumulate
+	s.writes++
+	if s.writes%1024 == 0 {
+		for key, existing := range s.records {
+			if s.expired(existing, now) {
+				delete(s.records, key)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Complete saves the response for a record
+func (s *InMemoryIdempotencyStore) Complete(ctx context.Context, record *IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *record
+	s.records[record.Key] = &copied
+	return nil
+}
+
+// Release drops an in-flight record
+func (s *InMemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.records[key]; ok && existing.InFlight() {
+		delete(s.records, key)
+	}
+	return nil
+}
+
+func (s *InMemoryIdempotencyStore) expired(record *IdempotencyRecord, now time.Time) bool {
+	if record.InFlight() {
+		return now.After(record.LockedUntil)
+	}
+	return now.After(record.ExpiresAt)
+}
+
+// IdempotencyConfig configures IdempotencyMiddleware
+type IdempotencyConfig struct {
+	Store    IdempotencyStore
+	TTL      time.Duration // How long responses are kept for replay
+	LockTTL  time.Duration // How long an in-flight request holds its key
+	Required bool          // Reject requests without an Idempotency-Key
+	Methods  []string      // Methods the middleware applies to
+
+	// Scope separates keys of different callers; defaults to the
+	// authenticated principal, then the client IP
+	Scope RateLimitKeyFunc
+}
+
+// DefaultIdempotencyConfig returns defaults backed by an in-memory store
+func DefaultIdempotencyConfig() *IdempotencyConfig {
+	return &IdempotencyConfig{
+		Store:   NewInMemoryIdempotencyStore(),
+		TTL:     24 * time.Hour,
+		LockTTL: time.Minute,
+		Methods: []string{fiber.MethodPost, fiber.MethodPatch},
+		Scope:   KeyFirst(KeyByUser, KeyByAPIKey, KeyByIP),
+	}
+}
+
+// idempotencySkippedHeaders are response headers that describe this
+// particular response rather than the result, and are not replayed
+var idempotencySkippedHeaders = []string{
+	"Date", "Content-Length", "Connection", "Transfer-Encoding", "Set-Cookie",
+	"Ratelimit-Limit", "Ratelimit-Remaining", "Ratelimit-Reset", "Retry-After",
+	HeaderRequestID,
+}
+
+// IdempotencyMiddleware implements the Idempotency-Key header: the first
+// request with a key runs and its response is stored; retries with the same
+// key and payload get that response replayed, marked with
+// Idempotent-Replayed. A retry while the first is still running gets 409,
+// and reusing a key for a different payload gets 422. Responses with a 5xx
+// status or handler errors are not stored, so the request can be retried.
+func IdempotencyMiddleware(config *IdempotencyConfig) fiber.Handler {
+	if config == nil {
+		config = DefaultIdempotencyConfig()
+	}
+
+	return func(c *fiber.Ctx) error {
+		if !applies(config.Methods, c.Method()) {
+			return c.Next()
+		}
+
+		key := c.Get("Idempotency-Key")
+		if key == "" {
+			if config.Required {
+				return ErrBadRequest.WithDetail("Idempotency-Key header required")
+			}
+			return c.Next()
+		}
+		if len(key) > 255 {
+			return ErrBadRequest.WithDetail("Idempotency-Key too long")
+		}
+
+		ctx := c.UserContext()
+		now := time.Now()
+		record := &IdempotencyRecord{
+			Key:         config.Scope(c) + "|" + key,
+			Fingerprint: requestFingerprint(c),
+			LockedUntil: now.Add(config.LockTTL),
+			ExpiresAt:   now.Add(config.TTL),
+		}
+
+		existing, err := config.Store.Begin(ctx, record)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			if existing.Fingerprint != record.Fingerprint {
+				return ErrIdempotencyKeyReused
+			}
+			if existing.InFlight() {
+				return ErrConflict.WithDetail("a request with this Idempotency-Key is in progress")
+			}
+			return replay(c, existing)
+		}
+
+		if err := c.Next(); err != nil {
+			_ = config.Store.Release(context.WithoutCancel(ctx), record.Key)
+			return err
+		}
+
+		resp := c.Response()
+		if resp.StatusCode() >= fiber.StatusInternalServerError {
+			_ = config.Store.Release(context.WithoutCancel(ctx), record.Key)
+			return nil
+		}
+
+		record.Status = resp.StatusCode()
+		record.Body = append([]byte(nil), resp.Body()...)
+		resp.Header.VisitAll(func(k, v []byte) {
+			name := string(k)
+			for _, skipped := range idempotencySkippedHeaders {
+				if strings.EqualFold(name, skipped) {
+					return
+				}
+			}
+			record.Headers = append(record.Headers, [2]string{name, string(v)})
+		})
+
+		// The response is sent either way; a failed save only loses the replay
+		_ = config.Store.Complete(context.WithoutCancel(ctx), record)
+		return nil
+	}
+}
+
+// replay writes a stored response
+func replay(c *fiber.Ctx, record *IdempotencyRecord) error {
+	for _, header := range record.Headers {
+		c.Set(header[0], header[1])
+	}
+	c.Set("Idempotent-Replayed", "true")
+	c.Status(record.Status)
+	return c.Send(record.Body)
+}
+
+// requestFingerprint hashes what makes two requests the same operation
+func requestFingerprint(c *fiber.Ctx) string {
+	h := sha256.New()
+	h.Write([]byte(c.Method()))
+	h.Write([]byte{0})
+	h.Write([]byte(c.Path()))
+	h.Write([]byte{0})
+	h.Write(c.Body())
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func applies(methods []string, method string) bool {
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
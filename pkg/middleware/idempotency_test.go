@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestInMemoryIdempotencyStoreReplacesExpiredRecords(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryIdempotencyStore()
+	now := time.Now()
+
+	first := &IdempotencyRecord{Key: "k", Fingerprint: "a", LockedUntil: now.Add(-time.Second), ExpiresAt: now.Add(time.Hour)}
+	if existing, err := store.Begin(ctx, first); err != nil || existing != nil {
+		t.Fatalf("first Begin: got %+v, %v", existing, err)
+	}
+
+	// The first request's lock has expired, so its key is free again
+	second := &IdempotencyRecord{Key: "k", Fingerprint: "b", LockedUntil: now.Add(time.Minute), ExpiresAt: now.Add(time.Hour)}
+	if existing, err := store.Begin(ctx, second); err != nil || existing != nil {
+		t.Fatalf("Begin after lock expiry: got %+v, %v", existing, err)
+	}
+
+	third := &IdempotencyRecord{Key: "k", Fingerprint: "c", LockedUntil: now.Add(time.Minute), ExpiresAt: now.Add(time.Hour)}
+	existing, err := store.Begin(ctx, third)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if existing == nil || existing.Fingerprint != "b" {
+		t.Fatalf("Begin with a live record: got %+v, want the second record", existing)
+	}
+}
+
+func TestInMemoryIdempotencyStoreSweepsExpiredRecords(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryIdempotencyStore()
+	past := time.Now().Add(-time.Second)
+
+	for i := 0; i < 4096; i++ {
+		record := &IdempotencyRecord{Key: strconv.Itoa(i), LockedUntil: past, ExpiresAt: past}
+		if _, err := store.Begin(ctx, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if n := len(store.records); n > 1024 {
+		t.Fatalf("store holds %d records, want expired ones swept", n)
+	}
+}
@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
+	"github.com/PrakarshSingh5/fintechkit/pkg/client"
+	"github.com/PrakarshSingh5/fintechkit/pkg/reliability"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sony/gobreaker"
+)
+
+// APIError is an error from the catalog below, rendered to clients as an
+// RFC 9457 problem. Code, Status and Title are stable; Detail is per
+// occurrence and must be safe to show. The wrapped cause is only logged.
+type APIError struct {
+	Code   string
+	Status int
+	Title  string
+	Type   string // URI documenting the error; about:blank when empty
+	Detail string
+	Errors []FieldError // Set for validation failures
+
+	cause error
+}
+
+// FieldError is one invalid field in a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ErrorDocsURL documents the error catalog, with a section per code
+const ErrorDocsURL = "https://github.com/PrakarshSingh5/fintechkit/blob/main/docs/errors.md"
+
+// Error catalog
+var (
+	ErrBadRequest = &APIError{Code: "bad_request", Status: fiber.StatusBadRequest,
+		Title: "The request is malformed", Type: ErrorDocsURL + "#bad_request"}
+	ErrValidationFailed = &APIError{Code: "validation_failed", Status: fiber.StatusUnprocessableEntity,
+		Title: "The request has invalid fields", Type: ErrorDocsURL + "#validation_failed"}
+	ErrUnauthenticated = &APIError{Code: "unauthenticated", Status: fiber.StatusUnauthorized,
+		Title: "Authentication is required", Type: ErrorDocsURL + "#unauthenticated"}
+	ErrPermissionDenied = &APIError{Code: "permission_denied", Status: fiber.StatusForbidden,
+		Title: "The caller may not perform this operation", Type: ErrorDocsURL + "#permission_denied"}
+	ErrNotFound = &APIError{Code: "not_found", Status: fiber.StatusNotFound,
+		Title: "The resource does not exist", Type: ErrorDocsURL + "#not_found"}
+	ErrMethodNotAllowed = &APIError{Code: "method_not_allowed", Status: fiber.StatusMethodNotAllowed,
+		Title: "The method is not allowed for this resource", Type: ErrorDocsURL + "#method_not_allowed"}
+	ErrConflict = &APIError{Code: "conflict", Status: fiber.StatusConflict,
+		Title: "The request conflicts with the resource's state", Type: ErrorDocsURL + "#conflict"}
+	ErrIdempotencyKeyReused = &APIError{Code: "idempotency_key_reused", Status: fiber.StatusUnprocessableEntity,
+		Title: "The Idempotency-Key was used for a different request", Type: ErrorDocsURL + "#idempotency_key_reused"}
+	ErrTooManyRequests = &APIError{Code: "rate_limited", Status: fiber.StatusTooManyRequests,
+		Title: "Too many requests", Type: ErrorDocsURL + "#rate_limited"}
+	ErrProviderDeclined = &APIError{Code: "provider_declined", Status: fiber.StatusUnprocessableEntity,
+		Title: "The provider declined the request", Type: ErrorDocsURL + "#provider_declined"}
+	ErrProviderFailed = &APIError{Code: "provider_error", Status: fiber.StatusBadGateway,
+		Title: "The provider returned an error", Type: ErrorDocsURL + "#provider_error"}
+	ErrProviderUnavailable = &APIError{Code: "provider_unavailable", Status: fiber.StatusServiceUnavailable,
+		Title: "The provider is temporarily unavailable", Type: ErrorDocsURL + "#provider_unavailable"}
+	ErrProviderTimeout = &APIError{Code: "provider_timeout", Status: fiber.StatusGatewayTimeout,
+		Title: "The provider did not respond in time", Type: ErrorDocsURL + "#provider_timeout"}
+	ErrInternal = &APIError{Code: "internal_error", Status: fiber.StatusInternalServerError,
+		Title: "An internal error occurred", Type: ErrorDocsURL + "#internal_error"}
+)
+
+func (e *APIError) Error() string {
+	msg := e.Code
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.cause != nil {
+		msg += ": " + e.cause.Error()
+	}
+	return msg
+}
+
+func (e *APIError) Unwrap() error {
+	return e.cause
+}
+
+// Is matches errors from the same catalog entry
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	return ok && t.Code == e.Code
+}
+
+// WithDetail returns a copy of the error with an occurrence-specific detail
+func (e *APIError) WithDetail(detail string) *APIError {
+	copied := *e
+	copied.Detail = detail
+	return &copied
+}
+
+// Wrap returns a copy of the error carrying cause, which is logged but never
+// sent to the client
+func (e *APIError) Wrap(cause error) *APIError {
+	copied := *e
+	copied.cause = cause
+	return &copied
+}
+
+// Invalid returns a validation error listing the invalid fields
+func Invalid(fields ...FieldError) *APIError {
+	copied := *ErrValidationFailed
+	copied.Errors = fields
+	return &copied
+}
+
+// ErrorMapper turns an application error into a catalog error, returning nil
+// for errors it does not recognise
+type ErrorMapper func(err error) *APIError
+
+// ToAPIError maps err onto the catalog. Mappers are tried first, then the
+// errors of this module; anything unrecognised is an internal error.
+func ToAPIError(err error, mappers ...ErrorMapper) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	for _, mapper := range mappers {
+		if mapped := mapper(err); mapped != nil {
+			return mapped
+		}
+	}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fromStatus(fiberErr.Code, fiberErr.Message).Wrap(err)
+	}
+
+	var providerErr *client.ProviderError
+	if errors.As(err, &providerErr) {
+		return fromProviderError(providerErr)
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrInvalidAPIKey), errors.Is(err, auth.ErrAPIKeyRevoked),
+		errors.Is(err, auth.ErrAPIKeyExpired), errors.Is(err, auth.ErrInvalidToken):
+		return ErrUnauthenticated.Wrap(err)
+	case errors.Is(err, auth.ErrForbidden):
+		return ErrPermissionDenied.Wrap(err)
+	case errors.Is(err, ErrResourceNotFound):
+		return ErrNotFound.Wrap(err)
+	case errors.Is(err, reliability.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return ErrProviderTimeout.Wrap(err)
+	case errors.Is(err, reliability.ErrServiceUnavailable), errors.Is(err, reliability.ErrRateLimited),
+		errors.Is(err, reliability.ErrRateLimitExceeded), errors.Is(err, reliability.ErrNetworkError),
+		errors.Is(err, gobreaker.ErrOpenState), errors.Is(err, gobreaker.ErrTooManyRequests):
+		return ErrProviderUnavailable.Wrap(err)
+	}
+
+	return ErrInternal.Wrap(err)
+}
+
+// fromStatus picks the catalog entry for an HTTP status. Fiber's own 4xx
+// messages (e.g. "Cannot GET /x") are kept as the detail.
+func fromStatus(status int, message string) *APIError {
+	var base *APIError
+	switch status {
+	case fiber.StatusBadRequest:
+		base = ErrBadRequest
+	case fiber.StatusUnauthorized:
+		base = ErrUnauthenticated
+	case fiber.StatusForbidden:
+		base = ErrPermissionDenied
+	case fiber.StatusNotFound:
+		base = ErrNotFound
+	case fiber.StatusMethodNotAllowed:
+		base = ErrMethodNotAllowed
+	case fiber.StatusConflict:
+		base = ErrConflict
+	case fiber.StatusUnprocessableEntity:
+		base = ErrValidationFailed
+	case fiber.StatusTooManyRequests:
+		base = ErrTooManyRequests
+	case fiber.StatusBadGateway:
+		return ErrProviderFailed.WithDetail("")
+	case fiber.StatusServiceUnavailable:
+		return ErrProviderUnavailable.WithDetail("")
+	default:
+		if status >= 400 && status < 500 {
+			return &APIError{Code: "client_error", Status: status, Title: http.StatusText(status), Detail: message}
+		}
+		return ErrInternal.WithDetail("")
+	}
+	return base.WithDetail(message)
+}
+
+// fromProviderError maps a provider's response: requests the provider turned
+// down are the caller's to fix, while failures on its side are not
+func fromProviderError(err *client.ProviderError) *APIError {
+	switch {
+	case err.StatusCode == fiber.StatusTooManyRequests || err.StatusCode >= 500:
+		return ErrProviderUnavailable.Wrap(err)
+	case err.StatusCode == fiber.StatusUnauthorized || err.StatusCode == fiber.StatusForbidden:
+		// Our credentials were rejected; nothing the caller can change
+		return ErrProviderFailed.Wrap(err)
+	case err.StatusCode >= 400:
+		declined := ErrProviderDeclined.WithDetail(strings.TrimSpace(err.Message))
+		return declined.Wrap(err)
+	}
+	return ErrProviderFailed.Wrap(err)
+}
@@ -1,8 +1,16 @@
 package middleware
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
 	"golang.org/x/time/rate"
 
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
+	"github.com/PrakarshSingh5/fintechkit/pkg/reliability"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -12,40 +20,115 @@ func RateLimitMiddleware(requestsPerSecond float64, burst int) fiber.Handler {
 
 	return func(c *fiber.Ctx) error {
 		if !limiter.Allow() {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": "Rate limit exceeded",
-			})
+			return ErrTooManyRequests
 		}
 
 		return c.Next()
 	}
 }
 
-// PerUserRateLimitMiddleware creates per-user rate limiting
-func PerUserRateLimitMiddleware(requestsPerSecond float64, burst int) fiber.Handler {
-	limiters := make(map[string]*rate.Limiter)
+// RateLimitKeyFunc extracts the key a request is rate limited by. An empty
+// key means the strategy does not apply to the request.
+type RateLimitKeyFunc func(c *fiber.Ctx) string
+
+// KeyByAPIKey limits per API key: the authenticated key's ID, or a hash of
+// the X-API-Key header when used before authentication
+func KeyByAPIKey(c *fiber.Ctx) string {
+	if principal, ok := PrincipalFromLocals(c); ok && principal.Method == auth.AuthMethodAPIKey {
+		return "key:" + principal.ID
+	}
+	if apiKey := c.Get("X-API-Key"); apiKey != "" {
+		sum := sha256.Sum256([]byte(apiKey))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+	return ""
+}
 
+// KeyByUser limits per authenticated user or principal
+func KeyByUser(c *fiber.Ctx) string {
+	if userID, ok := c.Locals("user_id").(string); ok && userID != "" {
+		return "user:" + userID
+	}
+	if principal, ok := PrincipalFromLocals(c); ok {
+		return "principal:" + principal.ID
+	}
+	return ""
+}
+
+// KeyByIP limits per client IP
+func KeyByIP(c *fiber.Ctx) string {
+	return "ip:" + c.IP()
+}
+
+// KeyByRoute gives each route its own limit for the key from inner
+func KeyByRoute(inner RateLimitKeyFunc) RateLimitKeyFunc {
+	return func(c *fiber.Ctx) string {
+		key := inner(c)
+		if key == "" {
+			return ""
+		}
+		return c.Method() + " " + c.Route().Path + "|" + key
+	}
+}
+
+// KeyFirst uses the first strategy that yields a key, e.g.
+// KeyFirst(KeyByAPIKey, KeyByUser, KeyByIP)
+func KeyFirst(strategies ...RateLimitKeyFunc) RateLimitKeyFunc {
+	return func(c *fiber.Ctx) string {
+		for _, strategy := range strategies {
+			if key := strategy(c); key != "" {
+				return key
+			}
+		}
+		return ""
+	}
+}
+
+// KeyedRateLimitMiddleware limits requests per key and sets the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers, plus
+// Retry-After when the limit is hit. Use a reliability.KeyedRateLimiter for
+// per-process limits or a reliability.GCRALimiter to share them between
+// replicas. Requests without a key, or arriving while the limiter is
+// failing, are let through.
+func KeyedRateLimitMiddleware(limiter reliability.KeyedLimiter, keyFunc RateLimitKeyFunc) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Get user ID from context (set by auth middleware)
-		userID, ok := c.Locals("user_id").(string)
-		if !ok {
-			userID = c.IP() // Fall back to IP-based limiting
+		key := keyFunc(c)
+		if key == "" {
+			return c.Next()
 		}
 
-		// Get or create limiter for this user
-		limiter, exists := limiters[userID]
-		if !exists {
-			limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), burst)
-			limiters[userID] = limiter
+		result, err := limiter.Allow(c.UserContext(), key)
+		if err != nil {
+			return c.Next()
 		}
 
-		if !limiter.Allow() {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error":   "Rate limit exceeded",
-				"user_id": userID,
-			})
+		c.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Set("RateLimit-Remaining", strconv.Itoa(max(0, result.Remaining)))
+		c.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			c.Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(result.RetryAfter))))
+			return ErrTooManyRequests
 		}
 
 		return c.Next()
 	}
 }
+
+// PerUserRateLimitMiddleware creates per-user rate limiting, falling back to
+// the client IP for unauthenticated requests
+func PerUserRateLimitMiddleware(requestsPerSecond float64, burst int) fiber.Handler {
+	limiter, err := reliability.NewKeyedRateLimiter(reliability.DefaultKeyedRateLimiterConfig(
+		reliability.PerSecond(requestsPerSecond, burst),
+	))
+	if err != nil {
+		panic(fmt.Sprintf("middleware: invalid rate limit: %v", err))
+	}
+
+	return KeyedRateLimitMiddleware(limiter, KeyFirst(KeyByUser, KeyByIP))
+}
+
+// ceilSeconds rounds a duration up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrResourceNotFound should be returned by tenant lookups for unknown resources
+var ErrResourceNotFound = errors.New("resource not found")
+
+// TenantLookup returns the tenant that owns the resource with the given ID
+type TenantLookup func(c *fiber.Ctx, id string) (tenantID string, err error)
+
+// AmountExtractor returns the amount and currency a request acts on. It
+// returns auth.UnknownAmount when the request does not state an amount and
+// an empty currency when it does not name one.
+type AmountExtractor func(c *fiber.Ctx) (amount int64, currency string, err error)
+
+// Authorize requires the authenticated principal to hold every permission.
+// Use it per route after APIKeyAuth or BearerTokenMiddleware:
+//
+//	payments.Post("/", middleware.Authorize(policy, auth.PermPaymentsCreate), createPayment)
+func Authorize(policy *auth.Policy, permissions ...auth.Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := PrincipalFromLocals(c)
+		if !ok {
+			return ErrUnauthenticated
+		}
+
+		if err := policy.Authorize(principal, permissions...); err != nil {
+			return ErrPermissionDenied.Wrap(err)
+		}
+
+		return c.Next()
+	}
+}
+
+// AuthorizeTenantResource checks that the resource named by a route parameter
+// belongs to the principal's tenant. Resources of other tenants are reported
+// as not found so their IDs cannot be probed.
+func AuthorizeTenantResource(policy *auth.Policy, param string, lookup TenantLookup) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := PrincipalFromLocals(c)
+		if !ok {
+			return ErrUnauthenticated
+		}
+
+		tenantID, err := lookup(c, c.Params(param))
+		if err != nil {
+			if errors.Is(err, ErrResourceNotFound) {
+				return ErrNotFound.Wrap(err)
+			}
+			return err
+		}
+
+		if err := policy.AuthorizeTenant(principal, tenantID); err != nil {
+			return ErrNotFound.Wrap(err)
+		}
+
+		return c.Next()
+	}
+}
+
+// AuthorizeAmount requires a permission and applies the policy's amount
+// limits to the amount the request acts on
+func AuthorizeAmount(policy *auth.Policy, permission auth.Permission, extract AmountExtractor) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := PrincipalFromLocals(c)
+		if !ok {
+			return ErrUnauthenticated
+		}
+
+		amount, currency, err := extract(c)
+		if err != nil {
+			return ErrBadRequest.WithDetail("invalid amount").Wrap(err)
+		}
+
+		if err := policy.AuthorizeAmount(principal, permission, amount, currency); err != nil {
+			return ErrPermissionDenied.Wrap(err)
+		}
+
+		return c.Next()
+	}
+}
+
+// JSONBodyAmount reads "amount" and "currency" fields from a JSON request
+// body. A missing amount or an empty body, such as on a full refund, is
+// auth.UnknownAmount.
+func JSONBodyAmount(c *fiber.Ctx) (int64, string, error) {
+	if len(bytes.TrimSpace(c.Body())) == 0 {
+		return auth.UnknownAmount, "", nil
+	}
+
+	var body struct {
+		Amount   *int64 `json:"amount"`
+		Currency string `json:"currency"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return 0, "", err
+	}
+	if body.Amount == nil {
+		return auth.UnknownAmount, body.Currency, nil
+	}
+	if *body.Amount < 0 {
+		return 0, "", errors.New("amount must not be negative")
+	}
+	return *body.Amount, body.Currency, nil
+}
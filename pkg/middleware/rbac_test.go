@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAuthorizeAmountDeniesUnstatedRefundAmount(t *testing.T) {
+	policy := auth.DefaultPolicy()
+	policy.AddAmountLimit(auth.AmountLimit{
+		Permission: auth.PermPaymentsRefund,
+		Currency:   "USD",
+		Threshold:  100000,
+		Requires:   auth.PermRefundLarge,
+	})
+
+	app := fiber.New(fiber.Config{ErrorHandler: FiberErrorHandler(nil)})
+	app.Post("/refunds", func(c *fiber.Ctx) error {
+		c.Locals("principal", &auth.Principal{Roles: []string{"operator"}})
+		return c.Next()
+	}, AuthorizeAmount(policy, auth.PermPaymentsRefund, JSONBodyAmount), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusCreated)
+	})
+
+	tests := []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{"amount": 5000, "currency": "USD"}`, fiber.StatusCreated, ""},
+		{`{"amount": 500000, "currency": "USD"}`, fiber.StatusForbidden, "permission_denied"},
+		{`{"amount": 500000}`, fiber.StatusForbidden, "permission_denied"},
+		{`{"payment_id": "pay_1"}`, fiber.StatusForbidden, "permission_denied"},
+		{``, fiber.StatusForbidden, "permission_denied"},
+		{"  \n", fiber.StatusForbidden, "permission_denied"},
+		{`{"amount": "lots"}`, fiber.StatusBadRequest, "bad_request"},
+		{`{"amount": -1, "currency": "USD"}`, fiber.StatusBadRequest, "bad_request"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/refunds", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.body, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.code == "" {
+			continue
+		}
+		var body problem
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Code != tt.code {
+			t.Errorf("%s: got code %q, want %q", tt.body, body.Code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"errors"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/tracing"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingMiddleware starts a server span for each request, continuing the
+// trace from the incoming headers, and makes it the parent of everything
+// done with c.UserContext(). A nil tp uses the global provider.
+func TracingMiddleware(tp trace.TracerProvider) fiber.Handler {
+	tracer := tracing.Tracer(tp)
+
+	return func(c *fiber.Ctx) error {
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), requestHeaderCarrier{c})
+
+		ctx, span := tracer.Start(ctx, c.Method(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Method()),
+				semconv.URLPath(c.Path()),
+				semconv.ClientAddress(c.IP()),
+			),
+		)
+		defer span.End()
+
+		c.SetUserContext(ctx)
+		err := c.Next()
+
+		// The matched route is only known once the request has been routed
+		route := c.Route().Path
+		span.SetName(c.Method() + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route))
+		if requestID, ok := c.Locals("request_id").(string); ok {
+			span.SetAttributes(tracing.RequestIDKey.String(requestID))
+		}
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			tracing.RecordError(span, err)
+			status = fiber.StatusInternalServerError
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				status = fiberErr.Code
+			}
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if err == nil && status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, "")
+		}
+
+		return err
+	}
+}
+
+// requestHeaderCarrier exposes request headers to propagators
+type requestHeaderCarrier struct {
+	c *fiber.Ctx
+}
+
+func (h requestHeaderCarrier) Get(key string) string {
+	return h.c.Get(key)
+}
+
+func (h requestHeaderCarrier) Set(key, value string) {
+	h.c.Request().Header.Set(key, value)
+}
+
+func (h requestHeaderCarrier) Keys() []string {
+	var keys []string
+	h.c.Request().Header.VisitAll(func(k, _ []byte) {
+		keys = append(keys, string(k))
+	})
+	return keys
+}
@@ -1,22 +1,37 @@
 package middleware
 
 import (
+	"errors"
+	"log/slog"
+	"strings"
 	"time"
 
-	"github.com/gofiber/fiber/v2"
+	"github.com/PrakarshSingh5/fintechkit/pkg/logging"
 	"github.com/PrakarshSingh5/fintechkit/pkg/webhook"
+	"github.com/gofiber/fiber/v2"
 )
 
-// WebhookMiddleware creates middleware for webhook validation
+// WebhookMiddleware verifies and decodes webhooks with the receiver and stores
+// the resulting *webhook.Event in c.Locals("webhook_event") for downstream handlers
 func WebhookMiddleware(receiver *webhook.Receiver, provider string, getSignature func(*fiber.Ctx) string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Get webhook payload
-		payload := c.Body()
+		// Copy the payload; Fiber reuses the request buffer after the handler returns
+		payload := append([]byte(nil), c.Body()...)
 
 		// Get signature from appropriate header
-		signature := getSignature(c)
+		signature := strings.Clone(getSignature(c))
+
+		if err := receiver.Verify(provider, payload, signature); err != nil {
+			return ErrUnauthenticated.WithDetail("invalid signature").Wrap(err)
+		}
+
+		event, err := receiver.Decode(provider, payload, signature)
+		if err != nil {
+			return ErrBadRequest.WithDetail("malformed event").Wrap(err)
+		}
 
 		// Store for downstream handlers
+		c.Locals("webhook_event", event)
 		c.Locals("webhook_payload", payload)
 		c.Locals("webhook_signature", signature)
 		c.Locals("webhook_provider", provider)
@@ -25,10 +40,24 @@ func WebhookMiddleware(receiver *webhook.Receiver, provider string, getSignature
 	}
 }
 
-// StripeWebhookMiddleware validates Stripe webhooks
+// StripeWebhookMiddleware stores the payload and Stripe-Signature header in
+// c.Locals for handlers that verify the webhook themselves. Use
+// StripeWebhookMiddlewareWithReceiver to verify and decode it here.
 func StripeWebhookMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals("webhook_payload", append([]byte(nil), c.Body()...))
+		c.Locals("webhook_signature", strings.Clone(c.Get("Stripe-Signature")))
+		c.Locals("webhook_provider", "stripe")
+
+		return c.Next()
+	}
+}
+
+// StripeWebhookMiddlewareWithReceiver validates Stripe webhooks with the
+// receiver's "stripe" verifier
+func StripeWebhookMiddlewareWithReceiver(receiver *webhook.Receiver) fiber.Handler {
 	return WebhookMiddleware(
-		nil,
+		receiver,
 		"stripe",
 		func(c *fiber.Ctx) string {
 			return c.Get("Stripe-Signature")
@@ -36,61 +65,121 @@ func StripeWebhookMiddleware() fiber.Handler {
 	)
 }
 
-// PlaidWebhookMiddleware validates Plaid webhooks
+// PlaidWebhookMiddleware stores the payload and Plaid-Verification header in
+// c.Locals for handlers that verify the webhook themselves. Use
+// PlaidWebhookMiddlewareWithReceiver to verify and decode it here.
 func PlaidWebhookMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Plaid doesn't use signature verification
-		// Just store the payload
-		c.Locals("webhook_payload", c.Body())
+		c.Locals("webhook_payload", append([]byte(nil), c.Body()...))
+		c.Locals("webhook_signature", strings.Clone(c.Get("Plaid-Verification")))
 		c.Locals("webhook_provider", "plaid")
 
 		return c.Next()
 	}
 }
 
-// IdempotencyMiddleware ensures webhook idempotency
-func IdempotencyMiddleware(tracker *webhook.IdempotencyTracker) fiber.Handler {
+// PlaidWebhookMiddlewareWithReceiver validates Plaid webhooks with the
+// receiver's "plaid" verifier, usually
+// webhook.NewPlaidVerifier(plaidClient.WebhookKeys())
+func PlaidWebhookMiddlewareWithReceiver(receiver *webhook.Receiver) fiber.Handler {
+	return WebhookMiddleware(
+		receiver,
+		"plaid",
+		func(c *fiber.Ctx) string {
+			return c.Get("Plaid-Verification")
+		},
+	)
+}
+
+// WebhookHandler returns a Fiber handler that runs a webhook through the
+// ingress (verify, decode, deduplicate, route) for a single provider
+func WebhookHandler(ingress *webhook.Ingress, provider string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Get idempotency key from header
-		key := c.Get("Idempotency-Key")
-
-		if key != "" {
-			if tracker.IsProcessed(key) {
-				// Already processed, return success
-				return c.Status(fiber.StatusOK).JSON(fiber.Map{
-					"status": "already_processed",
-				})
-			}
+		return handleWebhook(c, ingress, provider)
+	}
+}
 
-			// Mark as processed after successful processing
-			defer tracker.MarkProcessed(key)
-		}
+// RegisterWebhookRoutes mounts POST /:provider on the router for every provider
+// the ingress knows about, e.g. app.Group("/webhooks")
+func RegisterWebhookRoutes(router fiber.Router, ingress *webhook.Ingress) {
+	router.Post("/:provider", func(c *fiber.Ctx) error {
+		return handleWebhook(c, ingress, strings.Clone(c.Params("provider")))
+	})
+}
 
-		return c.Next()
+func handleWebhook(c *fiber.Ctx, ingress *webhook.Ingress, provider string) error {
+	// Copy the payload; async routing may outlive Fiber's request buffer
+	payload := append([]byte(nil), c.Body()...)
+
+	// Header values are cloned for the same reason
+	result := ingress.Handle(c.UserContext(), provider, payload, func(key string) string {
+		return strings.Clone(c.Get(key))
+	})
+
+	if result.StatusCode == fiber.StatusServiceUnavailable {
+		c.Set(fiber.HeaderRetryAfter, "30")
 	}
+	if result.StatusCode >= fiber.StatusBadRequest {
+		return fromStatus(result.StatusCode, result.Body()["error"]).Wrap(result.Err)
+	}
+	return c.Status(result.StatusCode).JSON(result.Body())
 }
 
-// RequestLoggingMiddleware logs all requests
+// RequestLoggingMiddleware logs each request with its status, duration and
+// correlation ID to logging.Logger()
 func RequestLoggingMiddleware() fiber.Handler {
+	return RequestLoggingMiddlewareWithLogger(nil)
+}
+
+// RequestLoggingMiddlewareWithLogger is RequestLoggingMiddleware writing to
+// logger. A nil logger uses logging.Logger(); either way values are redacted
+// before they are written.
+func RequestLoggingMiddlewareWithLogger(logger *slog.Logger) fiber.Handler {
+	if logger != nil {
+		logger = logging.Redacted(logger)
+	}
+
 	return func(c *fiber.Ctx) error {
 		start := time.Now()
+		requestID := RequestID(c)
 
 		// Process request
 		err := c.Next()
 
-		// Log request details
-		duration := time.Since(start)
+		status := c.Response().StatusCode()
+		if err != nil {
+			// The error handler has not written the response yet
+			status = fiber.StatusInternalServerError
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				status = fiberErr.Code
+			}
+		}
 
-		// In production, use structured logging
-		// logger.Info("request",
-		// 	"method", c.Method(),
-		// 	"path", c.Path(),
-		// 	"status", c.Response().StatusCode(),
-		// 	"duration", duration,
-		// 	"ip", c.IP(),
-		// )
+		attrs := []any{
+			"method", c.Method(),
+			"path", c.Path(),
+			"route", c.Route().Path,
+			"status", status,
+			"duration", time.Since(start),
+			"ip", c.IP(),
+			"request_id", requestID,
+		}
+		if principal, ok := PrincipalFromLocals(c); ok {
+			attrs = append(attrs, "principal", principal.ID)
+		}
+		if err != nil {
+			attrs = append(attrs, "error", err)
+		}
 
-		_ = duration // Suppress unused variable warning
+		level := slog.LevelInfo
+		switch {
+		case status >= fiber.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= fiber.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		logging.OrDefault(logger).Log(c.UserContext(), level, "request", attrs...)
 
 		return err
 	}
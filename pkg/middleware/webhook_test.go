@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/webhook"
+	"github.com/gofiber/fiber/v2"
+)
+
+// tokenVerifier accepts payloads whose signature is the given token
+type tokenVerifier string
+
+func (v tokenVerifier) Verify(payload []byte, signature string) error {
+	if signature != string(v) {
+		return errors.New("bad token")
+	}
+	return nil
+}
+
+const plaidBody = `{"webhook_type": "TRANSACTIONS", "webhook_code": "DEFAULT_UPDATE"}`
+
+// postPlaid sends a Plaid webhook with the given verification header
+func postPlaid(t *testing.T, app *fiber.App, token string) int {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/webhooks/plaid", strings.NewReader(plaidBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Plaid-Verification", token)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestPlaidWebhookMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Post("/webhooks/plaid", PlaidWebhookMiddleware(), func(c *fiber.Ctx) error {
+		if c.Locals("webhook_signature") != "token" || string(c.Locals("webhook_payload").([]byte)) != plaidBody {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	if status := postPlaid(t, app, "token"); status != fiber.StatusOK {
+		t.Fatalf("got status %d, want 200", status)
+	}
+}
+
+func TestPlaidWebhookMiddlewareWithReceiver(t *testing.T) {
+	receiver := webhook.NewReceiver()
+	receiver.RegisterVerifier("plaid", tokenVerifier("token"))
+
+	app := fiber.New(fiber.Config{ErrorHandler: FiberErrorHandler(nil)})
+	app.Post("/webhooks/plaid", PlaidWebhookMiddlewareWithReceiver(receiver), func(c *fiber.Ctx) error {
+		event, ok := c.Locals("webhook_event").(*webhook.Event)
+		if !ok || event.Type != webhook.EventPlaidTransactionsReady {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	if status := postPlaid(t, app, "token"); status != fiber.StatusOK {
+		t.Fatalf("got status %d for a verified webhook, want 200", status)
+	}
+	if status := postPlaid(t, app, "forged"); status != fiber.StatusUnauthorized {
+		t.Fatalf("got status %d for a forged webhook, want 401", status)
+	}
+}
@@ -2,14 +2,17 @@ package coingecko
 
 import (
 	"context"
+	"fmt"
 	"time"
 
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
 	"github.com/PrakarshSingh5/fintechkit/pkg/client"
 )
 
 // Client implements the CoinGecko cryptocurrency data provider
 type Client struct {
 	apiKey  string
+	source  auth.CredentialSource
 	baseURL string
 	isPro   bool
 }
@@ -18,6 +21,9 @@ type Client struct {
 type Config struct {
 	APIKey string // Optional for free tier
 	IsPro  bool   // Use Pro API endpoints
+
+	// Source, when set, supplies the API key on every call instead of APIKey
+	Source auth.CredentialSource
 }
 
 // NewClient creates a new CoinGecko client
@@ -29,11 +35,37 @@ func NewClient(config *Config) (*Client, error) {
 
 	return &Client{
 		apiKey:  config.APIKey,
+		source:  config.Source,
 		baseURL: baseURL,
 		isPro:   config.IsPro,
 	}, nil
 }
 
+// Constructor returns a client.ProviderConstructor that builds CoinGecko Pro
+// clients reading their key from the factory's credential source
+func Constructor() client.ProviderConstructor {
+	return func(config *client.ProviderConfig) (client.Provider, error) {
+		return NewClient(&Config{IsPro: true, Source: config.Source})
+	}
+}
+
+// key returns the current API key, which may be empty on the free tier
+func (c *Client) key(ctx context.Context) (string, error) {
+	apiKey := c.apiKey
+	if c.source != nil {
+		creds, err := c.source.Credentials(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to load CoinGecko credentials: %w", err)
+		}
+		apiKey = creds.APIKey
+	}
+
+	if apiKey == "" && c.isPro {
+		return "", fmt.Errorf("API key is required for the Pro API")
+	}
+	return apiKey, nil
+}
+
 // Name returns the provider name
 func (c *Client) Name() string {
 	return "coingecko"
@@ -43,7 +75,8 @@ func (c *Client) Name() string {
 func (c *Client) Authenticate(ctx context.Context) error {
 	// Free tier doesn't require authentication
 	// Pro tier should validate API key
-	return nil
+	_, err := c.key(ctx)
+	return err
 }
 
 // HealthCheck verifies API accessibility
@@ -54,6 +87,10 @@ func (c *Client) HealthCheck(ctx context.Context) error {
 
 // GetPrice retrieves current price for a cryptocurrency
 func (c *Client) GetPrice(ctx context.Context, coinID string, currency string) (*client.Price, error) {
+	if _, err := c.key(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP GET to /simple/price
 	// 2. Parse response
@@ -97,6 +134,10 @@ func (c *Client) GetPrices(ctx context.Context, coinIDs []string, currency strin
 
 // GetMarketData retrieves detailed market data
 func (c *Client) GetMarketData(ctx context.Context, coinID string) (*client.MarketData, error) {
+	if _, err := c.key(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP GET to /coins/{id}
 	// 2. Parse comprehensive market data
@@ -122,6 +163,10 @@ func (c *Client) GetMarketData(ctx context.Context, coinID string) (*client.Mark
 
 // GetHistoricalPrices retrieves historical price data
 func (c *Client) GetHistoricalPrices(ctx context.Context, coinID string, currency string, days int) ([]*client.Price, error) {
+	if _, err := c.key(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP GET to /coins/{id}/market_chart
 	// 2. Parse time series data
@@ -146,6 +191,10 @@ func (c *Client) GetHistoricalPrices(ctx context.Context, coinID string, currenc
 
 // GetTrendingCoins retrieves trending cryptocurrencies
 func (c *Client) GetTrendingCoins(ctx context.Context) ([]string, error) {
+	if _, err := c.key(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP GET to /search/trending
 	// 2. Parse response
@@ -155,6 +204,10 @@ func (c *Client) GetTrendingCoins(ctx context.Context) ([]string, error) {
 
 // GetGlobalMarketData retrieves global cryptocurrency market data
 func (c *Client) GetGlobalMarketData(ctx context.Context) (*GlobalMarketData, error) {
+	if _, err := c.key(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP GET to /global
 	// 2. Parse global market metrics
@@ -183,6 +236,10 @@ type GlobalMarketData struct {
 
 // SearchCoins searches for coins by query
 func (c *Client) SearchCoins(ctx context.Context, query string) ([]*CoinSearchResult, error) {
+	if _, err := c.key(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP GET to /search with query parameter
 	// 2. Parse search results
@@ -207,6 +264,10 @@ type CoinSearchResult struct {
 
 // GetCoinList retrieves the full list of supported coins
 func (c *Client) GetCoinList(ctx context.Context) ([]*CoinInfo, error) {
+	if _, err := c.key(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP GET to /coins/list
 	// 2. Return coin list
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
 	"github.com/PrakarshSingh5/fintechkit/pkg/client"
 )
 
@@ -12,6 +13,7 @@ import (
 type Client struct {
 	clientID string
 	secret   string
+	source   auth.CredentialSource
 	baseURL  string
 	env      string
 }
@@ -21,11 +23,15 @@ type Config struct {
 	ClientID string
 	Secret   string
 	Env      string // sandbox, development, production
+
+	// Source, when set, supplies the client ID and secret (metadata
+	// "client_id" and "secret") on every call instead of ClientID/Secret
+	Source auth.CredentialSource
 }
 
 // NewClient creates a new Plaid client
 func NewClient(config *Config) (*Client, error) {
-	if config.ClientID == "" || config.Secret == "" {
+	if config.Source == nil && (config.ClientID == "" || config.Secret == "") {
 		return nil, fmt.Errorf("client ID and secret are required")
 	}
 
@@ -39,11 +45,37 @@ func NewClient(config *Config) (*Client, error) {
 	return &Client{
 		clientID: config.ClientID,
 		secret:   config.Secret,
+		source:   config.Source,
 		baseURL:  baseURL,
 		env:      env,
 	}, nil
 }
 
+// Constructor returns a client.ProviderConstructor that builds Plaid clients
+// reading their credentials from the factory's credential source
+func Constructor(env string) client.ProviderConstructor {
+	return func(config *client.ProviderConfig) (client.Provider, error) {
+		return NewClient(&Config{Env: env, Source: config.Source})
+	}
+}
+
+// credentials returns the client ID and secret sent with each request
+func (c *Client) credentials(ctx context.Context) (string, string, error) {
+	clientID, secret := c.clientID, c.secret
+	if c.source != nil {
+		creds, err := c.source.Credentials(ctx)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to load Plaid credentials: %w", err)
+		}
+		clientID, secret = creds.Metadata["client_id"], creds.Metadata["secret"]
+	}
+
+	if clientID == "" || secret == "" {
+		return "", "", fmt.Errorf("credentials not set")
+	}
+	return clientID, secret, nil
+}
+
 // getBaseURL returns the appropriate base URL for the environment
 func getBaseURL(env string) string {
 	switch env {
@@ -63,10 +95,8 @@ func (c *Client) Name() string {
 
 // Authenticate verifies credentials are valid
 func (c *Client) Authenticate(ctx context.Context) error {
-	if c.clientID == "" || c.secret == "" {
-		return fmt.Errorf("credentials not set")
-	}
-	return nil
+	_, _, err := c.credentials(ctx)
+	return err
 }
 
 // HealthCheck verifies Plaid API is accessible
@@ -77,6 +107,10 @@ func (c *Client) HealthCheck(ctx context.Context) error {
 
 // CreateLinkToken creates a link token for Plaid Link
 func (c *Client) CreateLinkToken(ctx context.Context, userID string, products []string) (string, error) {
+	if _, _, err := c.credentials(ctx); err != nil {
+		return "", err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP POST to /link/token/create
 	// 2. Return the link token
@@ -86,6 +120,10 @@ func (c *Client) CreateLinkToken(ctx context.Context, userID string, products []
 
 // ExchangePublicToken exchanges a public token for an access token
 func (c *Client) ExchangePublicToken(ctx context.Context, publicToken string) (string, string, error) {
+	if _, _, err := c.credentials(ctx); err != nil {
+		return "", "", err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP POST to /item/public_token/exchange
 	// 2. Return access_token and item_id
@@ -97,6 +135,10 @@ func (c *Client) ExchangePublicToken(ctx context.Context, publicToken string) (s
 
 // GetAccounts retrieves all linked accounts
 func (c *Client) GetAccounts(ctx context.Context) ([]*client.Account, error) {
+	if _, _, err := c.credentials(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP POST to /accounts/get
 	// 2. Parse response
@@ -132,6 +174,10 @@ func (c *Client) GetAccount(ctx context.Context, accountID string) (*client.Acco
 
 // GetTransactions retrieves transactions for an account
 func (c *Client) GetTransactions(ctx context.Context, accountID string, startDate, endDate time.Time) ([]*client.Transaction, error) {
+	if _, _, err := c.credentials(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP POST to /transactions/get
 	// 2. Parse response with pagination
@@ -164,6 +210,10 @@ func (c *Client) GetTransactions(ctx context.Context, accountID string, startDat
 
 // GetBalance gets the current balance for an account
 func (c *Client) GetBalance(ctx context.Context, accountID string) (int64, string, error) {
+	if _, _, err := c.credentials(ctx); err != nil {
+		return 0, "", err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP POST to /accounts/balance/get
 	// 2. Return balance and currency
@@ -173,6 +223,10 @@ func (c *Client) GetBalance(ctx context.Context, accountID string) (int64, strin
 
 // GetIdentity retrieves identity information
 func (c *Client) GetIdentity(ctx context.Context, accessToken string) (*client.Identity, error) {
+	if _, _, err := c.credentials(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP POST to /identity/get
 	// 2. Parse response
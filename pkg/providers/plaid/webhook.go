@@ -0,0 +1,121 @@
+package plaid
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
+)
+
+// WebhookKeys is an auth.KeySet serving the keys Plaid signs webhooks with,
+// fetched from /webhook_verification_key/get by key ID and cached. Use it
+// with webhook.NewPlaidVerifier.
+type WebhookKeys struct {
+	client     *Client
+	httpClient *http.Client
+
+	mu   sync.RWMutex
+	keys map[string]crypto.PublicKey
+}
+
+// WebhookKeys returns a key set for verifying this account's webhooks
+func (c *Client) WebhookKeys() *WebhookKeys {
+	return &WebhookKeys{
+		client:     c,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		keys:       make(map[string]crypto.PublicKey),
+	}
+}
+
+// Key returns the webhook signing key with the given ID
+func (k *WebhookKeys) Key(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	if keyID == "" {
+		return nil, auth.ErrUnknownSigningKey
+	}
+
+	k.mu.RLock()
+	key, ok := k.keys[keyID]
+	k.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	key, err := k.fetch(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	k.keys[keyID] = key
+	k.mu.Unlock()
+	return key, nil
+}
+
+// fetch asks Plaid for a key by ID. Expired keys are refused.
+func (k *WebhookKeys) fetch(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	clientID, secret, err := k.client.credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"client_id": clientID,
+		"secret":    secret,
+		"key_id":    keyID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.client.baseURL+"/webhook_verification_key/get", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Plaid webhook key: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Plaid webhook key: %w", err)
+	}
+	if resp.StatusCode == http.StatusBadRequest {
+		// Plaid answers unknown key IDs with INVALID_INPUT
+		return nil, auth.ErrUnknownSigningKey
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch Plaid webhook key: status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Key json.RawMessage `json:"key"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode Plaid webhook key: %w", err)
+	}
+	var expiry struct {
+		ExpiredAt *int64 `json:"expired_at"`
+	}
+	if err := json.Unmarshal(result.Key, &expiry); err != nil {
+		return nil, fmt.Errorf("failed to decode Plaid webhook key: %w", err)
+	}
+	if expiry.ExpiredAt != nil {
+		return nil, fmt.Errorf("%w: Plaid webhook key %s has expired", auth.ErrUnknownSigningKey, keyID)
+	}
+
+	_, key, err := auth.ParseJWK(result.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode Plaid webhook key: %w", err)
+	}
+	return key, nil
+}
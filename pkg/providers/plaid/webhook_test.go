@@ -0,0 +1,91 @@
+package plaid
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
+)
+
+func TestWebhookKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := key.PublicKey
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	point.X.FillBytes(x)
+	point.Y.FillBytes(y)
+
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		var req struct {
+			ClientID string `json:"client_id"`
+			Secret   string `json:"secret"`
+			KeyID    string `json:"key_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ClientID != "client" || req.Secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		jwk := map[string]any{
+			"alg":        "ES256",
+			"crv":        "P-256",
+			"kty":        "EC",
+			"use":        "sig",
+			"kid":        req.KeyID,
+			"x":          base64.RawURLEncoding.EncodeToString(x),
+			"y":          base64.RawURLEncoding.EncodeToString(y),
+			"expired_at": nil,
+		}
+		switch req.KeyID {
+		case "kid_current":
+		case "kid_expired":
+			jwk["expired_at"] = 1700000000
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"key": jwk})
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&Config{ClientID: "client", Secret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.baseURL = server.URL
+	keys := client.WebhookKeys()
+	ctx := context.Background()
+
+	for range 3 {
+		got, err := keys.Key(ctx, "kid_current")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !key.PublicKey.Equal(got) {
+			t.Fatal("got a different key than Plaid served")
+		}
+	}
+	if fetches.Load() != 1 {
+		t.Fatalf("got %d fetches, want 1", fetches.Load())
+	}
+
+	for _, keyID := range []string{"kid_expired", "kid_unknown", ""} {
+		if _, err := keys.Key(ctx, keyID); !errors.Is(err, auth.ErrUnknownSigningKey) {
+			t.Fatalf("%q: got %v, want ErrUnknownSigningKey", keyID, err)
+		}
+	}
+}
@@ -2,9 +2,12 @@ package razorpay
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
 	"github.com/PrakarshSingh5/fintechkit/pkg/client"
 )
 
@@ -12,6 +15,7 @@ import (
 type Client struct {
 	keyID     string
 	keySecret string
+	source    auth.CredentialSource
 	baseURL   string
 }
 
@@ -20,15 +24,22 @@ type Config struct {
 	KeyID     string // Your Razorpay Key ID (e.g., rzp_test_xxxxx)
 	KeySecret string // Your Razorpay Key Secret
 	BaseURL   string // Optional, defaults to production
+
+	// Source, when set, supplies the key pair on every call instead of
+	// KeyID/KeySecret. Credentials hold either APIKey "keyID:keySecret" or
+	// metadata "key_id" and "key_secret".
+	Source auth.CredentialSource
 }
 
 // NewClient creates a new Razorpay client
 func NewClient(config *Config) (*Client, error) {
-	if config.KeyID == "" {
-		return nil, fmt.Errorf("Razorpay Key ID is required")
-	}
-	if config.KeySecret == "" {
-		return nil, fmt.Errorf("Razorpay Key Secret is required")
+	if config.Source == nil {
+		if config.KeyID == "" {
+			return nil, fmt.Errorf("Razorpay Key ID is required")
+		}
+		if config.KeySecret == "" {
+			return nil, fmt.Errorf("Razorpay Key Secret is required")
+		}
 	}
 
 	baseURL := config.BaseURL
@@ -39,10 +50,48 @@ func NewClient(config *Config) (*Client, error) {
 	return &Client{
 		keyID:     config.KeyID,
 		keySecret: config.KeySecret,
+		source:    config.Source,
 		baseURL:   baseURL,
 	}, nil
 }
 
+// Constructor returns a client.ProviderConstructor that builds Razorpay
+// clients reading their key pair from the factory's credential source
+func Constructor(baseURL string) client.ProviderConstructor {
+	return func(config *client.ProviderConfig) (client.Provider, error) {
+		return NewClient(&Config{BaseURL: baseURL, Source: config.Source})
+	}
+}
+
+// keyPair returns the current key ID and secret
+func (c *Client) keyPair(ctx context.Context) (string, string, error) {
+	keyID, keySecret := c.keyID, c.keySecret
+	if c.source != nil {
+		creds, err := c.source.Credentials(ctx)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to load Razorpay credentials: %w", err)
+		}
+		keyID, keySecret = creds.Metadata["key_id"], creds.Metadata["key_secret"]
+		if id, secret, ok := strings.Cut(creds.APIKey, ":"); ok {
+			keyID, keySecret = id, secret
+		}
+	}
+
+	if keyID == "" || keySecret == "" {
+		return "", "", fmt.Errorf("API credentials not set")
+	}
+	return keyID, keySecret, nil
+}
+
+// authorization returns the Basic Authorization header for the current key pair
+func (c *Client) authorization(ctx context.Context) (string, error) {
+	keyID, keySecret, err := c.keyPair(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(keyID+":"+keySecret)), nil
+}
+
 // Name returns the provider name
 func (c *Client) Name() string {
 	return "razorpay"
@@ -52,10 +101,8 @@ func (c *Client) Name() string {
 func (c *Client) Authenticate(ctx context.Context) error {
 	// In real implementation, make a test API call to verify credentials
 	// For now, just check if credentials exist
-	if c.keyID == "" || c.keySecret == "" {
-		return fmt.Errorf("API credentials not set")
-	}
-	return nil
+	_, err := c.authorization(ctx)
+	return err
 }
 
 // HealthCheck verifies Razorpay API is accessible
@@ -66,6 +113,10 @@ func (c *Client) HealthCheck(ctx context.Context) error {
 
 // CreatePayment creates a new Razorpay order
 func (c *Client) CreatePayment(ctx context.Context, req *client.PaymentRequest) (*client.Payment, error) {
+	if _, err := c.authorization(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Construct Razorpay Order request
 	// 2. Make HTTP POST to /orders with Basic Auth (keyID:keySecret)
@@ -97,6 +148,10 @@ func (c *Client) CreatePayment(ctx context.Context, req *client.PaymentRequest)
 
 // GetPayment retrieves a payment/order by ID
 func (c *Client) GetPayment(ctx context.Context, id string) (*client.Payment, error) {
+	if _, err := c.authorization(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP GET to /orders/{id}
 	// 2. Parse response
@@ -117,6 +172,10 @@ func (c *Client) GetPayment(ctx context.Context, id string) (*client.Payment, er
 
 // RefundPayment creates a refund for a payment
 func (c *Client) RefundPayment(ctx context.Context, id string, amount int64, reason string) (*client.Refund, error) {
+	if _, err := c.authorization(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP POST to /payments/{id}/refund
 	// 2. Parse response
@@ -144,6 +203,10 @@ func (c *Client) RefundPayment(ctx context.Context, id string, amount int64, rea
 
 // ListPayments lists all payments with filters
 func (c *Client) ListPayments(ctx context.Context, filters map[string]string) ([]*client.Payment, error) {
+	if _, err := c.authorization(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Build query parameters from filters
 	// 2. Make HTTP GET to /orders or /payments
@@ -179,6 +242,10 @@ func (c *Client) VerifyWebhookSignature(payload []byte, signature string, secret
 
 // CapturePayment captures an authorized payment
 func (c *Client) CapturePayment(ctx context.Context, paymentID string, amount int64) (*client.Payment, error) {
+	if _, err := c.authorization(ctx); err != nil {
+		return nil, err
+	}
+
 	// Razorpay specific: Capture a payment that was authorized
 	// POST https://api.razorpay.com/v1/payments/{id}/capture
 	// Body: { "amount": 50000, "currency": "INR" }
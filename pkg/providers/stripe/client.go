@@ -4,12 +4,14 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
 	"github.com/PrakarshSingh5/fintechkit/pkg/client"
 )
 
 // Client implements the Stripe payment provider
 type Client struct {
 	apiKey  string
+	source  auth.CredentialSource
 	baseURL string
 }
 
@@ -17,11 +19,14 @@ type Client struct {
 type Config struct {
 	APIKey  string
 	BaseURL string // Optional, defaults to production
+
+	// Source, when set, supplies the API key on every call instead of APIKey
+	Source auth.CredentialSource
 }
 
 // NewClient creates a new Stripe client
 func NewClient(config *Config) (*Client, error) {
-	if config.APIKey == "" {
+	if config.APIKey == "" && config.Source == nil {
 		return nil, fmt.Errorf("Stripe API key is required")
 	}
 
@@ -32,10 +37,36 @@ func NewClient(config *Config) (*Client, error) {
 
 	return &Client{
 		apiKey:  config.APIKey,
+		source:  config.Source,
 		baseURL: baseURL,
 	}, nil
 }
 
+// Constructor returns a client.ProviderConstructor that builds Stripe clients
+// reading their key from the factory's credential source
+func Constructor(baseURL string) client.ProviderConstructor {
+	return func(config *client.ProviderConfig) (client.Provider, error) {
+		return NewClient(&Config{BaseURL: baseURL, Source: config.Source})
+	}
+}
+
+// authorization returns the Authorization header for the current API key
+func (c *Client) authorization(ctx context.Context) (string, error) {
+	apiKey := c.apiKey
+	if c.source != nil {
+		creds, err := c.source.Credentials(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to load Stripe credentials: %w", err)
+		}
+		apiKey = creds.APIKey
+	}
+
+	if apiKey == "" {
+		return "", fmt.Errorf("API key not set")
+	}
+	return "Bearer " + apiKey, nil
+}
+
 // Name returns the provider name
 func (c *Client) Name() string {
 	return "stripe"
@@ -45,10 +76,8 @@ func (c *Client) Name() string {
 func (c *Client) Authenticate(ctx context.Context) error {
 	// In real implementation, make a test API call
 	// For now, just check if key exists
-	if c.apiKey == "" {
-		return fmt.Errorf("API key not set")
-	}
-	return nil
+	_, err := c.authorization(ctx)
+	return err
 }
 
 // HealthCheck verifies Stripe API is accessible
@@ -59,6 +88,10 @@ func (c *Client) HealthCheck(ctx context.Context) error {
 
 // CreatePayment creates a new payment intent
 func (c *Client) CreatePayment(ctx context.Context, req *client.PaymentRequest) (*client.Payment, error) {
+	if _, err := c.authorization(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Construct Stripe PaymentIntent request
 	// 2. Make HTTP POST to /v1/payment_intents
@@ -78,6 +111,10 @@ func (c *Client) CreatePayment(ctx context.Context, req *client.PaymentRequest)
 
 // GetPayment retrieves a payment by ID
 func (c *Client) GetPayment(ctx context.Context, id string) (*client.Payment, error) {
+	if _, err := c.authorization(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP GET to /v1/payment_intents/{id}
 	// 2. Parse response
@@ -92,6 +129,10 @@ func (c *Client) GetPayment(ctx context.Context, id string) (*client.Payment, er
 
 // RefundPayment creates a refund for a payment
 func (c *Client) RefundPayment(ctx context.Context, id string, amount int64, reason string) (*client.Refund, error) {
+	if _, err := c.authorization(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP POST to /v1/refunds
 	// 2. Parse response
@@ -107,6 +148,10 @@ func (c *Client) RefundPayment(ctx context.Context, id string, amount int64, rea
 
 // ListPayments lists all payments with filters
 func (c *Client) ListPayments(ctx context.Context, filters map[string]string) ([]*client.Payment, error) {
+	if _, err := c.authorization(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Build query parameters from filters
 	// 2. Make HTTP GET to /v1/payment_intents
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
 	"github.com/PrakarshSingh5/fintechkit/pkg/client"
 )
 
@@ -13,6 +14,7 @@ type Client struct {
 	clientID     string
 	clientSecret string
 	accessToken  string
+	source       auth.CredentialSource
 	baseURL      string
 	authURL      string
 	env          string
@@ -23,6 +25,10 @@ type Config struct {
 	ClientID     string
 	ClientSecret string
 	Env          string // sandbox, production
+
+	// Source, when set, supplies the OAuth access token on every call
+	// instead of SetAccessToken
+	Source auth.CredentialSource
 }
 
 // NewClient creates a new TrueLayer client
@@ -42,12 +48,43 @@ func NewClient(config *Config) (*Client, error) {
 	return &Client{
 		clientID:     config.ClientID,
 		clientSecret: config.ClientSecret,
+		source:       config.Source,
 		baseURL:      baseURL,
 		authURL:      authURL,
 		env:          env,
 	}, nil
 }
 
+// Constructor returns a client.ProviderConstructor that builds TrueLayer
+// clients reading their access token from the factory's credential source
+func Constructor(clientID, clientSecret, env string) client.ProviderConstructor {
+	return func(config *client.ProviderConfig) (client.Provider, error) {
+		return NewClient(&Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Env:          env,
+			Source:       config.Source,
+		})
+	}
+}
+
+// authorization returns the Authorization header for the current access token
+func (c *Client) authorization(ctx context.Context) (string, error) {
+	accessToken := c.accessToken
+	if c.source != nil {
+		creds, err := c.source.Credentials(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to load TrueLayer credentials: %w", err)
+		}
+		accessToken = creds.AccessToken
+	}
+
+	if accessToken == "" {
+		return "", fmt.Errorf("access token not set")
+	}
+	return "Bearer " + accessToken, nil
+}
+
 // getBaseURL returns the appropriate base URL
 func getBaseURL(env string) string {
 	if env == "production" {
@@ -89,6 +126,10 @@ func (c *Client) SetAccessToken(token string) {
 
 // GetAccounts retrieves all linked accounts
 func (c *Client) GetAccounts(ctx context.Context) ([]*client.Account, error) {
+	if _, err := c.authorization(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP GET to /data/v1/accounts
 	// 2. Parse response
@@ -108,6 +149,10 @@ func (c *Client) GetAccounts(ctx context.Context) ([]*client.Account, error) {
 
 // GetAccount retrieves a specific account
 func (c *Client) GetAccount(ctx context.Context, accountID string) (*client.Account, error) {
+	if _, err := c.authorization(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP GET to /data/v1/accounts/{account_id}
 
@@ -122,6 +167,10 @@ func (c *Client) GetAccount(ctx context.Context, accountID string) (*client.Acco
 
 // GetTransactions retrieves transactions
 func (c *Client) GetTransactions(ctx context.Context, accountID string, startDate, endDate time.Time) ([]*client.Transaction, error) {
+	if _, err := c.authorization(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP GET to /data/v1/accounts/{account_id}/transactions
 	// 2. Handle pagination
@@ -143,6 +192,10 @@ func (c *Client) GetTransactions(ctx context.Context, accountID string, startDat
 
 // GetBalance gets account balance
 func (c *Client) GetBalance(ctx context.Context, accountID string) (int64, string, error) {
+	if _, err := c.authorization(ctx); err != nil {
+		return 0, "", err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP GET to /data/v1/accounts/{account_id}/balance
 
@@ -151,6 +204,10 @@ func (c *Client) GetBalance(ctx context.Context, accountID string) (int64, strin
 
 // InitiatePayment initiates a PSD2 payment
 func (c *Client) InitiatePayment(ctx context.Context, req *PaymentInitiationRequest) (*PaymentInitiation, error) {
+	if _, err := c.authorization(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP POST to /payments
 	// 2. Return payment initiation details with redirect URL
@@ -167,6 +224,10 @@ func (c *Client) InitiatePayment(ctx context.Context, req *PaymentInitiationRequ
 
 // GetPaymentStatus retrieves payment status
 func (c *Client) GetPaymentStatus(ctx context.Context, paymentID string) (string, error) {
+	if _, err := c.authorization(ctx); err != nil {
+		return "", err
+	}
+
 	// Real implementation would:
 	// 1. Make HTTP GET to /payments/{payment_id}
 
@@ -252,6 +313,10 @@ func (c *Client) RefundPayment(ctx context.Context, id string, amount int64, rea
 
 // ListPayments lists payments
 func (c *Client) ListPayments(ctx context.Context, filters map[string]string) ([]*client.Payment, error) {
+	if _, err := c.authorization(ctx); err != nil {
+		return nil, err
+	}
+
 	// Real implementation would call TrueLayer API
 	return []*client.Payment{}, nil
 }
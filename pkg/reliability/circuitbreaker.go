@@ -1,11 +1,14 @@
 package reliability
 
 import (
+	"context"
 	"errors"
-	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
+	"github.com/PrakarshSingh5/fintechkit/pkg/logging"
+	"github.com/PrakarshSingh5/fintechkit/pkg/metrics"
 	"github.com/sony/gobreaker"
 )
 
@@ -17,6 +20,8 @@ type CircuitBreakerConfig struct {
 	FailureThreshold uint32        // Number of failures to open the circuit
 	SuccessThreshold uint32        // Number of successes to close from half-open
 	OnStateChange    func(name string, from gobreaker.State, to gobreaker.State)
+	Logger           *slog.Logger     // Reports state changes; defaults to logging.Logger()
+	Metrics          *metrics.Metrics // Records state and transitions; defaults to metrics.Default()
 }
 
 // DefaultCircuitBreakerConfig returns sensible defaults
@@ -44,7 +49,18 @@ func NewCircuitBreaker(name string, config *CircuitBreakerConfig) *CircuitBreake
 		config = DefaultCircuitBreakerConfig()
 	}
 
-	settings := gobreaker.Settings{
+	metrics.OrDefault(config.Metrics).BreakerState(name, gobreaker.StateClosed.String())
+
+	return &CircuitBreaker{
+		name:    name,
+		breaker: gobreaker.NewCircuitBreaker(breakerSettings(name, config)),
+		config:  config,
+	}
+}
+
+// breakerSettings builds the gobreaker settings for a config
+func breakerSettings(name string, config *CircuitBreakerConfig) gobreaker.Settings {
+	return gobreaker.Settings{
 		Name:        name,
 		MaxRequests: config.MaxRequests,
 		Interval:    config.Interval,
@@ -53,17 +69,22 @@ func NewCircuitBreaker(name string, config *CircuitBreakerConfig) *CircuitBreake
 			return counts.ConsecutiveFailures >= config.FailureThreshold
 		},
 		OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
+			level := slog.LevelInfo
+			if to == gobreaker.StateOpen {
+				level = slog.LevelWarn
+			}
+			logging.OrDefault(config.Logger).Log(context.Background(), level, "circuit breaker state changed",
+				"breaker", name,
+				"from", from.String(),
+				"to", to.String(),
+			)
+			metrics.OrDefault(config.Metrics).BreakerTransition(name, from.String(), to.String())
+
 			if config.OnStateChange != nil {
 				config.OnStateChange(name, from, to)
 			}
 		},
 	}
-
-	return &CircuitBreaker{
-		name:    name,
-		breaker: gobreaker.NewCircuitBreaker(settings),
-		config:  config,
-	}
 }
 
 // Execute runs a function through the circuit breaker
@@ -203,32 +224,37 @@ func (cb *CircuitBreaker) Reset() {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
 
-	settings := gobreaker.Settings{
-		Name:        cb.name,
-		MaxRequests: cb.config.MaxRequests,
-		Interval:    cb.config.Interval,
-		Timeout:     cb.config.Timeout,
-		ReadyToTrip: func(counts gobreaker.Counts) bool {
-			return counts.ConsecutiveFailures >= cb.config.FailureThreshold
-		},
-		OnStateChange: cb.config.OnStateChange,
-	}
-
-	cb.breaker = gobreaker.NewCircuitBreaker(settings)
+	cb.breaker = gobreaker.NewCircuitBreaker(breakerSettings(cb.name, cb.config))
+	metrics.OrDefault(cb.config.Metrics).BreakerState(cb.name, gobreaker.StateClosed.String())
 }
 
-// MonitorCircuitBreakers logs circuit breaker states periodically
-func MonitorCircuitBreakers(manager *CircuitBreakerManager, interval time.Duration, logger func(string)) {
+// MonitorCircuitBreakers logs the statistics of every managed breaker each
+// interval until ctx is done. Reading the state also lets an open breaker
+// whose timeout has passed move to half-open, so state metrics stay current
+// even without traffic. A nil logger uses logging.Logger().
+func MonitorCircuitBreakers(ctx context.Context, manager *CircuitBreakerManager, interval time.Duration, logger *slog.Logger) {
+	logger = logging.OrDefault(logger)
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		breakers := manager.GetAll()
-		for _, breaker := range breakers {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, breaker := range manager.GetAll() {
 			stats := breaker.GetStats()
-			msg := fmt.Sprintf("CircuitBreaker[%s]: State=%s, Requests=%d, Successes=%d, Failures=%d",
-				stats.Name, stats.State, stats.TotalRequests, stats.TotalSuccesses, stats.TotalFailures)
-			logger(msg)
+			metrics.OrDefault(breaker.config.Metrics).BreakerState(stats.Name, stats.State)
+			logger.DebugContext(ctx, "circuit breaker stats",
+				"breaker", stats.Name,
+				"state", stats.State,
+				"requests", stats.TotalRequests,
+				"successes", stats.TotalSuccesses,
+				"failures", stats.TotalFailures,
+			)
 		}
 	}
 }
@@ -0,0 +1,126 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// gcraMaxAttempts bounds compare-and-set retries under contention
+const gcraMaxAttempts = 10
+
+// ErrRateLimitContention is returned when the shared state changed on every attempt
+var ErrRateLimitContention = errors.New("rate limit state contended")
+
+// GCRALimiter is a DistributedRateLimiter using the generic cell rate
+// algorithm. Each key's whole state is one timestamp (the theoretical arrival
+// time of the next request) kept in a KV, updated with compare-and-set, so
+// any number of replicas sharing the KV enforce a single quota.
+type GCRALimiter struct {
+	kv     KV
+	window RateWindow
+	prefix string
+}
+
+// NewGCRALimiter creates a GCRA limiter enforcing window for every key
+func NewGCRALimiter(kv KV, window RateWindow) (*GCRALimiter, error) {
+	if window.Limit <= 0 || window.Period <= 0 {
+		return nil, errors.New("rate window needs a positive limit and period")
+	}
+	return &GCRALimiter{kv: kv, window: window, prefix: "gcra:"}, nil
+}
+
+// Allow takes one request for key. It implements KeyedLimiter, so the limiter
+// can back middleware.KeyedRateLimitMiddleware.
+func (g *GCRALimiter) Allow(ctx context.Context, key string) (*RateLimitResult, error) {
+	return g.take(ctx, key, 1)
+}
+
+// AllowN takes n requests for key if they are all allowed now
+func (g *GCRALimiter) AllowN(ctx context.Context, key string, n int) (bool, error) {
+	result, err := g.take(ctx, key, n)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// Wait blocks until a request for key is allowed or ctx is done
+func (g *GCRALimiter) Wait(ctx context.Context, key string) error {
+	for {
+		result, err := g.take(ctx, key, 1)
+		if err != nil {
+			return err
+		}
+		if result.Allowed {
+			return nil
+		}
+
+		timer := time.NewTimer(result.RetryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// take runs one GCRA step for n requests
+func (g *GCRALimiter) take(ctx context.Context, key string, n int) (*RateLimitResult, error) {
+	interval := g.window.interval()
+	capacity := g.window.capacity()
+	burst := time.Duration(capacity * float64(interval)) // Full bucket, as a time span
+	storeKey := g.prefix + key
+
+	for attempt := 0; attempt < gcraMaxAttempts; attempt++ {
+		value, version, err := g.kv.Get(ctx, storeKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rate limit state: %w", err)
+		}
+
+		now := time.Now()
+		tat := now
+		if value != nil {
+			stored, err := strconv.ParseInt(string(value), 10, 64)
+			if err == nil && stored > now.UnixNano() {
+				tat = time.Unix(0, stored)
+			}
+		}
+
+		newTAT := tat.Add(time.Duration(n) * interval)
+		allowAt := newTAT.Add(-burst)
+		if now.Before(allowAt) {
+			return &RateLimitResult{
+				Allowed:    false,
+				Limit:      int(capacity),
+				Remaining:  max(0, int(now.Sub(tat.Add(-burst))/interval)),
+				Reset:      tat.Sub(now),
+				RetryAfter: allowAt.Sub(now),
+			}, nil
+		}
+
+		stored, err := g.kv.CompareAndSet(ctx, storeKey, []byte(strconv.FormatInt(newTAT.UnixNano(), 10)), version, newTAT.Sub(now))
+		if err != nil {
+			return nil, fmt.Errorf("failed to update rate limit state: %w", err)
+		}
+		if stored {
+			return &RateLimitResult{
+				Allowed:   true,
+				Limit:     int(capacity),
+				Remaining: int(now.Sub(allowAt) / interval),
+				Reset:     newTAT.Sub(now),
+			}, nil
+		}
+	}
+
+	return nil, ErrRateLimitContention
+}
+
+// Window returns the token bucket equivalent of the config, for use with
+// KeyedRateLimiter or GCRALimiter
+func (c *RateLimitConfig) Window() RateWindow {
+	return PerSecond(c.RequestsPerSecond, c.Burst)
+}
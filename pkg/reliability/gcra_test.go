@@ -0,0 +1,135 @@
+package reliability
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGCRALimiterBurstThenDeny(t *testing.T) {
+	ctx := context.Background()
+	limiter, err := NewGCRALimiter(NewMemoryKV(), RateWindow{Limit: 10, Period: time.Hour, Burst: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Allow(ctx, "acme")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed {
+			t.Fatalf("request %d denied within the burst", i+1)
+		}
+		if want := 2 - i; result.Remaining != want {
+			t.Fatalf("request %d: got remaining %d, want %d", i+1, result.Remaining, want)
+		}
+	}
+
+	result, err := limiter.Allow(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed {
+		t.Fatal("request beyond the burst allowed")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > 6*time.Minute {
+		t.Fatalf("got retry after %v, want up to one interval (6m)", result.RetryAfter)
+	}
+
+	// Keys have separate quotas
+	if result, err := limiter.Allow(ctx, "globex"); err != nil || !result.Allowed {
+		t.Fatalf("other key: got %+v, %v", result, err)
+	}
+}
+
+func TestGCRALimiterRefills(t *testing.T) {
+	ctx := context.Background()
+	limiter, err := NewGCRALimiter(NewMemoryKV(), RateWindow{Limit: 1, Period: 20 * time.Millisecond, Burst: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := limiter.AllowN(ctx, "acme", 1); err != nil || !ok {
+		t.Fatalf("first request: got %v, %v", ok, err)
+	}
+	if ok, err := limiter.AllowN(ctx, "acme", 1); err != nil || ok {
+		t.Fatalf("second request: got %v, %v, want denied", ok, err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := limiter.Wait(waitCtx, "acme"); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+}
+
+func TestGCRALimiterAllowNIsAllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	limiter, err := NewGCRALimiter(NewMemoryKV(), RateWindow{Limit: 5, Period: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := limiter.AllowN(ctx, "acme", 6); err != nil || ok {
+		t.Fatalf("AllowN above capacity: got %v, %v, want denied", ok, err)
+	}
+	if ok, err := limiter.AllowN(ctx, "acme", 5); err != nil || !ok {
+		t.Fatalf("AllowN at capacity: got %v, %v; the denied request used quota", ok, err)
+	}
+}
+
+// TestGCRALimiterSharedAcrossReplicas checks that limiters sharing a KV
+// enforce one quota between them, however their requests interleave
+func TestGCRALimiterSharedAcrossReplicas(t *testing.T) {
+	const capacity, replicas, requests = 20, 4, 15
+
+	for name, kv := range testKVs(t) {
+		t.Run(name, func(t *testing.T) {
+			var allowed atomic.Int64
+			errs := make(chan error, replicas)
+			var wg sync.WaitGroup
+			for i := 0; i < replicas; i++ {
+				limiter, err := NewGCRALimiter(kv, RateWindow{Limit: capacity, Period: time.Hour})
+				if err != nil {
+					t.Fatal(err)
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < requests; j++ {
+						result, err := limiter.Allow(context.Background(), "acme")
+						if errors.Is(err, ErrRateLimitContention) {
+							continue // Denied, like a request over the limit
+						}
+						if err != nil {
+							errs <- err
+							return
+						}
+						if result.Allowed {
+							allowed.Add(1)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				t.Fatalf("Allow: %v", err)
+			}
+			if got := allowed.Load(); got != capacity {
+				t.Fatalf("allowed %d requests across replicas, want %d", got, capacity)
+			}
+		})
+	}
+}
+
+func TestNewGCRALimiterRejectsEmptyWindow(t *testing.T) {
+	if _, err := NewGCRALimiter(NewMemoryKV(), RateWindow{}); err == nil {
+		t.Fatal("accepted a window without a limit")
+	}
+}
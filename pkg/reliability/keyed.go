@@ -0,0 +1,237 @@
+package reliability
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateWindow is one limit applied to a key: Limit requests per Period, with
+// up to Burst allowed at once (defaults to Limit)
+type RateWindow struct {
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// PerSecond returns a window allowing requestsPerSecond with the given burst
+func PerSecond(requestsPerSecond float64, burst int) RateWindow {
+	return RateWindow{Limit: 1, Period: time.Duration(float64(time.Second) / requestsPerSecond), Burst: burst}
+}
+
+func (w RateWindow) capacity() float64 {
+	if w.Burst > 0 {
+		return float64(w.Burst)
+	}
+	return float64(w.Limit)
+}
+
+// interval is how long one request's worth of quota takes to refill
+func (w RateWindow) interval() time.Duration {
+	return w.Period / time.Duration(w.Limit)
+}
+
+// RateLimitResult is the outcome of a rate limit check, in the terms of the
+// RateLimit header fields
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int           // Capacity of the most constrained window
+	Remaining  int           // Requests left in that window
+	Reset      time.Duration // Until that window is full again
+	RetryAfter time.Duration // Until the request would be allowed; zero if allowed
+}
+
+// KeyedLimiter rate limits requests by key
+type KeyedLimiter interface {
+	Allow(ctx context.Context, key string) (*RateLimitResult, error)
+}
+
+// KeyedRateLimiterConfig configures a KeyedRateLimiter
+type KeyedRateLimiterConfig struct {
+	Windows []RateWindow // Every window must allow a request
+
+	MaxKeys     int           // Keys tracked before the least recently used are evicted
+	IdleTimeout time.Duration // Keys unused for this long are dropped
+	Shards      int           // Lock shards; more reduce contention
+}
+
+// DefaultKeyedRateLimiterConfig returns defaults for the given windows
+func DefaultKeyedRateLimiterConfig(windows ...RateWindow) *KeyedRateLimiterConfig {
+	return &KeyedRateLimiterConfig{
+		Windows:     windows,
+		MaxKeys:     100000,
+		IdleTimeout: 10 * time.Minute,
+		Shards:      32,
+	}
+}
+
+// KeyedRateLimiter keeps a token bucket per key and window in a sharded LRU,
+// so memory stays bounded however many distinct keys (e.g. client IPs) it
+// sees. It is safe for concurrent use.
+type KeyedRateLimiter struct {
+	windows     []RateWindow
+	idleTimeout time.Duration
+	shards      []*limiterShard
+}
+
+type limiterShard struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	lru      *list.List // Front is most recently used
+}
+
+type limiterEntry struct {
+	key      string
+	mu       sync.Mutex
+	tokens   []float64 // Per window
+	updated  time.Time
+	lastSeen time.Time
+}
+
+// NewKeyedRateLimiter creates a keyed rate limiter
+func NewKeyedRateLimiter(config *KeyedRateLimiterConfig) (*KeyedRateLimiter, error) {
+	if len(config.Windows) == 0 {
+		return nil, errors.New("at least one rate window is required")
+	}
+	for _, w := range config.Windows {
+		if w.Limit <= 0 || w.Period <= 0 {
+			return nil, errors.New("rate windows need a positive limit and period")
+		}
+	}
+
+	shards := config.Shards
+	if shards <= 0 {
+		shards = 32
+	}
+	maxKeys := config.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = 100000
+	}
+
+	// Dropping a key before its buckets have refilled would reset its limit
+	idleTimeout := config.IdleTimeout
+	for _, w := range config.Windows {
+		refill := time.Duration(w.capacity()) * w.interval()
+		idleTimeout = max(idleTimeout, refill)
+	}
+
+	l := &KeyedRateLimiter{
+		windows:     append([]RateWindow(nil), config.Windows...),
+		idleTimeout: idleTimeout,
+		shards:      make([]*limiterShard, shards),
+	}
+	for i := range l.shards {
+		l.shards[i] = &limiterShard{
+			capacity: max(1, maxKeys/shards),
+			entries:  make(map[string]*list.Element),
+			lru:      list.New(),
+		}
+	}
+	return l, nil
+}
+
+// Allow takes one request from every window for key if all have quota
+func (l *KeyedRateLimiter) Allow(ctx context.Context, key string) (*RateLimitResult, error) {
+	now := time.Now()
+	entry := l.entry(key, now)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	// Concurrent callers may take the lock out of order
+	elapsed := max(0, now.Sub(entry.updated).Seconds())
+	if now.After(entry.updated) {
+		entry.updated = now
+	}
+
+	allowed := true
+	for i, w := range l.windows {
+		refill := elapsed * float64(w.Limit) / w.Period.Seconds()
+		entry.tokens[i] = math.Min(w.capacity(), entry.tokens[i]+refill)
+		if entry.tokens[i] < 1 {
+			allowed = false
+		}
+	}
+
+	result := &RateLimitResult{Allowed: allowed, Remaining: math.MaxInt}
+	for i, w := range l.windows {
+		if allowed {
+			entry.tokens[i]--
+		} else if entry.tokens[i] < 1 {
+			wait := time.Duration((1 - entry.tokens[i]) * float64(w.interval()))
+			result.RetryAfter = max(result.RetryAfter, wait)
+		}
+
+		remaining := int(entry.tokens[i])
+		if remaining < result.Remaining {
+			result.Limit = int(w.capacity())
+			result.Remaining = remaining
+			result.Reset = time.Duration((w.capacity() - entry.tokens[i]) * float64(w.interval()))
+		}
+	}
+
+	return result, nil
+}
+
+// Len returns the number of keys being tracked
+func (l *KeyedRateLimiter) Len() int {
+	n := 0
+	for _, shard := range l.shards {
+		shard.mu.Lock()
+		n += len(shard.entries)
+		shard.mu.Unlock()
+	}
+	return n
+}
+
+// entry returns the buckets for key, creating them full if needed, and
+// evicts idle and least recently used keys from its shard
+func (l *KeyedRateLimiter) entry(key string, now time.Time) *limiterEntry {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	shard := l.shards[h.Sum32()%uint32(len(l.shards))]
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	for back := shard.lru.Back(); back != nil; back = shard.lru.Back() {
+		oldest := back.Value.(*limiterEntry)
+		if now.Sub(oldest.lastSeen) < l.idleTimeout {
+			break
+		}
+		shard.remove(back)
+	}
+
+	if elem, ok := shard.entries[key]; ok {
+		shard.lru.MoveToFront(elem)
+		entry := elem.Value.(*limiterEntry)
+		entry.lastSeen = now
+		return entry
+	}
+
+	if shard.lru.Len() >= shard.capacity {
+		shard.remove(shard.lru.Back())
+	}
+
+	entry := &limiterEntry{
+		key:      key,
+		tokens:   make([]float64, len(l.windows)),
+		updated:  now,
+		lastSeen: now,
+	}
+	for i, w := range l.windows {
+		entry.tokens[i] = w.capacity()
+	}
+	shard.entries[key] = shard.lru.PushFront(entry)
+	return entry
+}
+
+func (s *limiterShard) remove(elem *list.Element) {
+	s.lru.Remove(elem)
+	delete(s.entries, elem.Value.(*limiterEntry).key)
+}
@@ -0,0 +1,223 @@
+package reliability
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// exhaust takes every request key has left
+func exhaust(t *testing.T, limiter *KeyedRateLimiter, key string) {
+	t.Helper()
+	for {
+		result, err := limiter.Allow(context.Background(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed {
+			return
+		}
+	}
+}
+
+func TestKeyedRateLimiterMostConstrainedWindow(t *testing.T) {
+	ctx := context.Background()
+	limiter, err := NewKeyedRateLimiter(DefaultKeyedRateLimiterConfig(
+		RateWindow{Limit: 5, Period: time.Second, Burst: 2},
+		RateWindow{Limit: 3, Period: time.Hour},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		wantAllowed   bool
+		wantLimit     int
+		wantRemaining int
+	}{
+		{"first request", true, 2, 1},
+		{"burst spent", true, 2, 0},
+		{"burst empty", false, 2, 0},
+	}
+	for _, tt := range tests {
+		result, err := limiter.Allow(ctx, "acme")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed != tt.wantAllowed || result.Limit != tt.wantLimit || result.Remaining != tt.wantRemaining {
+			t.Fatalf("%s: got %+v, want allowed=%v limit=%d remaining=%d", tt.name, result, tt.wantAllowed, tt.wantLimit, tt.wantRemaining)
+		}
+		if !result.Allowed && (result.RetryAfter <= 0 || result.RetryAfter > 200*time.Millisecond) {
+			t.Fatalf("%s: got retry after %v, want up to one interval (200ms)", tt.name, result.RetryAfter)
+		}
+	}
+
+	// Once the burst refills, the hourly window is the one that runs out
+	time.Sleep(450 * time.Millisecond)
+	result, err := limiter.Allow(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Allowed || result.Limit != 3 || result.Remaining != 0 {
+		t.Fatalf("got %+v, want the last request of the hourly window", result)
+	}
+	time.Sleep(450 * time.Millisecond)
+	if result, err := limiter.Allow(ctx, "acme"); err != nil || result.Allowed {
+		t.Fatalf("got %+v, %v, want denied by the hourly window", result, err)
+	}
+}
+
+func TestKeyedRateLimiterEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultKeyedRateLimiterConfig(RateWindow{Limit: 1, Period: time.Hour})
+	config.MaxKeys = 3
+	config.Shards = 1
+	limiter, err := NewKeyedRateLimiter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		exhaust(t, limiter, key)
+	}
+	// Touching a makes b the least recently used
+	exhaust(t, limiter, "a")
+	exhaust(t, limiter, "d")
+
+	if n := limiter.Len(); n != 3 {
+		t.Fatalf("got %d keys, want 3", n)
+	}
+	for _, tt := range []struct {
+		key         string
+		wantAllowed bool
+	}{
+		{"a", false},
+		{"c", false},
+		{"d", false},
+		{"b", true}, // Evicted, so it starts over with a full bucket
+	} {
+		result, err := limiter.Allow(ctx, tt.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed != tt.wantAllowed {
+			t.Fatalf("key %s: got allowed=%v, want %v", tt.key, result.Allowed, tt.wantAllowed)
+		}
+	}
+}
+
+func TestKeyedRateLimiterBoundsMemory(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultKeyedRateLimiterConfig(RateWindow{Limit: 10, Period: time.Second})
+	config.MaxKeys = 64
+	config.Shards = 8
+	limiter, err := NewKeyedRateLimiter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 10000 {
+		if _, err := limiter.Allow(ctx, fmt.Sprintf("10.0.%d.%d", i/256, i%256)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := limiter.Len(); n > 64 {
+		t.Fatalf("got %d keys tracked, want at most 64", n)
+	}
+}
+
+func TestKeyedRateLimiterDropsIdleKeys(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultKeyedRateLimiterConfig(RateWindow{Limit: 1, Period: 10 * time.Millisecond})
+	config.IdleTimeout = 10 * time.Millisecond
+	config.Shards = 1
+	limiter, err := NewKeyedRateLimiter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := limiter.Allow(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := limiter.Allow(ctx, "d"); err != nil {
+		t.Fatal(err)
+	}
+	if n := limiter.Len(); n != 1 {
+		t.Fatalf("got %d keys after the others went idle, want 1", n)
+	}
+}
+
+func TestKeyedRateLimiterKeepsKeysUntilRefilled(t *testing.T) {
+	ctx := context.Background()
+	// The idle timeout is shorter than the hour the bucket takes to refill
+	config := DefaultKeyedRateLimiterConfig(RateWindow{Limit: 1, Period: time.Hour})
+	config.IdleTimeout = time.Millisecond
+	limiter, err := NewKeyedRateLimiter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exhaust(t, limiter, "acme")
+	time.Sleep(10 * time.Millisecond)
+	if _, err := limiter.Allow(ctx, "globex"); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := limiter.Allow(ctx, "acme"); err != nil || result.Allowed {
+		t.Fatalf("got %+v, %v, want the limit kept while idle", result, err)
+	}
+}
+
+func TestKeyedRateLimiterConcurrentRequests(t *testing.T) {
+	ctx := context.Background()
+	limiter, err := NewKeyedRateLimiter(DefaultKeyedRateLimiterConfig(RateWindow{Limit: 10, Period: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := limiter.Allow(ctx, "acme")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if result.Allowed {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != 10 {
+		t.Fatalf("got %d requests allowed, want 10", got)
+	}
+}
+
+func TestNewKeyedRateLimiterRejectsBadWindows(t *testing.T) {
+	tests := []struct {
+		name    string
+		windows []RateWindow
+	}{
+		{"no windows", nil},
+		{"zero limit", []RateWindow{{Limit: 0, Period: time.Second}}},
+		{"zero period", []RateWindow{{Limit: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeyedRateLimiter(DefaultKeyedRateLimiterConfig(tt.windows...)); err == nil {
+				t.Fatal("accepted an invalid window")
+			}
+		})
+	}
+}
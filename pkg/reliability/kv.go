@@ -0,0 +1,208 @@
+package reliability
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/sqldialect"
+)
+
+// KV is the shared state behind distributed rate limiting: a versioned
+// key-value store with compare-and-set. Versions start at 1; version 0 means
+// the key does not exist.
+type KV interface {
+	// Get returns the value and version for key. Expired values are returned
+	// as nil with the version of the stale entry.
+	Get(ctx context.Context, key string) ([]byte, int64, error)
+	// CompareAndSet stores value if key's version still equals expected and
+	// reports whether it did. The value expires after ttl.
+	CompareAndSet(ctx context.Context, key string, value []byte, expected int64, ttl time.Duration) (bool, error)
+}
+
+// MemoryKV is a KV for a single process
+type MemoryKV struct {
+	mu      sync.Mutex
+	entries map[string]*kvEntry
+	writes  int
+}
+
+type kvEntry struct {
+	value     []byte
+	version   int64
+	expiresAt time.Time
+}
+
+// NewMemoryKV creates an in-memory KV
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{entries: make(map[string]*kvEntry)}
+}
+
+// Get returns the value and version for key
+func (m *MemoryKV) Get(ctx context.Context, key string) ([]byte, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, 0, nil
+	}
+	if time.Now().After(entry.expiresAt) {
+		return nil, entry.version, nil
+	}
+	return append([]byte(nil), entry.value...), entry.version, nil
+}
+
+// CompareAndSet stores value if the version matches
+func (m *MemoryKV) CompareAndSet(ctx context.Context, key string, value []byte, expected int64, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var version int64
+	if entry, ok := m.entries[key]; ok {
+		version = entry.version
+	}
+	if version != expected {
+		return false, nil
+	}
+
+	m.entries[key] = &kvEntry{
+		value:     append([]byte(nil), value...),
+		version:   version + 1,
+		expiresAt: time.Now().Add(ttl),
+	}
+
+	// Drop expired entries now and then so idle keys do not accumulate
+	m.writes++
+	if m.writes%1024 == 0 {
+		now := time.Now()
+		for k, entry := range m.entries {
+			if now.After(entry.expiresAt) {
+				delete(m.entries, k)
+			}
+		}
+	}
+	return true, nil
+}
+
+// SQLKVConfig configures a SQLKV
+type SQLKVConfig struct {
+	Dialect sqldialect.Dialect
+	Table   string
+}
+
+// DefaultSQLKVConfig returns default SQL KV configuration
+func DefaultSQLKVConfig() *SQLKVConfig {
+	return &SQLKVConfig{
+		Dialect: sqldialect.SQLite,
+		Table:   "fintechkit_rate_limits",
+	}
+}
+
+// SQLKV is a KV in a database table, letting replicas share rate limits
+// through a database they already have
+type SQLKV struct {
+	db     *sql.DB
+	config *SQLKVConfig
+}
+
+// NewSQLKV creates a SQL-backed KV. Call Migrate before first use.
+func NewSQLKV(db *sql.DB, config *SQLKVConfig) (*SQLKV, error) {
+	if config == nil {
+		config = DefaultSQLKVConfig()
+	}
+	if config.Dialect == "" {
+		config.Dialect = sqldialect.SQLite
+	}
+	if config.Table == "" {
+		config.Table = "fintechkit_rate_limits"
+	}
+	if !sqldialect.ValidIdentifier(config.Table) {
+		return nil, fmt.Errorf("invalid table name %q", config.Table)
+	}
+
+	if err := config.Dialect.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &SQLKV{db: db, config: config}, nil
+}
+
+// Migrate creates the table. It is safe to run on every start.
+func (s *SQLKV) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	kv_key     VARCHAR(255) NOT NULL PRIMARY KEY,
+	kv_value   %s           NOT NULL,
+	version    BIGINT       NOT NULL,
+	expires_at BIGINT       NOT NULL
+)`, s.config.Table, s.config.Dialect.BlobType()))
+	if err != nil {
+		return fmt.Errorf("failed to create rate limit table: %w", err)
+	}
+	return nil
+}
+
+// Get returns the value and version for key
+func (s *SQLKV) Get(ctx context.Context, key string) ([]byte, int64, error) {
+	var value []byte
+	var version, expiresAt int64
+
+	row := s.db.QueryRowContext(ctx, s.config.Dialect.Rebind(fmt.Sprintf(
+		`SELECT kv_value, version, expires_at FROM %s WHERE kv_key = ?`, s.config.Table)), key)
+	if err := row.Scan(&value, &version, &expiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+
+	if time.Now().UnixMilli() > expiresAt {
+		return nil, version, nil
+	}
+	return value, version, nil
+}
+
+// CompareAndSet stores value if the version matches
+func (s *SQLKV) CompareAndSet(ctx context.Context, key string, value []byte, expected int64, ttl time.Duration) (bool, error) {
+	expiresAt := time.Now().Add(ttl).UnixMilli()
+
+	if expected == 0 {
+		_, err := s.db.ExecContext(ctx, s.config.Dialect.Rebind(fmt.Sprintf(
+			`INSERT INTO %s (kv_key, kv_value, version, expires_at) VALUES (?, ?, 1, ?)`, s.config.Table)),
+			key, value, expiresAt)
+		if err != nil {
+			// A failed insert most likely means another replica got there first
+			if _, version, gerr := s.Get(ctx, key); gerr == nil && version != 0 {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+
+	result, err := s.db.ExecContext(ctx, s.config.Dialect.Rebind(fmt.Sprintf(
+		`UPDATE %s SET kv_value = ?, version = version + 1, expires_at = ? WHERE kv_key = ? AND version = ?`,
+		s.config.Table)), value, expiresAt, key, expected)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// DeleteExpired removes entries that expired before now, returning how many.
+// Run it periodically to keep the table small.
+func (s *SQLKV) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, s.config.Dialect.Rebind(fmt.Sprintf(
+		`DELETE FROM %s WHERE expires_at < ?`, s.config.Table)), time.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
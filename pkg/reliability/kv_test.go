@@ -0,0 +1,198 @@
+package reliability
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// openTestSQLite opens a SQLite database file that several connections, and
+// so several simulated replicas, can share
+func openTestSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newTestSQLKV(t *testing.T, db *sql.DB) *SQLKV {
+	t.Helper()
+
+	kv, err := NewSQLKV(db, nil)
+	if err != nil {
+		t.Fatalf("NewSQLKV: %v", err)
+	}
+	if err := kv.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return kv
+}
+
+// testKVs returns each KV implementation under test
+func testKVs(t *testing.T) map[string]KV {
+	return map[string]KV{
+		"memory": NewMemoryKV(),
+		"sql":    newTestSQLKV(t, openTestSQLite(t)),
+	}
+}
+
+func TestKVCompareAndSet(t *testing.T) {
+	ctx := context.Background()
+	for name, kv := range testKVs(t) {
+		t.Run(name, func(t *testing.T) {
+			if value, version, err := kv.Get(ctx, "k"); err != nil || value != nil || version != 0 {
+				t.Fatalf("Get of a missing key: got %q version %d err %v", value, version, err)
+			}
+
+			if ok, err := kv.CompareAndSet(ctx, "k", []byte("a"), 0, time.Minute); err != nil || !ok {
+				t.Fatalf("insert: got %v, %v", ok, err)
+			}
+			if ok, err := kv.CompareAndSet(ctx, "k", []byte("b"), 0, time.Minute); err != nil || ok {
+				t.Fatalf("second insert: got %v, %v, want a conflict", ok, err)
+			}
+			if ok, err := kv.CompareAndSet(ctx, "k", []byte("c"), 1, time.Minute); err != nil || !ok {
+				t.Fatalf("update at current version: got %v, %v", ok, err)
+			}
+			if ok, err := kv.CompareAndSet(ctx, "k", []byte("d"), 1, time.Minute); err != nil || ok {
+				t.Fatalf("update at stale version: got %v, %v, want a conflict", ok, err)
+			}
+
+			value, version, err := kv.Get(ctx, "k")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != "c" || version != 2 {
+				t.Fatalf("got %q version %d, want %q version 2", value, version, "c")
+			}
+		})
+	}
+}
+
+func TestKVExpiredValueKeepsVersion(t *testing.T) {
+	ctx := context.Background()
+	for name, kv := range testKVs(t) {
+		t.Run(name, func(t *testing.T) {
+			if ok, err := kv.CompareAndSet(ctx, "k", []byte("a"), 0, time.Millisecond); err != nil || !ok {
+				t.Fatalf("insert: got %v, %v", ok, err)
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			value, version, err := kv.Get(ctx, "k")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value != nil || version != 1 {
+				t.Fatalf("got %q version %d, want nil version 1", value, version)
+			}
+
+			// The stale entry is replaced at its version, not recreated
+			if ok, err := kv.CompareAndSet(ctx, "k", []byte("b"), version, time.Minute); err != nil || !ok {
+				t.Fatalf("replace expired value: got %v, %v", ok, err)
+			}
+		})
+	}
+}
+
+func TestKVCompareAndSetUnderContention(t *testing.T) {
+	const workers, increments = 8, 25
+
+	for name, kv := range testKVs(t) {
+		t.Run(name, func(t *testing.T) {
+			errs := make(chan error, workers)
+			var wg sync.WaitGroup
+			for i := 0; i < workers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < increments; j++ {
+						if err := increment(context.Background(), kv, "counter"); err != nil {
+							errs <- err
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				t.Fatalf("increment: %v", err)
+			}
+			value, _, err := kv.Get(context.Background(), "counter")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := string(value), strconv.Itoa(workers*increments); got != want {
+				t.Fatalf("counter is %s, want %s; an update was lost", got, want)
+			}
+		})
+	}
+}
+
+// increment adds one to a counter with a compare-and-set loop
+func increment(ctx context.Context, kv KV, key string) error {
+	for {
+		value, version, err := kv.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		n := 0
+		if value != nil {
+			if n, err = strconv.Atoi(string(value)); err != nil {
+				return err
+			}
+		}
+		ok, err := kv.CompareAndSet(ctx, key, []byte(strconv.Itoa(n+1)), version, time.Minute)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+}
+
+func TestSQLKVDeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	kv := newTestSQLKV(t, openTestSQLite(t))
+
+	if _, err := kv.CompareAndSet(ctx, "old", []byte("a"), 0, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kv.CompareAndSet(ctx, "live", []byte("b"), 0, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	deleted, err := kv.DeleteExpired(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Fatalf("deleted %d entries, want 1", deleted)
+	}
+	if value, _, err := kv.Get(ctx, "live"); err != nil || string(value) != "b" {
+		t.Fatalf("live entry: got %q, %v", value, err)
+	}
+}
+
+func TestNewSQLKVRejectsUnsafeConfig(t *testing.T) {
+	db := openTestSQLite(t)
+	if _, err := NewSQLKV(db, &SQLKVConfig{Table: "limits; DROP TABLE x"}); err == nil {
+		t.Fatal("accepted an unsafe table name")
+	}
+	if _, err := NewSQLKV(db, &SQLKVConfig{Dialect: "oracle"}); err == nil {
+		t.Fatal("accepted an unsupported dialect")
+	}
+}
@@ -84,7 +84,8 @@ func (m *MultiTierRateLimiter) Wait(ctx context.Context, tier string) error {
 	return limiter.Wait(ctx)
 }
 
-// DistributedRateLimiter interface for distributed rate limiting (e.g., with Redis)
+// DistributedRateLimiter interface for distributed rate limiting. GCRALimiter
+// implements it over any KV, such as SQLKV or a Redis-backed one.
 type DistributedRateLimiter interface {
 	// AllowN checks if n requests are allowed for a key
 	AllowN(ctx context.Context, key string, n int) (bool, error)
@@ -4,9 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"math"
 	"math/rand"
 	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/logging"
+	"github.com/PrakarshSingh5/fintechkit/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // RetryPolicy defines retry behavior
@@ -17,6 +22,9 @@ type RetryPolicy struct {
 	Multiplier      float64
 	RandomizeJitter bool
 	RetryableErrors []error
+
+	// Logger reports each retry; defaults to logging.Logger()
+	Logger *slog.Logger
 }
 
 // DefaultRetryPolicy returns sensible defaults for retries
@@ -101,6 +109,7 @@ func WithRetry(ctx context.Context, policy *RetryPolicy, fn func() error) error
 
 		// Calculate backoff
 		backoff := policy.CalculateBackoff(attempt + 1)
+		policy.logRetry(ctx, attempt, backoff, err)
 
 		// Wait with context awareness
 		select {
@@ -114,6 +123,22 @@ func WithRetry(ctx context.Context, policy *RetryPolicy, fn func() error) error
 	return fmt.Errorf("max retries exceeded: %w", lastErr)
 }
 
+// logRetry reports a failed attempt that is about to be retried, in the log
+// and as an event on the current span
+func (p *RetryPolicy) logRetry(ctx context.Context, attempt int, backoff time.Duration, err error) {
+	logging.OrDefault(p.Logger).WarnContext(ctx, "retrying after error",
+		"attempt", attempt+1,
+		"max_retries", p.MaxRetries,
+		"backoff", backoff,
+		"error", err,
+	)
+
+	trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+		tracing.AttemptKey.Int(attempt+1),
+		tracing.RetryBackoffKey.Float64(tracing.Milliseconds(backoff)),
+	))
+}
+
 // RetryableFunc represents a function that can be retried and returns a value
 type RetryableFunc[T any] func() (T, error)
 
@@ -145,6 +170,7 @@ func WithRetryTyped[T any](ctx context.Context, policy *RetryPolicy, fn Retryabl
 		}
 
 		backoff := policy.CalculateBackoff(attempt + 1)
+		policy.logRetry(ctx, attempt, backoff, err)
 
 		select {
 		case <-ctx.Done():
@@ -0,0 +1,66 @@
+// Package sqldialect holds the SQL differences between the databases the
+// fintechkit SQL stores support, so packages can share them without
+// depending on each other.
+package sqldialect
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Dialect selects placeholder syntax and column types
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+	MySQL    Dialect = "mysql"
+)
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate returns an error for dialects the stores do not support
+func (d Dialect) Validate() error {
+	switch d {
+	case SQLite, Postgres, MySQL:
+		return nil
+	default:
+		return fmt.Errorf("unsupported SQL dialect %q", string(d))
+	}
+}
+
+// BlobType returns the column type for binary values
+func (d Dialect) BlobType() string {
+	if d == Postgres {
+		return "BYTEA"
+	}
+	return "BLOB"
+}
+
+// Rebind rewrites ? placeholders to $n for Postgres
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ValidIdentifier reports whether name is safe to splice into a query as a
+// table name
+func ValidIdentifier(name string) bool {
+	return identifier.MatchString(name)
+}
@@ -0,0 +1,28 @@
+package sqldialect
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	query := `UPDATE t SET v = ? WHERE k = ? AND version = ?`
+
+	if got := SQLite.Rebind(query); got != query {
+		t.Fatalf("SQLite: got %q, want the query unchanged", got)
+	}
+	if got := MySQL.Rebind(query); got != query {
+		t.Fatalf("MySQL: got %q, want the query unchanged", got)
+	}
+	if got, want := Postgres.Rebind(query), `UPDATE t SET v = $1 WHERE k = $2 AND version = $3`; got != want {
+		t.Fatalf("Postgres: got %q, want %q", got, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, d := range []Dialect{SQLite, Postgres, MySQL} {
+		if err := d.Validate(); err != nil {
+			t.Fatalf("%s: %v", d, err)
+		}
+	}
+	if err := Dialect("oracle").Validate(); err == nil {
+		t.Fatal("accepted an unsupported dialect")
+	}
+}
@@ -0,0 +1,119 @@
+// Package tracing holds the OpenTelemetry conventions shared by fintechkit's
+// packages: the tracer, span attribute keys and an HTTP transport that
+// propagates trace context to outbound requests.
+package tracing
+
+import (
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of every span the library creates
+const ScopeName = "github.com/PrakarshSingh5/fintechkit"
+
+// Span attribute keys
+const (
+	ProviderKey          = attribute.Key("fintechkit.provider")
+	OperationKey         = attribute.Key("fintechkit.operation")
+	RequestIDKey         = attribute.Key("fintechkit.request_id")
+	AccountKey           = attribute.Key("fintechkit.account") // Tenant, user and provider
+	AttemptKey           = attribute.Key("fintechkit.retry.attempt")
+	RetryBackoffKey      = attribute.Key("fintechkit.retry.backoff_ms")
+	BreakerStateKey      = attribute.Key("fintechkit.breaker.state")
+	RateLimitWaitKey     = attribute.Key("fintechkit.rate_limit.wait_ms")
+	WebhookEventTypeKey  = attribute.Key("fintechkit.webhook.event_type")
+	WebhookEventIDKey    = attribute.Key("fintechkit.webhook.event_id")
+	WebhookDuplicateKey  = attribute.Key("fintechkit.webhook.duplicate")
+	WebhookEndpointIDKey = attribute.Key("fintechkit.webhook.endpoint_id")
+)
+
+// Tracer returns the library's tracer from tp, or from the global provider
+// when tp is nil
+func Tracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(ScopeName)
+}
+
+// RecordError marks span as failed with err, if err is not nil
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Milliseconds converts a duration to fractional milliseconds for attributes
+func Milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Transport is an http.RoundTripper that records a client span for each
+// request and injects the trace context into its headers
+type Transport struct {
+	Base           http.RoundTripper // Defaults to http.DefaultTransport
+	TracerProvider trace.TracerProvider
+	Propagator     propagation.TextMapPropagator // Defaults to the global propagator
+}
+
+// RoundTrip sends the request inside a client span
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	propagator := t.Propagator
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+
+	ctx, span := Tracer(t.TracerProvider).Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.ServerAddress(req.URL.Hostname()),
+			semconv.URLPath(req.URL.Path),
+		),
+	)
+	defer span.End()
+
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(ctx)
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		RecordError(span, err)
+		return nil, err
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
+
+// WrapClient returns a copy of client whose requests are traced. A nil
+// client wraps http.DefaultClient.
+func WrapClient(client *http.Client, tp trace.TracerProvider) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if _, ok := client.Transport.(*Transport); ok {
+		return client
+	}
+
+	wrapped := *client
+	wrapped.Transport = &Transport{Base: client.Transport, TracerProvider: tp}
+	return &wrapped
+}
@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RegisterDLQRoutes mounts dead letter queue admin endpoints on a Fiber router:
+//
+//	GET    /           list failed events (filters: provider, event_type, status, since)
+//	GET    /:id        inspect a failed event
+//	POST   /:id/replay replay a single event
+//	POST   /replay     replay all events matching the filters
+//	DELETE /:id        remove a single event
+//	DELETE /           purge all events matching the filters
+//
+// These endpoints expose raw event payloads and should sit behind admin auth.
+// Failures are returned as *fiber.Error for the app's error handler, e.g.
+// middleware.FiberErrorHandler, to render.
+func RegisterDLQRoutes(router fiber.Router, dlq *DeadLetterQueue) {
+	router.Get("/", func(c *fiber.Ctx) error {
+		filter, err := dlqFilterFromQuery(c)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		events, err := dlq.List(c.Context(), filter)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{
+			"events": events,
+			"count":  len(events),
+		})
+	})
+
+	router.Get("/:id", func(c *fiber.Ctx) error {
+		failed, err := dlq.Get(c.Context(), c.Params("id"))
+		if errors.Is(err, ErrFailedEventNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(failed)
+	})
+
+	router.Post("/replay", func(c *fiber.Ctx) error {
+		filter, err := dlqFilterFromQuery(c)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		result, err := dlq.ReplayAll(c.Context(), filter)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(result)
+	})
+
+	router.Post("/:id/replay", func(c *fiber.Ctx) error {
+		err := dlq.Replay(c.Context(), c.Params("id"))
+		if errors.Is(err, ErrFailedEventNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		if errors.Is(err, ErrFailedEventInFlight) {
+			return fiber.NewError(fiber.StatusConflict, err.Error())
+		}
+		if err != nil {
+			// The cause is kept for logging but not sent
+			return fmt.Errorf("%w: %w", fiber.NewError(fiber.StatusBadGateway, "replay failed"), err)
+		}
+
+		return c.JSON(fiber.Map{"status": "replayed"})
+	})
+
+	router.Delete("/:id", func(c *fiber.Ctx) error {
+		if err := dlq.RemoveContext(c.Context(), c.Params("id")); err != nil {
+			return err
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	router.Delete("/", func(c *fiber.Ctx) error {
+		filter, err := dlqFilterFromQuery(c)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		purged, err := dlq.Purge(c.Context(), filter)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(fiber.Map{"purged": purged})
+	})
+}
+
+// dlqFilterFromQuery builds a DLQFilter from query parameters
+func dlqFilterFromQuery(c *fiber.Ctx) (DLQFilter, error) {
+	filter := DLQFilter{
+		Provider:  c.Query("provider"),
+		EventType: c.Query("event_type"),
+		Status:    FailedEventStatus(c.Query("status")),
+	}
+
+	switch filter.Status {
+	case "", FailedEventPending, FailedEventParked:
+	default:
+		return filter, errors.New("status must be pending or parked")
+	}
+
+	if since := c.Query("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return filter, errors.New("since must be an RFC 3339 timestamp")
+		}
+		filter.Since = t
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,333 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned when the async queue cannot accept an event
+	ErrQueueFull = errors.New("webhook queue is full")
+	// ErrRouterStopped is returned when enqueueing after the router was stopped
+	ErrRouterStopped = errors.New("webhook router is stopped")
+)
+
+// QueueFullPolicy decides what happens when the async queue is full
+type QueueFullPolicy int
+
+const (
+	// QueueFullReject returns ErrQueueFull immediately
+	QueueFullReject QueueFullPolicy = iota
+	// QueueFullBlock waits up to BlockTimeout for space in the queue
+	QueueFullBlock
+	// QueueFullSpillToDLQ writes the event to the dead letter queue for later redelivery
+	QueueFullSpillToDLQ
+)
+
+// OrderingKeyFunc returns the key used to serialize processing of related events.
+// Events with the same key are handled in the order they were enqueued.
+//
+// Ordering covers the first delivery only. An event whose handler fails goes
+// to the DLQ, and later events with the same key are processed without
+// waiting for its redelivery, so handlers fed by a DLQ must tolerate events
+// arriving out of order.
+type OrderingKeyFunc func(event *Event) string
+
+// AsyncRouterConfig configures an AsyncRouter
+type AsyncRouterConfig struct {
+	Workers      int
+	QueueSize    int // Total queue capacity, split evenly across workers
+	FullPolicy   QueueFullPolicy
+	BlockTimeout time.Duration // Used by QueueFullBlock; zero waits until the context is done
+
+	// DLQ receives events that fail in handlers, and spilled events under QueueFullSpillToDLQ
+	DLQ *DeadLetterQueue
+
+	// OrderingKeys overrides the ordering key per provider; DefaultOrderingKey is used otherwise
+	OrderingKeys map[string]OrderingKeyFunc
+
+	// OnError is called when a handler fails and the event could not be dead-lettered
+	OnError func(event *Event, err error)
+}
+
+// DefaultAsyncRouterConfig returns sensible defaults for async routing
+func DefaultAsyncRouterConfig() *AsyncRouterConfig {
+	return &AsyncRouterConfig{
+		Workers:    4,
+		QueueSize:  1000,
+		FullPolicy: QueueFullReject,
+	}
+}
+
+// AsyncRouter enqueues events and acknowledges immediately, processing them
+// on a pool of workers. Each worker owns a queue, and events are assigned to
+// workers by ordering key so related events are never processed concurrently.
+type AsyncRouter struct {
+	router   *Router
+	config   *AsyncRouterConfig
+	queues   []chan *routeJob
+	next     atomic.Uint32
+	pending  atomic.Int64
+	closed   bool
+	mu       sync.RWMutex
+	senders  sync.WaitGroup // Enqueue calls that passed the closed check
+	stopping chan struct{}  // Closed by Shutdown to release blocked senders
+	drained  chan struct{}  // Closed once every queued event is processed
+	drain    sync.Once
+	wg       sync.WaitGroup
+}
+
+type routeJob struct {
+	ctx   context.Context
+	event *Event
+}
+
+// NewAsyncRouter creates an async webhook router with default queue settings
+func NewAsyncRouter(router *Router, maxWorkers int) *AsyncRouter {
+	config := DefaultAsyncRouterConfig()
+	config.Workers = maxWorkers
+	config.QueueSize = maxWorkers * 2
+	return NewAsyncRouterWithConfig(router, config)
+}
+
+// NewAsyncRouterWithConfig creates an async webhook router
+func NewAsyncRouterWithConfig(router *Router, config *AsyncRouterConfig) *AsyncRouter {
+	if config == nil {
+		config = DefaultAsyncRouterConfig()
+	}
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+
+	perWorker := (config.QueueSize + config.Workers - 1) / config.Workers
+	if perWorker <= 0 {
+		perWorker = 1
+	}
+
+	ar := &AsyncRouter{
+		router:   router,
+		config:   config,
+		queues:   make([]chan *routeJob, config.Workers),
+		stopping: make(chan struct{}),
+		drained:  make(chan struct{}),
+	}
+
+	// Start workers
+	for i := range ar.queues {
+		ar.queues[i] = make(chan *routeJob, perWorker)
+		ar.wg.Add(1)
+		go ar.worker(ar.queues[i])
+	}
+
+	return ar
+}
+
+// worker processes routing jobs from its own queue
+func (ar *AsyncRouter) worker(queue chan *routeJob) {
+	defer ar.wg.Done()
+
+	for job := range queue {
+		if err := ar.router.Route(job.ctx, job.event); err != nil {
+			ar.handleFailure(job.ctx, job.event, err)
+		}
+		ar.pending.Add(-1)
+	}
+}
+
+// handleFailure dead-letters a failed event, falling back to OnError
+func (ar *AsyncRouter) handleFailure(ctx context.Context, event *Event, err error) {
+	if ar.config.DLQ != nil {
+		dlqErr := ar.config.DLQ.AddContext(ctx, event, err)
+		if dlqErr == nil {
+			return
+		}
+		err = errors.Join(err, dlqErr)
+	}
+
+	if ar.config.OnError != nil {
+		ar.config.OnError(event, err)
+	}
+}
+
+// Route enqueues an event and returns once it is accepted, without waiting
+// for handlers to run. It is equivalent to Enqueue.
+func (ar *AsyncRouter) Route(ctx context.Context, event *Event) error {
+	return ar.Enqueue(ctx, event)
+}
+
+// Enqueue accepts an event for asynchronous processing. The returned error
+// reflects only whether the event was accepted; handler errors go to the DLQ.
+func (ar *AsyncRouter) Enqueue(ctx context.Context, event *Event) error {
+	// Only the closed check runs under the lock, so a sender blocked on a
+	// full queue never holds up Shutdown or other senders
+	ar.mu.RLock()
+	if ar.closed {
+		ar.mu.RUnlock()
+		return ErrRouterStopped
+	}
+	ar.senders.Add(1)
+	ar.mu.RUnlock()
+	defer ar.senders.Done()
+
+	// Handlers outlive the request that delivered the event
+	job := &routeJob{
+		ctx:   context.WithoutCancel(ctx),
+		event: event,
+	}
+	queue := ar.queueFor(event)
+
+	ar.pending.Add(1)
+	select {
+	case queue <- job:
+		return nil
+	default:
+	}
+
+	switch ar.config.FullPolicy {
+	case QueueFullBlock:
+		var timeout <-chan time.Time
+		if ar.config.BlockTimeout > 0 {
+			timer := time.NewTimer(ar.config.BlockTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		select {
+		case queue <- job:
+			return nil
+		case <-timeout:
+			ar.pending.Add(-1)
+			return ErrQueueFull
+		case <-ctx.Done():
+			ar.pending.Add(-1)
+			return ctx.Err()
+		case <-ar.stopping:
+			ar.pending.Add(-1)
+			return ErrRouterStopped
+		}
+
+	case QueueFullSpillToDLQ:
+		ar.pending.Add(-1)
+		if ar.config.DLQ == nil {
+			return ErrQueueFull
+		}
+		return ar.config.DLQ.AddContext(ctx, event, ErrQueueFull)
+
+	default:
+		ar.pending.Add(-1)
+		return ErrQueueFull
+	}
+}
+
+// queueFor picks the worker queue for an event based on its ordering key
+func (ar *AsyncRouter) queueFor(event *Event) chan *routeJob {
+	keyFunc := DefaultOrderingKey
+	if fn, ok := ar.config.OrderingKeys[event.Provider]; ok {
+		keyFunc = fn
+	}
+
+	key := keyFunc(event)
+	if key == "" {
+		// Unordered events are spread round-robin
+		return ar.queues[ar.next.Add(1)%uint32(len(ar.queues))]
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return ar.queues[h.Sum32()%uint32(len(ar.queues))]
+}
+
+// Pending returns the number of events accepted but not yet processed
+func (ar *AsyncRouter) Pending() int {
+	return int(ar.pending.Load())
+}
+
+// Shutdown stops accepting events and waits for queued events to drain.
+// Senders blocked on a full queue return ErrRouterStopped. If ctx expires
+// first, remaining events keep processing in the background and ctx.Err() is
+// returned.
+func (ar *AsyncRouter) Shutdown(ctx context.Context) error {
+	ar.mu.Lock()
+	if !ar.closed {
+		ar.closed = true
+		close(ar.stopping)
+	}
+	ar.mu.Unlock()
+
+	ar.drain.Do(func() {
+		go func() {
+			// Queues close only once no sender can still write to them
+			ar.senders.Wait()
+			for _, queue := range ar.queues {
+				close(queue)
+			}
+			ar.wg.Wait()
+			close(ar.drained)
+		}()
+	})
+
+	select {
+	case <-ar.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stop stops the async router after draining all queued events.
+// It is safe to call more than once.
+func (ar *AsyncRouter) Stop() {
+	_ = ar.Shutdown(context.Background())
+}
+
+// DefaultOrderingKey keys events by the payment (or other object) they refer to,
+// so that e.g. payment.authorized and payment.captured for one payment are
+// processed in order. It understands the common Stripe, Razorpay and generic layouts.
+func DefaultOrderingKey(event *Event) string {
+	if len(event.Data) == 0 {
+		return ""
+	}
+
+	var data struct {
+		PaymentID string `json:"payment_id"`
+		ID        string `json:"id"`
+		Object    struct {
+			ID            string `json:"id"`
+			PaymentIntent string `json:"payment_intent"`
+		} `json:"object"`
+		Payment struct {
+			Entity struct {
+				ID string `json:"id"`
+			} `json:"entity"`
+		} `json:"payment"`
+		Refund struct {
+			Entity struct {
+				PaymentID string `json:"payment_id"`
+			} `json:"entity"`
+		} `json:"refund"`
+	}
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return ""
+	}
+
+	candidates := []string{
+		data.PaymentID,
+		data.Object.PaymentIntent,
+		data.Object.ID,
+		data.Payment.Entity.ID,
+		data.Refund.Entity.PaymentID,
+		data.ID,
+	}
+	for _, key := range candidates {
+		if key != "" {
+			return event.Provider + ":" + key
+		}
+	}
+
+	return ""
+}
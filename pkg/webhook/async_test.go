@@ -0,0 +1,168 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// paymentEvent returns an event keyed by DefaultOrderingKey to payment
+func paymentEvent(id, payment string) *Event {
+	return &Event{ID: id, Provider: "stripe", Data: []byte(fmt.Sprintf(`{"payment_id": %q}`, payment))}
+}
+
+func TestAsyncRouterKeepsOrderPerKey(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string][]string)
+	router := NewRouter()
+	router.Register("*", "*", func(ctx context.Context, event *Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		key := DefaultOrderingKey(event)
+		seen[key] = append(seen[key], event.ID)
+		return nil
+	})
+
+	ar := NewAsyncRouterWithConfig(router, &AsyncRouterConfig{Workers: 4, QueueSize: 400, FullPolicy: QueueFullBlock})
+	for i := range 50 {
+		for _, payment := range []string{"pay_a", "pay_b", "pay_c"} {
+			if err := ar.Enqueue(context.Background(), paymentEvent(fmt.Sprintf("evt_%d", i), payment)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := ar.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, ids := range seen {
+		if len(ids) != 50 {
+			t.Fatalf("%s: got %d events, want 50", key, len(ids))
+		}
+		for i, id := range ids {
+			if want := fmt.Sprintf("evt_%d", i); id != want {
+				t.Fatalf("%s: got %s at position %d, want %s", key, id, i, want)
+			}
+		}
+	}
+	if ar.Pending() != 0 {
+		t.Fatalf("got %d pending events after shutdown, want 0", ar.Pending())
+	}
+}
+
+func TestAsyncRouterFullQueue(t *testing.T) {
+	// newFull returns a router whose only worker is stuck in a handler until
+	// the test ends and whose queue is full
+	newFull := func(t *testing.T, config *AsyncRouterConfig) *AsyncRouter {
+		t.Helper()
+		started := make(chan struct{}, 1)
+		release := make(chan struct{})
+		router := NewRouter()
+		router.Register("*", "*", func(ctx context.Context, event *Event) error {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-release
+			return nil
+		})
+
+		config.Workers = 1
+		config.QueueSize = 1
+		ar := NewAsyncRouterWithConfig(router, config)
+		t.Cleanup(func() {
+			close(release)
+			ar.Stop()
+		})
+
+		if err := ar.Enqueue(context.Background(), paymentEvent("evt_busy", "pay_a")); err != nil {
+			t.Fatal(err)
+		}
+		<-started
+		if err := ar.Enqueue(context.Background(), paymentEvent("evt_queued", "pay_a")); err != nil {
+			t.Fatal(err)
+		}
+		return ar
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		ar := newFull(t, &AsyncRouterConfig{FullPolicy: QueueFullReject})
+		if err := ar.Enqueue(context.Background(), paymentEvent("evt_over", "pay_a")); !errors.Is(err, ErrQueueFull) {
+			t.Fatalf("got %v, want ErrQueueFull", err)
+		}
+	})
+
+	t.Run("block times out", func(t *testing.T) {
+		ar := newFull(t, &AsyncRouterConfig{FullPolicy: QueueFullBlock, BlockTimeout: 20 * time.Millisecond})
+		if err := ar.Enqueue(context.Background(), paymentEvent("evt_over", "pay_a")); !errors.Is(err, ErrQueueFull) {
+			t.Fatalf("got %v, want ErrQueueFull", err)
+		}
+	})
+
+	t.Run("spill to DLQ", func(t *testing.T) {
+		dlq := NewDeadLetterQueue()
+		ar := newFull(t, &AsyncRouterConfig{FullPolicy: QueueFullSpillToDLQ, DLQ: dlq})
+		if err := ar.Enqueue(context.Background(), paymentEvent("evt_over", "pay_a")); err != nil {
+			t.Fatal(err)
+		}
+		failed, err := dlq.Get(context.Background(), "evt_over")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !errors.Is(failed.Error, ErrQueueFull) {
+			t.Fatalf("got error %v, want ErrQueueFull", failed.Error)
+		}
+	})
+
+	t.Run("shutdown releases blocked senders", func(t *testing.T) {
+		ar := newFull(t, &AsyncRouterConfig{FullPolicy: QueueFullBlock})
+		blocked := make(chan error, 1)
+		go func() {
+			blocked <- ar.Enqueue(context.Background(), paymentEvent("evt_over", "pay_a"))
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if err := ar.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got %v, want the deadline while the handler is stuck", err)
+		}
+		if waited := time.Since(start); waited > time.Second {
+			t.Fatalf("Shutdown took %v past its deadline", waited)
+		}
+		select {
+		case err := <-blocked:
+			if !errors.Is(err, ErrRouterStopped) {
+				t.Fatalf("blocked sender got %v, want ErrRouterStopped", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Shutdown did not release the blocked sender")
+		}
+		if err := ar.Enqueue(context.Background(), paymentEvent("evt_late", "pay_a")); !errors.Is(err, ErrRouterStopped) {
+			t.Fatalf("got %v after shutdown, want ErrRouterStopped", err)
+		}
+	})
+}
+
+func TestAsyncRouterDeadLettersFailures(t *testing.T) {
+	var calls atomic.Int32
+	dlq := NewDeadLetterQueue()
+	ar := NewAsyncRouterWithConfig(countingRouter(&calls, errors.New("handler failed")), &AsyncRouterConfig{Workers: 2, QueueSize: 10, DLQ: dlq})
+
+	if err := ar.Enqueue(context.Background(), paymentEvent("evt_1", "pay_a")); err != nil {
+		t.Fatal(err)
+	}
+	ar.Stop()
+
+	if calls.Load() != 1 {
+		t.Fatalf("got %d deliveries, want 1", calls.Load())
+	}
+	if _, err := dlq.Get(context.Background(), "evt_1"); err != nil {
+		t.Fatalf("failed event not dead-lettered: %v", err)
+	}
+}
@@ -0,0 +1,663 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/logging"
+	"github.com/PrakarshSingh5/fintechkit/pkg/metrics"
+	"github.com/PrakarshSingh5/fintechkit/pkg/reliability"
+)
+
+// FailedEventStatus describes where a failed event is in its redelivery lifecycle
+type FailedEventStatus string
+
+const (
+	// FailedEventPending events are waiting for their next scheduled redelivery
+	FailedEventPending FailedEventStatus = "pending"
+	// FailedEventParked events exhausted their attempts and need manual replay
+	FailedEventParked FailedEventStatus = "parked"
+)
+
+var (
+	// ErrFailedEventNotFound is returned when an event is not in the dead letter queue
+	ErrFailedEventNotFound = errors.New("failed event not found")
+	// ErrFailedEventInFlight is returned when an event is already being redelivered
+	ErrFailedEventInFlight = errors.New("failed event is being redelivered")
+)
+
+// FailedEvent represents a failed webhook event. FirstFailedAt and
+// LastFailedAt are RFC 3339 timestamps.
+type FailedEvent struct {
+	Event         *Event
+	Error         error
+	Attempts      int
+	Status        FailedEventStatus
+	FirstFailedAt string
+	LastFailedAt  string
+	NextAttemptAt time.Time
+}
+
+// failedEventJSON is the stored form of a FailedEvent, with the error as text
+type failedEventJSON struct {
+	Event         *Event            `json:"event"`
+	Error         string            `json:"error,omitempty"`
+	Attempts      int               `json:"attempts"`
+	Status        FailedEventStatus `json:"status"`
+	FirstFailedAt string            `json:"first_failed_at"`
+	LastFailedAt  string            `json:"last_failed_at"`
+	NextAttemptAt time.Time         `json:"next_attempt_at,omitzero"`
+}
+
+// MarshalJSON encodes the error as its message
+func (f *FailedEvent) MarshalJSON() ([]byte, error) {
+	stored := failedEventJSON{
+		Event:         f.Event,
+		Attempts:      f.Attempts,
+		Status:        f.Status,
+		FirstFailedAt: f.FirstFailedAt,
+		LastFailedAt:  f.LastFailedAt,
+		NextAttemptAt: f.NextAttemptAt,
+	}
+	if f.Error != nil {
+		stored.Error = f.Error.Error()
+	}
+	return json.Marshal(stored)
+}
+
+// UnmarshalJSON decodes an event written by MarshalJSON
+func (f *FailedEvent) UnmarshalJSON(data []byte) error {
+	var stored failedEventJSON
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	*f = FailedEvent{
+		Event:         stored.Event,
+		Attempts:      stored.Attempts,
+		Status:        stored.Status,
+		FirstFailedAt: stored.FirstFailedAt,
+		LastFailedAt:  stored.LastFailedAt,
+		NextAttemptAt: stored.NextAttemptAt,
+	}
+	if stored.Error != "" {
+		f.Error = errors.New(stored.Error)
+	}
+	return nil
+}
+
+// firstFailed returns FirstFailedAt as a time, or the zero time when unset
+func (f *FailedEvent) firstFailed() time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, f.FirstFailedAt)
+	return t
+}
+
+// DLQStore persists failed events for the dead letter queue
+type DLQStore interface {
+	Save(ctx context.Context, failed *FailedEvent) error
+	Get(ctx context.Context, eventID string) (*FailedEvent, error)
+	List(ctx context.Context) ([]*FailedEvent, error)
+	Delete(ctx context.Context, eventID string) error
+}
+
+// DLQFilter selects failed events for listing, replay and purge.
+// Empty fields match everything.
+type DLQFilter struct {
+	Provider  string
+	EventType string
+	Status    FailedEventStatus
+	Since     time.Time // Only events that first failed at or after this time
+}
+
+// Matches reports whether a failed event satisfies the filter
+func (f DLQFilter) Matches(failed *FailedEvent) bool {
+	if f.Provider != "" && failed.Event.Provider != f.Provider {
+		return false
+	}
+	if f.EventType != "" && failed.Event.Type != f.EventType {
+		return false
+	}
+	if f.Status != "" && failed.Status != f.Status {
+		return false
+	}
+	if !f.Since.IsZero() && failed.firstFailed().Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// DLQConfig configures redelivery of failed events
+type DLQConfig struct {
+	// RetryPolicy controls the redelivery backoff. MaxRetries is the number of
+	// automatic redeliveries before an event is parked.
+	RetryPolicy  *reliability.RetryPolicy
+	PollInterval time.Duration    // How often to look for due events
+	Metrics      *metrics.Metrics // Reports queue depth each poll; defaults to metrics.Default()
+	Logger       *slog.Logger     // Reports failures of Add; defaults to logging.Logger()
+}
+
+// DefaultDLQConfig returns sensible defaults for redelivery
+func DefaultDLQConfig() *DLQConfig {
+	return &DLQConfig{
+		RetryPolicy: &reliability.RetryPolicy{
+			MaxRetries:      5,
+			InitialInterval: 30 * time.Second,
+			MaxInterval:     1 * time.Hour,
+			Multiplier:      4.0,
+			RandomizeJitter: true,
+		},
+		PollInterval: 10 * time.Second,
+	}
+}
+
+// DeadLetterQueue handles failed webhook deliveries and redelivers them
+// through a Router with exponential backoff
+type DeadLetterQueue struct {
+	store    DLQStore
+	router   *Router
+	config   *DLQConfig
+	logger   *slog.Logger
+	mu       sync.Mutex
+	inflight map[string]bool // Event IDs being redelivered, so none is routed twice at once
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewDeadLetterQueue creates an in-memory dead letter queue with no router,
+// which records failed events for inspection but never redelivers them
+func NewDeadLetterQueue() *DeadLetterQueue {
+	return NewDeadLetterQueueWithStore(nil, nil, nil)
+}
+
+// NewDeadLetterQueueWithStore creates a dead letter queue that redelivers
+// through router. A nil store defaults to an in-memory store and a nil config
+// to DefaultDLQConfig.
+func NewDeadLetterQueueWithStore(store DLQStore, router *Router, config *DLQConfig) *DeadLetterQueue {
+	if store == nil {
+		store = NewInMemoryDLQStore()
+	}
+
+	// Copy so defaults never leak into the caller's config
+	defaults := DefaultDLQConfig()
+	if config == nil {
+		config = defaults
+	}
+	copied := *config
+	config = &copied
+	if config.RetryPolicy == nil {
+		config.RetryPolicy = defaults.RetryPolicy
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+
+	return &DeadLetterQueue{
+		store:    store,
+		router:   router,
+		config:   config,
+		logger:   logging.OrDefault(config.Logger),
+		inflight: make(map[string]bool),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Add records a failed delivery, logging failures to store it. Use AddContext
+// to handle them.
+func (dlq *DeadLetterQueue) Add(event *Event, err error) {
+	if addErr := dlq.AddContext(context.Background(), event, err); addErr != nil {
+		dlq.logger.Error("failed to add event to dead letter queue",
+			"event_id", event.ID, "provider", event.Provider, "error", addErr)
+	}
+}
+
+// AddContext records a failed delivery. Adding an event that is already
+// queued counts as another failed attempt.
+func (dlq *DeadLetterQueue) AddContext(ctx context.Context, event *Event, err error) error {
+	failed, getErr := dlq.store.Get(ctx, event.ID)
+	if errors.Is(getErr, ErrFailedEventNotFound) {
+		failed = &FailedEvent{
+			Event:  event,
+			Status: FailedEventPending,
+		}
+	} else if getErr != nil {
+		return getErr
+	}
+
+	dlq.recordFailure(failed, err)
+	return dlq.store.Save(ctx, failed)
+}
+
+// recordFailure updates attempt counters and schedules the next redelivery
+func (dlq *DeadLetterQueue) recordFailure(failed *FailedEvent, err error) {
+	now := time.Now()
+
+	failed.Attempts++
+	if err != nil {
+		failed.Error = err
+	}
+	if failed.FirstFailedAt == "" {
+		failed.FirstFailedAt = now.Format(time.RFC3339Nano)
+	}
+	failed.LastFailedAt = now.Format(time.RFC3339Nano)
+
+	// Attempts includes the original delivery, so redeliveries are Attempts-1
+	if failed.Status == FailedEventParked || failed.Attempts-1 >= dlq.config.RetryPolicy.MaxRetries {
+		failed.Status = FailedEventParked
+		failed.NextAttemptAt = time.Time{}
+		return
+	}
+
+	failed.Status = FailedEventPending
+	failed.NextAttemptAt = now.Add(dlq.config.RetryPolicy.CalculateBackoff(failed.Attempts))
+}
+
+// Get returns a single failed event
+func (dlq *DeadLetterQueue) Get(ctx context.Context, eventID string) (*FailedEvent, error) {
+	return dlq.store.Get(ctx, eventID)
+}
+
+// List returns failed events matching the filter, oldest first
+func (dlq *DeadLetterQueue) List(ctx context.Context, filter DLQFilter) ([]*FailedEvent, error) {
+	all, err := dlq.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*FailedEvent, 0, len(all))
+	for _, failed := range all {
+		if filter.Matches(failed) {
+			result = append(result, failed)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].firstFailed().Before(result[j].firstFailed())
+	})
+	return result, nil
+}
+
+// GetAll returns all failed events, oldest first. It returns nil when the
+// store cannot be read; use List to handle the error.
+func (dlq *DeadLetterQueue) GetAll() []*FailedEvent {
+	all, err := dlq.List(context.Background(), DLQFilter{})
+	if err != nil {
+		dlq.logger.Error("failed to list dead letter queue", "error", err)
+		return nil
+	}
+	return all
+}
+
+// Remove removes a failed event from the queue without replaying it, logging
+// failures to delete it. Use RemoveContext to handle them.
+func (dlq *DeadLetterQueue) Remove(eventID string) {
+	if err := dlq.RemoveContext(context.Background(), eventID); err != nil {
+		dlq.logger.Error("failed to remove event from dead letter queue", "event_id", eventID, "error", err)
+	}
+}
+
+// RemoveContext removes a failed event from the queue without replaying it
+func (dlq *DeadLetterQueue) RemoveContext(ctx context.Context, eventID string) error {
+	return dlq.store.Delete(ctx, eventID)
+}
+
+// claim marks an event as being redelivered, reporting false if it already is
+func (dlq *DeadLetterQueue) claim(eventID string) bool {
+	dlq.mu.Lock()
+	defer dlq.mu.Unlock()
+
+	if dlq.inflight[eventID] {
+		return false
+	}
+	dlq.inflight[eventID] = true
+	return true
+}
+
+// release ends a claim taken by claim
+func (dlq *DeadLetterQueue) release(eventID string) {
+	dlq.mu.Lock()
+	defer dlq.mu.Unlock()
+
+	delete(dlq.inflight, eventID)
+}
+
+// Replay immediately redelivers a single event, including parked events.
+// On success the event is removed from the queue. Replaying an event that is
+// already being redelivered returns ErrFailedEventInFlight.
+func (dlq *DeadLetterQueue) Replay(ctx context.Context, eventID string) error {
+	if dlq.router == nil {
+		return errors.New("dead letter queue has no router to replay through")
+	}
+
+	if !dlq.claim(eventID) {
+		return ErrFailedEventInFlight
+	}
+	defer dlq.release(eventID)
+
+	failed, err := dlq.store.Get(ctx, eventID)
+	if err != nil {
+		return err
+	}
+
+	return dlq.redeliver(ctx, failed)
+}
+
+// ReplayResult summarizes a bulk replay
+type ReplayResult struct {
+	Succeeded int      `json:"succeeded"`
+	Failed    int      `json:"failed"`
+	FailedIDs []string `json:"failed_ids,omitempty"`
+}
+
+// ReplayAll redelivers every event matching the filter
+func (dlq *DeadLetterQueue) ReplayAll(ctx context.Context, filter DLQFilter) (*ReplayResult, error) {
+	failedEvents, err := dlq.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReplayResult{}
+	for _, failed := range failedEvents {
+		if err := dlq.Replay(ctx, failed.Event.ID); err != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			result.Failed++
+			result.FailedIDs = append(result.FailedIDs, failed.Event.ID)
+			continue
+		}
+		result.Succeeded++
+	}
+
+	return result, nil
+}
+
+// Purge deletes every event matching the filter and returns how many were removed
+func (dlq *DeadLetterQueue) Purge(ctx context.Context, filter DLQFilter) (int, error) {
+	failedEvents, err := dlq.List(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, failed := range failedEvents {
+		if err := dlq.store.Delete(ctx, failed.Event.ID); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// RedeliverDue redelivers all pending events whose next attempt is due and
+// reports the queue depth. Start calls this periodically; it can also be
+// driven manually.
+func (dlq *DeadLetterQueue) RedeliverDue(ctx context.Context) error {
+	all, err := dlq.List(ctx, DLQFilter{})
+	if err != nil {
+		return err
+	}
+	dlq.observeDepth(all)
+	if dlq.router == nil {
+		return nil
+	}
+
+	now := time.Now()
+	for _, failed := range all {
+		if failed.Status != FailedEventPending || failed.NextAttemptAt.After(now) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		dlq.redeliverDue(ctx, failed.Event.ID, now)
+	}
+
+	return nil
+}
+
+// redeliverDue redelivers one event unless a replay or purge got to it first
+func (dlq *DeadLetterQueue) redeliverDue(ctx context.Context, eventID string, now time.Time) {
+	if !dlq.claim(eventID) {
+		return
+	}
+	defer dlq.release(eventID)
+
+	current, err := dlq.store.Get(ctx, eventID)
+	if err == nil && current.Status == FailedEventPending && !current.NextAttemptAt.After(now) {
+		_ = dlq.redeliver(ctx, current)
+	}
+}
+
+// redeliver routes the event and updates the store. Callers must hold the
+// event's claim.
+func (dlq *DeadLetterQueue) redeliver(ctx context.Context, failed *FailedEvent) error {
+	routeErr := dlq.router.Route(ctx, failed.Event)
+	if routeErr == nil {
+		return dlq.store.Delete(ctx, failed.Event.ID)
+	}
+
+	dlq.recordFailure(failed, routeErr)
+	if err := dlq.store.Save(ctx, failed); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("redelivery of event %s failed: %w", failed.Event.ID, routeErr)
+}
+
+// observeDepth reports the number of queued events by status
+func (dlq *DeadLetterQueue) observeDepth(all []*FailedEvent) {
+	m := metrics.OrDefault(dlq.config.Metrics)
+	if m == nil {
+		return
+	}
+
+	depth := map[FailedEventStatus]int{FailedEventPending: 0, FailedEventParked: 0}
+	for _, failed := range all {
+		depth[failed.Status]++
+	}
+	for status, n := range depth {
+		m.DLQDepth(string(status), n)
+	}
+}
+
+// Start begins scheduled redelivery in the background
+func (dlq *DeadLetterQueue) Start(ctx context.Context) {
+	dlq.wg.Add(1)
+	go func() {
+		defer dlq.wg.Done()
+		if all, err := dlq.List(ctx, DLQFilter{}); err == nil {
+			dlq.observeDepth(all)
+		}
+
+		ticker := time.NewTicker(dlq.config.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-dlq.stopChan:
+				return
+			case <-ticker.C:
+				_ = dlq.RedeliverDue(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops scheduled redelivery. It is safe to call more than once.
+func (dlq *DeadLetterQueue) Stop() {
+	dlq.stopOnce.Do(func() {
+		close(dlq.stopChan)
+	})
+	dlq.wg.Wait()
+}
+
+// InMemoryDLQStore keeps failed events in memory (lost on restart)
+type InMemoryDLQStore struct {
+	mu     sync.RWMutex
+	events map[string]*FailedEvent
+}
+
+// NewInMemoryDLQStore creates a new in-memory DLQ store
+func NewInMemoryDLQStore() *InMemoryDLQStore {
+	return &InMemoryDLQStore{
+		events: make(map[string]*FailedEvent),
+	}
+}
+
+// Save stores a copy of the failed event
+func (s *InMemoryDLQStore) Save(ctx context.Context, failed *FailedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *failed
+	s.events[failed.Event.ID] = &copied
+	return nil
+}
+
+// Get retrieves a failed event by event ID
+func (s *InMemoryDLQStore) Get(ctx context.Context, eventID string) (*FailedEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	failed, ok := s.events[eventID]
+	if !ok {
+		return nil, ErrFailedEventNotFound
+	}
+	copied := *failed
+	return &copied, nil
+}
+
+// List returns all failed events
+func (s *InMemoryDLQStore) List(ctx context.Context) ([]*FailedEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*FailedEvent, 0, len(s.events))
+	for _, failed := range s.events {
+		copied := *failed
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+// Delete removes a failed event
+func (s *InMemoryDLQStore) Delete(ctx context.Context, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.events, eventID)
+	return nil
+}
+
+// FileDLQStore persists failed events to a JSON file so they survive restarts.
+// Every mutation rewrites the file atomically.
+type FileDLQStore struct {
+	memory *InMemoryDLQStore
+	path   string
+	mu     sync.Mutex
+}
+
+// NewFileDLQStore opens (or creates) a file-backed DLQ store at path
+func NewFileDLQStore(path string) (*FileDLQStore, error) {
+	s := &FileDLQStore{
+		memory: NewInMemoryDLQStore(),
+		path:   path,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letter file: %w", err)
+	}
+	if len(data) == 0 {
+		return s, nil
+	}
+
+	var events []*FailedEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, fmt.Errorf("failed to parse dead letter file: %w", err)
+	}
+	for _, failed := range events {
+		s.memory.events[failed.Event.ID] = failed
+	}
+
+	return s, nil
+}
+
+// Save stores the failed event and flushes to disk
+func (s *FileDLQStore) Save(ctx context.Context, failed *FailedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.memory.Save(ctx, failed); err != nil {
+		return err
+	}
+	return s.flush(ctx)
+}
+
+// Get retrieves a failed event by event ID
+func (s *FileDLQStore) Get(ctx context.Context, eventID string) (*FailedEvent, error) {
+	return s.memory.Get(ctx, eventID)
+}
+
+// List returns all failed events
+func (s *FileDLQStore) List(ctx context.Context) ([]*FailedEvent, error) {
+	return s.memory.List(ctx)
+}
+
+// Delete removes a failed event and flushes to disk
+func (s *FileDLQStore) Delete(ctx context.Context, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.memory.Delete(ctx, eventID); err != nil {
+		return err
+	}
+	return s.flush(ctx)
+}
+
+// flush writes the current contents to a temp file and renames it into place
+func (s *FileDLQStore) flush(ctx context.Context) error {
+	events, err := s.memory.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter queue: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write dead letter file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write dead letter file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync dead letter file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write dead letter file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
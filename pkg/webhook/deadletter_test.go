@@ -0,0 +1,250 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/metrics"
+	"github.com/PrakarshSingh5/fintechkit/pkg/reliability"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// immediateRetries makes every redelivery due as soon as it is scheduled
+func immediateRetries(maxRetries int) *DLQConfig {
+	return &DLQConfig{
+		RetryPolicy: &reliability.RetryPolicy{
+			MaxRetries:      maxRetries,
+			InitialInterval: time.Nanosecond,
+			MaxInterval:     time.Nanosecond,
+			Multiplier:      1,
+		},
+	}
+}
+
+// countingRouter routes every event to a handler returning err, counting calls
+func countingRouter(calls *atomic.Int32, err error) *Router {
+	router := NewRouter()
+	router.Register("*", "*", func(ctx context.Context, event *Event) error {
+		calls.Add(1)
+		return err
+	})
+	return router
+}
+
+// gaugeValue returns the value of a gauge series with the given label value
+func gaugeValue(t *testing.T, registry *prometheus.Registry, name, label, value string) float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, pair := range metric.GetLabel() {
+				if pair.GetName() == label && pair.GetValue() == value {
+					return metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	t.Fatalf("no %s series with %s=%s", name, label, value)
+	return 0
+}
+
+func TestDLQAddCountsAttempts(t *testing.T) {
+	ctx := context.Background()
+	dlq := NewDeadLetterQueue()
+	event := &Event{ID: "evt_1", Provider: "stripe", Type: "payment.succeeded"}
+
+	dlq.Add(event, errors.New("first"))
+	first, err := dlq.Get(ctx, "evt_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dlq.AddContext(ctx, event, errors.New("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	failed, err := dlq.Get(ctx, "evt_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed.Attempts != 2 {
+		t.Fatalf("got %d attempts, want 2", failed.Attempts)
+	}
+	if failed.Error == nil || failed.Error.Error() != "second" {
+		t.Fatalf("got error %v, want second", failed.Error)
+	}
+	if failed.FirstFailedAt != first.FirstFailedAt || failed.LastFailedAt == "" {
+		t.Fatalf("got first failure %q and last %q, want first %q kept", failed.FirstFailedAt, failed.LastFailedAt, first.FirstFailedAt)
+	}
+	if all := dlq.GetAll(); len(all) != 1 {
+		t.Fatalf("got %d events, want 1", len(all))
+	}
+
+	dlq.Remove("evt_1")
+	if _, err := dlq.Get(ctx, "evt_1"); !errors.Is(err, ErrFailedEventNotFound) {
+		t.Fatalf("got %v after Remove, want ErrFailedEventNotFound", err)
+	}
+}
+
+func TestDLQReplay(t *testing.T) {
+	ctx := context.Background()
+	event := &Event{ID: "evt_1", Provider: "stripe", Type: "payment.succeeded"}
+
+	t.Run("success removes the event", func(t *testing.T) {
+		var calls atomic.Int32
+		dlq := NewDeadLetterQueueWithStore(nil, countingRouter(&calls, nil), nil)
+		if err := dlq.AddContext(ctx, event, errors.New("handler failed")); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := dlq.Replay(ctx, "evt_1"); err != nil {
+			t.Fatal(err)
+		}
+		if calls.Load() != 1 {
+			t.Fatalf("got %d deliveries, want 1", calls.Load())
+		}
+		if _, err := dlq.Get(ctx, "evt_1"); !errors.Is(err, ErrFailedEventNotFound) {
+			t.Fatalf("got %v after replay, want ErrFailedEventNotFound", err)
+		}
+	})
+
+	t.Run("failure counts an attempt", func(t *testing.T) {
+		var calls atomic.Int32
+		dlq := NewDeadLetterQueueWithStore(nil, countingRouter(&calls, errors.New("still failing")), nil)
+		if err := dlq.AddContext(ctx, event, errors.New("handler failed")); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := dlq.Replay(ctx, "evt_1"); err == nil {
+			t.Fatal("replay succeeded, want the handler's error")
+		}
+		failed, err := dlq.Get(ctx, "evt_1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failed.Attempts != 2 {
+			t.Fatalf("got %d attempts, want 2", failed.Attempts)
+		}
+	})
+
+	t.Run("unknown event", func(t *testing.T) {
+		var calls atomic.Int32
+		dlq := NewDeadLetterQueueWithStore(nil, countingRouter(&calls, nil), nil)
+		if err := dlq.Replay(ctx, "evt_missing"); !errors.Is(err, ErrFailedEventNotFound) {
+			t.Fatalf("got %v, want ErrFailedEventNotFound", err)
+		}
+	})
+}
+
+func TestDLQParksAfterRetriesExhausted(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	dlq := NewDeadLetterQueueWithStore(nil, countingRouter(&calls, errors.New("still failing")), immediateRetries(2))
+
+	if err := dlq.AddContext(ctx, &Event{ID: "evt_1", Provider: "stripe"}, errors.New("handler failed")); err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		if err := dlq.RedeliverDue(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if calls.Load() != 2 {
+		t.Fatalf("got %d redeliveries, want 2", calls.Load())
+	}
+	failed, err := dlq.Get(ctx, "evt_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed.Status != FailedEventParked || failed.Attempts != 3 {
+		t.Fatalf("got status %s after %d attempts, want parked after 3", failed.Status, failed.Attempts)
+	}
+	if !failed.NextAttemptAt.IsZero() {
+		t.Fatalf("parked event scheduled for %v", failed.NextAttemptAt)
+	}
+
+	// A manual replay still delivers a parked event
+	if err := dlq.Replay(ctx, "evt_1"); err == nil {
+		t.Fatal("replay succeeded, want the handler's error")
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("got %d deliveries after replay, want 3", calls.Load())
+	}
+}
+
+func TestDLQReportsDepth(t *testing.T) {
+	ctx := context.Background()
+	registry := prometheus.NewRegistry()
+	config := immediateRetries(1)
+	config.Metrics = metrics.New(registry)
+	dlq := NewDeadLetterQueueWithStore(nil, nil, config)
+
+	for _, id := range []string{"evt_1", "evt_2", "evt_3"} {
+		if err := dlq.AddContext(ctx, &Event{ID: id}, errors.New("handler failed")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A second failure exhausts the one allowed redelivery
+	if err := dlq.AddContext(ctx, &Event{ID: "evt_3"}, errors.New("handler failed")); err != nil {
+		t.Fatal(err)
+	}
+	if err := dlq.RedeliverDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "fintechkit_webhook_dlq_depth"
+	if got := gaugeValue(t, registry, name, "status", string(FailedEventPending)); got != 2 {
+		t.Fatalf("got pending depth %v, want 2", got)
+	}
+	if got := gaugeValue(t, registry, name, "status", string(FailedEventParked)); got != 1 {
+		t.Fatalf("got parked depth %v, want 1", got)
+	}
+}
+
+func TestNewDeadLetterQueueDoesNotModifyConfig(t *testing.T) {
+	config := &DLQConfig{}
+	NewDeadLetterQueueWithStore(nil, nil, config)
+
+	if config.RetryPolicy != nil || config.PollInterval != 0 {
+		t.Fatal("NewDeadLetterQueueWithStore filled defaults into the caller's config")
+	}
+}
+
+func TestFileDLQStoreReload(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "dlq.json")
+	store, err := NewFileDLQStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dlq := NewDeadLetterQueueWithStore(store, nil, nil)
+	if err := dlq.AddContext(ctx, &Event{ID: "evt_1", Provider: "stripe"}, errors.New("handler failed")); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileDLQStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed, err := reopened.Get(ctx, "evt_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed.Error == nil || failed.Error.Error() != "handler failed" {
+		t.Fatalf("got error %v, want handler failed", failed.Error)
+	}
+	if failed.Status != FailedEventPending || failed.NextAttemptAt.IsZero() {
+		t.Fatalf("got status %s next at %v, want a scheduled pending event", failed.Status, failed.NextAttemptAt)
+	}
+}
@@ -0,0 +1,88 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// DecodeGenericEvent decodes payloads that already use the Event field names
+// (id, type, timestamp, data)
+func DecodeGenericEvent(payload []byte) (*Event, error) {
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// DecodeStripeEvent decodes a Stripe event object
+func DecodeStripeEvent(payload []byte) (*Event, error) {
+	var raw struct {
+		ID      string          `json:"id"`
+		Type    string          `json:"type"`
+		Created int64           `json:"created"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, err
+	}
+	if raw.Type == "" {
+		return nil, errors.New("missing event type")
+	}
+
+	event := &Event{
+		ID:   raw.ID,
+		Type: raw.Type,
+		Data: raw.Data,
+	}
+	if raw.Created > 0 {
+		event.Timestamp = time.Unix(raw.Created, 0)
+	}
+	return event, nil
+}
+
+// DecodeRazorpayEvent decodes a Razorpay webhook. Razorpay sends the event ID
+// in the X-Razorpay-Event-Id header rather than the body, so ID is left empty.
+func DecodeRazorpayEvent(payload []byte) (*Event, error) {
+	var raw struct {
+		Event     string          `json:"event"`
+		Payload   json.RawMessage `json:"payload"`
+		CreatedAt int64           `json:"created_at"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, err
+	}
+	if raw.Event == "" {
+		return nil, errors.New("missing event type")
+	}
+
+	event := &Event{
+		Type: raw.Event,
+		Data: raw.Payload,
+	}
+	if raw.CreatedAt > 0 {
+		event.Timestamp = time.Unix(raw.CreatedAt, 0)
+	}
+	return event, nil
+}
+
+// DecodePlaidEvent decodes a Plaid webhook. The event type is the
+// webhook_code (e.g. DEFAULT_UPDATE) and Data holds the full body.
+func DecodePlaidEvent(payload []byte) (*Event, error) {
+	var raw struct {
+		WebhookType string `json:"webhook_type"`
+		WebhookCode string `json:"webhook_code"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, err
+	}
+	if raw.WebhookCode == "" {
+		return nil, errors.New("missing webhook_code")
+	}
+
+	return &Event{
+		Type: raw.WebhookCode,
+		Data: append(json.RawMessage(nil), payload...),
+	}, nil
+}
@@ -113,3 +113,30 @@ const (
 	EventRazorpayRefundProcessed = "refund.processed"
 	EventRazorpayOrderPaid       = "order.paid"
 )
+
+// KnownEventTypes lists the event types above by provider. Ingress reports
+// these as metric labels and counts any other type as metrics.OtherEventType.
+var KnownEventTypes = map[string][]string{
+	"stripe": {
+		EventStripePaymentIntentSucceeded,
+		EventStripePaymentIntentFailed,
+		EventStripeChargeRefunded,
+		EventStripeCustomerCreated,
+	},
+	"plaid": {
+		EventPlaidItemError,
+		EventPlaidTransactionsReady,
+		EventPlaidWebhookUpdateAcknowledged,
+	},
+	"truelayer": {
+		EventTrueLayerPaymentExecuted,
+		EventTrueLayerPaymentFailed,
+		EventTrueLayerPaymentAuthorized,
+	},
+	"razorpay": {
+		EventRazorpayPaymentCaptured,
+		EventRazorpayPaymentFailed,
+		EventRazorpayRefundProcessed,
+		EventRazorpayOrderPaid,
+	},
+}
@@ -0,0 +1,352 @@
+package webhook
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/logging"
+	"github.com/PrakarshSingh5/fintechkit/pkg/metrics"
+	"github.com/PrakarshSingh5/fintechkit/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EventRouter routes decoded events; both Router and AsyncRouter implement it
+type EventRouter interface {
+	Route(ctx context.Context, event *Event) error
+}
+
+// IngressProvider describes where a provider puts its webhook metadata
+type IngressProvider struct {
+	SignatureHeader string
+	EventIDHeader   string // Optional, for providers that send the event ID out of band
+}
+
+// DefaultIngressProviders holds header conventions for the built-in providers
+// with verifiers. TrueLayer signs webhooks with detached JWS and is left out
+// until a verifier for it exists.
+var DefaultIngressProviders = map[string]IngressProvider{
+	"stripe":   {SignatureHeader: "Stripe-Signature"},
+	"razorpay": {SignatureHeader: "X-Razorpay-Signature", EventIDHeader: "X-Razorpay-Event-Id"},
+	"plaid":    {SignatureHeader: "Plaid-Verification"},
+}
+
+// IngressConfig configures an Ingress
+type IngressConfig struct {
+	Receiver     *Receiver
+	Router       EventRouter
+	Tracker      *IdempotencyTracker        // Optional; enables deduplication
+	Providers    map[string]IngressProvider // Defaults to DefaultIngressProviders
+	MaxBodyBytes int64                      // Defaults to 1 MiB
+
+	// EventTypes are the event types reported as metric labels, by
+	// provider; others count as metrics.OtherEventType. Defaults to
+	// KnownEventTypes.
+	EventTypes map[string][]string
+
+	// OnError is called for every rejected or failed webhook
+	OnError func(provider string, event *Event, err error)
+
+	Logger         *slog.Logger         // Defaults to logging.Logger()
+	TracerProvider trace.TracerProvider // Defaults to the global provider
+	Metrics        *metrics.Metrics     // Defaults to metrics.Default()
+}
+
+// Ingress is the single entry point for inbound webhooks: it verifies the
+// signature, decodes the event, deduplicates it and routes it, mapping each
+// outcome to the status code providers expect.
+type Ingress struct {
+	config     *IngressConfig
+	eventTypes map[string]map[string]bool // Metric labels by provider
+}
+
+// NewIngress creates a new webhook ingress
+func NewIngress(config *IngressConfig) *Ingress {
+	if config.Receiver == nil {
+		config.Receiver = NewReceiver()
+	}
+	if config.Providers == nil {
+		config.Providers = DefaultIngressProviders
+	}
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = 1 << 20
+	}
+	if config.EventTypes == nil {
+		config.EventTypes = KnownEventTypes
+	}
+
+	// Webhooks for these are rejected until a verifier is registered
+	for provider := range config.Providers {
+		if !config.Receiver.HasVerifier(provider) {
+			logging.OrDefault(config.Logger).Warn("webhook provider has no signature verifier; its webhooks will be rejected",
+				"provider", provider)
+		}
+	}
+
+	eventTypes := make(map[string]map[string]bool, len(config.EventTypes))
+	for provider, types := range config.EventTypes {
+		eventTypes[provider] = make(map[string]bool, len(types))
+		for _, eventType := range types {
+			eventTypes[provider][eventType] = true
+		}
+	}
+
+	return &Ingress{config: config, eventTypes: eventTypes}
+}
+
+// IngressResult is the outcome of handling one webhook request
+type IngressResult struct {
+	StatusCode int
+	Event      *Event
+	Duplicate  bool
+	Err        error
+}
+
+// Body returns the JSON response body for the result. Internal error details
+// are never exposed to the caller.
+func (r *IngressResult) Body() map[string]string {
+	switch {
+	case r.Duplicate:
+		return map[string]string{"status": "duplicate"}
+	case r.Err == nil:
+		return map[string]string{"status": "received"}
+	case errors.Is(r.Err, ErrInvalidSignature):
+		return map[string]string{"error": "invalid signature"}
+	case errors.Is(r.Err, ErrMalformedEvent):
+		return map[string]string{"error": "malformed event"}
+	case errors.Is(r.Err, ErrUnknownProvider):
+		return map[string]string{"error": "unknown provider"}
+	case errors.Is(r.Err, ErrQueueFull):
+		return map[string]string{"error": "temporarily unavailable"}
+	default:
+		return map[string]string{"error": "processing failed"}
+	}
+}
+
+// ErrUnknownProvider is returned for webhooks addressed to an unconfigured provider
+var ErrUnknownProvider = errors.New("unknown webhook provider")
+
+// Handle processes a raw webhook. header looks up request headers by name.
+//
+// Status codes: 200 when accepted or already processed, 401 for bad or
+// unverifiable signatures, 400 for undecodable payloads, 404 for unknown providers,
+// 503 when the async queue is full and 500 when routing failed, so that the
+// provider redelivers.
+//
+// Each webhook is handled in a span, continuing the trace from the request
+// headers when ctx does not already carry one.
+func (in *Ingress) Handle(ctx context.Context, provider string, payload []byte, header func(string) string) *IngressResult {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, headerCarrier(header))
+	}
+	ctx, span := tracing.Tracer(in.config.TracerProvider).Start(ctx, "webhook.receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(tracing.ProviderKey.String(provider)),
+	)
+	defer span.End()
+
+	start := time.Now()
+	result := in.handle(ctx, provider, payload, header)
+	in.metrics().WebhookReceived(in.metricsLabel(provider), result.outcome(), time.Since(start))
+
+	span.SetAttributes(
+		semconv.HTTPResponseStatusCode(result.StatusCode),
+		tracing.WebhookDuplicateKey.Bool(result.Duplicate),
+	)
+	if result.Event != nil {
+		span.SetAttributes(
+			tracing.WebhookEventTypeKey.String(result.Event.Type),
+			tracing.WebhookEventIDKey.String(result.Event.ID),
+		)
+	}
+	tracing.RecordError(span, result.Err)
+	return result
+}
+
+// headerCarrier reads propagation headers through a header lookup function
+type headerCarrier func(string) string
+
+func (h headerCarrier) Get(key string) string { return h(key) }
+func (h headerCarrier) Set(string, string)    {}
+func (h headerCarrier) Keys() []string        { return nil }
+
+func (in *Ingress) handle(ctx context.Context, provider string, payload []byte, header func(string) string) *IngressResult {
+	spec, ok := in.config.Providers[provider]
+	if !ok {
+		return in.fail(ctx, provider, nil, http.StatusNotFound, ErrUnknownProvider)
+	}
+
+	signature := ""
+	if spec.SignatureHeader != "" {
+		signature = header(spec.SignatureHeader)
+	}
+
+	err := in.config.Receiver.Verify(provider, payload, signature)
+	in.metrics().WebhookVerified(provider, err == nil)
+	if err != nil {
+		return in.fail(ctx, provider, nil, http.StatusUnauthorized, err)
+	}
+
+	event, err := in.config.Receiver.Decode(provider, payload, signature)
+	if err != nil {
+		return in.fail(ctx, provider, nil, http.StatusBadRequest, err)
+	}
+
+	if event.ID == "" && spec.EventIDHeader != "" {
+		event.ID = header(spec.EventIDHeader)
+	}
+	if event.ID == "" {
+		// Fall back to a content hash so retries of the same payload still deduplicate
+		sum := sha256.Sum256(payload)
+		event.ID = "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	dedupKey := provider + ":" + event.ID
+	if in.config.Tracker != nil && !in.config.Tracker.Claim(dedupKey) {
+		in.logger().DebugContext(ctx, "duplicate webhook ignored",
+			"provider", provider,
+			"event_type", event.Type,
+			"event_id", event.ID,
+		)
+		in.metrics().WebhookProcessed(provider, in.eventLabel(provider, event.Type), metrics.WebhookDuplicate)
+		return &IngressResult{StatusCode: http.StatusOK, Event: event, Duplicate: true}
+	}
+
+	if in.config.Router != nil {
+		if err := in.config.Router.Route(ctx, event); err != nil {
+			if in.config.Tracker != nil {
+				in.config.Tracker.Forget(dedupKey)
+			}
+
+			status, outcome := http.StatusInternalServerError, metrics.WebhookFailed
+			if errors.Is(err, ErrQueueFull) || errors.Is(err, ErrRouterStopped) {
+				status, outcome = http.StatusServiceUnavailable, metrics.WebhookUnavailable
+			}
+			in.metrics().WebhookProcessed(provider, in.eventLabel(provider, event.Type), outcome)
+			return in.fail(ctx, provider, event, status, err)
+		}
+	}
+
+	in.logger().DebugContext(ctx, "webhook accepted",
+		"provider", provider,
+		"event_type", event.Type,
+		"event_id", event.ID,
+	)
+	in.metrics().WebhookProcessed(provider, in.eventLabel(provider, event.Type), metrics.WebhookAccepted)
+	return &IngressResult{StatusCode: http.StatusOK, Event: event}
+}
+
+func (in *Ingress) logger() *slog.Logger {
+	return logging.OrDefault(in.config.Logger)
+}
+
+func (in *Ingress) metrics() *metrics.Metrics {
+	return metrics.OrDefault(in.config.Metrics)
+}
+
+// metricsLabel returns the provider label for metrics, collapsing
+// unconfigured providers so request paths cannot create new series
+func (in *Ingress) metricsLabel(provider string) string {
+	if _, ok := in.config.Providers[provider]; !ok {
+		return metrics.UnknownProvider
+	}
+	return provider
+}
+
+// eventLabel returns the event type label for metrics, collapsing types
+// outside the configured set so payloads cannot create new series
+func (in *Ingress) eventLabel(provider, eventType string) string {
+	if in.eventTypes[provider][eventType] {
+		return eventType
+	}
+	return metrics.OtherEventType
+}
+
+// outcome classifies the result for metrics
+func (r *IngressResult) outcome() string {
+	switch {
+	case r.Duplicate:
+		return metrics.WebhookDuplicate
+	case r.Err == nil:
+		return metrics.WebhookAccepted
+	case r.StatusCode == http.StatusRequestEntityTooLarge:
+		return metrics.WebhookTooLarge
+	case errors.Is(r.Err, ErrInvalidSignature), r.StatusCode == http.StatusUnauthorized:
+		return metrics.WebhookInvalid
+	case errors.Is(r.Err, ErrMalformedEvent):
+		return metrics.WebhookMalformed
+	case errors.Is(r.Err, ErrUnknownProvider):
+		return metrics.WebhookUnknownProvider
+	case r.StatusCode == http.StatusServiceUnavailable:
+		return metrics.WebhookUnavailable
+	default:
+		return metrics.WebhookFailed
+	}
+}
+
+// fail builds an error result and reports it
+func (in *Ingress) fail(ctx context.Context, provider string, event *Event, status int, err error) *IngressResult {
+	attrs := []any{"provider", provider, "status", status, "error", err}
+	if event != nil {
+		attrs = append(attrs, "event_type", event.Type, "event_id", event.ID)
+	}
+	if status >= http.StatusInternalServerError {
+		in.logger().ErrorContext(ctx, "webhook processing failed", attrs...)
+	} else {
+		in.logger().WarnContext(ctx, "webhook rejected", attrs...)
+	}
+
+	if in.config.OnError != nil {
+		in.config.OnError(provider, event, err)
+	}
+	return &IngressResult{StatusCode: status, Event: event, Err: err}
+}
+
+// HTTPHandler returns a net/http handler for a single provider
+func (in *Ingress) HTTPHandler(provider string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		in.serve(w, r, provider)
+	})
+}
+
+// ServeHTTP handles webhooks for any configured provider, taking the provider
+// from the {provider} path wildcard, e.g. mux.Handle("POST /webhooks/{provider}", ingress)
+func (in *Ingress) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	in.serve(w, r, r.PathValue("provider"))
+}
+
+func (in *Ingress) serve(w http.ResponseWriter, r *http.Request, provider string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, in.config.MaxBodyBytes))
+	var result *IngressResult
+	if err != nil {
+		result = in.fail(r.Context(), provider, nil, http.StatusRequestEntityTooLarge, err)
+		in.metrics().WebhookReceived(in.metricsLabel(provider), result.outcome(), 0)
+	} else {
+		result = in.Handle(r.Context(), provider, payload, r.Header.Get)
+	}
+
+	if result.StatusCode == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "30")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(result.StatusCode)
+	if result.StatusCode == http.StatusRequestEntityTooLarge {
+		json.NewEncoder(w).Encode(map[string]string{"error": "payload too large"})
+		return
+	}
+	json.NewEncoder(w).Encode(result.Body())
+}
@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// acceptAll is a SignatureVerifier that trusts every payload
+type acceptAll struct{}
+
+func (acceptAll) Verify(payload []byte, signature string) error { return nil }
+
+// labelValues returns the values a label takes across a metric's series
+func labelValues(t *testing.T, registry *prometheus.Registry, name, label string) map[string]bool {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]bool)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, pair := range metric.GetLabel() {
+				if pair.GetName() == label {
+					values[pair.GetValue()] = true
+				}
+			}
+		}
+	}
+	return values
+}
+
+func TestIngressBoundsEventTypeLabel(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	receiver := NewReceiver()
+	receiver.RegisterVerifier("acme", acceptAll{})
+	ingress := NewIngress(&IngressConfig{
+		Receiver:   receiver,
+		Providers:  map[string]IngressProvider{"acme": {SignatureHeader: "X-Signature"}},
+		EventTypes: map[string][]string{"acme": {"invoice.paid"}},
+		Metrics:    metrics.New(registry),
+	})
+
+	header := func(string) string { return "sig" }
+	for i, eventType := range []string{"invoice.paid", "attacker.chosen.1", "attacker.chosen.2"} {
+		payload := fmt.Sprintf(`{"id": "evt_%d", "type": %q}`, i, eventType)
+		if result := ingress.Handle(context.Background(), "acme", []byte(payload), header); result.StatusCode != http.StatusOK {
+			t.Fatalf("%s: got status %d: %v", eventType, result.StatusCode, result.Err)
+		}
+	}
+
+	got := labelValues(t, registry, "fintechkit_webhook_processed_total", "event_type")
+	if len(got) != 2 || !got["invoice.paid"] || !got[metrics.OtherEventType] {
+		t.Fatalf("got event_type labels %v, want invoice.paid and %s", got, metrics.OtherEventType)
+	}
+}
@@ -0,0 +1,130 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/logging"
+	"github.com/PrakarshSingh5/fintechkit/pkg/reliability"
+	"github.com/PrakarshSingh5/fintechkit/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// LoggingMiddleware logs each handler invocation with its outcome and duration
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	logger = logging.OrDefault(logger)
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, event *Event) error {
+			start := time.Now()
+			err := next(ctx, event)
+
+			attrs := []any{
+				"provider", event.Provider,
+				"event_type", event.Type,
+				"event_id", event.ID,
+				"duration", time.Since(start),
+			}
+			if err != nil {
+				logger.ErrorContext(ctx, "webhook handler failed", append(attrs, "error", err)...)
+			} else {
+				logger.InfoContext(ctx, "webhook handled", attrs...)
+			}
+
+			return err
+		}
+	}
+}
+
+// TracingMiddleware runs each handler invocation in a span. A nil tp uses
+// the global provider.
+func TracingMiddleware(tp trace.TracerProvider) Middleware {
+	tracer := tracing.Tracer(tp)
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, event *Event) error {
+			ctx, span := tracer.Start(ctx, "webhook.handle "+event.Type,
+				trace.WithAttributes(
+					tracing.ProviderKey.String(event.Provider),
+					tracing.WebhookEventTypeKey.String(event.Type),
+					tracing.WebhookEventIDKey.String(event.ID),
+				),
+			)
+			defer span.End()
+
+			err := next(ctx, event)
+			tracing.RecordError(span, err)
+			return err
+		}
+	}
+}
+
+// TimeoutMiddleware bounds handler execution. The handler's context is
+// cancelled at the deadline; handlers that ignore it keep running in the
+// background but the router moves on with context.DeadlineExceeded. The
+// handler runs on its own goroutine, so its panics are recovered there and
+// returned as a *PanicError.
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, event *Event) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			done := make(chan error, 1)
+			go func() {
+				done <- callRecovered(ctx, next, event)
+			}()
+
+			select {
+			case err := <-done:
+				return err
+			case <-ctx.Done():
+				return fmt.Errorf("handler for event %s timed out: %w", event.Type, ctx.Err())
+			}
+		}
+	}
+}
+
+// PanicError is returned by RecoveryMiddleware when a handler panics
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("handler panicked: %v", e.Value)
+}
+
+// RecoveryMiddleware converts handler panics into a *PanicError
+func RecoveryMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, event *Event) error {
+			return callRecovered(ctx, next, event)
+		}
+	}
+}
+
+// callRecovered calls the handler, returning a panic as a *PanicError
+func callRecovered(ctx context.Context, handler Handler, event *Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+
+	return handler(ctx, event)
+}
+
+// RetryMiddleware retries a failing handler according to the policy
+func RetryMiddleware(policy *reliability.RetryPolicy) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, event *Event) error {
+			return reliability.WithRetry(ctx, policy, func() error {
+				return next(ctx, event)
+			})
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/reliability"
+)
+
+// tagMiddleware appends name to the trace before and after calling next
+func tagMiddleware(name string, trace *[]string) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, event *Event) error {
+			*trace = append(*trace, name)
+			err := next(ctx, event)
+			*trace = append(*trace, "/"+name)
+			return err
+		}
+	}
+}
+
+func TestRouterMiddlewareOrder(t *testing.T) {
+	var trace []string
+	router := NewRouter()
+	router.Register("stripe", "payment.*", func(ctx context.Context, event *Event) error {
+		trace = append(trace, "handler")
+		return nil
+	}, tagMiddleware("route", &trace))
+	// Router middleware added after registration still wraps the handler
+	router.Use(tagMiddleware("outer", &trace), tagMiddleware("inner", &trace))
+
+	if err := router.Route(context.Background(), &Event{Provider: "stripe", Type: "payment.captured"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "outer inner route handler /route /inner /outer"
+	if got := strings.Join(trace, " "); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestRouterBuildsChainsOnce(t *testing.T) {
+	wraps := 0
+	counting := func(next Handler) Handler {
+		wraps++
+		return next
+	}
+
+	router := NewRouter()
+	router.Use(counting)
+	router.Register("*", "*", func(ctx context.Context, event *Event) error { return nil })
+	router.SetUnroutedHandler(func(ctx context.Context, event *Event) error { return nil })
+	built := wraps
+
+	for range 10 {
+		if err := router.Route(context.Background(), &Event{Provider: "stripe", Type: "payment.captured"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if wraps != built {
+		t.Fatalf("routing wrapped handlers %d more times, want 0", wraps-built)
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	event := &Event{ID: "evt_1", Type: "payment.captured"}
+
+	tests := []struct {
+		name    string
+		handler Handler
+		check   func(t *testing.T, err error)
+	}{
+		{
+			name:    "returns handler error",
+			handler: func(ctx context.Context, event *Event) error { return errors.New("handler failed") },
+			check: func(t *testing.T, err error) {
+				if err == nil || err.Error() != "handler failed" {
+					t.Fatalf("got %v, want handler failed", err)
+				}
+			},
+		},
+		{
+			name: "times out",
+			handler: func(ctx context.Context, event *Event) error {
+				<-ctx.Done()
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Fatalf("got %v, want context.DeadlineExceeded", err)
+				}
+			},
+		},
+		{
+			name:    "recovers panics on its goroutine",
+			handler: func(ctx context.Context, event *Event) error { panic("boom") },
+			check: func(t *testing.T, err error) {
+				var panicErr *PanicError
+				if !errors.As(err, &panicErr) || panicErr.Value != "boom" {
+					t.Fatalf("got %v, want a *PanicError for boom", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewRouter()
+			router.Use(RecoveryMiddleware(), TimeoutMiddleware(20*time.Millisecond))
+			router.Register("*", "*", tt.handler)
+			tt.check(t, router.Route(context.Background(), event))
+		})
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	handler := RecoveryMiddleware()(func(ctx context.Context, event *Event) error {
+		panic("boom")
+	})
+
+	err := handler(context.Background(), &Event{})
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("got %v, want a *PanicError", err)
+	}
+	if len(panicErr.Stack) == 0 {
+		t.Fatal("PanicError has no stack")
+	}
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	policy := &reliability.RetryPolicy{MaxRetries: 3, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, Multiplier: 1}
+	calls := 0
+	handler := RetryMiddleware(policy)(func(ctx context.Context, event *Event) error {
+		calls++
+		if calls < 3 {
+			return errors.New("temporary")
+		}
+		return nil
+	})
+
+	if err := handler(context.Background(), &Event{}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Fatalf("got %d calls, want 3", calls)
+	}
+}
@@ -0,0 +1,872 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/logging"
+	"github.com/PrakarshSingh5/fintechkit/pkg/reliability"
+	"github.com/PrakarshSingh5/fintechkit/pkg/tracing"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Headers set on outbound webhook requests
+const (
+	HeaderWebhookID        = "X-Webhook-ID"
+	HeaderWebhookEvent     = "X-Webhook-Event"
+	HeaderWebhookTimestamp = "X-Webhook-Timestamp"
+	HeaderWebhookSignature = "X-Webhook-Signature"
+)
+
+var (
+	// ErrEndpointNotFound is returned when an outbound endpoint does not exist
+	ErrEndpointNotFound = errors.New("endpoint not found")
+	// ErrDeliveryNotFound is returned when a delivery does not exist
+	ErrDeliveryNotFound = errors.New("delivery not found")
+	// ErrDeliveryInFlight is returned when a delivery is already being sent
+	ErrDeliveryInFlight = errors.New("delivery is already being sent")
+	// ErrInvalidEndpointURL is returned when an endpoint URL is not an absolute HTTP(S) URL
+	ErrInvalidEndpointURL = errors.New("endpoint URL must be an absolute http or https URL")
+)
+
+// Endpoint is a merchant URL that receives outbound webhooks
+type Endpoint struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"-"`
+	EventTypes []string  `json:"event_types"` // Empty subscribes to all events; supports "payment.*" and "*"
+	Disabled   bool      `json:"disabled"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Failure tracking used for automatic disabling
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	FailingSince        time.Time `json:"failing_since,omitempty"`
+	DisabledReason      string    `json:"disabled_reason,omitempty"`
+	DisabledAt          time.Time `json:"disabled_at,omitempty"`
+}
+
+// Subscribes reports whether the endpoint wants events of the given type
+func (e *Endpoint) Subscribes(eventType string) bool {
+	if len(e.EventTypes) == 0 {
+		return true
+	}
+	for _, pattern := range e.EventTypes {
+		if MatchEventType(pattern, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeliveryStatus describes the state of an outbound delivery
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"   // Waiting for the next attempt
+	DeliverySucceeded DeliveryStatus = "succeeded" // Endpoint returned 2xx
+	DeliveryExhausted DeliveryStatus = "exhausted" // All attempts failed
+	DeliveryCancelled DeliveryStatus = "cancelled" // Endpoint was disabled before delivery
+)
+
+// DeliveryAttempt records a single HTTP attempt
+type DeliveryAttempt struct {
+	Number       int           `json:"number"`
+	AttemptedAt  time.Time     `json:"attempted_at"`
+	StatusCode   int           `json:"status_code,omitempty"`
+	Error        string        `json:"error,omitempty"`
+	Duration     time.Duration `json:"duration"`
+	ResponseBody string        `json:"response_body,omitempty"` // Truncated
+}
+
+// Delivery is one event sent to one endpoint, with its attempt log
+type Delivery struct {
+	ID            string            `json:"id"`
+	EndpointID    string            `json:"endpoint_id"`
+	Event         *Event            `json:"event"`
+	Status        DeliveryStatus    `json:"status"`
+	Attempts      []DeliveryAttempt `json:"attempts"`
+	CreatedAt     time.Time         `json:"created_at"`
+	NextAttemptAt time.Time         `json:"next_attempt_at,omitempty"`
+}
+
+// OutboundStore persists endpoints and deliveries
+type OutboundStore interface {
+	SaveEndpoint(ctx context.Context, endpoint *Endpoint) error
+	GetEndpoint(ctx context.Context, id string) (*Endpoint, error)
+	ListEndpoints(ctx context.Context) ([]*Endpoint, error)
+	DeleteEndpoint(ctx context.Context, id string) error
+
+	SaveDelivery(ctx context.Context, delivery *Delivery) error
+	GetDelivery(ctx context.Context, id string) (*Delivery, error)
+	ListDeliveries(ctx context.Context, endpointID string) ([]*Delivery, error)
+	// ListDueDeliveries returns pending deliveries whose next attempt is at or before due
+	ListDueDeliveries(ctx context.Context, due time.Time) ([]*Delivery, error)
+	// DeleteDeliveries removes finished deliveries created before cutoff and returns how many
+	DeleteDeliveries(ctx context.Context, cutoff time.Time) (int, error)
+}
+
+// DispatcherConfig configures outbound delivery
+type DispatcherConfig struct {
+	HTTPClient  *http.Client
+	RetryPolicy *reliability.RetryPolicy // MaxRetries is the number of retries after the first attempt
+	UserAgent   string
+
+	// An endpoint is disabled once it has failed at least DisableAfterFailures
+	// deliveries in a row and has been failing for at least DisableAfter.
+	DisableAfterFailures int
+	DisableAfter         time.Duration
+
+	PollInterval time.Duration // How often Start looks for due retries
+	Workers      int           // Concurrent senders started by Start
+	QueueSize    int           // Deliveries waiting for a worker; overflow is picked up by the poller
+
+	// Retention is how long finished deliveries are kept for inspection.
+	// Start prunes older ones every SweepInterval.
+	Retention     time.Duration
+	SweepInterval time.Duration
+
+	Logger         *slog.Logger         // Defaults to logging.Logger()
+	TracerProvider trace.TracerProvider // Defaults to the global provider
+}
+
+// DefaultDispatcherConfig returns sensible defaults for outbound delivery
+func DefaultDispatcherConfig() *DispatcherConfig {
+	return &DispatcherConfig{
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		RetryPolicy: &reliability.RetryPolicy{
+			MaxRetries:      8,
+			InitialInterval: 30 * time.Second,
+			MaxInterval:     6 * time.Hour,
+			Multiplier:      3.0,
+			RandomizeJitter: true,
+		},
+		UserAgent:            "FintechKit-Webhooks/1.0",
+		DisableAfterFailures: 20,
+		DisableAfter:         24 * time.Hour,
+		PollInterval:         10 * time.Second,
+		Workers:              4,
+		QueueSize:            1000,
+		Retention:            30 * 24 * time.Hour,
+		SweepInterval:        time.Hour,
+	}
+}
+
+// Dispatcher sends normalized events to subscribed merchant endpoints
+type Dispatcher struct {
+	store    OutboundStore
+	config   *DispatcherConfig
+	inflight map[string]bool
+	mu       sync.Mutex  // Guards inflight and endpoint failure accounting
+	queue    chan string // IDs of deliveries due now
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewDispatcher creates a new outbound webhook dispatcher
+func NewDispatcher(store OutboundStore, config *DispatcherConfig) *Dispatcher {
+	if store == nil {
+		store = NewInMemoryOutboundStore()
+	}
+	defaults := DefaultDispatcherConfig()
+	if config == nil {
+		config = defaults
+	}
+	// Copy so defaults and the traced client don't leak into the caller's config
+	copied := *config
+	config = &copied
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = defaults.HTTPClient
+	}
+	if config.RetryPolicy == nil {
+		config.RetryPolicy = defaults.RetryPolicy
+	}
+	if config.UserAgent == "" {
+		config.UserAgent = defaults.UserAgent
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+	if config.Workers <= 0 {
+		config.Workers = defaults.Workers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaults.QueueSize
+	}
+	if config.Retention <= 0 {
+		config.Retention = defaults.Retention
+	}
+	if config.SweepInterval <= 0 {
+		config.SweepInterval = defaults.SweepInterval
+	}
+	config.HTTPClient = tracing.WrapClient(config.HTTPClient, config.TracerProvider)
+
+	return &Dispatcher{
+		store:    store,
+		config:   config,
+		inflight: make(map[string]bool),
+		queue:    make(chan string, config.QueueSize),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// AddEndpoint registers an endpoint. ID and Secret are generated when empty;
+// the returned endpoint carries the secret to share with the merchant.
+func (d *Dispatcher) AddEndpoint(ctx context.Context, endpoint *Endpoint) (*Endpoint, error) {
+	if err := ValidateEndpointURL(endpoint.URL); err != nil {
+		return nil, err
+	}
+
+	if endpoint.ID == "" {
+		id, err := randomID("we_")
+		if err != nil {
+			return nil, err
+		}
+		endpoint.ID = id
+	}
+	if endpoint.Secret == "" {
+		secret, err := GenerateEndpointSecret()
+		if err != nil {
+			return nil, err
+		}
+		endpoint.Secret = secret
+	}
+	if endpoint.CreatedAt.IsZero() {
+		endpoint.CreatedAt = time.Now()
+	}
+
+	if err := d.store.SaveEndpoint(ctx, endpoint); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+// Endpoint returns a registered endpoint
+func (d *Dispatcher) Endpoint(ctx context.Context, id string) (*Endpoint, error) {
+	return d.store.GetEndpoint(ctx, id)
+}
+
+// Endpoints returns all registered endpoints
+func (d *Dispatcher) Endpoints(ctx context.Context) ([]*Endpoint, error) {
+	return d.store.ListEndpoints(ctx)
+}
+
+// RemoveEndpoint deletes an endpoint
+func (d *Dispatcher) RemoveEndpoint(ctx context.Context, id string) error {
+	return d.store.DeleteEndpoint(ctx, id)
+}
+
+// EnableEndpoint re-enables a disabled endpoint and resets its failure streak
+func (d *Dispatcher) EnableEndpoint(ctx context.Context, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	endpoint, err := d.store.GetEndpoint(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	endpoint.Disabled = false
+	endpoint.DisabledReason = ""
+	endpoint.DisabledAt = time.Time{}
+	endpoint.ConsecutiveFailures = 0
+	endpoint.FailingSince = time.Time{}
+	return d.store.SaveEndpoint(ctx, endpoint)
+}
+
+// DisableEndpoint stops deliveries to an endpoint
+func (d *Dispatcher) DisableEndpoint(ctx context.Context, id string, reason string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	endpoint, err := d.store.GetEndpoint(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	disableEndpoint(endpoint, reason)
+	return d.store.SaveEndpoint(ctx, endpoint)
+}
+
+// ValidateEndpointURL checks that rawURL is an absolute http or https URL
+// without credentials
+func ValidateEndpointURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEndpointURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidEndpointURL
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: credentials belong in the signing secret, not the URL", ErrInvalidEndpointURL)
+	}
+	return nil
+}
+
+func disableEndpoint(endpoint *Endpoint, reason string) {
+	endpoint.Disabled = true
+	endpoint.DisabledReason = reason
+	endpoint.DisabledAt = time.Now()
+}
+
+// Dispatch creates a delivery for every enabled endpoint subscribed to the
+// event and queues its first attempt, so a slow endpoint never blocks the
+// caller. Deliveries are sent and retried by the workers Start runs.
+func (d *Dispatcher) Dispatch(ctx context.Context, event *Event) ([]*Delivery, error) {
+	endpoints, err := d.store.ListEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*Delivery, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if endpoint.Disabled || !endpoint.Subscribes(event.Type) {
+			continue
+		}
+
+		id, err := randomID("wd_")
+		if err != nil {
+			return deliveries, err
+		}
+
+		delivery := &Delivery{
+			ID:            id,
+			EndpointID:    endpoint.ID,
+			Event:         event,
+			Status:        DeliveryPending,
+			CreatedAt:     time.Now(),
+			NextAttemptAt: time.Now(),
+		}
+		if err := d.store.SaveDelivery(ctx, delivery); err != nil {
+			return deliveries, err
+		}
+
+		d.enqueue(delivery.ID)
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+// Delivery returns a delivery with its attempt log
+func (d *Dispatcher) Delivery(ctx context.Context, id string) (*Delivery, error) {
+	return d.store.GetDelivery(ctx, id)
+}
+
+// Deliveries returns deliveries for an endpoint, newest first. An empty
+// endpointID returns deliveries for all endpoints.
+func (d *Dispatcher) Deliveries(ctx context.Context, endpointID string) ([]*Delivery, error) {
+	deliveries, err := d.store.ListDeliveries(ctx, endpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	return deliveries, nil
+}
+
+// enqueue hands a due delivery to the workers. When the queue is full the
+// delivery stays pending and the poller picks it up.
+func (d *Dispatcher) enqueue(deliveryID string) {
+	select {
+	case d.queue <- deliveryID:
+	default:
+	}
+}
+
+// Redeliver immediately attempts a delivery again, regardless of its status.
+// It returns ErrDeliveryInFlight if the delivery is being sent already.
+func (d *Dispatcher) Redeliver(ctx context.Context, deliveryID string) (*Delivery, error) {
+	return d.attempt(ctx, deliveryID, true)
+}
+
+// RetryDue attempts every pending delivery whose next attempt is due
+func (d *Dispatcher) RetryDue(ctx context.Context) error {
+	deliveries, err := d.store.ListDueDeliveries(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		_, _ = d.attempt(ctx, delivery.ID, false)
+	}
+
+	return nil
+}
+
+// PruneDeliveries deletes finished deliveries older than the retention period
+// and returns how many were removed. Start calls this every SweepInterval.
+func (d *Dispatcher) PruneDeliveries(ctx context.Context) (int, error) {
+	return d.store.DeleteDeliveries(ctx, time.Now().Add(-d.config.Retention))
+}
+
+// attempt sends a delivery once and records the outcome. Unless force is
+// set, deliveries that are no longer pending or not yet due are skipped.
+func (d *Dispatcher) attempt(ctx context.Context, deliveryID string, force bool) (*Delivery, error) {
+	// Leave deliveries that a concurrent retry or manual redelivery is already sending
+	d.mu.Lock()
+	if d.inflight[deliveryID] {
+		d.mu.Unlock()
+		return nil, ErrDeliveryInFlight
+	}
+	d.inflight[deliveryID] = true
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		delete(d.inflight, deliveryID)
+		d.mu.Unlock()
+	}()
+
+	// Load under the claim so attempts recorded by a concurrent sender are kept
+	delivery, err := d.store.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if !force && (delivery.Status != DeliveryPending || delivery.NextAttemptAt.After(time.Now())) {
+		return delivery, nil
+	}
+
+	endpoint, err := d.store.GetEndpoint(ctx, delivery.EndpointID)
+	if err != nil || endpoint.Disabled {
+		delivery.Status = DeliveryCancelled
+		delivery.NextAttemptAt = time.Time{}
+		return delivery, d.store.SaveDelivery(ctx, delivery)
+	}
+
+	ctx, span := tracing.Tracer(d.config.TracerProvider).Start(ctx, "webhook.deliver",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			tracing.WebhookEndpointIDKey.String(endpoint.ID),
+			tracing.WebhookEventIDKey.String(delivery.Event.ID),
+			tracing.WebhookEventTypeKey.String(delivery.Event.Type),
+			tracing.AttemptKey.Int(len(delivery.Attempts)+1),
+		),
+	)
+	defer span.End()
+
+	record := d.send(ctx, endpoint, delivery)
+	record.Number = len(delivery.Attempts) + 1
+	delivery.Attempts = append(delivery.Attempts, record)
+	if record.Error != "" {
+		span.SetStatus(codes.Error, record.Error)
+	}
+
+	succeeded := record.Error == ""
+	if succeeded {
+		delivery.Status = DeliverySucceeded
+		delivery.NextAttemptAt = time.Time{}
+	} else if len(delivery.Attempts) > d.config.RetryPolicy.MaxRetries {
+		delivery.Status = DeliveryExhausted
+		delivery.NextAttemptAt = time.Time{}
+	} else {
+		delivery.Status = DeliveryPending
+		delivery.NextAttemptAt = time.Now().Add(d.config.RetryPolicy.CalculateBackoff(len(delivery.Attempts)))
+	}
+	_ = d.store.SaveDelivery(ctx, delivery)
+
+	if !succeeded {
+		attrs := []any{
+			"delivery_id", delivery.ID,
+			"endpoint_id", delivery.EndpointID,
+			"event_id", delivery.Event.ID,
+			"attempt", record.Number,
+			"status_code", record.StatusCode,
+			"error", record.Error,
+		}
+		if delivery.Status == DeliveryExhausted {
+			d.logger().ErrorContext(ctx, "webhook delivery exhausted retries", attrs...)
+		} else {
+			d.logger().WarnContext(ctx, "webhook delivery failed", append(attrs, "next_attempt_at", delivery.NextAttemptAt)...)
+		}
+	}
+
+	// Re-read the endpoint so concurrent attempts don't lose failure counts
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	endpoint, err = d.store.GetEndpoint(ctx, delivery.EndpointID)
+	if err != nil {
+		return delivery, nil
+	}
+	if succeeded {
+		endpoint.ConsecutiveFailures = 0
+		endpoint.FailingSince = time.Time{}
+	} else {
+		d.recordEndpointFailure(endpoint, record)
+		if endpoint.Disabled {
+			d.logger().WarnContext(ctx, "webhook endpoint disabled",
+				"endpoint_id", endpoint.ID,
+				"reason", endpoint.DisabledReason,
+			)
+		}
+	}
+	return delivery, d.store.SaveEndpoint(ctx, endpoint)
+}
+
+func (d *Dispatcher) logger() *slog.Logger {
+	return logging.OrDefault(d.config.Logger)
+}
+
+// recordEndpointFailure extends the endpoint's failure streak and disables it
+// when failures are sustained
+func (d *Dispatcher) recordEndpointFailure(endpoint *Endpoint, record DeliveryAttempt) {
+	endpoint.ConsecutiveFailures++
+	if endpoint.FailingSince.IsZero() {
+		endpoint.FailingSince = record.AttemptedAt
+	}
+
+	// 410 Gone is an explicit request to stop sending
+	if record.StatusCode == http.StatusGone {
+		disableEndpoint(endpoint, "endpoint returned 410 Gone")
+		return
+	}
+
+	if d.config.DisableAfterFailures <= 0 || endpoint.ConsecutiveFailures < d.config.DisableAfterFailures {
+		return
+	}
+	if time.Since(endpoint.FailingSince) < d.config.DisableAfter {
+		return
+	}
+
+	disableEndpoint(endpoint, fmt.Sprintf("%d consecutive failed deliveries since %s",
+		endpoint.ConsecutiveFailures, endpoint.FailingSince.Format(time.RFC3339)))
+}
+
+// outboundPayload is the JSON body sent to merchant endpoints
+type outboundPayload struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Provider  string          `json:"provider"`
+	CreatedAt int64           `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// send performs the HTTP request for a delivery
+func (d *Dispatcher) send(ctx context.Context, endpoint *Endpoint, delivery *Delivery) DeliveryAttempt {
+	record := DeliveryAttempt{AttemptedAt: time.Now()}
+
+	event := delivery.Event
+	createdAt := event.Timestamp
+	if createdAt.IsZero() {
+		createdAt = delivery.CreatedAt
+	}
+
+	body, err := json.Marshal(outboundPayload{
+		ID:        event.ID,
+		Type:      event.Type,
+		Provider:  event.Provider,
+		CreatedAt: createdAt.Unix(),
+		Data:      event.Data,
+	})
+	if err != nil {
+		record.Error = fmt.Sprintf("failed to encode payload: %v", err)
+		return record
+	}
+
+	timestamp := strconv.FormatInt(record.AttemptedAt.Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		record.Error = fmt.Sprintf("failed to build request: %v", err)
+		return record
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", d.config.UserAgent)
+	req.Header.Set(HeaderWebhookID, delivery.ID)
+	req.Header.Set(HeaderWebhookEvent, event.Type)
+	req.Header.Set(HeaderWebhookTimestamp, timestamp)
+	req.Header.Set(HeaderWebhookSignature, SignOutboundPayload(endpoint.Secret, timestamp, body))
+
+	resp, err := d.config.HTTPClient.Do(req)
+	record.Duration = time.Since(record.AttemptedAt)
+	if err != nil {
+		record.Error = err.Error()
+		return record
+	}
+	defer resp.Body.Close()
+
+	record.StatusCode = resp.StatusCode
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	record.ResponseBody = string(snippet)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		record.Error = fmt.Sprintf("endpoint returned status %d", resp.StatusCode)
+	}
+
+	return record
+}
+
+// Start begins sending queued deliveries and retrying failed ones in the
+// background
+func (d *Dispatcher) Start(ctx context.Context) {
+	for i := 0; i < d.config.Workers; i++ {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-d.stopChan:
+					return
+				case id := <-d.queue:
+					_, _ = d.attempt(ctx, id, false)
+				}
+			}
+		}()
+	}
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(d.config.PollInterval)
+		defer ticker.Stop()
+		sweep := time.NewTicker(d.config.SweepInterval)
+		defer sweep.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-d.stopChan:
+				return
+			case <-ticker.C:
+				_ = d.RetryDue(ctx)
+			case <-sweep.C:
+				if _, err := d.PruneDeliveries(ctx); err != nil {
+					d.logger().WarnContext(ctx, "failed to prune webhook deliveries", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops background delivery. Queued deliveries stay pending in the
+// store. It is safe to call more than once.
+func (d *Dispatcher) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stopChan)
+	})
+	d.wg.Wait()
+}
+
+// SignOutboundPayload signs "timestamp.body" with the endpoint secret using
+// the same hex HMAC-SHA256 scheme as HMACVerifier, formatted as "t=<ts>,v1=<sig>"
+func SignOutboundPayload(secret string, timestamp string, body []byte) string {
+	signed := append([]byte(timestamp+"."), body...)
+	return "t=" + timestamp + ",v1=" + NewHMACVerifier(secret).Sign(signed)
+}
+
+// OutboundVerifier verifies signatures produced by the Dispatcher. Merchants
+// built on this package can register it with a Receiver.
+type OutboundVerifier struct {
+	secret    string
+	tolerance time.Duration
+}
+
+// NewOutboundVerifier creates a verifier; tolerance bounds the accepted timestamp skew
+func NewOutboundVerifier(secret string, tolerance time.Duration) *OutboundVerifier {
+	return &OutboundVerifier{secret: secret, tolerance: tolerance}
+}
+
+// Verify checks a "t=<ts>,v1=<sig>" signature header against the payload
+func (v *OutboundVerifier) Verify(payload []byte, signature string) error {
+	return verifyTimestampedSignature(v.secret, v.tolerance, payload, signature)
+}
+
+// GenerateEndpointSecret generates a random signing secret for an endpoint
+func GenerateEndpointSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate endpoint secret: %w", err)
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// randomID generates a prefixed random identifier
+func randomID(prefix string) (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate ID: %w", err)
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// MatchEventType reports whether an event type matches a subscription pattern.
+// "*" matches everything and a trailing "*" matches any type with that prefix,
+// so "payment.*" matches "payment.captured".
+func MatchEventType(pattern, eventType string) bool {
+	if pattern == "*" || pattern == eventType {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(eventType, prefix)
+	}
+	return false
+}
+
+// InMemoryOutboundStore keeps endpoints and deliveries in memory
+type InMemoryOutboundStore struct {
+	mu         sync.RWMutex
+	endpoints  map[string]*Endpoint
+	deliveries map[string]*Delivery
+	pending    map[string]*Delivery // Pending subset of deliveries, so polls skip history
+}
+
+// NewInMemoryOutboundStore creates a new in-memory outbound store
+func NewInMemoryOutboundStore() *InMemoryOutboundStore {
+	return &InMemoryOutboundStore{
+		endpoints:  make(map[string]*Endpoint),
+		deliveries: make(map[string]*Delivery),
+		pending:    make(map[string]*Delivery),
+	}
+}
+
+// SaveEndpoint stores a copy of the endpoint
+func (s *InMemoryOutboundStore) SaveEndpoint(ctx context.Context, endpoint *Endpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *endpoint
+	copied.EventTypes = append([]string(nil), endpoint.EventTypes...)
+	s.endpoints[endpoint.ID] = &copied
+	return nil
+}
+
+// GetEndpoint retrieves an endpoint
+func (s *InMemoryOutboundStore) GetEndpoint(ctx context.Context, id string) (*Endpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	endpoint, ok := s.endpoints[id]
+	if !ok {
+		return nil, ErrEndpointNotFound
+	}
+	copied := *endpoint
+	return &copied, nil
+}
+
+// ListEndpoints returns all endpoints
+func (s *InMemoryOutboundStore) ListEndpoints(ctx context.Context) ([]*Endpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*Endpoint, 0, len(s.endpoints))
+	for _, endpoint := range s.endpoints {
+		copied := *endpoint
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+// DeleteEndpoint removes an endpoint
+func (s *InMemoryOutboundStore) DeleteEndpoint(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.endpoints, id)
+	return nil
+}
+
+// SaveDelivery stores a copy of the delivery
+func (s *InMemoryOutboundStore) SaveDelivery(ctx context.Context, delivery *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *delivery
+	copied.Attempts = append([]DeliveryAttempt(nil), delivery.Attempts...)
+	s.deliveries[delivery.ID] = &copied
+	if copied.Status == DeliveryPending {
+		s.pending[delivery.ID] = &copied
+	} else {
+		delete(s.pending, delivery.ID)
+	}
+	return nil
+}
+
+// GetDelivery retrieves a delivery
+func (s *InMemoryOutboundStore) GetDelivery(ctx context.Context, id string) (*Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return nil, ErrDeliveryNotFound
+	}
+	copied := *delivery
+	copied.Attempts = append([]DeliveryAttempt(nil), delivery.Attempts...)
+	return &copied, nil
+}
+
+// ListDeliveries returns deliveries for an endpoint, or all when endpointID is empty
+func (s *InMemoryOutboundStore) ListDeliveries(ctx context.Context, endpointID string) ([]*Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*Delivery, 0)
+	for _, delivery := range s.deliveries {
+		if endpointID != "" && delivery.EndpointID != endpointID {
+			continue
+		}
+		copied := *delivery
+		copied.Attempts = append([]DeliveryAttempt(nil), delivery.Attempts...)
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+// ListDueDeliveries returns pending deliveries whose next attempt is at or before due
+func (s *InMemoryOutboundStore) ListDueDeliveries(ctx context.Context, due time.Time) ([]*Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*Delivery, 0)
+	for _, delivery := range s.pending {
+		if delivery.NextAttemptAt.After(due) {
+			continue
+		}
+		copied := *delivery
+		copied.Attempts = append([]DeliveryAttempt(nil), delivery.Attempts...)
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+// DeleteDeliveries removes finished deliveries created before cutoff
+func (s *InMemoryOutboundStore) DeleteDeliveries(ctx context.Context, cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for id, delivery := range s.deliveries {
+		if delivery.Status != DeliveryPending && delivery.CreatedAt.Before(cutoff) {
+			delete(s.deliveries, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
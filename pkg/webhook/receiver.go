@@ -8,7 +8,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
+	"github.com/PrakarshSingh5/fintechkit/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Event represents a webhook event
@@ -24,10 +31,25 @@ type Event struct {
 // Handler is a function that processes a webhook event
 type Handler func(ctx context.Context, event *Event) error
 
+var (
+	// ErrInvalidSignature is returned when a webhook signature does not verify
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrMalformedEvent is returned when a webhook payload cannot be decoded
+	ErrMalformedEvent = errors.New("malformed webhook event")
+	// ErrNoVerifier is returned for providers without a registered verifier;
+	// their webhooks are rejected rather than trusted unsigned
+	ErrNoVerifier = errors.New("no signature verifier registered")
+)
+
+// EventDecoder converts a provider's raw payload into an Event
+type EventDecoder func(payload []byte) (*Event, error)
+
 // Receiver manages webhook reception and verification
 type Receiver struct {
-	handlers  map[string][]Handler
-	verifiers map[string]SignatureVerifier
+	handlers       map[string][]Handler
+	verifiers      map[string]SignatureVerifier
+	decoders       map[string]EventDecoder
+	tracerProvider trace.TracerProvider
 }
 
 // SignatureVerifier verifies webhook signatures
@@ -40,9 +62,20 @@ func NewReceiver() *Receiver {
 	return &Receiver{
 		handlers:  make(map[string][]Handler),
 		verifiers: make(map[string]SignatureVerifier),
+		decoders: map[string]EventDecoder{
+			"stripe":   DecodeStripeEvent,
+			"razorpay": DecodeRazorpayEvent,
+			"plaid":    DecodePlaidEvent,
+		},
 	}
 }
 
+// SetTracerProvider sets where ProcessEvent records its spans; by default
+// the global provider
+func (r *Receiver) SetTracerProvider(tp trace.TracerProvider) {
+	r.tracerProvider = tp
+}
+
 // RegisterHandler registers a handler for a specific event type
 func (r *Receiver) RegisterHandler(eventType string, handler Handler) {
 	r.handlers[eventType] = append(r.handlers[eventType], handler)
@@ -53,24 +86,74 @@ func (r *Receiver) RegisterVerifier(provider string, verifier SignatureVerifier)
 	r.verifiers[provider] = verifier
 }
 
-// ProcessEvent processes an incoming webhook event
-func (r *Receiver) ProcessEvent(ctx context.Context, provider string, payload []byte, signature string) error {
-	// Verify signature
+// RegisterDecoder registers the payload decoder for a provider.
+// Providers without a decoder use DecodeGenericEvent.
+func (r *Receiver) RegisterDecoder(provider string, decoder EventDecoder) {
+	r.decoders[provider] = decoder
+}
+
+// HasVerifier reports whether a signature verifier is registered for the provider
+func (r *Receiver) HasVerifier(provider string) bool {
+	_, ok := r.verifiers[provider]
+	return ok
+}
+
+// Verify checks the payload signature with the provider's verifier. Payloads
+// from providers without one are rejected. Failures wrap ErrInvalidSignature.
+func (r *Receiver) Verify(provider string, payload []byte, signature string) error {
 	verifier, ok := r.verifiers[provider]
-	if ok {
-		if err := verifier.Verify(payload, signature); err != nil {
-			return fmt.Errorf("signature verification failed: %w", err)
-		}
+	if !ok {
+		return fmt.Errorf("%w: %w for %s", ErrInvalidSignature, ErrNoVerifier, provider)
 	}
 
-	// Parse event
-	var event Event
-	if err := json.Unmarshal(payload, &event); err != nil {
-		return fmt.Errorf("failed to parse event: %w", err)
+	if err := verifier.Verify(payload, signature); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return nil
+}
+
+// Decode parses a verified payload into an Event. Failures wrap ErrMalformedEvent.
+func (r *Receiver) Decode(provider string, payload []byte, signature string) (*Event, error) {
+	decoder, ok := r.decoders[provider]
+	if !ok {
+		decoder = DecodeGenericEvent
+	}
+
+	event, err := decoder(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedEvent, err)
 	}
 
 	event.Provider = provider
 	event.Signature = signature
+	return event, nil
+}
+
+// ProcessEvent processes an incoming webhook event in a span
+func (r *Receiver) ProcessEvent(ctx context.Context, provider string, payload []byte, signature string) (err error) {
+	ctx, span := tracing.Tracer(r.tracerProvider).Start(ctx, "webhook.process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(tracing.ProviderKey.String(provider)),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	// Verify signature
+	if err := r.Verify(provider, payload, signature); err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	// Parse event
+	event, err := r.Decode(provider, payload, signature)
+	if err != nil {
+		return fmt.Errorf("failed to parse event: %w", err)
+	}
+	span.SetAttributes(
+		tracing.WebhookEventTypeKey.String(event.Type),
+		tracing.WebhookEventIDKey.String(event.ID),
+	)
 
 	// Get handlers for this event type
 	handlers, ok := r.handlers[event.Type]
@@ -81,7 +164,7 @@ func (r *Receiver) ProcessEvent(ctx context.Context, provider string, payload []
 
 	// Execute all handlers
 	for _, handler := range handlers {
-		if err := handler(ctx, &event); err != nil {
+		if err := handler(ctx, event); err != nil {
 			return fmt.Errorf("handler error for event %s: %w", event.Type, err)
 		}
 	}
@@ -99,11 +182,16 @@ func NewHMACVerifier(secret string) *HMACVerifier {
 	return &HMACVerifier{secret: secret}
 }
 
-// Verify verifies an HMAC signature
-func (v *HMACVerifier) Verify(payload []byte, signature string) error {
+// Sign computes the hex-encoded HMAC-SHA256 signature that Verify expects
+func (v *HMACVerifier) Sign(payload []byte) string {
 	mac := hmac.New(sha256.New, []byte(v.secret))
 	mac.Write(payload)
-	expectedMAC := hex.EncodeToString(mac.Sum(nil))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify verifies an HMAC signature
+func (v *HMACVerifier) Verify(payload []byte, signature string) error {
+	expectedMAC := v.Sign(payload)
 
 	if !hmac.Equal([]byte(signature), []byte(expectedMAC)) {
 		return errors.New("invalid signature")
@@ -114,29 +202,110 @@ func (v *HMACVerifier) Verify(payload []byte, signature string) error {
 
 // StripeVerifier implements Stripe webhook signature verification
 type StripeVerifier struct {
-	secret string
+	secret    string
+	tolerance time.Duration
 }
 
-// NewStripeVerifier creates a new Stripe verifier
+// NewStripeVerifier creates a new Stripe verifier with Stripe's default
+// five minute timestamp tolerance
 func NewStripeVerifier(secret string) *StripeVerifier {
-	return &StripeVerifier{secret: secret}
+	return &StripeVerifier{secret: secret, tolerance: 5 * time.Minute}
 }
 
-// Verify verifies a Stripe webhook signature
+// Verify verifies a Stripe-Signature header ("t=<ts>,v1=<sig>[,v1=<sig>]")
 func (v *StripeVerifier) Verify(payload []byte, signature string) error {
-	// Real implementation would:
-	// 1. Extract timestamp and signatures from header
-	// 2. Construct signed payload
-	// 3. Compute expected signature
-	// 4. Compare signatures
-	// 5. Check timestamp tolerance
-
-	// Simplified for demonstration
+	return verifyTimestampedSignature(v.secret, v.tolerance, payload, signature)
+}
+
+// PlaidVerifier implements Plaid webhook verification. The Plaid-Verification
+// header is an ES256 JWT whose request_body_sha256 claim is the hash of the
+// payload, signed with a key Plaid serves by key ID.
+type PlaidVerifier struct {
+	keys    auth.KeySet
+	maxAge  time.Duration
+	timeout time.Duration
+}
+
+// NewPlaidVerifier creates a Plaid verifier that looks up signing keys in
+// keys, usually (*plaid.Client).WebhookKeys, and rejects tokens issued more
+// than five minutes ago as Plaid recommends
+func NewPlaidVerifier(keys auth.KeySet) *PlaidVerifier {
+	return &PlaidVerifier{keys: keys, maxAge: 5 * time.Minute, timeout: 10 * time.Second}
+}
+
+// Verify checks the JWT signature, its age and the body hash it carries
+func (v *PlaidVerifier) Verify(payload []byte, signature string) error {
+	// Fetching an unseen key is the only network call
+	ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
+	defer cancel()
+
+	claims, err := auth.VerifyJWT(ctx, signature, v.keys, auth.AlgES256)
+	if err != nil {
+		return err
+	}
+
+	issuedAt, ok := claims["iat"].(float64)
+	if !ok {
+		return errors.New("missing iat claim")
+	}
+	if age := time.Since(time.Unix(int64(issuedAt), 0)); age > v.maxAge || age < -v.maxAge {
+		return errors.New("signature timestamp outside tolerance")
+	}
+
+	claimed, _ := claims["request_body_sha256"].(string)
+	sum := sha256.Sum256(payload)
+	if !hmac.Equal([]byte(claimed), []byte(hex.EncodeToString(sum[:]))) {
+		return errors.New("body hash does not match")
+	}
 	return nil
 }
 
+// verifyTimestampedSignature checks a "t=<ts>,v1=<sig>" header where each v1
+// is the hex HMAC-SHA256 of "<ts>.<payload>". Any matching v1 is accepted so
+// secrets can be rolled. A zero tolerance skips the timestamp check.
+func verifyTimestampedSignature(secret string, tolerance time.Duration, payload []byte, header string) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return errors.New("malformed signature header")
+	}
+
+	if tolerance > 0 {
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return errors.New("malformed signature timestamp")
+		}
+		age := time.Since(time.Unix(ts, 0))
+		if age > tolerance || age < -tolerance {
+			return errors.New("signature timestamp outside tolerance")
+		}
+	}
+
+	signed := append([]byte(timestamp+"."), payload...)
+	verifier := NewHMACVerifier(secret)
+	for _, sig := range signatures {
+		if verifier.Verify(signed, sig) == nil {
+			return nil
+		}
+	}
+	return errors.New("invalid signature")
+}
+
 // IdempotencyTracker tracks processed events to prevent duplicates
 type IdempotencyTracker struct {
+	mu        sync.Mutex
 	processed map[string]time.Time
 }
 
@@ -149,17 +318,48 @@ func NewIdempotencyTracker() *IdempotencyTracker {
 
 // IsProcessed checks if an event has been processed
 func (t *IdempotencyTracker) IsProcessed(eventID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	_, exists := t.processed[eventID]
 	return exists
 }
 
 // MarkProcessed marks an event as processed
 func (t *IdempotencyTracker) MarkProcessed(eventID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	t.processed[eventID] = time.Now()
 }
 
+// Claim atomically marks an event as processed and reports whether it was
+// new. Callers that fail to process a claimed event should call Forget so a
+// redelivery is not treated as a duplicate.
+func (t *IdempotencyTracker) Claim(eventID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, exists := t.processed[eventID]; exists {
+		return false
+	}
+	t.processed[eventID] = time.Now()
+	return true
+}
+
+// Forget removes an event so it can be processed again
+func (t *IdempotencyTracker) Forget(eventID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.processed, eventID)
+}
+
 // Cleanup removes old processed events (call periodically)
 func (t *IdempotencyTracker) Cleanup(maxAge time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	cutoff := time.Now().Add(-maxAge)
 	for id, processedAt := range t.processed {
 		if processedAt.Before(cutoff) {
@@ -185,8 +385,8 @@ func NewIdempotentReceiver(receiver *Receiver) *IdempotentReceiver {
 // ProcessEvent processes an event with idempotency checks
 func (r *IdempotentReceiver) ProcessEvent(ctx context.Context, provider string, payload []byte, signature string) error {
 	// Parse event to get ID
-	var event Event
-	if err := json.Unmarshal(payload, &event); err != nil {
+	event, err := r.receiver.Decode(provider, payload, signature)
+	if err != nil {
 		return fmt.Errorf("failed to parse event: %w", err)
 	}
 
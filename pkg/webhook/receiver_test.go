@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/PrakarshSingh5/fintechkit/pkg/auth"
+)
+
+// signPlaidJWT builds an ES256 JWT the way Plaid signs Plaid-Verification
+func signPlaidJWT(t *testing.T, key *ecdsa.PrivateKey, alg, kid string, claims map[string]any) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestPlaidVerifier(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := NewPlaidVerifier(auth.StaticKeySet{"kid_1": &key.PublicKey})
+
+	body := []byte(`{"webhook_type": "TRANSACTIONS", "webhook_code": "DEFAULT_UPDATE"}`)
+	sum := sha256.Sum256(body)
+	bodyHash := hex.EncodeToString(sum[:])
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name      string
+		signature string
+		payload   []byte
+		wantErr   bool
+	}{
+		{"valid", signPlaidJWT(t, key, "ES256", "kid_1", map[string]any{"iat": now, "request_body_sha256": bodyHash}), body, false},
+		{"tampered body", signPlaidJWT(t, key, "ES256", "kid_1", map[string]any{"iat": now, "request_body_sha256": bodyHash}), []byte(`{}`), true},
+		{"stale", signPlaidJWT(t, key, "ES256", "kid_1", map[string]any{"iat": now - 600, "request_body_sha256": bodyHash}), body, true},
+		{"missing iat", signPlaidJWT(t, key, "ES256", "kid_1", map[string]any{"request_body_sha256": bodyHash}), body, true},
+		{"wrong key", signPlaidJWT(t, other, "ES256", "kid_1", map[string]any{"iat": now, "request_body_sha256": bodyHash}), body, true},
+		{"unknown key ID", signPlaidJWT(t, key, "ES256", "kid_2", map[string]any{"iat": now, "request_body_sha256": bodyHash}), body, true},
+		{"other algorithm", signPlaidJWT(t, key, "none", "kid_1", map[string]any{"iat": now, "request_body_sha256": bodyHash}), body, true},
+		{"missing header", "", body, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifier.Verify(tt.payload, tt.signature)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReceiverRejectsProvidersWithoutVerifier(t *testing.T) {
+	err := NewReceiver().Verify("plaid", []byte(`{}`), "token")
+	if !errors.Is(err, ErrInvalidSignature) || !errors.Is(err, ErrNoVerifier) {
+		t.Fatalf("got %v, want ErrInvalidSignature wrapping ErrNoVerifier", err)
+	}
+}
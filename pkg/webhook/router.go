@@ -5,169 +5,120 @@ import (
 	"sync"
 )
 
+// Middleware wraps a Handler with additional behaviour
+type Middleware func(Handler) Handler
+
+// route is a single registered handler
+type route struct {
+	provider  string  // Exact provider name or "*"
+	eventType string  // Exact type, "*" or a prefix pattern like "payment.*"
+	handler   Handler // With the route's own middleware
+	chained   Handler // With router middleware too, rebuilt by Use
+}
+
+// matches reports whether the route applies to the event
+func (rt *route) matches(event *Event) bool {
+	if rt.provider != "*" && rt.provider != event.Provider {
+		return false
+	}
+	return MatchEventType(rt.eventType, event.Type)
+}
+
 // Router manages event routing to handlers
 type Router struct {
-	routes map[string]map[string][]Handler // provider -> eventType -> handlers
-	mu     sync.RWMutex
+	routes     []*route
+	middleware []Middleware
+	unrouted   Handler
+	chained    Handler // unrouted with router middleware
+	mu         sync.RWMutex
 }
 
 // NewRouter creates a new webhook router
 func NewRouter() *Router {
-	return &Router{
-		routes: make(map[string]map[string][]Handler),
-	}
+	return &Router{}
 }
 
-// Register registers a handler for a provider and event type
-func (r *Router) Register(provider string, eventType string, handler Handler) {
+// Register registers a handler for a provider and event type. Provider may be
+// "*" to match every provider, and eventType may be "*" or a prefix pattern
+// such as "payment.*". Middleware given here applies to this handler only.
+func (r *Router) Register(provider string, eventType string, handler Handler, middleware ...Middleware) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if r.routes[provider] == nil {
-		r.routes[provider] = make(map[string][]Handler)
-	}
-
-	r.routes[provider][eventType] = append(r.routes[provider][eventType], handler)
+	handler = chain(handler, middleware)
+	r.routes = append(r.routes, &route{
+		provider:  provider,
+		eventType: eventType,
+		handler:   handler,
+		chained:   chain(handler, r.middleware),
+	})
 }
 
-// Route routes an event to registered handlers
-func (r *Router) Route(ctx context.Context, event *Event) error {
-	r.mu.RLock()
-	providerRoutes, ok := r.routes[event.Provider]
-	r.mu.RUnlock()
+// Use adds middleware that wraps every handler, including the unrouted handler
+func (r *Router) Use(middleware ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	if !ok {
-		return nil // No routes for this provider
-	}
+	r.middleware = append(r.middleware, middleware...)
 
-	handlers, ok := providerRoutes[event.Type]
-	if !ok {
-		return nil // No handlers for this event type
+	// Chains are built here and at registration, never per event
+	for _, rt := range r.routes {
+		rt.chained = chain(rt.handler, r.middleware)
 	}
-
-	// Execute handlers
-	for _, handler := range handlers {
-		if err := handler(ctx, event); err != nil {
-			return err
-		}
+	if r.unrouted != nil {
+		r.chained = chain(r.unrouted, r.middleware)
 	}
-
-	return nil
-}
-
-// AsyncRouter executes handlers asynchronously
-type AsyncRouter struct {
-	router     *Router
-	maxWorkers int
-	queue      chan *routeJob
-	wg         sync.WaitGroup
 }
 
-type routeJob struct {
-	ctx   context.Context
-	event *Event
-	done  chan error
-}
-
-// NewAsyncRouter creates an async webhook router
-func NewAsyncRouter(router *Router, maxWorkers int) *AsyncRouter {
-	ar := &AsyncRouter{
-		router:     router,
-		maxWorkers: maxWorkers,
-		queue:      make(chan *routeJob, maxWorkers*2),
-	}
+// SetUnroutedHandler sets a catch-all handler for events that match no route
+func (r *Router) SetUnroutedHandler(handler Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	// Start workers
-	for i := 0; i < maxWorkers; i++ {
-		ar.wg.Add(1)
-		go ar.worker()
+	r.unrouted = handler
+	r.chained = nil
+	if handler != nil {
+		r.chained = chain(handler, r.middleware)
 	}
-
-	return ar
 }
 
-// worker processes routing jobs
-func (ar *AsyncRouter) worker() {
-	defer ar.wg.Done()
+// Handlers returns the handlers that would run for an event, with router
+// middleware applied, in registration order
+func (r *Router) Handlers(event *Event) []Handler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	for job := range ar.queue {
-		err := ar.router.Route(job.ctx, job.event)
-		job.done <- err
-		close(job.done)
+	var handlers []Handler
+	for _, rt := range r.routes {
+		if rt.matches(event) {
+			handlers = append(handlers, rt.chained)
+		}
 	}
-}
 
-// Route routes an event asynchronously
-func (ar *AsyncRouter) Route(ctx context.Context, event *Event) error {
-	job := &routeJob{
-		ctx:   ctx,
-		event: event,
-		done:  make(chan error, 1),
+	if len(handlers) == 0 && r.chained != nil {
+		handlers = append(handlers, r.chained)
 	}
 
-	ar.queue <- job
-	return <-job.done
+	return handlers
 }
 
-// Stop stops the async router
-func (ar *AsyncRouter) Stop() {
-	close(ar.queue)
-	ar.wg.Wait()
-}
-
-// DeadLetterQueue handles failed webhook deliveries
-type DeadLetterQueue struct {
-	failed []*FailedEvent
-	mu     sync.RWMutex
-}
-
-// FailedEvent represents a failed webhook event
-type FailedEvent struct {
-	Event         *Event
-	Error         error
-	Attempts      int
-	FirstFailedAt string
-	LastFailedAt  string
-}
-
-// NewDeadLetterQueue creates a new dead letter queue
-func NewDeadLetterQueue() *DeadLetterQueue {
-	return &DeadLetterQueue{
-		failed: make([]*FailedEvent, 0),
+// Route routes an event to all matching handlers in registration order,
+// stopping at the first error. Events that match no route go to the unrouted
+// handler if one is set.
+func (r *Router) Route(ctx context.Context, event *Event) error {
+	for _, handler := range r.Handlers(event) {
+		if err := handler(ctx, event); err != nil {
+			return err
+		}
 	}
-}
-
-// Add adds a failed event to the queue
-func (dlq *DeadLetterQueue) Add(event *Event, err error) {
-	dlq.mu.Lock()
-	defer dlq.mu.Unlock()
-
-	dlq.failed = append(dlq.failed, &FailedEvent{
-		Event:    event,
-		Error:    err,
-		Attempts: 1,
-	})
-}
-
-// GetAll returns all failed events
-func (dlq *DeadLetterQueue) GetAll() []*FailedEvent {
-	dlq.mu.RLock()
-	defer dlq.mu.RUnlock()
 
-	result := make([]*FailedEvent, len(dlq.failed))
-	copy(result, dlq.failed)
-	return result
+	return nil
 }
 
-// Remove removes a failed event from the queue
-func (dlq *DeadLetterQueue) Remove(eventID string) {
-	dlq.mu.Lock()
-	defer dlq.mu.Unlock()
-
-	for i, failed := range dlq.failed {
-		if failed.Event.ID == eventID {
-			dlq.failed = append(dlq.failed[:i], dlq.failed[i+1:]...)
-			return
-		}
+// chain applies middleware so that the first middleware is the outermost
+func chain(handler Handler, middleware []Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
 	}
+	return handler
 }